@@ -0,0 +1,86 @@
+package migratepod
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/yhlooo/podmig/pkg/commands/migratepod/options"
+	"github.com/yhlooo/podmig/pkg/migration"
+	"github.com/yhlooo/podmig/pkg/scheduling"
+)
+
+// NewDrainCommandWithOptions 基于选项创建 drain 子命令
+func NewDrainCommandWithOptions(globalOpts *options.GlobalOptions, opts *options.DrainOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "drain NODE",
+		Short: "Drain node by live migrating pods to other nodes",
+		Long: "Drain node by live migrating pods to other nodes.\n\n" +
+			"The node is cordoned first, then evictable pods on it are checkpointed and restored on target nodes " +
+			"one by one, respecting PodDisruptionBudgets. Each restored pod is handed over to a replacement pod " +
+			"object bound to the target node, and the original pod is deleted once the replacement is running " +
+			"and ready. Pods failing the compatibility check on target node or controlled by StatefulSets " +
+			"are evicted instead. Checkpoint and restore are run by pcrctl in privileged worker pods on nodes.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.WorkerImage == "" {
+				return fmt.Errorf("--worker-image is required")
+			}
+			ctx := cmd.Context()
+			logger := logr.FromContextOrDiscard(ctx)
+
+			restConfig, err := globalOpts.ConfigFlags.ToRESTConfig()
+			if err != nil {
+				return fmt.Errorf("get kubernetes client config error: %w", err)
+			}
+			client, err := kubernetes.NewForConfig(restConfig)
+			if err != nil {
+				return fmt.Errorf("create kubernetes client error: %w", err)
+			}
+
+			workers := migration.NewWorkers(client, restConfig, opts.WorkerNamespace, opts.WorkerImage)
+			defer func() {
+				// 上下文可能已取消
+				if err := workers.Cleanup(context.Background()); err != nil {
+					logger.Error(err, "cleanup worker pods error")
+				}
+			}()
+			targets := migration.NewSchedulerTargetSelector(scheduling.NewScheduler(client))
+			if len(opts.Targets) > 0 {
+				targets = migration.NewStaticTargetSelector(opts.Targets)
+			}
+			drainer := migration.NewDrainer(client, migration.NewMigrator(client, workers), targets, migration.DrainOptions{
+				Concurrency:        opts.Concurrency,
+				IgnoreDaemonSets:   opts.IgnoreDaemonSets,
+				DeleteEmptyDirData: opts.DeleteEmptyDirData,
+				Force:              opts.Force,
+				GracePeriodSeconds: opts.GracePeriodSeconds,
+				Timeout:            opts.Timeout,
+				PodSelector:        opts.PodSelector,
+			})
+
+			result, err := drainer.Drain(ctx, args[0])
+			if result != nil {
+				out := cmd.OutOrStdout()
+				for _, pod := range result.Migrated {
+					_, _ = fmt.Fprintf(out, "pod/%s migrated\n", pod)
+				}
+				for _, pod := range result.Evicted {
+					_, _ = fmt.Fprintf(out, "pod/%s evicted\n", pod)
+				}
+				for pod, err := range result.Failed {
+					_, _ = fmt.Fprintf(out, "pod/%s failed: %v\n", pod, err)
+				}
+			}
+			return err
+		},
+	}
+
+	// 绑定选项到命令行参数
+	opts.AddPFlags(cmd.Flags())
+
+	return cmd
+}
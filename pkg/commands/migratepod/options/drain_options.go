@@ -0,0 +1,84 @@
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// NewDefaultDrainOptions 返回一个默认的 DrainOptions
+func NewDefaultDrainOptions() DrainOptions {
+	return DrainOptions{
+		Concurrency:        1,
+		GracePeriodSeconds: -1,
+		WorkerNamespace:    "kube-system",
+	}
+}
+
+// DrainOptions drain 子命令选项
+type DrainOptions struct {
+	// 目标节点，为空时按 Pod 的调度约束和与源节点的兼容性选择
+	Targets []string `json:"targets,omitempty" yaml:"targets,omitempty"`
+	// 同时迁移的 Pod 数
+	Concurrency int `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	// 是否忽略 DaemonSet 管理的 Pod
+	IgnoreDaemonSets bool `json:"ignoreDaemonSets,omitempty" yaml:"ignoreDaemonSets,omitempty"`
+	// 是否允许驱逐使用 emptyDir 的 Pod
+	DeleteEmptyDirData bool `json:"deleteEmptyDirData,omitempty" yaml:"deleteEmptyDirData,omitempty"`
+	// 是否处理不受控制器管理的 Pod
+	Force bool `json:"force,omitempty" yaml:"force,omitempty"`
+	// 驱逐 Pod 的优雅终止时间（秒），为负数时使用 Pod 的设置
+	GracePeriodSeconds int `json:"gracePeriodSeconds,omitempty" yaml:"gracePeriodSeconds,omitempty"`
+	// 等待超时时间， 0 表示不限
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	// 只处理匹配该标签选择器的 Pod
+	PodSelector string `json:"podSelector,omitempty" yaml:"podSelector,omitempty"`
+	// 工作 Pod 镜像，需包含 pcrctl 和 criu
+	WorkerImage string `json:"workerImage,omitempty" yaml:"workerImage,omitempty"`
+	// 工作 Pod 所在命名空间
+	WorkerNamespace string `json:"workerNamespace,omitempty" yaml:"workerNamespace,omitempty"`
+}
+
+// AddPFlags 将选项绑定到命令行参数
+func (o *DrainOptions) AddPFlags(flags *pflag.FlagSet) {
+	flags.StringSliceVar(
+		&o.Targets, "target", o.Targets,
+		"Nodes to migrate pods to, in turn (e.g. --target node1,node2). "+
+			"If not specified, choose by pod's node selector, affinity, tolerations, resource requests "+
+			"and compatibility with source node",
+	)
+	flags.IntVar(&o.Concurrency, "concurrency", o.Concurrency, "Number of pods to migrate concurrently")
+	flags.BoolVar(
+		&o.IgnoreDaemonSets, "ignore-daemonsets", o.IgnoreDaemonSets,
+		"Ignore DaemonSet-managed pods",
+	)
+	flags.BoolVar(
+		&o.DeleteEmptyDirData, "delete-emptydir-data", o.DeleteEmptyDirData,
+		"Allow evicting pods using emptyDir when they can not be migrated (local data will be deleted)",
+	)
+	flags.BoolVar(
+		&o.Force, "force", o.Force,
+		"Continue even if there are pods that do not declare a controller",
+	)
+	flags.IntVar(
+		&o.GracePeriodSeconds, "grace-period", o.GracePeriodSeconds,
+		"Period of time in seconds given to each pod to terminate gracefully. "+
+			"If negative, the default value specified in the pod will be used",
+	)
+	flags.DurationVar(
+		&o.Timeout, "timeout", o.Timeout,
+		"The length of time to wait for pod disruption budgets and evictions, zero means infinite",
+	)
+	flags.StringVar(
+		&o.PodSelector, "pod-selector", o.PodSelector,
+		"Label selector to filter pods on the node",
+	)
+	flags.StringVar(
+		&o.WorkerImage, "worker-image", o.WorkerImage,
+		"Image of worker pods running pcrctl on nodes (required)",
+	)
+	flags.StringVar(
+		&o.WorkerNamespace, "worker-namespace", o.WorkerNamespace,
+		"Namespace to create worker pods in",
+	)
+}
@@ -0,0 +1,17 @@
+package options
+
+// NewDefaultOptions 创建一个默认运行选项
+func NewDefaultOptions() Options {
+	return Options{
+		Global: NewDefaultGlobalOptions(),
+		Drain:  NewDefaultDrainOptions(),
+	}
+}
+
+// Options kubectl-migratepod 运行选项
+type Options struct {
+	// 全局选项
+	Global GlobalOptions `json:"global,omitempty" yaml:"global,omitempty"`
+	// drain 子命令选项
+	Drain DrainOptions `json:"drain,omitempty" yaml:"drain,omitempty"`
+}
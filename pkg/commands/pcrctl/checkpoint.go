@@ -3,90 +3,331 @@ package pcrctl
 import (
 	"archive/tar"
 	"compress/gzip"
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/apimachinery/pkg/labels"
 
 	"github.com/yhlooo/podmig/pkg/commands/pcrctl/options"
 	podcrcommon "github.com/yhlooo/podmig/pkg/podcr/common"
 	podcrcontianerd "github.com/yhlooo/podmig/pkg/podcr/containerd"
+	"github.com/yhlooo/podmig/pkg/podcr/events"
+	"github.com/yhlooo/podmig/pkg/podcr/metrics"
+	"github.com/yhlooo/podmig/pkg/utils/ioutil"
 	"github.com/yhlooo/podmig/pkg/utils/randutil"
 )
 
 // NewCheckpointCommandWithOptions 基于选项创建 checkpoint 子命令
 func NewCheckpointCommandWithOptions(opts *options.CheckpointOptions) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "checkpoint POD",
+		Use:   "checkpoint [POD]",
 		Short: "Checkpoint a running pod on node",
-		Args:  cobra.ExactArgs(1),
+		Long: "Checkpoint a running pod on node.\n\n" +
+			"With --selector or --all-namespaces, checkpoint all matching running pods on node in batch, " +
+			"one archive per pod in --export-dir.",
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			switch opts.ContainerRuntime {
-			case "containerd":
-			default:
-				return fmt.Errorf("unsupported container runtime: %s", opts.ContainerRuntime)
+			checkpointOpts, err := newCheckpointOptions(opts)
+			if err != nil {
+				return err
 			}
 
-			ctx := cmd.Context()
-			logger := logr.FromContextOrDiscard(ctx)
+			// 批量建立检查点
+			if opts.Selector != "" || opts.AllNamespaces {
+				if len(args) > 0 {
+					return fmt.Errorf("POD can not be specified with --selector or --all-namespaces")
+				}
+				if opts.ExportFile != "" {
+					return fmt.Errorf("--export can not be used in batch, use --export-dir instead")
+				}
+				return checkpointPods(cmd.Context(), opts, checkpointOpts)
+			}
 
-			podName := args[0]
-			podNS := opts.Namespace
+			if len(args) == 0 {
+				return fmt.Errorf("POD is required unless --selector or --all-namespaces is specified")
+			}
+			pod := podcrcommon.PodKey{Namespace: opts.Namespace, Name: args[0]}
 			checkpointID := randutil.NewRand().LowerAlphaNumN(8)
 			exportFile := opts.ExportFile
 			if exportFile == "" {
-				exportFile = fmt.Sprintf("%s_%s_checkpoint_%s.tar.gz", podNS, podName, checkpointID)
+				exportFile = defaultExportFileName(pod, checkpointID)
 			}
+			_, err = checkpointPod(cmd.Context(), opts, checkpointOpts, pod, checkpointID, exportFile, cmd.OutOrStdout())
+			return err
+		},
+	}
 
-			// 准备临时文件目录
-			tmpdir := exportFile + ".tmp"
-			if err := os.Mkdir(tmpdir, 0755); err != nil {
-				return fmt.Errorf("make temp dir %q error: %w", tmpdir, err)
-			}
-			defer func() { _ = os.RemoveAll(tmpdir) }()
+	// 绑定选项到命令行参数
+	opts.AddPFlags(cmd.Flags())
 
-			// 打开导出 tar 文件
-			file, err := os.Create(exportFile)
-			if err != nil {
-				return fmt.Errorf("failed to create export file %q: %w", exportFile, err)
-			}
-			gzipW := gzip.NewWriter(file)
-			tw := tar.NewWriter(gzipW)
-			defer func() {
-				if err := tw.Close(); err != nil {
-					logger.Error(err, "close tar writer error")
-				}
-				if err := gzipW.Close(); err != nil {
-					logger.Error(err, "close gzip writer error")
-				}
-				if err := file.Close(); err != nil {
-					logger.Error(err, "close export file writer error")
-				}
-			}()
+	return cmd
+}
 
-			// 准备检查点管理器
-			var mgr podcrcommon.PodCRManager
-			switch opts.ContainerRuntime {
-			case "containerd":
-				mgr, err = podcrcontianerd.New(opts.ContainerRuntimeEndpoint, tmpdir, opts.RetainCheckpointImages)
-			}
-			if err != nil {
-				return fmt.Errorf("create pod checkpoint manager error: %w", err)
-			}
+// checkpointPods 为本节点上匹配的运行中的 Pod 批量建立检查点，每个 Pod 导出一个检查点文件
+//
+// 单个 Pod 失败不影响其它 Pod ，上下文取消后不再开始新的 Pod
+func checkpointPods(
+	ctx context.Context,
+	opts *options.CheckpointOptions,
+	checkpointOpts podcrcommon.CheckpointOptions,
+) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	if opts.Concurrency < 1 {
+		return fmt.Errorf("concurrency must be positive, got %d", opts.Concurrency)
+	}
 
-			// 建立检查点
-			if err := mgr.Checkpoint(ctx, checkpointID, podNS, podName, tw); err != nil {
-				return err
-			}
+	// 列出匹配的 Pod
+	pods, err := listMatchedPods(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		logger.Info("no running pods matched")
+		return nil
+	}
+	logger.Info(fmt.Sprintf("checkpointing %d pods: %v", len(pods), pods))
 
-			logger.Info(fmt.Sprintf("exported pod checkpoint to file: %s", exportFile))
+	start := time.Now()
+	recorder := events.FromContextOrDiscard(ctx)
+	results := make([]events.Result, len(pods))
+	eg := &errgroup.Group{}
+	eg.SetLimit(opts.Concurrency)
+	for i, pod := range pods {
+		podCtx := events.NewContext(ctx, events.WithPod(recorder, pod.String()))
+		if err := ctx.Err(); err != nil {
+			// 已取消，不再开始新的 Pod
+			results[i] = events.NewSummarizer(metrics.OperationCheckpoint, events.FromContextOrDiscard(podCtx)).
+				Finish(err, nil)
+			continue
+		}
+		eg.Go(func() error {
+			checkpointID := randutil.NewRand().LowerAlphaNumN(8)
+			exportFile := filepath.Join(opts.ExportDir, defaultExportFileName(pod, checkpointID))
+			results[i], _ = checkpointPod(podCtx, opts, checkpointOpts, pod, checkpointID, exportFile, nil)
 			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	// 汇总结果
+	batchResult := events.BatchResult{
+		Operation:  metrics.OperationCheckpoint,
+		Total:      len(pods),
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	for i, result := range results {
+		if result.Success {
+			batchResult.Succeeded++
+			logger.Info(fmt.Sprintf("checkpointed pod %q: %s", pods[i], result.ArchivePath))
+		} else {
+			batchResult.Failed++
+			logger.Info(fmt.Sprintf("checkpoint pod %q failed: %s", pods[i], result.Error))
+		}
+	}
+	events.Record(ctx, events.Event{Type: events.TypeBatchResult, BatchResult: &batchResult})
+	logger.Info(fmt.Sprintf(
+		"checkpointed %d of %d pods, %d failed", batchResult.Succeeded, batchResult.Total, batchResult.Failed,
+	))
+	if batchResult.Failed > 0 {
+		return fmt.Errorf("%d of %d pods failed to checkpoint", batchResult.Failed, batchResult.Total)
+	}
+	return nil
+}
+
+// newCheckpointOptions 校验选项并转换为 podcrcommon.CheckpointOptions
+func newCheckpointOptions(opts *options.CheckpointOptions) (podcrcommon.CheckpointOptions, error) {
+	switch opts.ContainerRuntime {
+	case "containerd":
+	default:
+		return podcrcommon.CheckpointOptions{}, fmt.Errorf("unsupported container runtime: %s", opts.ContainerRuntime)
+	}
+	switch podcrcommon.NetworkMode(opts.NetworkMode) {
+	case podcrcommon.NetworkModeNew, podcrcommon.NetworkModePreserveIP:
+	default:
+		return podcrcommon.CheckpointOptions{}, fmt.Errorf("unsupported network mode: %s", opts.NetworkMode)
+	}
+	volumePolicies, err := parseVolumePolicies(opts.VolumePolicies)
+	if err != nil {
+		return podcrcommon.CheckpointOptions{}, err
+	}
+	return podcrcommon.CheckpointOptions{
+		NetworkMode:    podcrcommon.NetworkMode(opts.NetworkMode),
+		VolumePolicies: volumePolicies,
+		FollowMounts:   opts.FollowMounts,
+		IncludeSecrets: opts.IncludeSecrets,
+		Containers: podcrcommon.ContainerFilter{
+			Include: opts.Containers,
+			Exclude: opts.ExcludeContainers,
 		},
+		RecreateOnCheckpointFailure: opts.RecreateOnCheckpointFailure,
+		IncludeEphemeralContainers:  opts.IncludeEphemeralContainers,
+		LeavePaused:                 !opts.LeaveRunning,
+	}, nil
+}
+
+// listMatchedPods 列出本节点上匹配 --selector 和 --namespace 或 --all-namespaces 的运行中的 Pod
+func listMatchedPods(ctx context.Context, opts *options.CheckpointOptions) ([]podcrcommon.PodKey, error) {
+	selector, err := labels.Parse(opts.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("parse selector %q error: %w", opts.Selector, err)
+	}
+	namespace := opts.Namespace
+	if opts.AllNamespaces {
+		namespace = ""
 	}
 
-	// 绑定选项到命令行参数
-	opts.AddPFlags(cmd.Flags())
+	mgr, err := newCheckpointManager(opts, "")
+	if err != nil {
+		return nil, fmt.Errorf("create pod checkpoint manager error: %w", err)
+	}
+	pods, err := mgr.ListPods(ctx, namespace, selector)
+	if err != nil {
+		return nil, fmt.Errorf("list pods error: %w", err)
+	}
+	return pods, nil
+}
 
-	return cmd
+// checkpointPod 为 Pod 建立检查点并导出到 exportFile ，返回最终结果
+//
+// exportFile 为 - 时导出到 stdout
+func checkpointPod(
+	ctx context.Context,
+	opts *options.CheckpointOptions,
+	checkpointOpts podcrcommon.CheckpointOptions,
+	pod podcrcommon.PodKey,
+	checkpointID string,
+	exportFile string,
+	stdout io.Writer,
+) (result events.Result, err error) {
+	// 汇总进度事件，结束时输出最终结果
+	summarizer := events.NewSummarizer(metrics.OperationCheckpoint, events.FromContextOrDiscard(ctx))
+	ctx = events.NewContext(ctx, summarizer)
+	logger := logr.FromContextOrDiscard(ctx)
+	var exported *ioutil.CountingWriter
+	defer func() {
+		result = summarizer.Finish(err, func(result *events.Result) {
+			result.CheckpointID = checkpointID
+			if exported != nil {
+				result.ArchivePath = exportFile
+				result.BytesExported = exported.Count()
+			}
+		})
+		if err == nil {
+			metrics.ArchiveSize.WithLabelValues(metrics.OperationCheckpoint).Observe(float64(exported.Count()))
+		}
+	}()
+
+	// 准备临时文件目录
+	var tmpdir string
+	if exportFile == stdioFileName {
+		tmpdir, err = os.MkdirTemp("", "pcrctl-checkpoint-")
+		if err != nil {
+			return result, fmt.Errorf("make temp dir error: %w", err)
+		}
+	} else {
+		tmpdir = exportFile + ".tmp"
+		if err := os.Mkdir(tmpdir, 0755); err != nil {
+			return result, fmt.Errorf("make temp dir %q error: %w", tmpdir, err)
+		}
+	}
+	defer func() { _ = os.RemoveAll(tmpdir) }()
+
+	// 打开导出 tar 文件
+	var file io.WriteCloser
+	if exportFile == stdioFileName {
+		file = nopWriteCloser{Writer: stdout}
+	} else {
+		file, err = os.Create(exportFile)
+		if err != nil {
+			return result, fmt.Errorf("failed to create export file %q: %w", exportFile, err)
+		}
+	}
+	exported = ioutil.NewCountingWriter(file)
+	gzipW := gzip.NewWriter(exported)
+	tw := tar.NewWriter(gzipW)
+	defer func() {
+		if err := tw.Close(); err != nil {
+			logger.Error(err, "close tar writer error")
+		}
+		if err := gzipW.Close(); err != nil {
+			logger.Error(err, "close gzip writer error")
+		}
+		if err := file.Close(); err != nil {
+			logger.Error(err, "close export file writer error")
+		}
+	}()
+
+	// 准备检查点管理器
+	mgr, err := newCheckpointManager(opts, tmpdir)
+	if err != nil {
+		return result, fmt.Errorf("create pod checkpoint manager error: %w", err)
+	}
+
+	// 建立检查点
+	if err := mgr.Checkpoint(ctx, checkpointID, pod.Namespace, pod.Name, tw, checkpointOpts); err != nil {
+		return result, err
+	}
+
+	logger.Info(fmt.Sprintf("exported pod checkpoint to file: %s", exportFile))
+	return result, nil
+}
+
+// newCheckpointManager 创建建立检查点使用的 Pod 检查点还原管理器， tmpdir 为临时文件目录
+//
+// 测试时替换为使用模拟容器运行时的管理器
+var newCheckpointManager = func(
+	opts *options.CheckpointOptions,
+	tmpdir string,
+) (podcrcommon.PodCRManager, error) {
+	switch opts.ContainerRuntime {
+	case "containerd":
+		return podcrcontianerd.New(opts.ContainerRuntimeEndpoint, tmpdir, opts.RetainCheckpointImages)
+	}
+	return nil, fmt.Errorf("unsupported container runtime: %s", opts.ContainerRuntime)
+}
+
+// stdioFileName 表示标准输入或标准输出的文件名
+const stdioFileName = "-"
+
+// nopWriteCloser Close 不做任何操作的 io.WriteCloser
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close 关闭
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// defaultExportFileName 获取默认的检查点导出文件名
+func defaultExportFileName(pod podcrcommon.PodKey, checkpointID string) string {
+	return fmt.Sprintf("%s_%s_checkpoint_%s.tar.gz", pod.Namespace, pod.Name, checkpointID)
+}
+
+// parseVolumePolicies 解析以卷插件名为键的卷数据处理策略，不含 / 的插件名视为 kubernetes.io/ 下的插件
+func parseVolumePolicies(policies map[string]string) (map[string]podcrcommon.VolumePolicy, error) {
+	if len(policies) == 0 {
+		return nil, nil
+	}
+	ret := make(map[string]podcrcommon.VolumePolicy, len(policies))
+	for plugin, policy := range policies {
+		switch podcrcommon.VolumePolicy(policy) {
+		case podcrcommon.VolumePolicyCopy, podcrcommon.VolumePolicySkip, podcrcommon.VolumePolicySnapshot:
+		default:
+			return nil, fmt.Errorf("unsupported volume policy %q for volume plugin %q", policy, plugin)
+		}
+		if !strings.Contains(plugin, "/") {
+			plugin = "kubernetes.io/" + plugin
+		}
+		ret[plugin] = podcrcommon.VolumePolicy(policy)
+	}
+	return ret, nil
 }
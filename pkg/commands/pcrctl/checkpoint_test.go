@@ -0,0 +1,240 @@
+package pcrctl
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containerd/containerd"
+
+	"github.com/yhlooo/podmig/pkg/commands/pcrctl/options"
+	podcrcommon "github.com/yhlooo/podmig/pkg/podcr/common"
+	podcrcontianerd "github.com/yhlooo/podmig/pkg/podcr/containerd"
+	"github.com/yhlooo/podmig/pkg/podcr/containerd/fake"
+	"github.com/yhlooo/podmig/pkg/podcr/events"
+)
+
+// eventsRecorder 在内存中记录事件的 events.Recorder
+type eventsRecorder struct {
+	lock   sync.Mutex
+	events []events.Event
+}
+
+// Record 记录事件
+func (r *eventsRecorder) Record(event events.Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event)
+}
+
+// ofType 返回指定类型的事件
+func (r *eventsRecorder) ofType(t events.Type) []events.Event {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var ret []events.Event
+	for _, event := range r.events {
+		if event.Type == t {
+			ret = append(ret, event)
+		}
+	}
+	return ret
+}
+
+// TestCheckpointPods 测试批量建立检查点时按选择器匹配 Pod ，单个 Pod 失败或中途取消时汇总结果并返回错误
+func TestCheckpointPods(t *testing.T) {
+	pods := []fake.Pod{
+		{Namespace: "default", Name: "web-0", Labels: map[string]string{"app": "web"}},
+		{Namespace: "default", Name: "web-1", Labels: map[string]string{"app": "web"}},
+		{Namespace: "default", Name: "web-2", Labels: map[string]string{"app": "web"}},
+		{Namespace: "default", Name: "db-0", Labels: map[string]string{"app": "db"}},
+	}
+	errDump := errors.New("criu dump failed")
+
+	cases := []struct {
+		name        string
+		selector    string
+		concurrency int
+		// 建立检查点时调用，返回错误时该容器建立检查点失败
+		hook func(cancel context.CancelFunc, pod string) error
+
+		expectedErr       string
+		expectedBatch     *events.BatchResult
+		expectedSucceeded []string
+		expectedFailed    map[string]string
+		// 调用了检查点钩子的 Pod
+		expectedDumped []string
+	}{
+		{
+			name:              "AllSucceeded",
+			selector:          "app=web",
+			concurrency:       2,
+			expectedBatch:     &events.BatchResult{Total: 3, Succeeded: 3},
+			expectedSucceeded: []string{"default/web-0", "default/web-1", "default/web-2"},
+			expectedDumped:    []string{"default/web-0", "default/web-1", "default/web-2"},
+		},
+		{
+			name:        "OnePodFailed",
+			selector:    "app=web",
+			concurrency: 2,
+			hook: func(_ context.CancelFunc, pod string) error {
+				if pod == "default/web-1" {
+					return errDump
+				}
+				return nil
+			},
+			expectedErr:       "1 of 3 pods failed to checkpoint",
+			expectedBatch:     &events.BatchResult{Total: 3, Succeeded: 2, Failed: 1},
+			expectedSucceeded: []string{"default/web-0", "default/web-2"},
+			expectedFailed:    map[string]string{"default/web-1": errDump.Error()},
+			expectedDumped:    []string{"default/web-0", "default/web-1", "default/web-2"},
+		},
+		{
+			name:        "CanceledInBatch",
+			selector:    "app=web",
+			concurrency: 1,
+			hook: func(cancel context.CancelFunc, _ string) error {
+				cancel()
+				return context.Canceled
+			},
+			expectedErr:   "3 of 3 pods failed to checkpoint",
+			expectedBatch: &events.BatchResult{Total: 3, Failed: 3},
+			expectedFailed: map[string]string{
+				"default/web-0": context.Canceled.Error(),
+				"default/web-1": context.Canceled.Error(),
+				"default/web-2": context.Canceled.Error(),
+			},
+			expectedDumped: []string{"default/web-0"},
+		},
+		{
+			name:        "NotMatched",
+			selector:    "app=cache",
+			concurrency: 2,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			recorder := &eventsRecorder{}
+			ctx = events.NewContext(ctx, recorder)
+
+			cri := fake.NewRuntimeService()
+			backend := fake.NewBackend()
+			kubeletRootDir := t.TempDir()
+			podOfContainer := map[string]string{}
+			for _, pod := range pods {
+				pod.UID = "uid-" + pod.Name
+				pod.ContainerName = "app"
+				pod.Memory = []byte("heap")
+				id, err := fake.RunPod(ctx, cri, backend, kubeletRootDir, pod)
+				if err != nil {
+					t.Fatalf("run pod %q error: %v", pod.Name, err)
+				}
+				podOfContainer[id] = pod.Namespace + "/" + pod.Name
+			}
+			var lock sync.Mutex
+			var dumped []string
+			backend.SetCheckpointHook(func(_ context.Context, id string) error {
+				lock.Lock()
+				dumped = append(dumped, podOfContainer[id])
+				lock.Unlock()
+				if c.hook == nil {
+					return nil
+				}
+				return c.hook(cancel, podOfContainer[id])
+			})
+
+			orig := newCheckpointManager
+			defer func() { newCheckpointManager = orig }()
+			newCheckpointManager = func(_ *options.CheckpointOptions, tmpdir string) (podcrcommon.PodCRManager, error) {
+				return podcrcontianerd.NewWithClients(
+					tmpdir, false, cri, backend, backend, backend,
+					podcrcontianerd.WithKubeletRootDir(kubeletRootDir),
+					podcrcontianerd.WithCgroupV2(true),
+				), nil
+			}
+
+			opts := options.NewDefaultCheckpointOptions()
+			opts.Namespace = "default"
+			opts.Selector = c.selector
+			opts.Concurrency = c.concurrency
+			opts.ExportDir = t.TempDir()
+			checkpointOpts, err := newCheckpointOptions(&opts)
+			if err != nil {
+				t.Fatalf("new checkpoint options error: %v", err)
+			}
+
+			err = checkpointPods(ctx, &opts, checkpointOpts)
+			switch {
+			case c.expectedErr == "" && err != nil:
+				t.Errorf("expected no error, got %v", err)
+			case c.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), c.expectedErr)):
+				t.Errorf("expected error containing %q, got %v", c.expectedErr, err)
+			}
+
+			// 汇总结果
+			batches := recorder.ofType(events.TypeBatchResult)
+			switch {
+			case c.expectedBatch == nil && len(batches) != 0:
+				t.Errorf("expected no batch result, got %+v", batches[0].BatchResult)
+			case c.expectedBatch != nil && len(batches) != 1:
+				t.Errorf("expected 1 batch result, got %d", len(batches))
+			case c.expectedBatch != nil:
+				got := *batches[0].BatchResult
+				if got.Total != c.expectedBatch.Total ||
+					got.Succeeded != c.expectedBatch.Succeeded ||
+					got.Failed != c.expectedBatch.Failed {
+					t.Errorf("expected batch result %+v, got %+v", *c.expectedBatch, got)
+				}
+			}
+
+			// 各 Pod 结果
+			var succeeded []string
+			failed := map[string]string{}
+			for _, event := range recorder.ofType(events.TypeResult) {
+				if event.Result.Success {
+					succeeded = append(succeeded, event.Pod)
+					if _, err := os.Stat(event.Result.ArchivePath); err != nil {
+						t.Errorf("expected archive of pod %q exported: %v", event.Pod, err)
+					}
+					if filepath.Dir(event.Result.ArchivePath) != opts.ExportDir {
+						t.Errorf("expected archive of pod %q in %q, got %q",
+							event.Pod, opts.ExportDir, event.Result.ArchivePath)
+					}
+					continue
+				}
+				failed[event.Pod] = event.Result.Error
+			}
+			sort.Strings(succeeded)
+			if !reflect.DeepEqual(succeeded, c.expectedSucceeded) {
+				t.Errorf("expected succeeded pods %v, got %v", c.expectedSucceeded, succeeded)
+			}
+			if len(failed) != len(c.expectedFailed) {
+				t.Errorf("expected failed pods %v, got %v", c.expectedFailed, failed)
+			}
+			for pod, expected := range c.expectedFailed {
+				if !strings.Contains(failed[pod], expected) {
+					t.Errorf("expected pod %q failed with %q, got %q", pod, expected, failed[pod])
+				}
+			}
+
+			sort.Strings(dumped)
+			if !reflect.DeepEqual(dumped, c.expectedDumped) {
+				t.Errorf("expected pods %v dumped, got %v", c.expectedDumped, dumped)
+			}
+			// 失败或取消时恢复已暂停的容器
+			for _, container := range backend.Containers() {
+				if container.Status != containerd.Running {
+					t.Errorf("expected container of pod %q running, got %s",
+						podOfContainer[container.ID], container.Status)
+				}
+			}
+		})
+	}
+}
@@ -12,6 +12,12 @@ func NewDefaultCheckpointOptions() CheckpointOptions {
 		ContainerRuntimeEndpoint: "unix:///run/containerd/containerd.sock",
 		ExportFile:               "",
 		RetainCheckpointImages:   false,
+		NetworkMode:              "new",
+		VolumePolicies:           nil,
+		FollowMounts:             false,
+		IncludeSecrets:           false,
+		Concurrency:              4,
+		LeaveRunning:             true,
 	}
 }
 
@@ -25,8 +31,34 @@ type CheckpointOptions struct {
 	ContainerRuntimeEndpoint string `json:"containerRuntimeEndpoint,omitempty" yaml:"containerRuntimeEndpoint,omitempty"`
 	// 检查点导出目录
 	ExportFile string `json:"exportFile,omitempty" yaml:"exportFile,omitempty"`
+	// 按标签选择 Pod 批量建立检查点
+	Selector string `json:"selector,omitempty" yaml:"selector,omitempty"`
+	// 批量建立检查点时选择所有命名空间中的 Pod
+	AllNamespaces bool `json:"allNamespaces,omitempty" yaml:"allNamespaces,omitempty"`
+	// 批量建立检查点时同时处理的 Pod 数
+	Concurrency int `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	// 批量建立检查点时检查点文件的导出目录
+	ExportDir string `json:"exportDir,omitempty" yaml:"exportDir,omitempty"`
 	// 导出后容器检查点后保留检查点镜像
 	RetainCheckpointImages bool `json:"retainCheckpointImages,omitempty" yaml:"retainCheckpointImages,omitempty"`
+	// 网络模式
+	NetworkMode string `json:"networkMode,omitempty" yaml:"networkMode,omitempty"`
+	// 以卷插件名为键的卷数据处理策略
+	VolumePolicies map[string]string `json:"volumePolicies,omitempty" yaml:"volumePolicies,omitempty"`
+	// 导出 kubelet Pod 目录时跟随进入非卷自身的挂载点
+	FollowMounts bool `json:"followMounts,omitempty" yaml:"followMounts,omitempty"`
+	// 导出 secret 、 projected 卷中的敏感数据
+	IncludeSecrets bool `json:"includeSecrets,omitempty" yaml:"includeSecrets,omitempty"`
+	// 转储内存的容器名，为空表示所有容器
+	Containers []string `json:"containers,omitempty" yaml:"containers,omitempty"`
+	// 不转储内存、还原时使用原始镜像重新创建的容器名
+	ExcludeContainers []string `json:"excludeContainers,omitempty" yaml:"excludeContainers,omitempty"`
+	// 容器建立检查点失败时改为还原时使用原始镜像重新创建
+	RecreateOnCheckpointFailure bool `json:"recreateOnCheckpointFailure,omitempty" yaml:"recreateOnCheckpointFailure,omitempty"`
+	// 为临时容器建立检查点
+	IncludeEphemeralContainers bool `json:"includeEphemeralContainers,omitempty" yaml:"includeEphemeralContainers,omitempty"`
+	// 建立检查点后保持容器运行，否则保持容器暂停直到通过 resume 子命令恢复
+	LeaveRunning bool `json:"leaveRunning,omitempty" yaml:"leaveRunning,omitempty"`
 }
 
 // AddPFlags 将选项绑定到命令行参数
@@ -34,9 +66,66 @@ func (o *CheckpointOptions) AddPFlags(flags *pflag.FlagSet) {
 	flags.StringVarP(&o.Namespace, "namespace", "n", o.Namespace, "Pod namespace")
 	flags.StringVar(&o.ContainerRuntime, "runtime", o.ContainerRuntime, "Container runtime")
 	flags.StringVar(&o.ContainerRuntimeEndpoint, "endpoint", o.ContainerRuntimeEndpoint, "Container runtime endpoint")
-	flags.StringVar(&o.ExportFile, "export", o.ExportFile, "Tar file to export checkpoint")
+	flags.StringVar(&o.ExportFile, "export", o.ExportFile, "Tar file to export checkpoint, \"-\" for stdout")
+	flags.StringVarP(
+		&o.Selector, "selector", "l", o.Selector,
+		"Checkpoint all running pods matching the label selector (e.g. -l app=foo), one archive per pod",
+	)
+	flags.BoolVarP(
+		&o.AllNamespaces, "all-namespaces", "A", o.AllNamespaces,
+		"Checkpoint running pods in all namespaces, can be combined with --selector",
+	)
+	flags.IntVar(&o.Concurrency, "concurrency", o.Concurrency, "Number of pods to checkpoint concurrently in batch")
+	flags.StringVar(
+		&o.ExportDir, "export-dir", o.ExportDir,
+		"Directory to export checkpoints to in batch, defaults to the current directory",
+	)
 	flags.BoolVar(
 		&o.RetainCheckpointImages, "retain-checkpoint-images", o.RetainCheckpointImages,
 		"Retain checkpoint images after export",
 	)
+	flags.StringVar(
+		&o.NetworkMode, "network-mode", o.NetworkMode,
+		"Network mode, \"new\" or \"preserve-ip\". "+
+			"With \"preserve-ip\", pod ips are recorded and established tcp connections are dumped",
+	)
+	flags.StringToStringVar(
+		&o.VolumePolicies, "volume-policy", o.VolumePolicies,
+		"Volume data policy by volume plugin, one of \"copy\", \"skip\" or \"snapshot\" "+
+			"(e.g. --volume-policy local-volume=snapshot). "+
+			"By default emptyDir, configMap and downwardAPI volumes are copied, "+
+			"secret and projected volumes are rematerialized by kubelet on restore, others are skipped",
+	)
+	flags.BoolVar(
+		&o.FollowMounts, "follow-mounts", o.FollowMounts,
+		"Follow mount points other than volume roots when exporting kubelet pod directory",
+	)
+	flags.BoolVar(
+		&o.IncludeSecrets, "include-secrets", o.IncludeSecrets,
+		"Include secret material (e.g. secret volumes and projected service account tokens) in checkpoint",
+	)
+	flags.StringSliceVar(
+		&o.Containers, "containers", o.Containers,
+		"Names of containers to checkpoint, defaults to all containers. "+
+			"Other containers are not dumped and will be recreated from their original images on restore",
+	)
+	flags.StringSliceVar(
+		&o.ExcludeContainers, "exclude-containers", o.ExcludeContainers,
+		"Names of containers not to checkpoint, they will be recreated from their original images on restore",
+	)
+	flags.BoolVar(
+		&o.RecreateOnCheckpointFailure, "recreate-on-checkpoint-failure", o.RecreateOnCheckpointFailure,
+		"Do not abort when checkpointing a container fails, "+
+			"record it to be recreated from its original image on restore instead",
+	)
+	flags.BoolVar(
+		&o.IncludeEphemeralContainers, "include-ephemeral-containers", o.IncludeEphemeralContainers,
+		"Checkpoint ephemeral containers targeting another container (kubectl debug --target), "+
+			"which are excluded by default",
+	)
+	flags.BoolVar(
+		&o.LeaveRunning, "leave-running", o.LeaveRunning,
+		"Leave containers running after checkpoint. If false, containers stay paused after a successful checkpoint "+
+			"until resumed by the resume command, e.g. when migrating the pod",
+	)
 }
@@ -2,14 +2,24 @@ package options
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/pflag"
 )
 
+// 输出格式
+const (
+	// OutputText 文本日志
+	OutputText = "text"
+	// OutputJSON NDJSON 格式的进度事件
+	OutputJSON = "json"
+)
+
 // NewDefaultGlobalOptions 返回默认全局选项
 func NewDefaultGlobalOptions() GlobalOptions {
 	return GlobalOptions{
 		Verbosity: 0,
+		Output:    OutputText,
 	}
 }
 
@@ -17,6 +27,25 @@ func NewDefaultGlobalOptions() GlobalOptions {
 type GlobalOptions struct {
 	// 日志数量级别（ 0 / 1 / 2 ）
 	Verbosity uint32 `json:"verbosity" yaml:"verbosity"`
+	// 输出格式（ text / json ）
+	Output string `json:"output,omitempty" yaml:"output,omitempty"`
+	// 输出 json 格式进度事件的文件，为空时输出到标准输出
+	OutputFile string `json:"outputFile,omitempty" yaml:"outputFile,omitempty"`
+	// 通过 HTTP 暴露指标的监听地址，为空时不暴露
+	MetricsAddress string `json:"metricsAddress,omitempty" yaml:"metricsAddress,omitempty"`
+	// 命令结束时写入指标的文件，与文件中已有的指标累加，为空时不写入
+	MetricsTextfile string `json:"metricsTextfile,omitempty" yaml:"metricsTextfile,omitempty"`
+	// 导出 trace 的 OTLP gRPC 接收端地址，为空且未设置 OTEL_EXPORTER_OTLP_ENDPOINT 等环境变量时不导出
+	OTLPEndpoint string `json:"otlpEndpoint,omitempty" yaml:"otlpEndpoint,omitempty"`
+	// 是否不使用 TLS 连接 OTLP 接收端
+	OTLPInsecure bool `json:"otlpInsecure,omitempty" yaml:"otlpInsecure,omitempty"`
+}
+
+// TracingEnabled 是否导出 trace
+func (o *GlobalOptions) TracingEnabled() bool {
+	return o.OTLPEndpoint != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
 }
 
 // Validate 校验选项是否合法
@@ -24,10 +53,43 @@ func (o *GlobalOptions) Validate() error {
 	if o.Verbosity > 2 {
 		return fmt.Errorf("invalid log verbosity: %d (expected: 0, 1 or 2)", o.Verbosity)
 	}
+	switch o.Output {
+	case OutputText, OutputJSON:
+	default:
+		return fmt.Errorf("invalid output format: %q (expected: %q or %q)", o.Output, OutputText, OutputJSON)
+	}
+	if o.OutputFile != "" && o.Output != OutputJSON {
+		return fmt.Errorf("--output-file can only be used with --output %s", OutputJSON)
+	}
 	return nil
 }
 
 // AddPFlags 将选项绑定到命令行参数
 func (o *GlobalOptions) AddPFlags(flags *pflag.FlagSet) {
 	flags.Uint32VarP(&o.Verbosity, "verbose", "v", o.Verbosity, "Number for the log level verbosity (0, 1, or 2)")
+	flags.StringVarP(
+		&o.Output, "output", "o", o.Output,
+		"Output format (text or json). "+
+			"With json, progress events and the final result are written as NDJSON, logs still go to stderr",
+	)
+	flags.StringVar(
+		&o.OutputFile, "output-file", o.OutputFile,
+		"File to write json progress events to instead of stdout",
+	)
+	flags.StringVar(
+		&o.MetricsAddress, "metrics-address", o.MetricsAddress,
+		"Address to expose Prometheus metrics on (at /metrics) while the command is running",
+	)
+	flags.StringVar(
+		&o.MetricsTextfile, "metrics-textfile", o.MetricsTextfile,
+		"File to write Prometheus metrics to when the command finishes, "+
+			"e.g. a *.prom file in the node-exporter textfile collector directory. "+
+			"Counters and histograms are added to those already in the file, so they accumulate across runs",
+	)
+	flags.StringVar(
+		&o.OTLPEndpoint, "otlp-endpoint", o.OTLPEndpoint,
+		"OTLP gRPC endpoint (host:port) to export traces to. "+
+			"Tracing is also enabled by the standard OTEL_EXPORTER_OTLP_ENDPOINT environment variables",
+	)
+	flags.BoolVar(&o.OTLPInsecure, "otlp-insecure", o.OTLPInsecure, "Connect to the OTLP endpoint without TLS")
 }
@@ -0,0 +1,25 @@
+package options
+
+import "github.com/spf13/pflag"
+
+// NewDefaultPreflightOptions 返回一个默认的 PreflightOptions
+func NewDefaultPreflightOptions() PreflightOptions {
+	return PreflightOptions{
+		ContainerRuntime:         "containerd",
+		ContainerRuntimeEndpoint: "unix:///run/containerd/containerd.sock",
+	}
+}
+
+// PreflightOptions preflight 子命令选项
+type PreflightOptions struct {
+	// 容器运行时
+	ContainerRuntime string `json:"containerRuntime,omitempty" yaml:"containerRuntime,omitempty"`
+	// 容器运行时访问入口
+	ContainerRuntimeEndpoint string `json:"containerRuntimeEndpoint,omitempty" yaml:"containerRuntimeEndpoint,omitempty"`
+}
+
+// AddPFlags 将选项绑定到命令行参数
+func (o *PreflightOptions) AddPFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.ContainerRuntime, "runtime", o.ContainerRuntime, "Container runtime")
+	flags.StringVar(&o.ContainerRuntimeEndpoint, "endpoint", o.ContainerRuntimeEndpoint, "Container runtime endpoint")
+}
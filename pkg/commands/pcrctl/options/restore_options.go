@@ -1,11 +1,30 @@
 package options
 
-import "github.com/spf13/pflag"
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+
+	podcrcommon "github.com/yhlooo/podmig/pkg/podcr/common"
+)
 
 // NewDefaultRestoreOptions 返回一个默认的 RestoreOptions
 func NewDefaultRestoreOptions() RestoreOptions {
 	return RestoreOptions{
 		PodUID:                   "",
+		Name:                     "",
+		Namespace:                "",
+		Hostname:                 "",
+		Labels:                   nil,
+		Annotations:              nil,
+		CPULimits:                nil,
+		MemoryLimits:             nil,
+		NetworkMode:              "",
+		IPRequestAnnotation:      "",
+		RematerializeVolumes:     false,
+		VolumeWaitTimeout:        podcrcommon.DefaultVolumeWaitTimeout,
+		DryRun:                   false,
+		SkipPreflight:            false,
 		ContainerRuntime:         "containerd",
 		ContainerRuntimeEndpoint: "unix:///run/containerd/containerd.sock",
 	}
@@ -15,6 +34,47 @@ func NewDefaultRestoreOptions() RestoreOptions {
 type RestoreOptions struct {
 	// 还原的目标 Pod UID
 	PodUID string `json:"podUID,omitempty" yaml:"podUID,omitempty"`
+	// 还原的目标 Pod 名
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// 还原的目标 Pod 命名空间
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	// 还原的目标 Pod 主机名
+	Hostname string `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+	// 追加或覆盖的 Pod 标签
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	// 追加或覆盖的 Pod 注解
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	// 以容器名为键的 CPU 限制，如 500m
+	CPULimits map[string]string `json:"cpuLimits,omitempty" yaml:"cpuLimits,omitempty"`
+	// 以容器名为键的内存限制，如 1Gi
+	MemoryLimits map[string]string `json:"memoryLimits,omitempty" yaml:"memoryLimits,omitempty"`
+	// 网络模式
+	NetworkMode string `json:"networkMode,omitempty" yaml:"networkMode,omitempty"`
+	// 请求 CNI 复用 Pod IP 的沙盒注解键
+	IPRequestAnnotation string `json:"ipRequestAnnotation,omitempty" yaml:"ipRequestAnnotation,omitempty"`
+	// 不还原检查点中 secret 、 configMap 、 projected 、 downwardAPI 卷的数据，等待 kubelet 重新投射
+	RematerializeVolumes bool `json:"rematerializeVolumes,omitempty" yaml:"rematerializeVolumes,omitempty"`
+	// 等待 kubelet 重新投射卷内容的超时时间
+	VolumeWaitTimeout time.Duration `json:"volumeWaitTimeout,omitempty" yaml:"volumeWaitTimeout,omitempty"`
+	// 仅输出还原计划，不执行还原
+	DryRun bool `json:"dryRun,omitempty" yaml:"dryRun,omitempty"`
+	// 跳过还原前的兼容性检查
+	SkipPreflight bool `json:"skipPreflight,omitempty" yaml:"skipPreflight,omitempty"`
+	// 从检查点还原的容器名，为空表示所有已转储的容器
+	Containers []string `json:"containers,omitempty" yaml:"containers,omitempty"`
+	// 不从检查点还原、使用原始镜像重新创建的容器名
+	ExcludeContainers []string `json:"excludeContainers,omitempty" yaml:"excludeContainers,omitempty"`
+	// 目标 Pod 声明的临时容器名
+	EphemeralContainers []string `json:"ephemeralContainers,omitempty" yaml:"ephemeralContainers,omitempty"`
+
+	// 从检查点存储中选择 Pod 最新的有效检查点还原
+	Latest bool `json:"latest,omitempty" yaml:"latest,omitempty"`
+	// 选择检查点的 Pod ，格式为 namespace/name
+	Pod string `json:"pod,omitempty" yaml:"pod,omitempty"`
+	// 检查点存储目录或镜像引用
+	Store string `json:"store,omitempty" yaml:"store,omitempty"`
+	// 检查原 Pod 是否仍在运行时访问 Kubernetes 集群的 kubeconfig 文件，为空时使用默认规则或集群内配置
+	Kubeconfig string `json:"kubeconfig,omitempty" yaml:"kubeconfig,omitempty"`
 
 	// 容器运行时
 	ContainerRuntime string `json:"containerRuntime,omitempty" yaml:"containerRuntime,omitempty"`
@@ -25,6 +85,85 @@ type RestoreOptions struct {
 // AddPFlags 将选项绑定到命令行参数
 func (o *RestoreOptions) AddPFlags(flags *pflag.FlagSet) {
 	flags.StringVar(&o.PodUID, "pod-uid", o.PodUID, "Pod UID")
+	flags.StringVar(&o.Name, "name", o.Name, "Pod name, defaults to the name in checkpoint")
+	flags.StringVarP(
+		&o.Namespace, "namespace", "n", o.Namespace,
+		"Pod namespace, defaults to the namespace in checkpoint",
+	)
+	flags.StringVar(&o.Hostname, "hostname", o.Hostname, "Pod hostname, defaults to the hostname in checkpoint")
+	flags.StringToStringVar(&o.Labels, "label", o.Labels, "Pod labels to add or override (e.g. --label key=value)")
+	flags.StringToStringVar(
+		&o.Annotations, "annotation", o.Annotations,
+		"Pod annotations to add or override (e.g. --annotation key=value)",
+	)
+	flags.StringToStringVar(
+		&o.CPULimits, "cpu-limit", o.CPULimits,
+		"CPU limit of container to override (e.g. --cpu-limit CONTAINER=500m)",
+	)
+	flags.StringToStringVar(
+		&o.MemoryLimits, "memory-limit", o.MemoryLimits,
+		"Memory limit of container to override, must not be less than checkpointed memory "+
+			"(e.g. --memory-limit CONTAINER=1Gi)",
+	)
+	flags.StringVar(
+		&o.NetworkMode, "network-mode", o.NetworkMode,
+		"Network mode, \"new\" or \"preserve-ip\", defaults to the network mode in checkpoint",
+	)
+	flags.StringVar(
+		&o.IPRequestAnnotation, "ip-request-annotation", o.IPRequestAnnotation,
+		"Sandbox annotation key used to request pod ips from CNI in \"preserve-ip\" network mode "+
+			"(e.g. cni.projectcalico.org/ipAddrs)",
+	)
+	flags.BoolVar(
+		&o.RematerializeVolumes, "rematerialize-volumes", o.RematerializeVolumes,
+		"Do not restore secret, configMap, projected and downwardAPI volumes from checkpoint, "+
+			"wait for kubelet to project them for the restored pod instead. "+
+			"Kubelet only projects volumes of pods bound to this node, "+
+			"so the pod with --pod-uid must be bound to this node before --volume-wait-timeout",
+	)
+	flags.DurationVar(
+		&o.VolumeWaitTimeout, "volume-wait-timeout", o.VolumeWaitTimeout,
+		"Timeout for waiting kubelet to project volumes",
+	)
+	flags.BoolVar(
+		&o.DryRun, "dry-run", o.DryRun,
+		"Only print the restore plan without creating sandbox, importing images or writing files",
+	)
+	flags.BoolVar(
+		&o.SkipPreflight, "skip-preflight", o.SkipPreflight,
+		"Skip compatibility checks between checkpoint and this node before restoring",
+	)
+	flags.StringSliceVar(
+		&o.Containers, "containers", o.Containers,
+		"Names of containers to restore from checkpoint, defaults to all checkpointed containers. "+
+			"Other containers are recreated from their original images",
+	)
+	flags.StringSliceVar(
+		&o.ExcludeContainers, "exclude-containers", o.ExcludeContainers,
+		"Names of containers not to restore from checkpoint, they are recreated from their original images",
+	)
+	flags.StringSliceVar(
+		&o.EphemeralContainers, "ephemeral-containers", o.EphemeralContainers,
+		"Names of ephemeral containers declared by the target pod. "+
+			"Ephemeral containers in checkpoint not declared here are never restored or recreated",
+	)
+	flags.BoolVar(
+		&o.Latest, "latest", o.Latest,
+		"Restore the latest valid checkpoint of --pod in --store instead of FILE. "+
+			"Refuse if the original pod is still running",
+	)
+	flags.StringVar(&o.Pod, "pod", o.Pod, "Pod (NAMESPACE/NAME) to restore the latest checkpoint of")
+	flags.StringVar(
+		&o.Store, "store", o.Store,
+		"Directory of checkpoint store (written by schedule) to find the latest checkpoint in, "+
+			"or reference to an image whose layers are checkpoints titled by their paths in the directory. "+
+			"Images are pulled anonymously, checkpoints are downloaded one by one from the latest until a valid one",
+	)
+	flags.StringVar(
+		&o.Kubeconfig, "kubeconfig", o.Kubeconfig,
+		"Path to the kubeconfig file used to check whether the original pod is still running with --latest, "+
+			"defaults to $KUBECONFIG, ~/.kube/config or the in-cluster config",
+	)
 
 	flags.StringVar(&o.ContainerRuntime, "runtime", o.ContainerRuntime, "Container runtime")
 	flags.StringVar(&o.ContainerRuntimeEndpoint, "endpoint", o.ContainerRuntimeEndpoint, "Container runtime endpoint")
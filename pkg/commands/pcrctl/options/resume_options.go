@@ -0,0 +1,29 @@
+package options
+
+import "github.com/spf13/pflag"
+
+// NewDefaultResumeOptions 返回一个默认的 ResumeOptions
+func NewDefaultResumeOptions() ResumeOptions {
+	return ResumeOptions{
+		Namespace:                "default",
+		ContainerRuntime:         "containerd",
+		ContainerRuntimeEndpoint: "unix:///run/containerd/containerd.sock",
+	}
+}
+
+// ResumeOptions resume 子命令选项
+type ResumeOptions struct {
+	// Pod 命名空间
+	Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	// 容器运行时
+	ContainerRuntime string `json:"containerRuntime,omitempty" yaml:"containerRuntime,omitempty"`
+	// 容器运行时访问入口
+	ContainerRuntimeEndpoint string `json:"containerRuntimeEndpoint,omitempty" yaml:"containerRuntimeEndpoint,omitempty"`
+}
+
+// AddPFlags 将选项绑定到命令行参数
+func (o *ResumeOptions) AddPFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&o.Namespace, "namespace", "n", o.Namespace, "Pod namespace")
+	flags.StringVar(&o.ContainerRuntime, "runtime", o.ContainerRuntime, "Container runtime")
+	flags.StringVar(&o.ContainerRuntimeEndpoint, "endpoint", o.ContainerRuntimeEndpoint, "Container runtime endpoint")
+}
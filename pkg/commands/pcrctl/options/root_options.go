@@ -6,6 +6,9 @@ func NewDefaultOptions() Options {
 		Global:     NewDefaultGlobalOptions(),
 		Checkpoint: NewDefaultCheckpointOptions(),
 		Restore:    NewDefaultRestoreOptions(),
+		Preflight:  NewDefaultPreflightOptions(),
+		Schedule:   NewDefaultScheduleOptions(),
+		Resume:     NewDefaultResumeOptions(),
 	}
 }
 
@@ -17,4 +20,10 @@ type Options struct {
 	Checkpoint CheckpointOptions `json:"checkpoint,omitempty" yaml:"checkpoint,omitempty"`
 	// restore 子命令选项
 	Restore RestoreOptions `json:"restore,omitempty" yaml:"restore,omitempty"`
+	// preflight 子命令选项
+	Preflight PreflightOptions `json:"preflight,omitempty" yaml:"preflight,omitempty"`
+	// schedule 子命令选项
+	Schedule ScheduleOptions `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+	// resume 子命令选项
+	Resume ResumeOptions `json:"resume,omitempty" yaml:"resume,omitempty"`
 }
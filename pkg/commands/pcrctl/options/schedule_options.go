@@ -0,0 +1,45 @@
+package options
+
+import (
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// NewDefaultScheduleOptions 返回一个默认的 ScheduleOptions
+func NewDefaultScheduleOptions() ScheduleOptions {
+	return ScheduleOptions{
+		CheckpointOptions: NewDefaultCheckpointOptions(),
+		Interval:          10 * time.Minute,
+		Keep:              3,
+	}
+}
+
+// ScheduleOptions schedule 子命令选项
+type ScheduleOptions struct {
+	// 建立检查点的选项
+	CheckpointOptions `json:",inline" yaml:",inline"`
+	// 检查点存储目录
+	Store string `json:"store,omitempty" yaml:"store,omitempty"`
+	// 建立检查点的间隔
+	Interval time.Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+	// 每个 Pod 保留的检查点数， 0 表示全部保留
+	Keep int `json:"keep,omitempty" yaml:"keep,omitempty"`
+	// 建立检查点的轮数， 0 表示不限
+	Count int `json:"count,omitempty" yaml:"count,omitempty"`
+}
+
+// AddPFlags 将选项绑定到命令行参数
+func (o *ScheduleOptions) AddPFlags(flags *pflag.FlagSet) {
+	o.CheckpointOptions.AddPFlags(flags)
+	// 检查点写入存储
+	_ = flags.MarkHidden("export")
+	_ = flags.MarkHidden("export-dir")
+	// 周期性建立检查点时容器需保持运行
+	_ = flags.MarkHidden("leave-running")
+
+	flags.StringVar(&o.Store, "store", o.Store, "Directory of checkpoint store to save checkpoints to (required)")
+	flags.DurationVar(&o.Interval, "interval", o.Interval, "Interval between checkpoints")
+	flags.IntVar(&o.Keep, "keep", o.Keep, "Number of latest checkpoints to keep for each pod, 0 to keep all")
+	flags.IntVar(&o.Count, "count", o.Count, "Number of rounds to checkpoint before exiting, 0 to run until interrupted")
+}
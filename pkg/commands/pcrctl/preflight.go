@@ -0,0 +1,76 @@
+package pcrctl
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yhlooo/podmig/pkg/commands/pcrctl/options"
+	podcrcommon "github.com/yhlooo/podmig/pkg/podcr/common"
+	podcrcontianerd "github.com/yhlooo/podmig/pkg/podcr/containerd"
+)
+
+// NewPreflightCommandWithOptions 基于选项创建 preflight 子命令
+func NewPreflightCommandWithOptions(opts *options.PreflightOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "preflight FILE",
+		Short: "Check compatibility between checkpoint and this node",
+		Long:  "Check compatibility between checkpoint and this node. Read checkpoint from stdin if FILE is \"-\".",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch opts.ContainerRuntime {
+			case "containerd":
+			default:
+				return fmt.Errorf("unsupported container runtime: %s", opts.ContainerRuntime)
+			}
+
+			ctx := cmd.Context()
+
+			// 打开检查点 tar 文件
+			importFile := args[0]
+			file, err := openImportFile(cmd, importFile)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = file.Close() }()
+			gzipR, err := gzip.NewReader(file)
+			if err != nil {
+				return fmt.Errorf("open gzip reader for import file %q error: %w", importFile, err)
+			}
+			defer func() { _ = gzipR.Close() }()
+			tr := tar.NewReader(gzipR)
+
+			// 准备还原管理器
+			var mgr podcrcommon.PodCRManager
+			switch opts.ContainerRuntime {
+			case "containerd":
+				mgr, err = podcrcontianerd.New(opts.ContainerRuntimeEndpoint, "", false)
+			}
+			if err != nil {
+				return fmt.Errorf("create pod restore manager error: %w", err)
+			}
+
+			// 检查兼容性
+			report, err := mgr.Preflight(ctx, tr)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			for _, issue := range report.Issues {
+				_, _ = fmt.Fprintf(out, "%-8s %s\n", issue.Severity, issue)
+			}
+			if blocking := report.Blocking(); len(blocking) > 0 {
+				return fmt.Errorf("%d blocking incompatibilities found", len(blocking))
+			}
+			_, _ = fmt.Fprintf(out, "checkpoint is compatible with this node (%d warnings)\n", len(report.Issues))
+			return nil
+		},
+	}
+
+	// 绑定选项到命令行参数
+	opts.AddPFlags(cmd.Flags())
+
+	return cmd
+}
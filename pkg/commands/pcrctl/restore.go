@@ -3,24 +3,37 @@ package pcrctl
 import (
 	"archive/tar"
 	"compress/gzip"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
 
 	"github.com/yhlooo/podmig/pkg/commands/pcrctl/options"
 	podcrcommon "github.com/yhlooo/podmig/pkg/podcr/common"
 	podcrcontianerd "github.com/yhlooo/podmig/pkg/podcr/containerd"
+	"github.com/yhlooo/podmig/pkg/podcr/events"
+	"github.com/yhlooo/podmig/pkg/podcr/metrics"
+	"github.com/yhlooo/podmig/pkg/podcr/network"
+	"github.com/yhlooo/podmig/pkg/utils/ioutil"
 )
 
 // NewRestoreCommandWithOptions 基于选项创建 restore 子命令
 func NewRestoreCommandWithOptions(opts *options.RestoreOptions) *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "restore",
+		Use:   "restore [FILE]",
 		Short: "Restore pod from checkpoint to node",
-		Args:  cobra.ExactArgs(1),
-		RunE: func(cmd *cobra.Command, args []string) error {
+		Long: "Restore pod from checkpoint to node. Read checkpoint from stdin if FILE is \"-\".\n\n" +
+			"With --latest, restore the latest valid checkpoint of --pod in --store instead, " +
+			"e.g. after the node the pod ran on failed. " +
+			"--store is a directory written by schedule, or a reference to an image whose layers are " +
+			"checkpoints titled by their paths in such a directory (e.g. pushed by oras). " +
+			"Refuse if the original pod is still running on this node or on a ready node in the cluster.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
 			switch opts.ContainerRuntime {
 			case "containerd":
 			default:
@@ -28,22 +41,105 @@ func NewRestoreCommandWithOptions(opts *options.RestoreOptions) *cobra.Command {
 			}
 
 			ctx := cmd.Context()
+			var importFile string
+			switch {
+			case opts.Latest && len(args) > 0:
+				return fmt.Errorf("FILE can not be specified with --latest")
+			case opts.Latest:
+				var cleanup func()
+				if importFile, cleanup, err = resolveLatestCheckpoint(ctx, opts); err != nil {
+					return err
+				}
+				defer cleanup()
+			case len(args) == 0:
+				return fmt.Errorf("FILE is required unless --latest is specified")
+			default:
+				importFile = args[0]
+			}
+			var imported *ioutil.CountingReader
+			if !opts.DryRun {
+				// 汇总进度事件，结束时输出最终结果
+				summarizer := events.NewSummarizer("restore", events.FromContextOrDiscard(ctx))
+				ctx = events.NewContext(ctx, summarizer)
+				defer func() {
+					summarizer.Finish(err, func(result *events.Result) {
+						result.ArchivePath = importFile
+						if imported != nil {
+							result.BytesImported = imported.Count()
+						}
+					})
+					if err == nil {
+						metrics.ArchiveSize.WithLabelValues(metrics.OperationRestore).Observe(float64(imported.Count()))
+					}
+				}()
+			}
 			logger := logr.FromContextOrDiscard(ctx)
 
+			// 解析资源限制覆盖
+			resources, err := parseContainerResources(opts.CPULimits, opts.MemoryLimits)
+			if err != nil {
+				return err
+			}
+			// 准备 IP 请求方式
+			var ipRequester podcrcommon.IPRequester
+			if opts.IPRequestAnnotation != "" {
+				ipRequester = network.NewAnnotationIPRequester(opts.IPRequestAnnotation)
+			}
+
 			// 打开导入 tar 文件
-			importFile := args[0]
-			file, err := os.Open(importFile)
+			file, err := openImportFile(cmd, importFile)
 			if err != nil {
-				return fmt.Errorf("open import file %q error: %w", importFile, err)
+				return err
 			}
 			defer func() { _ = file.Close() }()
-			gzipR, err := gzip.NewReader(file)
+			imported = ioutil.NewCountingReader(file)
+			gzipR, err := gzip.NewReader(imported)
 			if err != nil {
 				return fmt.Errorf("open gzip reader for import file %q error: %w", importFile, err)
 			}
 			defer func() { _ = gzipR.Close() }()
 			tr := tar.NewReader(gzipR)
 
+			restoreOpts := podcrcommon.RestoreOptions{
+				PodUID:               opts.PodUID,
+				PodName:              opts.Name,
+				PodNamespace:         opts.Namespace,
+				Hostname:             opts.Hostname,
+				Labels:               opts.Labels,
+				Annotations:          opts.Annotations,
+				Resources:            resources,
+				NetworkMode:          podcrcommon.NetworkMode(opts.NetworkMode),
+				IPRequester:          ipRequester,
+				RematerializeVolumes: opts.RematerializeVolumes,
+				VolumeWaitTimeout:    opts.VolumeWaitTimeout,
+				SkipPreflight:        opts.SkipPreflight,
+				Containers: podcrcommon.ContainerFilter{
+					Include: opts.Containers,
+					Exclude: opts.ExcludeContainers,
+				},
+				EphemeralContainers: opts.EphemeralContainers,
+			}
+
+			// 仅输出还原计划
+			if opts.DryRun {
+				// 计算还原计划不需要访问容器运行时
+				var mgr podcrcommon.PodCRManager
+				switch opts.ContainerRuntime {
+				case "containerd":
+					mgr = podcrcontianerd.NewWithClients("", false, nil, nil, nil, nil)
+				}
+				plan, err := mgr.PlanRestore(ctx, tr, restoreOpts)
+				if err != nil {
+					return err
+				}
+				if events.Enabled(ctx) {
+					// 输出 json 格式进度事件时，还原计划也作为事件输出，避免与事件混在同一输出中
+					events.Record(ctx, events.Event{Type: events.TypeRestorePlan, RestorePlan: plan})
+					return nil
+				}
+				return printRestorePlan(cmd.OutOrStdout(), plan)
+			}
+
 			// 准备还原管理器
 			var mgr podcrcommon.PodCRManager
 			switch opts.ContainerRuntime {
@@ -55,9 +151,7 @@ func NewRestoreCommandWithOptions(opts *options.RestoreOptions) *cobra.Command {
 			}
 
 			// 还原到检查点
-			if err := mgr.Restore(ctx, tr, podcrcommon.RestoreOptions{
-				PodUID: opts.PodUID,
-			}); err != nil {
+			if err := mgr.Restore(ctx, tr, restoreOpts); err != nil {
 				return err
 			}
 			logger.Info("restored")
@@ -71,3 +165,99 @@ func NewRestoreCommandWithOptions(opts *options.RestoreOptions) *cobra.Command {
 
 	return cmd
 }
+
+// openImportFile 打开检查点文件， name 为 - 时从标准输入读取
+func openImportFile(cmd *cobra.Command, name string) (io.ReadCloser, error) {
+	if name == stdioFileName {
+		return io.NopCloser(cmd.InOrStdin()), nil
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("open import file %q error: %w", name, err)
+	}
+	return file, nil
+}
+
+// parseContainerResources 解析以容器名为键的 CPU 和内存限制
+func parseContainerResources(cpuLimits, memoryLimits map[string]string) (
+	map[string]podcrcommon.ContainerResources,
+	error,
+) {
+	if len(cpuLimits) == 0 && len(memoryLimits) == 0 {
+		return nil, nil
+	}
+	ret := make(map[string]podcrcommon.ContainerResources)
+	for name, v := range cpuLimits {
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu limit %q for container %q: %w", v, name, err)
+		}
+		if q.Sign() < 0 {
+			return nil, fmt.Errorf("invalid cpu limit %q for container %q: must not be negative", v, name)
+		}
+		res := ret[name]
+		res.MilliCPU = q.MilliValue()
+		ret[name] = res
+	}
+	for name, v := range memoryLimits {
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory limit %q for container %q: %w", v, name, err)
+		}
+		if q.Sign() < 0 {
+			return nil, fmt.Errorf("invalid memory limit %q for container %q: must not be negative", v, name)
+		}
+		res := ret[name]
+		res.MemoryBytes = q.Value()
+		ret[name] = res
+	}
+	return ret, nil
+}
+
+// printRestorePlan 输出还原计划
+func printRestorePlan(w io.Writer, plan *podcrcommon.RestorePlan) error {
+	sandboxConfig, err := json.MarshalIndent(plan.SandboxConfig, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal sandbox config to json error: %w", err)
+	}
+
+	p := func(format string, a ...interface{}) {
+		_, _ = fmt.Fprintf(w, format+"\n", a...)
+	}
+	p("Sandbox config:")
+	p("%s", sandboxConfig)
+	p("Network mode: %s", plan.NetworkMode)
+	if len(plan.RequestIPs) > 0 {
+		p("Pod IPs to request: %v", plan.RequestIPs)
+	}
+	p("Images to import:")
+	for _, img := range plan.Images {
+		p("  %s", img)
+	}
+	p("Containers to restore:")
+	for _, c := range plan.Containers {
+		switch {
+		case c.Exited:
+			p("  %s (exited with code %d, not rerun)", c.Name, c.ExitCode)
+		case c.CheckpointImage == "":
+			p("  %s (recreate from %s):", c.Name, c.Image)
+		default:
+			p("  %s (%s):", c.Name, c.CheckpointImage)
+		}
+		for _, change := range c.SpecChanges {
+			p("    %s", change)
+		}
+	}
+	p("Files to write:")
+	conflicts := 0
+	for _, f := range plan.Files {
+		if f.Conflict == "" {
+			p("  %s %10d %s", f.Mode, f.Size, f.Path)
+			continue
+		}
+		conflicts++
+		p("  %s %10d %s (CONFLICT: %s)", f.Mode, f.Size, f.Path, f.Conflict)
+	}
+	p("%d files, %d conflicts", len(plan.Files), conflicts)
+	return nil
+}
@@ -0,0 +1,263 @@
+package pcrctl
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	refdocker "github.com/containerd/containerd/reference/docker"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/yhlooo/podmig/pkg/commands/pcrctl/options"
+	podcrcommon "github.com/yhlooo/podmig/pkg/podcr/common"
+	podcrcontianerd "github.com/yhlooo/podmig/pkg/podcr/containerd"
+	"github.com/yhlooo/podmig/pkg/podcr/store"
+)
+
+// resolveLatestCheckpoint 查找 --pod 在 --store 中最新的有效检查点，并确认原 Pod 没有在运行
+//
+// 返回检查点文件路径，以及还原结束后清理下载的检查点的函数
+func resolveLatestCheckpoint(ctx context.Context, opts *options.RestoreOptions) (string, func(), error) {
+	logger := logr.FromContextOrDiscard(ctx)
+	if opts.Pod == "" {
+		return "", nil, fmt.Errorf("--pod is required with --latest")
+	}
+	if opts.Store == "" {
+		return "", nil, fmt.Errorf("--store is required with --latest")
+	}
+	pod, err := parsePodKey(opts.Pod)
+	if err != nil {
+		return "", nil, err
+	}
+	st, cleanup, err := openCheckpointStore(opts.Store)
+	if err != nil {
+		return "", nil, err
+	}
+
+	entry, err := findLatestCheckpoint(ctx, st, pod)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	logger.Info(fmt.Sprintf(
+		"latest valid checkpoint of pod %q: %s (created at %s)",
+		pod, entry.Path, entry.CreatedAt.Format(time.RFC3339),
+	))
+
+	// 原 Pod 仍在运行时还原会出现两个相同的 Pod
+	// 仅输出还原计划时不会还原，不检查
+	if !opts.DryRun {
+		mgr, client, err := newPodRunningCheckClients(opts)
+		if err == nil {
+			err = checkPodNotRunning(ctx, mgr, client, pod)
+		}
+		if err != nil {
+			cleanup()
+			return "", nil, fmt.Errorf("refuse to restore: %w", err)
+		}
+	}
+	return entry.Path, cleanup, nil
+}
+
+// checkpointStore 可列出和校验 Pod 检查点的存储
+type checkpointStore interface {
+	// List 列出 Pod 的检查点，按建立时间从早到晚排序
+	List(ctx context.Context, pod podcrcommon.PodKey) ([]store.Entry, error)
+	// Verify 校验检查点完整，通过后检查点文件可以读取
+	Verify(ctx context.Context, entry *store.Entry) error
+}
+
+// dirStore 基于目录的检查点存储
+type dirStore struct {
+	*store.Store
+}
+
+var _ checkpointStore = dirStore{}
+var _ checkpointStore = &store.Remote{}
+
+// List 列出 Pod 的检查点，按建立时间从早到晚排序
+func (s dirStore) List(_ context.Context, pod podcrcommon.PodKey) ([]store.Entry, error) {
+	return s.Store.List(pod)
+}
+
+// Verify 校验检查点文件完整
+func (s dirStore) Verify(_ context.Context, entry *store.Entry) error {
+	return s.Store.Verify(entry)
+}
+
+// openCheckpointStore 打开 --store 指定的检查点存储
+//
+// 存在的目录作为 schedule 写入的目录存储，否则作为镜像引用，从镜像仓库下载检查点到临时目录。
+// 返回清理临时目录的函数
+func openCheckpointStore(s string) (checkpointStore, func(), error) {
+	info, err := os.Stat(s)
+	switch {
+	case err == nil && info.IsDir():
+		return dirStore{Store: store.New(s)}, func() {}, nil
+	case err == nil:
+		return nil, nil, fmt.Errorf("store %q is neither a directory nor an image reference", s)
+	case !os.IsNotExist(err):
+		return nil, nil, fmt.Errorf("stat store %q error: %w", s, err)
+	}
+
+	ref, err := refdocker.ParseDockerRef(s)
+	if err != nil {
+		return nil, nil, fmt.Errorf(
+			"store %q is neither an existing directory nor a valid image reference: %w", s, err,
+		)
+	}
+	dir, err := os.MkdirTemp("", "pcrctl-store-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("make temp dir error: %w", err)
+	}
+	return store.NewRemote(ref.String(), newStoreResolver(), dir), func() { _ = os.RemoveAll(dir) }, nil
+}
+
+// newStoreResolver 创建从镜像仓库读取检查点存储使用的解析器
+//
+// 匿名访问镜像仓库， localhost 上的镜像仓库使用 HTTP 。测试时替换为模拟的解析器
+var newStoreResolver = func() remotes.Resolver {
+	return docker.NewResolver(docker.ResolverOptions{})
+}
+
+// parsePodKey 解析 namespace/name 格式的 Pod
+func parsePodKey(s string) (podcrcommon.PodKey, error) {
+	namespace, name, ok := strings.Cut(s, "/")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return podcrcommon.PodKey{}, fmt.Errorf("invalid pod %q, must be NAMESPACE/NAME", s)
+	}
+	return podcrcommon.PodKey{Namespace: namespace, Name: name}, nil
+}
+
+// findLatestCheckpoint 查找存储中 Pod 最新的有效检查点
+//
+// 从新到旧逐个校验，跳过损坏的检查点，全部无效时返回 store.ErrNotFound
+func findLatestCheckpoint(ctx context.Context, st checkpointStore, pod podcrcommon.PodKey) (*store.Entry, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+	entries, err := st.List(ctx, pod)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := &entries[i]
+		if err := st.Verify(ctx, entry); err != nil {
+			logger.Error(err, "skip invalid checkpoint")
+			continue
+		}
+		return entry, nil
+	}
+	return nil, fmt.Errorf("%w: no valid checkpoint of pod %q in %d checkpoints", store.ErrNotFound, pod, len(entries))
+}
+
+// newPodRunningCheckClients 创建检查原 Pod 是否仍在运行使用的 Pod 检查点还原管理器和 Kubernetes 客户端
+//
+// 测试时替换为使用模拟容器运行时的管理器和模拟的客户端
+var newPodRunningCheckClients = func(
+	opts *options.RestoreOptions,
+) (podcrcommon.PodCRManager, kubernetes.Interface, error) {
+	var mgr podcrcommon.PodCRManager
+	var err error
+	switch opts.ContainerRuntime {
+	case "containerd":
+		mgr, err = podcrcontianerd.New(opts.ContainerRuntimeEndpoint, "", false)
+	default:
+		err = fmt.Errorf("unsupported container runtime: %s", opts.ContainerRuntime)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("create pod checkpoint manager error: %w", err)
+	}
+	config, err := loadKubeconfig(opts.Kubeconfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load kubeconfig for checking whether pod is running error: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create kubernetes client error: %w", err)
+	}
+	return mgr, client, nil
+}
+
+// checkPodNotRunning 检查原 Pod 没有在本节点或集群中的其它节点上运行
+//
+// 原 Pod 所在节点未就绪时无法确认 Pod 已停止，仅输出警告
+func checkPodNotRunning(
+	ctx context.Context,
+	mgr podcrcommon.PodCRManager,
+	client kubernetes.Interface,
+	pod podcrcommon.PodKey,
+) error {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	// 检查本节点
+	localPods, err := mgr.ListPods(ctx, pod.Namespace, labels.Everything())
+	if err != nil {
+		return fmt.Errorf("list pods on node error: %w", err)
+	}
+	for _, p := range localPods {
+		if p == pod {
+			return fmt.Errorf("pod %q is still running on this node", pod)
+		}
+	}
+
+	// 检查集群
+	obj, err := client.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return nil
+	case err != nil:
+		return fmt.Errorf("get pod %q error: %w", pod, err)
+	}
+	switch {
+	case obj.Status.Phase == corev1.PodSucceeded, obj.Status.Phase == corev1.PodFailed:
+		return nil
+	case obj.Spec.NodeName == "":
+		// 尚未调度，如控制器重建的同名 Pod
+		return nil
+	}
+	node, err := client.CoreV1().Nodes().Get(ctx, obj.Spec.NodeName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		logger.Info(fmt.Sprintf("node %q of pod %q not found, assume the pod is no longer running", obj.Spec.NodeName, pod))
+		return nil
+	case err != nil:
+		return fmt.Errorf("get node %q error: %w", obj.Spec.NodeName, err)
+	}
+	if isNodeReady(node) {
+		return fmt.Errorf("pod %q is still %s on ready node %q", pod, obj.Status.Phase, obj.Spec.NodeName)
+	}
+	logger.Info(fmt.Sprintf(
+		"node %q of pod %q is not ready, make sure the pod is no longer running there",
+		obj.Spec.NodeName, pod,
+	))
+	return nil
+}
+
+// loadKubeconfig 加载访问 Kubernetes 集群的配置
+//
+// path 为空时依次使用 $KUBECONFIG 、 ~/.kube/config 和集群内配置
+func loadKubeconfig(path string) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = path
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+}
+
+// isNodeReady 判断节点是否就绪
+func isNodeReady(node *corev1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
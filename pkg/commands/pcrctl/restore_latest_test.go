@@ -0,0 +1,359 @@
+package pcrctl
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	podcrcommon "github.com/yhlooo/podmig/pkg/podcr/common"
+	podcrcontianerd "github.com/yhlooo/podmig/pkg/podcr/containerd"
+	"github.com/yhlooo/podmig/pkg/podcr/containerd/fake"
+	"github.com/yhlooo/podmig/pkg/podcr/store"
+)
+
+// TestLoadKubeconfig 测试未指定 kubeconfig 文件时使用 $KUBECONFIG ，指定时优先使用指定的文件
+func TestLoadKubeconfig(t *testing.T) {
+	dir := t.TempDir()
+	writeKubeconfig := func(name, server string) string {
+		path := filepath.Join(dir, name)
+		content := "apiVersion: v1\nkind: Config\n" +
+			"clusters:\n- name: c\n  cluster:\n    server: " + server + "\n" +
+			"users:\n- name: u\n  user: {}\n" +
+			"contexts:\n- name: c\n  context:\n    cluster: c\n    user: u\n" +
+			"current-context: c\n"
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("write kubeconfig error: %v", err)
+		}
+		return path
+	}
+	t.Setenv("KUBECONFIG", writeKubeconfig("env", "https://env.example.com:6443"))
+	explicit := writeKubeconfig("explicit", "https://explicit.example.com:6443")
+
+	cases := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{name: "Env", path: "", expected: "https://env.example.com:6443"},
+		{name: "Explicit", path: explicit, expected: "https://explicit.example.com:6443"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config, err := loadKubeconfig(c.path)
+			if err != nil {
+				t.Fatalf("load kubeconfig error: %v", err)
+			}
+			if config.Host != c.expected {
+				t.Errorf("expected host %q, got %q", c.expected, config.Host)
+			}
+		})
+	}
+}
+
+// memoryResolver 从内存中解析镜像的 remotes.Resolver ，模拟保存检查点的镜像仓库
+type memoryResolver struct {
+	ref   string
+	desc  ocispec.Descriptor
+	blobs map[digest.Digest][]byte
+}
+
+var _ remotes.Resolver = &memoryResolver{}
+
+// newMemoryResolver 创建一个 *memoryResolver ，镜像 ref 的每一层为一个以 titles 为标题、 layers 为内容的检查点
+func newMemoryResolver(t *testing.T, ref string, titles []string, layers [][]byte) *memoryResolver {
+	r := &memoryResolver{ref: ref, blobs: map[digest.Digest][]byte{}}
+	add := func(mediaType string, data []byte, annotations map[string]string) ocispec.Descriptor {
+		desc := ocispec.Descriptor{
+			MediaType:   mediaType,
+			Digest:      digest.FromBytes(data),
+			Size:        int64(len(data)),
+			Annotations: annotations,
+		}
+		r.blobs[desc.Digest] = data
+		return desc
+	}
+	manifest := ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    add(ocispec.MediaTypeImageConfig, []byte("{}"), nil),
+	}
+	for i, title := range titles {
+		manifest.Layers = append(manifest.Layers, add(
+			"application/vnd.oci.image.layer.v1.tar+gzip", layers[i],
+			map[string]string{ocispec.AnnotationTitle: title},
+		))
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("marshal manifest error: %v", err)
+	}
+	r.desc = add(ocispec.MediaTypeImageManifest, data, nil)
+	return r
+}
+
+// Resolve 解析镜像引用
+func (r *memoryResolver) Resolve(_ context.Context, ref string) (string, ocispec.Descriptor, error) {
+	if ref != r.ref {
+		return "", ocispec.Descriptor{}, fmt.Errorf("%s: %w", ref, errdefs.ErrNotFound)
+	}
+	return ref, r.desc, nil
+}
+
+// Fetcher 返回从内存中读取内容的 remotes.Fetcher
+func (r *memoryResolver) Fetcher(context.Context, string) (remotes.Fetcher, error) {
+	return remotes.FetcherFunc(func(_ context.Context, desc ocispec.Descriptor) (io.ReadCloser, error) {
+		data, ok := r.blobs[desc.Digest]
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", desc.Digest, errdefs.ErrNotFound)
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}), nil
+}
+
+// Pusher 不支持推送
+func (r *memoryResolver) Pusher(context.Context, string) (remotes.Pusher, error) {
+	return nil, errdefs.ErrNotImplemented
+}
+
+// testCheckpointArchive 返回一个内容为 content 的 gzip 压缩的 tar 检查点文件
+func testCheckpointArchive(t *testing.T, content string) []byte {
+	buf := &bytes.Buffer{}
+	gzipW := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gzipW)
+	if err := tw.WriteHeader(&tar.Header{Name: "pod.json", Mode: 0o644, Size: int64(len(content))}); err != nil {
+		t.Fatalf("write tar header error: %v", err)
+	}
+	if _, err := tw.Write([]byte(content)); err != nil {
+		t.Fatalf("write tar error: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar writer error: %v", err)
+	}
+	if err := gzipW.Close(); err != nil {
+		t.Fatalf("close gzip writer error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestFindLatestCheckpoint 测试从目录存储和镜像中查找最新的有效检查点时跳过损坏的检查点
+func TestFindLatestCheckpoint(t *testing.T) {
+	pod := podcrcommon.PodKey{Namespace: "default", Name: "web-0"}
+	other := podcrcommon.PodKey{Namespace: "default", Name: "web-1"}
+	valid := testCheckpointArchive(t, "valid")
+	// 较新的检查点写入中断
+	corrupt := valid[:len(valid)/2]
+	checkpoints := []struct {
+		pod          podcrcommon.PodKey
+		checkpointID string
+		createdAt    time.Time
+		content      []byte
+	}{
+		{pod: pod, checkpointID: "old", createdAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), content: valid},
+		{pod: pod, checkpointID: "new", createdAt: time.Date(2024, 1, 1, 0, 5, 0, 0, time.UTC), content: corrupt},
+		{pod: other, checkpointID: "other", createdAt: time.Date(2024, 1, 1, 0, 10, 0, 0, time.UTC), content: valid},
+	}
+
+	orig := newStoreResolver
+	defer func() { newStoreResolver = orig }()
+
+	cases := []struct {
+		name  string
+		store func(t *testing.T) string
+	}{
+		{
+			name: "Directory",
+			store: func(t *testing.T) string {
+				dir := t.TempDir()
+				st := store.New(dir)
+				for _, c := range checkpoints {
+					_, err := st.Put(c.pod, c.checkpointID, c.createdAt, func(path string) error {
+						return os.WriteFile(path, c.content, 0o644)
+					})
+					if err != nil {
+						t.Fatalf("put checkpoint error: %v", err)
+					}
+				}
+				return dir
+			},
+		},
+		{
+			name: "ImageReference",
+			store: func(t *testing.T) string {
+				ref := "registry.example.com/checkpoints:latest"
+				var titles []string
+				var layers [][]byte
+				for _, c := range checkpoints {
+					titles = append(titles, path.Join(
+						c.pod.Namespace, c.pod.Name,
+						c.createdAt.Format("20060102T150405Z")+"_"+c.checkpointID+".tar.gz",
+					))
+					layers = append(layers, c.content)
+				}
+				newStoreResolver = func() remotes.Resolver {
+					return newMemoryResolver(t, "registry.example.com/checkpoints:latest", titles, layers)
+				}
+				return ref
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			st, cleanup, err := openCheckpointStore(c.store(t))
+			if err != nil {
+				t.Fatalf("open checkpoint store error: %v", err)
+			}
+			defer cleanup()
+
+			entry, err := findLatestCheckpoint(context.Background(), st, pod)
+			if err != nil {
+				t.Fatalf("find latest checkpoint error: %v", err)
+			}
+			if entry.CheckpointID != "old" {
+				t.Errorf("expected latest valid checkpoint %q, got %q", "old", entry.CheckpointID)
+			}
+			data, err := os.ReadFile(entry.Path)
+			if err != nil {
+				t.Fatalf("read checkpoint error: %v", err)
+			}
+			if !bytes.Equal(data, valid) {
+				t.Errorf("unexpected content of checkpoint %q", entry.Path)
+			}
+
+			_, err = findLatestCheckpoint(context.Background(), st, podcrcommon.PodKey{Namespace: "default", Name: "web-2"})
+			if !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("expected %v for pod without checkpoints, got %v", store.ErrNotFound, err)
+			}
+		})
+	}
+}
+
+// TestOpenCheckpointStore 测试 --store 为目录时使用目录存储，不存在时作为镜像引用，为文件或无效引用时报错
+func TestOpenCheckpointStore(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatalf("write file error: %v", err)
+	}
+
+	cases := []struct {
+		name        string
+		store       string
+		expectedErr string
+		expectImage bool
+	}{
+		{name: "Directory", store: dir},
+		{name: "ImageReference", store: "registry.example.com/checkpoints:latest", expectImage: true},
+		{name: "File", store: file, expectedErr: "neither a directory nor an image reference"},
+		{
+			name:        "InvalidReference",
+			store:       filepath.Join(dir, "NotExists"),
+			expectedErr: "neither an existing directory nor a valid image reference",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			st, cleanup, err := openCheckpointStore(c.store)
+			if c.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.expectedErr) {
+					t.Fatalf("expected error containing %q, got %v", c.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("open checkpoint store error: %v", err)
+			}
+			defer cleanup()
+			if _, ok := st.(*store.Remote); ok != c.expectImage {
+				t.Errorf("expected image store %t, got %T", c.expectImage, st)
+			}
+		})
+	}
+}
+
+// TestCheckPodNotRunning 测试原 Pod 在本节点或就绪节点上运行时拒绝还原，不存在、未调度或所在节点未就绪时允许还原
+func TestCheckPodNotRunning(t *testing.T) {
+	ctx := context.Background()
+	cri := fake.NewRuntimeService()
+	backend := fake.NewBackend()
+	kubeletRootDir := t.TempDir()
+	runFakePod(t, ctx, cri, backend, kubeletRootDir, podcrcommon.PodKey{Namespace: "default", Name: "local-0"})
+	mgr := podcrcontianerd.NewWithClients(
+		t.TempDir(), false, cri, backend, backend, backend,
+		podcrcontianerd.WithKubeletRootDir(kubeletRootDir),
+	)
+
+	newNode := func(name string, ready corev1.ConditionStatus) *corev1.Node {
+		return &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: corev1.NodeStatus{
+				Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}},
+			},
+		}
+	}
+	newPod := func(name, nodeName string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec:       corev1.PodSpec{NodeName: nodeName},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+	client := kubefake.NewSimpleClientset(
+		newNode("node-ready", corev1.ConditionTrue),
+		newNode("node-not-ready", corev1.ConditionUnknown),
+		newPod("running-0", "node-ready", corev1.PodRunning),
+		newPod("pending-0", "node-ready", corev1.PodPending),
+		newPod("unscheduled-0", "", corev1.PodPending),
+		newPod("lost-0", "node-not-ready", corev1.PodRunning),
+		newPod("orphan-0", "node-deleted", corev1.PodRunning),
+		newPod("failed-0", "node-ready", corev1.PodFailed),
+	)
+
+	cases := []struct {
+		name        string
+		pod         string
+		expectedErr string
+	}{
+		{name: "RunningOnThisNode", pod: "local-0", expectedErr: "still running on this node"},
+		{name: "RunningOnReadyNode", pod: "running-0", expectedErr: "still Running on ready node"},
+		{name: "PendingOnReadyNode", pod: "pending-0", expectedErr: "still Pending on ready node"},
+		{name: "Unscheduled", pod: "unscheduled-0"},
+		{name: "NodeNotReady", pod: "lost-0"},
+		{name: "NodeNotFound", pod: "orphan-0"},
+		{name: "Failed", pod: "failed-0"},
+		{name: "Missing", pod: "missing-0"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := checkPodNotRunning(ctx, mgr, client, podcrcommon.PodKey{Namespace: "default", Name: c.pod})
+			if c.expectedErr == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.expectedErr) {
+				t.Errorf("expected error containing %q, got %v", c.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package pcrctl
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/yhlooo/podmig/pkg/commands/pcrctl/options"
+	podcrcommon "github.com/yhlooo/podmig/pkg/podcr/common"
+	podcrcontianerd "github.com/yhlooo/podmig/pkg/podcr/containerd"
+)
+
+// NewResumeCommandWithOptions 基于选项创建 resume 子命令
+func NewResumeCommandWithOptions(opts *options.ResumeOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "resume POD",
+		Short: "Resume paused containers of a pod on node",
+		Long: "Resume paused containers of a pod on node, " +
+			"e.g. containers left paused by checkpoint --leave-running=false after the migration failed.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			logger := logr.FromContextOrDiscard(ctx)
+
+			var mgr podcrcommon.PodCRManager
+			var err error
+			switch opts.ContainerRuntime {
+			case "containerd":
+				mgr, err = podcrcontianerd.New(opts.ContainerRuntimeEndpoint, "", false)
+			default:
+				return fmt.Errorf("unsupported container runtime: %s", opts.ContainerRuntime)
+			}
+			if err != nil {
+				return fmt.Errorf("create pod manager error: %w", err)
+			}
+
+			if err := mgr.Resume(ctx, opts.Namespace, args[0]); err != nil {
+				return err
+			}
+			logger.Info("resumed")
+			return nil
+		},
+	}
+
+	// 绑定选项到命令行参数
+	opts.AddPFlags(cmd.Flags())
+
+	return cmd
+}
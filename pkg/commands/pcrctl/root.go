@@ -1,11 +1,17 @@
 package pcrctl
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"os"
 
 	"github.com/spf13/cobra"
 
 	"github.com/yhlooo/podmig/pkg/commands/pcrctl/options"
+	"github.com/yhlooo/podmig/pkg/podcr/events"
+	"github.com/yhlooo/podmig/pkg/podcr/metrics"
+	"github.com/yhlooo/podmig/pkg/podcr/tracing"
 	"github.com/yhlooo/podmig/pkg/utils/cmdutil"
 )
 
@@ -16,6 +22,7 @@ func NewRootCommand() *cobra.Command {
 
 // NewRootCommandWithOptions  使用指定选项创建一个 pcrctl 命令
 func NewRootCommandWithOptions(opts options.Options) *cobra.Command {
+	var eventsFile *os.File
 	cmd := &cobra.Command{
 		Use:          "pcrctl",
 		Short:        "Checkpoint/Restore kubernetes pod on node",
@@ -29,8 +36,65 @@ func NewRootCommandWithOptions(opts options.Options) *cobra.Command {
 			logger := cmdutil.SetLogger(cmd, opts.Global.Verbosity)
 
 			logger.V(1).Info(fmt.Sprintf("command: %q, args: %#v, options: %#v", cmd.Name(), args, opts))
+
+			// 设置进度事件输出
+			if opts.Global.Output == options.OutputJSON {
+				if opts.Global.OutputFile == "" && stdoutCarriesData(cmd, opts) {
+					return fmt.Errorf(
+						"--output %s without --output-file can not be used when writing checkpoint to stdout",
+						options.OutputJSON,
+					)
+				}
+				var w io.Writer = cmd.OutOrStdout()
+				if opts.Global.OutputFile != "" {
+					var err error
+					eventsFile, err = os.Create(opts.Global.OutputFile)
+					if err != nil {
+						return fmt.Errorf("create output file %q error: %w", opts.Global.OutputFile, err)
+					}
+					w = eventsFile
+				}
+				cmd.SetContext(events.NewContext(cmd.Context(), events.NewJSONRecorder(w)))
+			}
+
+			// 暴露指标
+			if opts.Global.MetricsAddress != "" {
+				if err := metrics.Serve(cmd.Context(), opts.Global.MetricsAddress); err != nil {
+					return fmt.Errorf("serve metrics on %q error: %w", opts.Global.MetricsAddress, err)
+				}
+			}
+			if opts.Global.MetricsTextfile != "" {
+				// 命令失败时也需要写入
+				cobra.OnFinalize(func() {
+					if err := metrics.WriteTextfile(opts.Global.MetricsTextfile); err != nil {
+						logger.Error(err, fmt.Sprintf("write metrics to file %q error", opts.Global.MetricsTextfile))
+					}
+				})
+			}
+
+			// 导出 trace
+			if opts.Global.TracingEnabled() {
+				shutdown, err := tracing.Setup(cmd.Context(), tracing.Options{
+					Endpoint: opts.Global.OTLPEndpoint,
+					Insecure: opts.Global.OTLPInsecure,
+				})
+				if err != nil {
+					return fmt.Errorf("setup tracing error: %w", err)
+				}
+				// 命令结束时导出剩余的 span
+				cobra.OnFinalize(func() {
+					if err := shutdown(context.Background()); err != nil {
+						logger.Error(err, "shutdown tracing error")
+					}
+				})
+			}
 			return nil
 		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			if eventsFile != nil {
+				_ = eventsFile.Close()
+			}
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return cmd.Help()
 		},
@@ -43,7 +107,15 @@ func NewRootCommandWithOptions(opts options.Options) *cobra.Command {
 	cmd.AddCommand(
 		NewCheckpointCommandWithOptions(&opts.Checkpoint),
 		NewRestoreCommandWithOptions(&opts.Restore),
+		NewPreflightCommandWithOptions(&opts.Preflight),
+		NewScheduleCommandWithOptions(&opts.Schedule),
+		NewResumeCommandWithOptions(&opts.Resume),
 	)
 
 	return cmd
 }
+
+// stdoutCarriesData 命令是否将检查点数据写入标准输出，此时标准输出不能再输出进度事件
+func stdoutCarriesData(cmd *cobra.Command, opts options.Options) bool {
+	return cmd.Name() == "checkpoint" && opts.Checkpoint.ExportFile == stdioFileName
+}
@@ -0,0 +1,62 @@
+package pcrctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yhlooo/podmig/pkg/podcr/events"
+)
+
+// fixtureArchive 测试使用的检查点归档
+var fixtureArchive = filepath.Join("..", "..", "podcr", "containerd", "testdata", "archives", "v1.tar.gz")
+
+// runCommand 以 args 运行 pcrctl 命令，返回标准输出
+func runCommand(t *testing.T, args ...string) (string, error) {
+	cmd := NewRootCommand()
+	stdout := &bytes.Buffer{}
+	cmd.SetOut(stdout)
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs(args)
+	err := cmd.ExecuteContext(context.Background())
+	return stdout.String(), err
+}
+
+// TestJSONOutputWithStdoutExport 测试检查点写入标准输出时拒绝将 json 进度事件也输出到标准输出
+func TestJSONOutputWithStdoutExport(t *testing.T) {
+	_, err := runCommand(t, "checkpoint", "web-0", "--export", "-", "-o", "json")
+	if err == nil || !strings.Contains(err.Error(), "--output-file") {
+		t.Errorf("expected --output-file required error, got %v", err)
+	}
+}
+
+// TestRestoreDryRunJSON 测试输出 json 格式进度事件时还原计划作为事件输出
+func TestRestoreDryRunJSON(t *testing.T) {
+	stdout, err := runCommand(t, "restore", fixtureArchive, "--dry-run", "--pod-uid", "test-uid", "-o", "json")
+	if err != nil {
+		t.Fatalf("restore dry-run error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	var plan *events.Event
+	for _, line := range lines {
+		event := &events.Event{}
+		if err := json.Unmarshal([]byte(line), event); err != nil {
+			t.Fatalf("stdout line %q is not a json event: %v", line, err)
+		}
+		if event.Type == events.TypeRestorePlan {
+			plan = event
+		}
+	}
+	if plan == nil || plan.RestorePlan == nil {
+		t.Fatalf("restore plan event not found in stdout:\n%s", stdout)
+	}
+	if len(plan.RestorePlan.Containers) != 1 || plan.RestorePlan.Containers[0].Name != "app" {
+		t.Errorf("unexpected containers in restore plan: %+v", plan.RestorePlan.Containers)
+	}
+	if got := plan.RestorePlan.SandboxConfig.GetMetadata().GetUid(); got != "test-uid" {
+		t.Errorf("expected planned pod uid %q, got %q", "test-uid", got)
+	}
+}
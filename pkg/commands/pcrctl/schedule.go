@@ -0,0 +1,183 @@
+package pcrctl
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/yhlooo/podmig/pkg/commands/pcrctl/options"
+	podcrcommon "github.com/yhlooo/podmig/pkg/podcr/common"
+	"github.com/yhlooo/podmig/pkg/podcr/events"
+	"github.com/yhlooo/podmig/pkg/podcr/metrics"
+	"github.com/yhlooo/podmig/pkg/podcr/store"
+	"github.com/yhlooo/podmig/pkg/utils/randutil"
+)
+
+// NewScheduleCommandWithOptions 基于选项创建 schedule 子命令
+func NewScheduleCommandWithOptions(opts *options.ScheduleOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schedule [POD]",
+		Short: "Checkpoint running pods on node periodically",
+		Long: "Checkpoint running pods on node periodically to a checkpoint store, keeping the latest ones.\n\n" +
+			"Pods keep running after each checkpoint. With --selector or --all-namespaces, " +
+			"matching pods are listed again in each round. " +
+			"Each checkpoint is a full dump, as containerd does not support dumping on top of a parent checkpoint. " +
+			"When interrupted, pods paused by checkpoints in progress are resumed and no partial checkpoint is kept.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Store == "" {
+				return fmt.Errorf("--store is required")
+			}
+			if opts.Interval <= 0 {
+				return fmt.Errorf("interval must be positive, got %s", opts.Interval)
+			}
+			if opts.Keep < 0 {
+				return fmt.Errorf("keep must not be negative, got %d", opts.Keep)
+			}
+			if opts.Concurrency < 1 {
+				return fmt.Errorf("concurrency must be positive, got %d", opts.Concurrency)
+			}
+			batch := opts.Selector != "" || opts.AllNamespaces
+			switch {
+			case batch && len(args) > 0:
+				return fmt.Errorf("POD can not be specified with --selector or --all-namespaces")
+			case !batch && len(args) == 0:
+				return fmt.Errorf("POD is required unless --selector or --all-namespaces is specified")
+			}
+			if !opts.LeaveRunning {
+				return fmt.Errorf("--leave-running=false can not be used with schedule")
+			}
+			checkpointOpts, err := newCheckpointOptions(&opts.CheckpointOptions)
+			if err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			logger := logr.FromContextOrDiscard(ctx)
+			st := store.New(opts.Store)
+			listPods := func(ctx context.Context) ([]podcrcommon.PodKey, error) {
+				if batch {
+					return listMatchedPods(ctx, &opts.CheckpointOptions)
+				}
+				return []podcrcommon.PodKey{{Namespace: opts.Namespace, Name: args[0]}}, nil
+			}
+
+			ticker := time.NewTicker(opts.Interval)
+			defer ticker.Stop()
+			failedRounds := 0
+			for round := 1; ; round++ {
+				logger.Info(fmt.Sprintf("checkpoint round %d", round))
+				if err := scheduleRound(ctx, opts, checkpointOpts, st, listPods); err != nil {
+					logger.Error(err, fmt.Sprintf("checkpoint round %d error", round))
+					failedRounds++
+				}
+				if opts.Count > 0 && round >= opts.Count {
+					break
+				}
+				// 等待下一轮，耗时超过间隔时跳过错过的轮次
+				select {
+				case <-ctx.Done():
+					logger.Info("stopped")
+					return nil
+				case <-ticker.C:
+				}
+			}
+			if failedRounds > 0 {
+				return fmt.Errorf("%d of %d checkpoint rounds failed", failedRounds, opts.Count)
+			}
+			return nil
+		},
+	}
+
+	// 绑定选项到命令行参数
+	opts.AddPFlags(cmd.Flags())
+
+	return cmd
+}
+
+// scheduleRound 为 Pod 建立检查点并写入存储，然后按保留数清理旧的检查点
+//
+// 单个 Pod 失败不影响其它 Pod ，也不清理该 Pod 的旧检查点
+func scheduleRound(
+	ctx context.Context,
+	opts *options.ScheduleOptions,
+	checkpointOpts podcrcommon.CheckpointOptions,
+	st *store.Store,
+	listPods func(ctx context.Context) ([]podcrcommon.PodKey, error),
+) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	pods, err := listPods(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		logger.Info("no running pods matched")
+		return nil
+	}
+
+	start := time.Now()
+	recorder := events.FromContextOrDiscard(ctx)
+	succeeded := make([]bool, len(pods))
+	eg := &errgroup.Group{}
+	eg.SetLimit(opts.Concurrency)
+	for i, pod := range pods {
+		if ctx.Err() != nil {
+			// 已取消，不再开始新的 Pod
+			break
+		}
+		podCtx := events.NewContext(ctx, events.WithPod(recorder, pod.String()))
+		eg.Go(func() error {
+			checkpointID := randutil.NewRand().LowerAlphaNumN(8)
+			entry, err := st.Put(pod, checkpointID, time.Now(), func(path string) error {
+				_, err := checkpointPod(podCtx, &opts.CheckpointOptions, checkpointOpts, pod, checkpointID, path, nil)
+				return err
+			})
+			if err != nil {
+				logger.Info(fmt.Sprintf("checkpoint pod %q failed: %v", pod, err))
+				return nil
+			}
+			succeeded[i] = true
+			logger.Info(fmt.Sprintf("checkpointed pod %q: %s", pod, entry.Path))
+
+			// 清理旧的检查点
+			if opts.Keep == 0 {
+				return nil
+			}
+			removed, err := st.Prune(pod, opts.Keep)
+			for _, entry := range removed {
+				logger.V(1).Info(fmt.Sprintf("removed old checkpoint of pod %q: %s", pod, entry.Path))
+			}
+			if err != nil {
+				logger.Error(err, fmt.Sprintf("prune checkpoints of pod %q error", pod))
+			}
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	// 汇总结果
+	batchResult := events.BatchResult{
+		Operation:  metrics.OperationCheckpoint,
+		Total:      len(pods),
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	for _, ok := range succeeded {
+		if ok {
+			batchResult.Succeeded++
+		} else {
+			batchResult.Failed++
+		}
+	}
+	events.Record(ctx, events.Event{Type: events.TypeBatchResult, BatchResult: &batchResult})
+	logger.Info(fmt.Sprintf(
+		"checkpointed %d of %d pods, %d failed", batchResult.Succeeded, batchResult.Total, batchResult.Failed,
+	))
+	if batchResult.Failed > 0 {
+		return fmt.Errorf("%d of %d pods failed to checkpoint", batchResult.Failed, batchResult.Total)
+	}
+	return nil
+}
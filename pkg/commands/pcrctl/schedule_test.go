@@ -0,0 +1,100 @@
+package pcrctl
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd"
+
+	"github.com/yhlooo/podmig/pkg/commands/pcrctl/options"
+	podcrcommon "github.com/yhlooo/podmig/pkg/podcr/common"
+	podcrcontianerd "github.com/yhlooo/podmig/pkg/podcr/containerd"
+	"github.com/yhlooo/podmig/pkg/podcr/containerd/fake"
+	"github.com/yhlooo/podmig/pkg/podcr/store"
+)
+
+// runFakePod 在模拟容器运行时中运行一个包含一个容器的 Pod ，返回容器 ID
+func runFakePod(
+	t *testing.T,
+	ctx context.Context,
+	cri *fake.RuntimeService,
+	backend *fake.Backend,
+	kubeletRootDir string,
+	pod podcrcommon.PodKey,
+) string {
+	containerID, err := fake.RunPod(ctx, cri, backend, kubeletRootDir, fake.Pod{
+		Namespace:     pod.Namespace,
+		Name:          pod.Name,
+		UID:           "uid-" + pod.Name,
+		ContainerName: "app",
+		Memory:        []byte("heap"),
+	})
+	if err != nil {
+		t.Fatalf("run pod %q error: %v", pod, err)
+	}
+	return containerID
+}
+
+// TestScheduleRoundCanceled 测试一轮建立检查点期间被中断时恢复所有已暂停的容器，且不在存储中留下检查点
+func TestScheduleRoundCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cri := fake.NewRuntimeService()
+	backend := fake.NewBackend()
+	kubeletRootDir := t.TempDir()
+	pods := []podcrcommon.PodKey{
+		{Namespace: "default", Name: "web-0"},
+		{Namespace: "default", Name: "web-1"},
+	}
+	var containerIDs []string
+	for _, pod := range pods {
+		containerIDs = append(containerIDs, runFakePod(t, ctx, cri, backend, kubeletRootDir, pod))
+	}
+
+	orig := newCheckpointManager
+	defer func() { newCheckpointManager = orig }()
+	backend.SetCheckpointHook(fake.CancelCheckpoint(cancel))
+	newCheckpointManager = func(_ *options.CheckpointOptions, tmpdir string) (podcrcommon.PodCRManager, error) {
+		return podcrcontianerd.NewWithClients(
+			tmpdir, false, cri, backend, backend, backend,
+			podcrcontianerd.WithKubeletRootDir(kubeletRootDir),
+			podcrcontianerd.WithCgroupV2(true),
+		), nil
+	}
+
+	opts := options.NewDefaultScheduleOptions()
+	opts.Concurrency = len(pods)
+	opts.Store = t.TempDir()
+	checkpointOpts, err := newCheckpointOptions(&opts.CheckpointOptions)
+	if err != nil {
+		t.Fatalf("new checkpoint options error: %v", err)
+	}
+	st := store.New(opts.Store)
+	listPods := func(context.Context) ([]podcrcommon.PodKey, error) { return pods, nil }
+
+	if err := scheduleRound(ctx, &opts, checkpointOpts, st, listPods); err == nil {
+		t.Fatalf("expected error from canceled round, got nil")
+	}
+
+	for i, id := range containerIDs {
+		c, ok := backend.Container(id)
+		if !ok {
+			t.Fatalf("container of pod %q not found", pods[i])
+		}
+		if c.Status != containerd.Running {
+			t.Errorf("expected container of pod %q running after canceled round, got %s", pods[i], c.Status)
+		}
+	}
+	err = filepath.Walk(opts.Store, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			t.Errorf("unexpected file left in store: %s", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("walk store error: %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/sync/errgroup"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubectl/pkg/drain"
+)
+
+const pdbPollingInterval = 2 * time.Second
+
+// DrainOptions 通过迁移排空节点的选项
+type DrainOptions struct {
+	// 同时迁移的 Pod 数
+	Concurrency int
+	// 是否忽略 DaemonSet 管理的 Pod
+	IgnoreDaemonSets bool
+	// 是否允许驱逐使用 emptyDir 的 Pod （数据将丢失）
+	DeleteEmptyDirData bool
+	// 是否处理不受控制器管理的 Pod
+	Force bool
+	// 驱逐 Pod 的优雅终止时间（秒），为负数时使用 Pod 的设置
+	GracePeriodSeconds int
+	// 等待 PodDisruptionBudget 允许中断和等待驱逐完成的超时时间， 0 表示不限
+	Timeout time.Duration
+	// 只处理匹配该标签选择器的 Pod
+	PodSelector string
+}
+
+// DrainResult 通过迁移排空节点的结果
+type DrainResult struct {
+	// 迁移成功的 Pod
+	Migrated []string
+	// 兼容性检查未通过或不支持交接而被驱逐的 Pod
+	Evicted []string
+	// 失败的 Pod 及原因
+	Failed map[string]error
+}
+
+// Drainer 通过将 Pod 热迁移到其它节点排空节点
+type Drainer struct {
+	client   kubernetes.Interface
+	migrator *Migrator
+	targets  TargetSelector
+	opts     DrainOptions
+
+	lock sync.Mutex
+	// 以 PodDisruptionBudget 的 命名空间/名称 为键的锁，匹配同一 PodDisruptionBudget 的 Pod 逐个中断
+	pdbLocks map[string]*sync.Mutex
+}
+
+// NewDrainer 创建一个 *Drainer
+func NewDrainer(client kubernetes.Interface, migrator *Migrator, targets TargetSelector, opts DrainOptions) *Drainer {
+	return &Drainer{
+		client:   client,
+		migrator: migrator,
+		targets:  targets,
+		opts:     opts,
+		pdbLocks: make(map[string]*sync.Mutex),
+	}
+}
+
+// Drain 封锁节点 nodeName ，并将其上可驱逐的 Pod 逐个热迁移到其它节点
+//
+// 目标节点兼容性检查未通过或不支持交接的 Pod 退化为驱逐；单个 Pod 失败不影响其它 Pod
+func (d *Drainer) Drain(ctx context.Context, nodeName string) (*DrainResult, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+	if d.opts.Concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be positive, got %d", d.opts.Concurrency)
+	}
+	helper := d.newDrainHelper(ctx)
+
+	// 封锁节点
+	node, err := d.client.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get node %q error: %w", nodeName, err)
+	}
+	if err := drain.RunCordonOrUncordon(helper, node, true); err != nil {
+		return nil, fmt.Errorf("cordon node %q error: %w", nodeName, err)
+	}
+	logger.Info(fmt.Sprintf("node %q cordoned", nodeName))
+
+	// 列出可驱逐的 Pod
+	// 使用 emptyDir 的 Pod 可以迁移，是否允许驱逐在退化时再判断
+	listHelper := *helper
+	listHelper.DeleteEmptyDirData = true
+	list, errs := listHelper.GetPodsForDeletion(nodeName)
+	if errs != nil {
+		return nil, fmt.Errorf("list pods on node %q error: %v", nodeName, errs)
+	}
+	if warnings := list.Warnings(); warnings != "" {
+		logger.Info(warnings)
+	}
+	pods := list.Pods()
+	logger.Info(fmt.Sprintf("migrating %d pods from node %q", len(pods), nodeName))
+
+	result := &DrainResult{Failed: make(map[string]error)}
+	lock := sync.Mutex{}
+	eg := &errgroup.Group{}
+	eg.SetLimit(d.opts.Concurrency)
+	for i := range pods {
+		pod := &pods[i]
+		key := pod.Namespace + "/" + pod.Name
+		if err := ctx.Err(); err != nil {
+			// 已取消，不再开始新的 Pod
+			lock.Lock()
+			result.Failed[key] = err
+			lock.Unlock()
+			continue
+		}
+		eg.Go(func() error {
+			evicted, err := d.drainPod(ctx, helper, pod)
+			lock.Lock()
+			defer lock.Unlock()
+			switch {
+			case err != nil:
+				logger.Error(err, fmt.Sprintf("drain pod %q error", key))
+				result.Failed[key] = err
+			case evicted:
+				result.Evicted = append(result.Evicted, key)
+			default:
+				result.Migrated = append(result.Migrated, key)
+			}
+			return nil
+		})
+	}
+	_ = eg.Wait()
+
+	logger.Info(fmt.Sprintf(
+		"drained node %q: %d migrated, %d evicted, %d failed",
+		nodeName, len(result.Migrated), len(result.Evicted), len(result.Failed),
+	))
+	if len(result.Failed) > 0 {
+		return result, fmt.Errorf("%d of %d pods failed to drain", len(result.Failed), len(pods))
+	}
+	return result, nil
+}
+
+// drainPod 将 Pod 迁移到其它节点，目标节点兼容性检查未通过或不支持交接时驱逐 Pod
+//
+// 返回 Pod 是否是被驱逐的
+func (d *Drainer) drainPod(ctx context.Context, helper *drain.Helper, pod *corev1.Pod) (bool, error) {
+	logger := logr.FromContextOrDiscard(ctx).WithValues("pod", pod.Namespace+"/"+pod.Name)
+	ctx = logr.NewContext(ctx, logger)
+
+	// 迁移同样会中断 Pod ，需要等待 PodDisruptionBudget 允许
+	// 迁移完成前替代 Pod 尚未就绪，中断预算未被扣减，匹配同一 PodDisruptionBudget 的 Pod 需逐个迁移或驱逐
+	pdbs, err := d.matchPodDisruptionBudgets(ctx, pod)
+	if err != nil {
+		return false, err
+	}
+	unlock := d.lockPodDisruptionBudgets(pod.Namespace, pdbs)
+	defer unlock()
+	if err := d.waitForDisruptionAllowed(ctx, pod.Namespace, pdbs); err != nil {
+		return false, err
+	}
+
+	target, err := d.targets.SelectTarget(ctx, pod)
+	if err != nil {
+		return false, fmt.Errorf("select target node error: %w", err)
+	}
+
+	err = d.migrator.Migrate(ctx, pod, target)
+	d.targets.ReleaseTarget(pod)
+	switch {
+	case err == nil:
+		logger.Info(fmt.Sprintf("migrated to node %q", target))
+		return false, nil
+	case errors.Is(err, ErrPreflightFailed), errors.Is(err, ErrHandoverUnsupported):
+		logger.Error(err, "can not migrate, fall back to eviction")
+	default:
+		return false, err
+	}
+
+	// 退化为驱逐
+	if !d.opts.DeleteEmptyDirData && hasEmptyDir(pod) {
+		return false, fmt.Errorf(
+			"can not evict pod with emptyDir volume without --delete-emptydir-data (data will be lost): %w", err,
+		)
+	}
+	if err := helper.DeleteOrEvictPods([]corev1.Pod{*pod}); err != nil {
+		return false, fmt.Errorf("evict pod error: %w", err)
+	}
+	logger.Info("evicted")
+	return true, nil
+}
+
+// matchPodDisruptionBudgets 列出匹配 Pod 的 PodDisruptionBudget 名，按名称排序
+func (d *Drainer) matchPodDisruptionBudgets(ctx context.Context, pod *corev1.Pod) ([]string, error) {
+	pdbs, err := d.client.PolicyV1().PodDisruptionBudgets(pod.Namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list pod disruption budgets error: %w", err)
+	}
+	var matched []string
+	for _, pdb := range pdbs.Items {
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || selector.Empty() || !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		matched = append(matched, pdb.Name)
+	}
+	sort.Strings(matched)
+	return matched, nil
+}
+
+// lockPodDisruptionBudgets 按顺序锁定命名空间 namespace 中的 PodDisruptionBudget names ，返回解锁函数
+func (d *Drainer) lockPodDisruptionBudgets(namespace string, names []string) func() {
+	d.lock.Lock()
+	locks := make([]*sync.Mutex, 0, len(names))
+	for _, name := range names {
+		key := namespace + "/" + name
+		l, ok := d.pdbLocks[key]
+		if !ok {
+			l = &sync.Mutex{}
+			d.pdbLocks[key] = l
+		}
+		locks = append(locks, l)
+	}
+	d.lock.Unlock()
+
+	// 按相同顺序加锁，避免死锁
+	for _, l := range locks {
+		l.Lock()
+	}
+	return func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+		}
+	}
+}
+
+// waitForDisruptionAllowed 等待命名空间 namespace 中的 PodDisruptionBudget names 允许中断
+func (d *Drainer) waitForDisruptionAllowed(ctx context.Context, namespace string, names []string) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	if len(names) == 0 {
+		return nil
+	}
+
+	timeout := d.opts.Timeout
+	if timeout == 0 {
+		timeout = time.Duration(1<<63 - 1)
+	}
+	waiting := false
+	err := wait.PollUntilContextTimeout(ctx, pdbPollingInterval, timeout, true,
+		func(ctx context.Context) (bool, error) {
+			for _, name := range names {
+				pdb, err := d.client.PolicyV1().PodDisruptionBudgets(namespace).Get(ctx, name, metav1.GetOptions{})
+				if err != nil {
+					return false, err
+				}
+				if !isDisruptionAllowed(pdb) {
+					if !waiting {
+						logger.Info(fmt.Sprintf("waiting for pod disruption budget %q to allow disruption", name))
+						waiting = true
+					}
+					return false, nil
+				}
+			}
+			return true, nil
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("wait for pod disruption budgets %v error: %w", names, err)
+	}
+	return nil
+}
+
+// newDrainHelper 创建驱逐 Pod 用的 *drain.Helper
+func (d *Drainer) newDrainHelper(ctx context.Context) *drain.Helper {
+	logger := logr.FromContextOrDiscard(ctx)
+	return &drain.Helper{
+		Ctx:                 ctx,
+		Client:              d.client,
+		Force:               d.opts.Force,
+		GracePeriodSeconds:  d.opts.GracePeriodSeconds,
+		IgnoreAllDaemonSets: d.opts.IgnoreDaemonSets,
+		Timeout:             d.opts.Timeout,
+		DeleteEmptyDirData:  d.opts.DeleteEmptyDirData,
+		PodSelector:         d.opts.PodSelector,
+		Out:                 io.Discard,
+		ErrOut:              io.Discard,
+		OnPodDeletionOrEvictionFinished: func(pod *corev1.Pod, usingEviction bool, err error) {
+			if err == nil {
+				logger.V(1).Info(fmt.Sprintf("pod %s/%s removed from node", pod.Namespace, pod.Name))
+			}
+		},
+	}
+}
+
+// isDisruptionAllowed 判断 PodDisruptionBudget 是否允许中断
+func isDisruptionAllowed(pdb *policyv1.PodDisruptionBudget) bool {
+	// 控制器尚未处理最新的定义时状态不可信
+	return pdb.Status.ObservedGeneration >= pdb.Generation && pdb.Status.DisruptionsAllowed > 0
+}
+
+// hasEmptyDir 判断 Pod 是否使用 emptyDir 卷
+func hasEmptyDir(pod *corev1.Pod) bool {
+	for _, vol := range pod.Spec.Volumes {
+		if vol.EmptyDir != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package migration
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TestDrainPodSerializesPodsSharingPDB 测试匹配同一 PodDisruptionBudget 的 Pod 逐个迁移
+func TestDrainPodSerializesPodsSharingPDB(t *testing.T) {
+	labels := map[string]string{"app": "nginx"}
+	pod1 := newTestPod("app-1", "node-a", labels)
+	pod2 := newTestPod("app-2", "node-a", labels)
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+		},
+		// 只允许中断一个 Pod ，但状态在迁移完成前不会更新
+		Status: policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: 1},
+	}
+	client := newFakeClient(pod1, pod2, pdb)
+
+	// 记录同时处于 建立检查点 至 还原完成 之间的 Pod 数
+	lock := sync.Mutex{}
+	inFlight, maxInFlight := 0, 0
+	runner := &fakeRunner{handlers: map[string]func(context.Context, string, []string) error{
+		"checkpoint": func(context.Context, string, []string) error {
+			lock.Lock()
+			inFlight++
+			if inFlight > maxInFlight {
+				maxInFlight = inFlight
+			}
+			lock.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		},
+		"restore": func(context.Context, string, []string) error {
+			lock.Lock()
+			inFlight--
+			lock.Unlock()
+			return nil
+		},
+	}}
+	d := NewDrainer(client, NewMigrator(client, runner), NewStaticTargetSelector([]string{"node-b"}), DrainOptions{
+		Concurrency: 2,
+	})
+	ctx := context.Background()
+	helper := d.newDrainHelper(ctx)
+
+	wg := sync.WaitGroup{}
+	for _, p := range []*corev1.Pod{pod1, pod2} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			evicted, err := d.drainPod(ctx, helper, p)
+			if err != nil {
+				t.Errorf("drain pod %q error: %v", p.Name, err)
+			}
+			if evicted {
+				t.Errorf("expected pod %q migrated, got evicted", p.Name)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight != 1 {
+		t.Errorf("expected pods sharing pod disruption budget migrated one by one, got %d at the same time", maxInFlight)
+	}
+}
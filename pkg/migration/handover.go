@@ -0,0 +1,215 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// HandoverSchedulerName 替代 Pod 使用的调度器名
+	//
+	// 没有调度器处理该名称，替代 Pod 在绑定到目标节点前保持待调度，绑定后 kubelet 接管已还原的沙盒。
+	// 不使用 schedulingGates ，因为 API Server 拒绝绑定有 schedulingGates 的 Pod
+	HandoverSchedulerName = "podmig-handover"
+
+	// HandoverOfLabelKey 替代 Pod 的标签，值为被替代的 Pod 的 UID
+	HandoverOfLabelKey = "podmig.yhlooo.github.io/handover-of"
+	// HandoverLabelsAnnotationKey 交接完成前暂存替代 Pod 的标签的注解
+	HandoverLabelsAnnotationKey = "podmig.yhlooo.github.io/handover-labels"
+	// HandoverOwnerReferencesAnnotationKey 交接完成前暂存替代 Pod 的 ownerReferences 的注解
+	HandoverOwnerReferencesAnnotationKey = "podmig.yhlooo.github.io/handover-owner-references"
+
+	// podDeletionCostAnnotationKey 控制器缩容时优先删除该值小的 Pod
+	podDeletionCostAnnotationKey = "controller.kubernetes.io/pod-deletion-cost"
+
+	handoverPollingInterval = time.Second
+	handoverReadyTimeout    = 5 * time.Minute
+)
+
+// ErrHandoverUnsupported Pod 无法交接到替代 Pod
+var ErrHandoverUnsupported = errors.New("handover unsupported")
+
+// checkHandoverSupported 检查 Pod 能否交接到替代 Pod
+//
+// 替代 Pod 名与原 Pod 不同，依赖固定 Pod 名的 StatefulSet Pod 不支持
+func checkHandoverSupported(pod *corev1.Pod) error {
+	if ref := metav1.GetControllerOf(pod); ref != nil && ref.Kind == "StatefulSet" {
+		return fmt.Errorf("%w: pod is controlled by StatefulSet %q", ErrHandoverUnsupported, ref.Name)
+	}
+	return nil
+}
+
+// newReplacementPod 创建替代原 Pod 的 Pod 定义
+//
+// 替代 Pod 与原 Pod 定义相同，但不绑定节点且使用 HandoverSchedulerName 。
+// 标签和 ownerReferences 暂存到注解中，避免交接完成前被控制器和 Service 选中
+func newReplacementPod(pod *corev1.Pod) (*corev1.Pod, error) {
+	labelsJSON, err := json.Marshal(pod.Labels)
+	if err != nil {
+		return nil, fmt.Errorf("marshal labels to json error: %w", err)
+	}
+	ownerReferencesJSON, err := json.Marshal(pod.OwnerReferences)
+	if err != nil {
+		return nil, fmt.Errorf("marshal owner references to json error: %w", err)
+	}
+
+	generateName := pod.GenerateName
+	if generateName == "" {
+		generateName = pod.Name + "-"
+	}
+	annotations := make(map[string]string, len(pod.Annotations)+2)
+	for k, v := range pod.Annotations {
+		annotations[k] = v
+	}
+	delete(annotations, podDeletionCostAnnotationKey)
+	annotations[HandoverLabelsAnnotationKey] = string(labelsJSON)
+	annotations[HandoverOwnerReferencesAnnotationKey] = string(ownerReferencesJSON)
+
+	replacement := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: generateName,
+			Namespace:    pod.Namespace,
+			Labels:       map[string]string{HandoverOfLabelKey: string(pod.UID)},
+			Annotations:  annotations,
+		},
+		Spec: *pod.Spec.DeepCopy(),
+	}
+	replacement.Spec.NodeName = ""
+	replacement.Spec.SchedulerName = HandoverSchedulerName
+	replacement.Spec.SchedulingGates = nil
+	// 创建时不允许指定临时容器
+	replacement.Spec.EphemeralContainers = nil
+	return replacement, nil
+}
+
+// bindPod 将 Pod 绑定到节点
+func bindPod(ctx context.Context, client kubernetes.Interface, pod *corev1.Pod, node string) error {
+	err := client.CoreV1().Pods(pod.Namespace).Bind(ctx, &corev1.Binding{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace, UID: pod.UID},
+		Target:     corev1.ObjectReference{Kind: "Node", Name: node},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("bind pod %q to node %q error: %w", pod.Name, node, err)
+	}
+	return nil
+}
+
+// waitForPodReady 等待 Pod 运行且就绪
+func waitForPodReady(ctx context.Context, client kubernetes.Interface, pod *corev1.Pod) error {
+	err := wait.PollUntilContextTimeout(ctx, handoverPollingInterval, handoverReadyTimeout, true,
+		func(ctx context.Context) (bool, error) {
+			pod, err := client.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			switch pod.Status.Phase {
+			case corev1.PodRunning:
+			case corev1.PodFailed, corev1.PodSucceeded:
+				return false, fmt.Errorf("pod is %s", pod.Status.Phase)
+			default:
+				return false, nil
+			}
+			for _, cond := range pod.Status.Conditions {
+				if cond.Type == corev1.PodReady {
+					return cond.Status == corev1.ConditionTrue, nil
+				}
+			}
+			return false, nil
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("wait for pod %q running and ready error: %w", pod.Name, err)
+	}
+	return nil
+}
+
+// handOver 将原 Pod 的标签和 ownerReferences 交接给已在目标节点就绪的替代 Pod
+//
+// 先将原 Pod 的删除代价设为最低，控制器在短暂多出一个副本时会优先删除原 Pod
+func handOver(ctx context.Context, client kubernetes.Interface, pod, replacement *corev1.Pod) error {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	// 降低原 Pod 的删除代价
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				podDeletionCostAnnotationKey: strconv.Itoa(math.MinInt32),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("marshal patch to json error: %w", err)
+	}
+	_, err = client.CoreV1().Pods(pod.Namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("patch deletion cost of pod %q error: %w", pod.Name, err)
+	}
+
+	// 恢复替代 Pod 的标签和 ownerReferences
+	// 使用 JSON Patch 以整体替换标签，并以 UID 作为前提条件
+	labels := pod.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	ownerReferences := pod.OwnerReferences
+	if ownerReferences == nil {
+		ownerReferences = []metav1.OwnerReference{}
+	}
+	ops := []map[string]interface{}{
+		{"op": "test", "path": "/metadata/uid", "value": replacement.UID},
+		{"op": "replace", "path": "/metadata/labels", "value": labels},
+		{"op": "add", "path": "/metadata/ownerReferences", "value": ownerReferences},
+		{"op": "remove", "path": "/metadata/annotations/" + jsonPointerEscaper.Replace(HandoverLabelsAnnotationKey)},
+		{"op": "remove", "path": "/metadata/annotations/" + jsonPointerEscaper.Replace(HandoverOwnerReferencesAnnotationKey)},
+	}
+	patch, err = json.Marshal(ops)
+	if err != nil {
+		return fmt.Errorf("marshal patch to json error: %w", err)
+	}
+	_, err = client.CoreV1().Pods(replacement.Namespace).
+		Patch(ctx, replacement.Name, types.JSONPatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("restore labels and owner references of pod %q error: %w", replacement.Name, err)
+	}
+	logger.V(1).Info(fmt.Sprintf("labels and owner references handed over to pod %q", replacement.Name))
+	return nil
+}
+
+// deleteSourcePod 交接完成后删除原 Pod
+func deleteSourcePod(ctx context.Context, client kubernetes.Interface, pod *corev1.Pod) error {
+	err := client.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{
+		Preconditions: metav1.NewUIDPreconditions(string(pod.UID)),
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("delete pod %q error: %w", pod.Name, err)
+	}
+	return nil
+}
+
+// deleteReplacementPod 交接失败时删除替代 Pod
+func deleteReplacementPod(ctx context.Context, client kubernetes.Interface, replacement *corev1.Pod) {
+	logger := logr.FromContextOrDiscard(ctx)
+	err := client.CoreV1().Pods(replacement.Namespace).Delete(ctx, replacement.Name, metav1.DeleteOptions{
+		Preconditions: metav1.NewUIDPreconditions(string(replacement.UID)),
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Error(err, fmt.Sprintf("delete replacement pod %q error, delete it manually", replacement.Name))
+	}
+}
+
+// jsonPointerEscaper 转义 JSON Pointer 中的一段
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
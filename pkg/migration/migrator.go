@@ -0,0 +1,175 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ErrPreflightFailed 目标节点兼容性检查未通过
+var ErrPreflightFailed = errors.New("preflight failed")
+
+// sourceResumeTimeout 迁移失败后恢复源 Pod 的超时时间
+const sourceResumeTimeout = 30 * time.Second
+
+// NewMigrator 创建一个 *Migrator
+func NewMigrator(client kubernetes.Interface, runner Runner) *Migrator {
+	return &Migrator{client: client, runner: runner}
+}
+
+// Migrator 将 Pod 热迁移到其它节点
+//
+// 在源节点上建立检查点，暂存到本地临时文件，在目标节点上检查兼容性后，
+// 以替代 Pod 的标识还原，并将原 Pod 交接给替代 Pod
+type Migrator struct {
+	client kubernetes.Interface
+	runner Runner
+}
+
+// Migrate 将 Pod 热迁移到目标节点 target
+//
+// 交接流程：
+//  1. 在源节点上建立检查点，转储后源 Pod 的容器保持暂停，检查检查点与目标节点的兼容性
+//  2. 创建未绑定节点的替代 Pod ，获得 API Server 分配的 UID
+//  3. 在目标节点上以替代 Pod 的名称和 UID 还原，此时替代 Pod 尚未绑定， secret 等卷使用检查点中拷贝的数据
+//  4. 将替代 Pod 绑定到目标节点，等待其运行且就绪
+//  5. 将标签和 ownerReferences 交接给替代 Pod ，删除原 Pod
+//
+// 目标节点兼容性检查未通过或 Pod 不支持交接时返回的错误包含 ErrPreflightFailed 或 ErrHandoverUnsupported ，
+// 此时 Pod 继续运行；交接完成前失败时删除替代 Pod ，并恢复暂停的源 Pod 继续运行。
+//
+// 源 Pod 从转储到被删除一直保持暂停，避免其在转储后继续运行产生的状态在迁移后丢失，
+// 删除时 kubelet 直接终止暂停的容器
+func (m *Migrator) Migrate(ctx context.Context, pod *corev1.Pod, target string) error {
+	logger := logr.FromContextOrDiscard(ctx).WithValues("pod", pod.Namespace+"/"+pod.Name)
+	ctx = logr.NewContext(ctx, logger)
+
+	if err := checkHandoverSupported(pod); err != nil {
+		return err
+	}
+
+	// 暂存检查点的临时文件，包含 secret 等卷的数据，仅当前用户可读
+	file, err := os.CreateTemp("", "podmig-checkpoint-*.tar.gz")
+	if err != nil {
+		return fmt.Errorf("create temp file error: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+
+	// 在源节点上建立检查点，之后源 Pod 保持暂停直到被删除
+	// 即使返回错误，检查点也可能已建立，交接完成前失败时总是恢复源 Pod
+	handedOver := false
+	defer func() {
+		if !handedOver {
+			m.resumeSourcePod(ctx, pod)
+		}
+	}()
+	logger.Info(fmt.Sprintf("checkpointing on node %q", pod.Spec.NodeName))
+	err = m.runner.Run(ctx, pod.Spec.NodeName, []string{
+		"checkpoint", pod.Name,
+		"--namespace", pod.Namespace,
+		"--export", "-",
+		"--leave-running=false",
+		// 替代 Pod 在还原后才绑定到目标节点，还原时 kubelet 不会投射 secret 等卷，需要拷贝其数据
+		"--include-secrets",
+	}, nil, file)
+	if err != nil {
+		return fmt.Errorf("checkpoint on node %q error: %w", pod.Spec.NodeName, err)
+	}
+
+	// 在目标节点上检查兼容性
+	logger.Info(fmt.Sprintf("checking compatibility with node %q", target))
+	report := &lineLogger{logger: logger}
+	err = m.runWithCheckpoint(ctx, target, file, []string{"preflight", "-"}, report)
+	report.Flush()
+	if err != nil {
+		return fmt.Errorf("%w on node %q: %w", ErrPreflightFailed, target, err)
+	}
+
+	// 创建替代 Pod
+	replacement, err := newReplacementPod(pod)
+	if err != nil {
+		return err
+	}
+	replacement, err = m.client.CoreV1().Pods(pod.Namespace).Create(ctx, replacement, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("create replacement pod error: %w", err)
+	}
+	logger.Info(fmt.Sprintf("created replacement pod %q (uid: %s)", replacement.Name, replacement.UID))
+	// 先于恢复源 Pod 执行，避免两者同时运行
+	defer func() {
+		if !handedOver {
+			// 上下文可能已取消
+			deleteReplacementPod(logr.NewContext(context.Background(), logger), m.client, replacement)
+		}
+	}()
+
+	// 在目标节点上以替代 Pod 的标识还原
+	logger.Info(fmt.Sprintf("restoring on node %q", target))
+	err = m.runWithCheckpoint(ctx, target, file, []string{
+		"restore", "-",
+		"--skip-preflight",
+		// 不等待 kubelet 投射卷，绑定后 kubelet 原地更新卷内容
+		"--rematerialize-volumes=false",
+		"--pod-uid", string(replacement.UID),
+		"--name", replacement.Name,
+		"--namespace", replacement.Namespace,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("restore on node %q error: %w", target, err)
+	}
+
+	// 绑定到目标节点，等待 kubelet 接管
+	if err := bindPod(ctx, m.client, replacement, target); err != nil {
+		return err
+	}
+	if err := waitForPodReady(ctx, m.client, replacement); err != nil {
+		return err
+	}
+
+	// 交接，之后替代 Pod 已被控制器接管，不再删除
+	if err := handOver(ctx, m.client, pod, replacement); err != nil {
+		return err
+	}
+	handedOver = true
+	logger.Info(fmt.Sprintf("handed over to pod %q on node %q", replacement.Name, target))
+	return deleteSourcePod(ctx, m.client, pod)
+}
+
+// runWithCheckpoint 在节点上执行 pcrctl ，将检查点文件作为标准输入
+func (m *Migrator) runWithCheckpoint(
+	ctx context.Context,
+	node string,
+	file *os.File,
+	args []string,
+	stdout io.Writer,
+) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek checkpoint file error: %w", err)
+	}
+	return m.runner.Run(ctx, node, args, file, stdout)
+}
+
+// resumeSourcePod 迁移失败后恢复源节点上暂停的源 Pod
+func (m *Migrator) resumeSourcePod(ctx context.Context, pod *corev1.Pod) {
+	logger := logr.FromContextOrDiscard(ctx)
+	// 上下文可能已取消
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sourceResumeTimeout)
+	defer cancel()
+	err := m.runner.Run(ctx, pod.Spec.NodeName, []string{"resume", pod.Name, "--namespace", pod.Namespace}, nil, nil)
+	if err != nil {
+		logger.Error(err, fmt.Sprintf("resume pod on node %q error, resume it manually", pod.Spec.NodeName))
+		return
+	}
+	logger.Info(fmt.Sprintf("resumed pod on node %q", pod.Spec.NodeName))
+}
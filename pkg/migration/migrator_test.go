@@ -0,0 +1,350 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// runCall 一次 fakeRunner.Run 调用
+type runCall struct {
+	Node string
+	Args []string
+	// 调用时上下文是否已取消
+	Canceled bool
+}
+
+// fakeRunner 记录调用并按子命令返回结果的 Runner
+type fakeRunner struct {
+	lock  sync.Mutex
+	calls []runCall
+	// 以子命令名为键的处理函数，未设置时成功
+	handlers map[string]func(ctx context.Context, node string, args []string) error
+}
+
+var _ Runner = &fakeRunner{}
+
+// Run 在节点 node 上执行 pcrctl args...
+func (r *fakeRunner) Run(ctx context.Context, node string, args []string, stdin io.Reader, stdout io.Writer) error {
+	r.lock.Lock()
+	r.calls = append(r.calls, runCall{Node: node, Args: args, Canceled: ctx.Err() != nil})
+	handler := r.handlers[args[0]]
+	r.lock.Unlock()
+
+	if stdin != nil {
+		if _, err := io.Copy(io.Discard, stdin); err != nil {
+			return err
+		}
+	}
+	if stdout != nil && args[0] == "checkpoint" {
+		if _, err := stdout.Write([]byte("checkpoint")); err != nil {
+			return err
+		}
+	}
+	if handler != nil {
+		return handler(ctx, node, args)
+	}
+	return nil
+}
+
+// Calls 返回所有调用
+func (r *fakeRunner) Calls() []runCall {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]runCall(nil), r.calls...)
+}
+
+// Commands 返回所有调用的 节点: 子命令 POD
+func (r *fakeRunner) Commands() []string {
+	var ret []string
+	for _, call := range r.Calls() {
+		ret = append(ret, call.Node+": "+call.Args[0]+" "+podArg(call.Args))
+	}
+	return ret
+}
+
+// podArg 返回 pcrctl 参数中的 Pod 名
+func podArg(args []string) string {
+	for i, arg := range args {
+		if arg == "--name" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	if len(args) > 1 && args[1] != "-" {
+		return args[1]
+	}
+	return ""
+}
+
+// newFakeClient 创建模拟 API Server 分配名称、 UID 和调度器绑定行为的 fake.Clientset
+//
+// 绑定后 Pod 立即运行且就绪
+func newFakeClient(objs ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objs...)
+	lock := sync.Mutex{}
+	n := 0
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		create := action.(k8stesting.CreateAction)
+		if create.GetSubresource() != "" {
+			return false, nil, nil
+		}
+		pod := create.GetObject().(*corev1.Pod)
+		lock.Lock()
+		defer lock.Unlock()
+		if pod.Name == "" && pod.GenerateName != "" {
+			n++
+			pod.Name = fmt.Sprintf("%s%d", pod.GenerateName, n)
+		}
+		if pod.UID == "" {
+			pod.UID = types.UID("uid-" + pod.Name)
+		}
+		return false, nil, nil
+	})
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		create := action.(k8stesting.CreateAction)
+		if create.GetSubresource() != "binding" {
+			return false, nil, nil
+		}
+		binding := create.GetObject().(*corev1.Binding)
+		tracker := client.Tracker()
+		obj, err := tracker.Get(corev1.SchemeGroupVersion.WithResource("pods"), binding.Namespace, binding.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		pod := obj.(*corev1.Pod).DeepCopy()
+		pod.Spec.NodeName = binding.Target.Name
+		pod.Status.Phase = corev1.PodRunning
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+		if err := tracker.Update(corev1.SchemeGroupVersion.WithResource("pods"), pod, pod.Namespace); err != nil {
+			return true, nil, err
+		}
+		return true, binding, nil
+	})
+	return client
+}
+
+// newTestPod 创建运行在节点 node 上的测试用 Pod
+func newTestPod(name, node string, labels map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			UID:       types.UID("uid-" + name),
+			Labels:    labels,
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "apps/v1",
+				Kind:       "ReplicaSet",
+				Name:       "app-7d9f8",
+				UID:        "uid-app-7d9f8",
+				Controller: func() *bool { b := true; return &b }(),
+			}},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   node,
+			Containers: []corev1.Container{{Name: "app", Image: "nginx"}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+// listPodNames 列出命名空间 default 中的 Pod 名
+func listPodNames(t *testing.T, client *fake.Clientset) []string {
+	t.Helper()
+	pods, err := client.CoreV1().Pods("default").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("list pods error: %v", err)
+	}
+	var names []string
+	for _, pod := range pods.Items {
+		names = append(names, pod.Name)
+	}
+	return names
+}
+
+// TestMigrate 测试迁移成功时源 Pod 转储后保持暂停直到被删除
+func TestMigrate(t *testing.T) {
+	pod := newTestPod("app", "node-a", map[string]string{"app": "nginx"})
+	client := newFakeClient(pod)
+	runner := &fakeRunner{}
+
+	if err := NewMigrator(client, runner).Migrate(context.Background(), pod, "node-b"); err != nil {
+		t.Fatalf("migrate error: %v", err)
+	}
+
+	expected := []string{
+		"node-a: checkpoint app",
+		"node-b: preflight ",
+		"node-b: restore app-1",
+	}
+	if got := runner.Commands(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected commands %q, got %q", expected, got)
+	}
+	if args := runner.Calls()[0].Args; !containsArg(args, "--leave-running=false") {
+		t.Errorf("expected checkpoint with --leave-running=false, got args %q", args)
+	}
+	if got := listPodNames(t, client); !reflect.DeepEqual(got, []string{"app-1"}) {
+		t.Errorf("expected only replacement pod left, got %q", got)
+	}
+	replacement, err := client.CoreV1().Pods("default").Get(context.Background(), "app-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get replacement pod error: %v", err)
+	}
+	if !reflect.DeepEqual(replacement.Labels, pod.Labels) {
+		t.Errorf("expected replacement labels %v, got %v", pod.Labels, replacement.Labels)
+	}
+	if replacement.Spec.NodeName != "node-b" {
+		t.Errorf("expected replacement bound to %q, got %q", "node-b", replacement.Spec.NodeName)
+	}
+}
+
+// TestMigrateFailedResumesSource 测试交接完成前失败时删除替代 Pod 并以未取消的上下文恢复源 Pod
+func TestMigrateFailedResumesSource(t *testing.T) {
+	cases := []struct {
+		name     string
+		failed   string
+		expected []string
+	}{
+		{
+			name:   "PreflightFailed",
+			failed: "preflight",
+			expected: []string{
+				"node-a: checkpoint app",
+				"node-b: preflight ",
+				"node-a: resume app",
+			},
+		},
+		{
+			name:   "RestoreFailed",
+			failed: "restore",
+			expected: []string{
+				"node-a: checkpoint app",
+				"node-b: preflight ",
+				"node-b: restore app-1",
+				"node-a: resume app",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pod := newTestPod("app", "node-a", map[string]string{"app": "nginx"})
+			client := newFakeClient(pod)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			runner := &fakeRunner{handlers: map[string]func(context.Context, string, []string) error{
+				// 失败时上下文同时被取消，如迁移被中断
+				c.failed: func(context.Context, string, []string) error {
+					cancel()
+					return errors.New("failed")
+				},
+			}}
+
+			if err := NewMigrator(client, runner).Migrate(ctx, pod, "node-b"); err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+
+			if got := runner.Commands(); !reflect.DeepEqual(got, c.expected) {
+				t.Errorf("expected commands %q, got %q", c.expected, got)
+			}
+			calls := runner.Calls()
+			if resume := calls[len(calls)-1]; resume.Canceled {
+				t.Errorf("expected resume with uncanceled context")
+			}
+			if got := listPodNames(t, client); !reflect.DeepEqual(got, []string{"app"}) {
+				t.Errorf("expected only source pod left, got %q", got)
+			}
+		})
+	}
+}
+
+// TestMigrateOrdering 测试替代 Pod 在还原完成后才绑定，还原不依赖 kubelet 投射卷
+func TestMigrateOrdering(t *testing.T) {
+	pod := newTestPod("app", "node-a", map[string]string{"app": "nginx"})
+	client := newFakeClient(pod)
+
+	// 按顺序记录 pcrctl 调用和对 API Server 的修改
+	lock := sync.Mutex{}
+	var steps []string
+	record := func(step string) {
+		lock.Lock()
+		defer lock.Unlock()
+		steps = append(steps, step)
+	}
+	client.PrependReactor("*", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		switch action.GetVerb() {
+		case "create", "patch", "delete":
+			step := action.GetVerb() + " pods"
+			if sub := action.GetSubresource(); sub != "" {
+				step += "/" + sub
+			}
+			record(step)
+		}
+		return false, nil, nil
+	})
+	runner := &fakeRunner{handlers: map[string]func(context.Context, string, []string) error{
+		"checkpoint": func(_ context.Context, _ string, args []string) error {
+			record("checkpoint")
+			if !containsArg(args, "--include-secrets") {
+				t.Errorf("expected checkpoint with --include-secrets, got args %q", args)
+			}
+			return nil
+		},
+		"preflight": func(context.Context, string, []string) error {
+			record("preflight")
+			return nil
+		},
+		"restore": func(ctx context.Context, _ string, args []string) error {
+			record("restore")
+			if !containsArg(args, "--rematerialize-volumes=false") {
+				t.Errorf("expected restore with --rematerialize-volumes=false, got args %q", args)
+			}
+			replacement, err := client.CoreV1().Pods("default").Get(ctx, podArg(args), metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if replacement.Spec.NodeName != "" {
+				t.Errorf("expected replacement pod not bound on restore, got bound to %q", replacement.Spec.NodeName)
+			}
+			return nil
+		},
+	}}
+
+	if err := NewMigrator(client, runner).Migrate(context.Background(), pod, "node-b"); err != nil {
+		t.Fatalf("migrate error: %v", err)
+	}
+
+	expected := []string{
+		"checkpoint",
+		"preflight",
+		"create pods",
+		"restore",
+		"create pods/binding",
+		// 降低原 Pod 的删除代价、交接标签和 ownerReferences
+		"patch pods",
+		"patch pods",
+		"delete pods",
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Errorf("expected steps %q, got %q", expected, steps)
+	}
+}
+
+// containsArg 判断参数中是否包含 arg
+func containsArg(args []string, arg string) bool {
+	for _, a := range args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/yhlooo/podmig/pkg/scheduling"
+)
+
+// TargetSelector 为待迁移的 Pod 选择目标节点
+type TargetSelector interface {
+	// SelectTarget 为 Pod 选择目标节点，返回节点名
+	SelectTarget(ctx context.Context, pod *corev1.Pod) (string, error)
+	// ReleaseTarget 释放为 Pod 选择的目标节点，在 Pod 迁移结束（无论成功与否）后调用
+	ReleaseTarget(pod *corev1.Pod)
+}
+
+// NewStaticTargetSelector 创建一个在指定节点间轮流选择的 TargetSelector
+func NewStaticTargetSelector(nodes []string) TargetSelector {
+	return &staticTargetSelector{nodes: nodes}
+}
+
+// staticTargetSelector 在指定节点间轮流选择的 TargetSelector
+type staticTargetSelector struct {
+	lock  sync.Mutex
+	nodes []string
+	next  int
+}
+
+var _ TargetSelector = &staticTargetSelector{}
+
+// SelectTarget 为 Pod 选择目标节点，返回节点名
+func (s *staticTargetSelector) SelectTarget(_ context.Context, pod *corev1.Pod) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for range s.nodes {
+		node := s.nodes[s.next%len(s.nodes)]
+		s.next++
+		if node != pod.Spec.NodeName {
+			return node, nil
+		}
+	}
+	return "", fmt.Errorf("no target node other than %q", pod.Spec.NodeName)
+}
+
+// ReleaseTarget 释放为 Pod 选择的目标节点
+func (s *staticTargetSelector) ReleaseTarget(_ *corev1.Pod) {}
+
+// NewSchedulerTargetSelector 创建一个按 kube-scheduler 的视角选择目标节点的 TargetSelector
+//
+// 迁移结束前，选定的节点会计入后续选择时该节点已请求的资源
+func NewSchedulerTargetSelector(scheduler *scheduling.Scheduler) TargetSelector {
+	return &schedulerTargetSelector{scheduler: scheduler}
+}
+
+// schedulerTargetSelector 按 kube-scheduler 的视角选择目标节点的 TargetSelector
+type schedulerTargetSelector struct {
+	scheduler *scheduling.Scheduler
+}
+
+var _ TargetSelector = &schedulerTargetSelector{}
+
+// SelectTarget 为 Pod 选择目标节点，返回节点名
+func (s *schedulerTargetSelector) SelectTarget(ctx context.Context, pod *corev1.Pod) (string, error) {
+	result, err := s.scheduler.Schedule(ctx, pod)
+	if err != nil {
+		return "", err
+	}
+	s.scheduler.Reserve(pod, result.Node)
+	return result.Node, nil
+}
+
+// ReleaseTarget 释放为 Pod 选择的目标节点
+func (s *schedulerTargetSelector) ReleaseTarget(pod *corev1.Pod) {
+	s.scheduler.Forget(pod)
+}
@@ -0,0 +1,249 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	workerContainerName   = "pcrctl"
+	workerPodNamePrefix   = "podmig-worker-"
+	workerLabelKey        = "app.kubernetes.io/name"
+	workerLabelValue      = "podmig-worker"
+	workerStartupTimeout  = 2 * time.Minute
+	workerPollingInterval = time.Second
+)
+
+// workerHostPaths 工作 Pod 需要以相同路径挂载的节点目录
+//
+// pcrctl 通过 containerd 套接字操作容器，并直接读写 kubelet Pod 目录、 Pod 日志目录和 cgroup ，
+// CRIU 配置等临时文件需要对节点上的 containerd 可见
+var workerHostPaths = []string{
+	"/run/containerd",
+	"/var/lib/kubelet",
+	"/var/log/pods",
+	"/sys/fs/cgroup",
+	"/tmp",
+}
+
+// Runner 在节点上执行 pcrctl
+type Runner interface {
+	// Run 在节点 node 上执行 pcrctl args... ，stdin 、 stdout 为 nil 时不传输标准输入、标准输出
+	Run(ctx context.Context, node string, args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+// Workers 在节点上运行 pcrctl 的工作 Pod
+//
+// 每个节点按需创建一个特权工作 Pod ，通过 exec 在其中执行 pcrctl ，检查点通过 exec 的标准输入输出传输
+type Workers struct {
+	client     kubernetes.Interface
+	restConfig *rest.Config
+	namespace  string
+	image      string
+
+	lock sync.Mutex
+	pods map[string]string
+}
+
+var _ Runner = &Workers{}
+
+// NewWorkers 创建一个 *Workers
+func NewWorkers(client kubernetes.Interface, restConfig *rest.Config, namespace, image string) *Workers {
+	return &Workers{
+		client:     client,
+		restConfig: restConfig,
+		namespace:  namespace,
+		image:      image,
+		pods:       make(map[string]string),
+	}
+}
+
+// Run 在节点 node 上执行 pcrctl args...
+//
+// stdin 、 stdout 为 nil 时不传输标准输入、标准输出， pcrctl 的标准错误输出（日志）逐行输出到上下文中的日志
+func (w *Workers) Run(ctx context.Context, node string, args []string, stdin io.Reader, stdout io.Writer) error {
+	logger := logr.FromContextOrDiscard(ctx).WithValues("node", node)
+
+	podName, err := w.ensureWorker(ctx, node)
+	if err != nil {
+		return fmt.Errorf("ensure worker pod on node %q error: %w", node, err)
+	}
+
+	req := w.client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(w.namespace).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: workerContainerName,
+			Command:   append([]string{"pcrctl"}, args...),
+			Stdin:     stdin != nil,
+			Stdout:    stdout != nil,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+	executor, err := remotecommand.NewSPDYExecutor(w.restConfig, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("create executor error: %w", err)
+	}
+
+	logger.V(1).Info(fmt.Sprintf("run on worker %s: pcrctl %s", podName, strings.Join(args, " ")))
+	stderr := &lineLogger{logger: logger}
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	stderr.Flush()
+	if err != nil {
+		return fmt.Errorf("pcrctl %s error: %w", args[0], err)
+	}
+	return nil
+}
+
+// Cleanup 删除创建的所有工作 Pod
+func (w *Workers) Cleanup(ctx context.Context) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	var errs []error
+	for node, podName := range w.pods {
+		err := w.client.CoreV1().Pods(w.namespace).Delete(ctx, podName, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("delete worker pod %q error: %w", podName, err))
+			continue
+		}
+		delete(w.pods, node)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
+
+// ensureWorker 确保节点上有运行中的工作 Pod ，返回其名称
+func (w *Workers) ensureWorker(ctx context.Context, node string) (string, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if podName, ok := w.pods[node]; ok {
+		return podName, nil
+	}
+
+	logger := logr.FromContextOrDiscard(ctx)
+	pod, err := w.client.CoreV1().Pods(w.namespace).Create(ctx, w.newWorkerPod(node), metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("create worker pod error: %w", err)
+	}
+	w.pods[node] = pod.Name
+	logger.Info(fmt.Sprintf("created worker pod %s/%s on node %q", w.namespace, pod.Name, node))
+
+	// 等待运行
+	err = wait.PollUntilContextTimeout(ctx, workerPollingInterval, workerStartupTimeout, true,
+		func(ctx context.Context) (bool, error) {
+			pod, err := w.client.CoreV1().Pods(w.namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			switch pod.Status.Phase {
+			case corev1.PodRunning:
+				return true, nil
+			case corev1.PodFailed, corev1.PodSucceeded:
+				return false, fmt.Errorf("worker pod %q is %s", pod.Name, pod.Status.Phase)
+			}
+			return false, nil
+		},
+	)
+	if err != nil {
+		return "", fmt.Errorf("wait for worker pod %q running error: %w", pod.Name, err)
+	}
+	return pod.Name, nil
+}
+
+// newWorkerPod 创建节点 node 上的工作 Pod 定义
+func (w *Workers) newWorkerPod(node string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: workerPodNamePrefix,
+			Namespace:    w.namespace,
+			Labels:       map[string]string{workerLabelKey: workerLabelValue},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:      node,
+			HostPID:       true,
+			HostNetwork:   true,
+			RestartPolicy: corev1.RestartPolicyNever,
+			// 节点已被封锁或带有污点时也需要运行
+			Tolerations: []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Containers: []corev1.Container{{
+				Name:    workerContainerName,
+				Image:   w.image,
+				Command: []string{"sleep", "infinity"},
+				SecurityContext: &corev1.SecurityContext{
+					Privileged: ptr.To(true),
+				},
+			}},
+			TerminationGracePeriodSeconds: ptr.To[int64](0),
+		},
+	}
+	for i, path := range workerHostPaths {
+		name := fmt.Sprintf("host-%d", i)
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{Path: path},
+			},
+		})
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: path,
+			// 还原内存介质卷时挂载的 tmpfs 需要传播到节点
+			MountPropagation: ptr.To(corev1.MountPropagationBidirectional),
+		})
+	}
+	return pod
+}
+
+// lineLogger 将写入的内容逐行输出到日志的 io.Writer
+type lineLogger struct {
+	logger logr.Logger
+	buf    []byte
+}
+
+var _ io.Writer = &lineLogger{}
+
+// Write 写入
+func (l *lineLogger) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := strings.IndexByte(string(l.buf), '\n')
+		if i < 0 {
+			break
+		}
+		l.logger.Info(string(l.buf[:i]))
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush 输出剩余不完整的行
+func (l *lineLogger) Flush() {
+	if len(l.buf) > 0 {
+		l.logger.Info(string(l.buf))
+		l.buf = nil
+	}
+}
@@ -3,18 +3,262 @@ package common
 import (
 	"archive/tar"
 	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
 )
 
 // PodCRManager Pod Checkpoint/Restore manager
 type PodCRManager interface {
 	// Checkpoint 建立 Pod 检查点，并导出到 tw
-	Checkpoint(ctx context.Context, checkpointID, namespace, name string, tw *tar.Writer) error
+	Checkpoint(ctx context.Context, checkpointID, namespace, name string, tw *tar.Writer, opts CheckpointOptions) error
 	// Restore 从 tr 读取 Pod 检查点并还原 Pod
 	Restore(ctx context.Context, tr *tar.Reader, opts RestoreOptions) error
+	// PlanRestore 从 tr 读取 Pod 检查点并计算还原计划，不创建沙盒、不导入镜像、不写入文件
+	PlanRestore(ctx context.Context, tr *tar.Reader, opts RestoreOptions) (*RestorePlan, error)
+	// Preflight 从 tr 读取 Pod 检查点并检查其与本节点的兼容性
+	Preflight(ctx context.Context, tr *tar.Reader) (*PreflightReport, error)
+	// Resume 恢复 Pod 中暂停的容器，如以 CheckpointOptions.LeavePaused 建立检查点后保持暂停的容器
+	Resume(ctx context.Context, namespace, name string) error
+	// ListPods 列出本节点上命名空间 namespace （为空表示所有命名空间）中标签与 selector 匹配的运行中的 Pod
+	ListPods(ctx context.Context, namespace string, selector labels.Selector) ([]PodKey, error)
+}
+
+// PodKey Pod 的命名空间和名称
+type PodKey struct {
+	// 命名空间
+	Namespace string
+	// 名称
+	Name string
+}
+
+// String 返回 命名空间/名称 形式的 Pod 标识
+func (k PodKey) String() string {
+	return k.Namespace + "/" + k.Name
+}
+
+// NetworkMode 网络模式
+type NetworkMode string
+
+// NetworkMode 的可选值
+const (
+	// NetworkModeNew 还原时使用目标节点 CNI 分配的新 IP ，检查点中已建立的 TCP 连接会被关闭
+	NetworkModeNew NetworkMode = "new"
+	// NetworkModePreserveIP 还原时请求目标节点 CNI 复用源 Pod IP ，并还原已建立的 TCP 连接
+	NetworkModePreserveIP NetworkMode = "preserve-ip"
+)
+
+// VolumePolicy 检查点中卷数据的处理策略
+type VolumePolicy string
+
+// VolumePolicy 的可选值
+const (
+	// VolumePolicyCopy 拷贝卷数据，仅跨越卷自身的挂载点
+	VolumePolicyCopy VolumePolicy = "copy"
+	// VolumePolicySkip 不拷贝卷数据，期望在目标节点重新挂载
+	VolumePolicySkip VolumePolicy = "skip"
+	// VolumePolicySnapshot 拷贝卷的完整数据快照，跨越卷内所有挂载点
+	VolumePolicySnapshot VolumePolicy = "snapshot"
+	// VolumePolicyRematerialize 不拷贝卷数据，还原时等待 kubelet 在目标节点基于新 Pod UID 重新投射卷内容
+	VolumePolicyRematerialize VolumePolicy = "rematerialize"
+)
+
+// DefaultVolumeWaitTimeout 等待 kubelet 重新投射卷内容的默认超时时间
+const DefaultVolumeWaitTimeout = 2 * time.Minute
+
+// CheckpointOptions 检查点选项
+type CheckpointOptions struct {
+	// 网络模式
+	NetworkMode NetworkMode
+	// 以卷插件名（如 kubernetes.io/local-volume ）为键的卷数据处理策略，覆盖默认策略
+	VolumePolicies map[string]VolumePolicy
+	// 导出 kubelet Pod 目录时是否跟随进入非卷自身的挂载点
+	FollowMounts bool
+	// 是否拷贝 secret 、 projected 卷中的敏感数据（如 ServiceAccount token ），默认由 kubelet 在目标节点重新投射
+	IncludeSecrets bool
+	// 建立检查点的容器，未选中的容器不转储内存，还原时使用原始镜像重新创建
+	Containers ContainerFilter
+	// 容器建立检查点失败时不中止，改为还原时使用原始镜像重新创建该容器
+	RecreateOnCheckpointFailure bool
+	// 是否为临时容器（如 kubectl debug 创建的调试容器）建立检查点，默认不转储
+	IncludeEphemeralContainers bool
+	// 建立检查点成功后是否保持容器暂停，使源 Pod 在转储后不再运行（如迁移时），之后可通过 Resume 恢复
+	//
+	// 不终止容器，避免 kubelet 按重启策略重新启动容器
+	LeavePaused bool
 }
 
 // RestoreOptions 还原选项
 type RestoreOptions struct {
 	// 还原的目标 Pod UID
 	PodUID string
+	// 还原的目标 Pod 名，为空时与检查点一致
+	PodName string
+	// 还原的目标 Pod 命名空间，为空时与检查点一致
+	PodNamespace string
+	// 还原的目标 Pod 主机名，为空时与检查点一致（若检查点主机名与 Pod 名一致，则跟随新 Pod 名）
+	Hostname string
+	// 追加或覆盖的 Pod 标签
+	Labels map[string]string
+	// 追加或覆盖的 Pod 注解
+	Annotations map[string]string
+	// 以容器名为键的容器资源限制覆盖
+	Resources map[string]ContainerResources
+	// 网络模式，为空时与检查点一致
+	NetworkMode NetworkMode
+	// 请求目标节点 CNI 复用源 Pod IP 的方式，网络模式为 NetworkModePreserveIP 时必须指定
+	IPRequester IPRequester
+	// 是否不还原检查点中 secret 、 configMap 、 projected 、 downwardAPI 卷的数据，而是等待 kubelet 重新投射
+	//
+	// kubelet 只为绑定到本节点的 Pod 投射卷，等待超时前 UID 为 PodUID 的 Pod 需要已绑定到本节点。
+	// 检查点中未包含的卷（如默认不拷贝的 secret 卷）总是等待 kubelet 重新投射
+	RematerializeVolumes bool
+	// 等待 kubelet 重新投射卷内容的超时时间，为 0 时使用 DefaultVolumeWaitTimeout
+	VolumeWaitTimeout time.Duration
+	// 是否跳过还原前的兼容性检查
+	SkipPreflight bool
+	// 从检查点还原的容器，未选中的容器使用原始镜像重新创建
+	Containers ContainerFilter
+	// 目标 Pod 声明的临时容器名，检查点中未在此声明的临时容器不会被还原或重新创建
+	EphemeralContainers []string
+}
+
+// ContainerFilter 按容器名选择容器
+type ContainerFilter struct {
+	// 选择的容器，为空表示选择所有容器
+	Include []string
+	// 排除的容器，优先于 Include
+	Exclude []string
+}
+
+// Match 判断容器是否被选中
+func (f ContainerFilter) Match(name string) bool {
+	if slices.Contains(f.Exclude, name) {
+		return false
+	}
+	return len(f.Include) == 0 || slices.Contains(f.Include, name)
+}
+
+// Validate 校验选择条件中的容器名都在 names 中
+func (f ContainerFilter) Validate(names []string) error {
+	for _, name := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if !slices.Contains(names, name) {
+			return fmt.Errorf("container %q not found, available containers: %v", name, names)
+		}
+	}
+	return nil
+}
+
+// ContainerResources 容器资源限制
+type ContainerResources struct {
+	// CPU 限制（ millicore ），为 0 表示不修改
+	MilliCPU int64
+	// 内存限制（字节），为 0 表示不修改
+	MemoryBytes int64
+}
+
+// IPRequester 请求目标节点 CNI 为还原的沙盒分配指定 IP
+type IPRequester interface {
+	// RequestIPs 在创建沙盒前调用，通过修改沙盒配置请求 CNI 分配指定 IP
+	RequestIPs(ctx context.Context, config *runtimev1.PodSandboxConfig, ips []string) error
+}
+
+// RestorePlan 还原计划
+type RestorePlan struct {
+	// 转换后的 Pod 沙盒配置
+	SandboxConfig *runtimev1.PodSandboxConfig `json:"sandboxConfig,omitempty"`
+	// 网络模式
+	NetworkMode NetworkMode `json:"networkMode,omitempty"`
+	// 复用源 Pod IP 时将向 IPRequester 请求的 IP ，计划中不执行请求
+	RequestIPs []string `json:"requestIPs,omitempty"`
+	// 将导入的检查点镜像
+	Images []string `json:"images,omitempty"`
+	// 将按顺序还原的容器
+	Containers []ContainerRestorePlan `json:"containers,omitempty"`
+	// 将写入的 kubelet Pod 目录文件
+	Files []FileRestorePlan `json:"files,omitempty"`
+}
+
+// ContainerRestorePlan 容器还原计划
+type ContainerRestorePlan struct {
+	// 容器名
+	Name string `json:"name"`
+	// 检查点镜像，为空表示使用原始镜像重新创建
+	CheckpointImage string `json:"checkpointImage,omitempty"`
+	// 重新创建容器使用的原始镜像
+	Image string `json:"image,omitempty"`
+	// 容器已退出，不还原也不重新运行
+	Exited bool `json:"exited,omitempty"`
+	// 已退出容器的退出码
+	ExitCode int32 `json:"exitCode,omitempty"`
+	// 容器配置改写记录
+	SpecChanges []string `json:"specChanges,omitempty"`
+}
+
+// FileRestorePlan 文件还原计划
+type FileRestorePlan struct {
+	// 文件路径
+	Path string `json:"path"`
+	// 文件模式
+	Mode os.FileMode `json:"mode,omitempty"`
+	// 文件大小
+	Size int64 `json:"size,omitempty"`
+	// 与已有文件的冲突，为空表示没有冲突
+	Conflict string `json:"conflict,omitempty"`
+}
+
+// PreflightSeverity 兼容性问题的严重程度
+type PreflightSeverity string
+
+// PreflightSeverity 的可选值
+const (
+	// PreflightSeverityBlocking 会导致还原失败的问题
+	PreflightSeverityBlocking PreflightSeverity = "blocking"
+	// PreflightSeverityWarning 可能导致还原失败或还原后行为不一致的问题
+	PreflightSeverityWarning PreflightSeverity = "warning"
+)
+
+// PreflightReport 检查点与目标节点的兼容性检查报告
+type PreflightReport struct {
+	// 发现的问题
+	Issues []PreflightIssue
+}
+
+// Add 添加问题
+func (r *PreflightReport) Add(severity PreflightSeverity, item, message string) {
+	r.Issues = append(r.Issues, PreflightIssue{
+		Severity: severity,
+		Item:     item,
+		Message:  message,
+	})
+}
+
+// Blocking 获取所有会导致还原失败的问题
+func (r *PreflightReport) Blocking() []PreflightIssue {
+	var ret []PreflightIssue
+	for _, issue := range r.Issues {
+		if issue.Severity == PreflightSeverityBlocking {
+			ret = append(ret, issue)
+		}
+	}
+	return ret
+}
+
+// PreflightIssue 兼容性问题
+type PreflightIssue struct {
+	// 严重程度
+	Severity PreflightSeverity
+	// 检查项，如 criu 、 kernel
+	Item string
+	// 问题描述
+	Message string
+}
+
+// String 返回问题的字符串表示
+func (i PreflightIssue) String() string {
+	return i.Item + ": " + i.Message
 }
@@ -0,0 +1,91 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestContainerFilterMatch 测试按容器名选择容器，排除优先于选择
+func TestContainerFilterMatch(t *testing.T) {
+	cases := []struct {
+		name     string
+		filter   ContainerFilter
+		expected map[string]bool
+	}{
+		{
+			name:     "All",
+			filter:   ContainerFilter{},
+			expected: map[string]bool{"app": true, "sidecar": true},
+		},
+		{
+			name:     "Include",
+			filter:   ContainerFilter{Include: []string{"app"}},
+			expected: map[string]bool{"app": true, "sidecar": false},
+		},
+		{
+			name:     "Exclude",
+			filter:   ContainerFilter{Exclude: []string{"sidecar"}},
+			expected: map[string]bool{"app": true, "sidecar": false},
+		},
+		{
+			name:     "ExcludeOverridesInclude",
+			filter:   ContainerFilter{Include: []string{"app", "sidecar"}, Exclude: []string{"sidecar"}},
+			expected: map[string]bool{"app": true, "sidecar": false},
+		},
+		{
+			name:     "IncludeAndExcludeSame",
+			filter:   ContainerFilter{Include: []string{"app"}, Exclude: []string{"app"}},
+			expected: map[string]bool{"app": false, "sidecar": false},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			for name, expected := range c.expected {
+				if got := c.filter.Match(name); got != expected {
+					t.Errorf("expected Match(%q) %t, got %t", name, expected, got)
+				}
+			}
+		})
+	}
+}
+
+// TestContainerFilterValidate 测试校验选择和排除的容器名都存在
+func TestContainerFilterValidate(t *testing.T) {
+	names := []string{"app", "sidecar"}
+	cases := []struct {
+		name        string
+		filter      ContainerFilter
+		expectedErr string
+	}{
+		{name: "Empty", filter: ContainerFilter{}},
+		{name: "Known", filter: ContainerFilter{Include: []string{"app"}, Exclude: []string{"sidecar"}}},
+		{name: "IncludeAndExcludeSame", filter: ContainerFilter{Include: []string{"app"}, Exclude: []string{"app"}}},
+		{
+			name:        "UnknownInclude",
+			filter:      ContainerFilter{Include: []string{"app", "web"}},
+			expectedErr: `container "web" not found`,
+		},
+		{
+			name:        "UnknownExclude",
+			filter:      ContainerFilter{Exclude: []string{"Sidecar"}},
+			expectedErr: `container "Sidecar" not found`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := c.filter.Validate(names)
+			if c.expectedErr == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.expectedErr) {
+				t.Fatalf("expected error containing %q, got %v", c.expectedErr, err)
+			}
+			if !strings.Contains(err.Error(), "available containers: [app sidecar]") {
+				t.Errorf("expected available containers in error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,429 @@
+package containerd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+	"github.com/yhlooo/podmig/pkg/podcr/containerd/fake"
+)
+
+var updateArchives = flag.Bool("update-archives", false, "regenerate fixture archives in testdata/archives")
+
+const (
+	fixtureSandboxID   = "8a9b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b"
+	fixtureContainerID = "4e5f6a7b8c9d0e1f2a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091"
+	fixturePid         = 12345
+)
+
+// fixtureModTime 固定的文件修改时间，使生成的归档稳定
+var fixtureModTime = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+// fixtureArchiveVersions 生成并测试的归档格式版本
+var fixtureArchiveVersions = []int{archiveFormatVersionLegacy, archiveFormatVersionV1}
+
+// fixtureKubeletPodDir 源节点的 kubelet Pod 目录
+func fixtureKubeletPodDir() string {
+	return filepath.Join(defaultKubeletRootDir, kubeletPodsDirName, testPodUID)
+}
+
+// fixtureSandboxInfo 源沙盒信息
+func fixtureSandboxInfo() *SandboxInfo {
+	cgroupParent := "/kubepods/besteffort/pod" + testPodUID
+	return &SandboxInfo{
+		ID:  fixtureSandboxID,
+		IPs: []string{"10.244.1.5"},
+		Pid: fixturePid,
+		Config: &runtimev1.PodSandboxConfig{
+			Metadata: &runtimev1.PodSandboxMetadata{
+				Name:      testPodName,
+				Namespace: testPodNamespace,
+				Uid:       testPodUID,
+			},
+			Hostname:     testPodName,
+			LogDirectory: fmt.Sprintf("/var/log/pods/%s_%s_%s", testPodNamespace, testPodName, testPodUID),
+			Labels: map[string]string{
+				labelPodName:      testPodName,
+				labelPodNamespace: testPodNamespace,
+				labelPodUID:       testPodUID,
+			},
+			Linux: &runtimev1.LinuxPodSandboxConfig{
+				CgroupParent: cgroupParent,
+				SecurityContext: &runtimev1.LinuxSandboxSecurityContext{
+					NamespaceOptions: &runtimev1.NamespaceOption{Ipc: runtimev1.NamespaceMode_NODE},
+				},
+			},
+		},
+		RuntimeSpec: &ociruntime.Spec{
+			Hostname: testPodName,
+			Linux:    &ociruntime.Linux{CgroupsPath: filepath.Join(cgroupParent, fixtureSandboxID)},
+		},
+	}
+}
+
+// fixtureContainerSpec 源容器配置
+func fixtureContainerSpec() *ociruntime.Spec {
+	podDir := fixtureKubeletPodDir()
+	return &ociruntime.Spec{
+		Hostname: testPodName,
+		Process: &ociruntime.Process{
+			Args: []string{"server", "--listen=10.244.1.5:8080"},
+			Env: []string{
+				"HOSTNAME=" + testPodName,
+				"POD_IP=10.244.1.5",
+				"UPSTREAM=10.244.1.50:80",
+			},
+			Cwd: "/",
+		},
+		Mounts: []ociruntime.Mount{
+			{Destination: "/etc/hosts", Type: "bind", Source: filepath.Join(podDir, kubeletPodHostsFileName)},
+			{
+				Destination: "/data",
+				Type:        "bind",
+				Source:      filepath.Join(podDir, kubeletPodVolumesDirName, "kubernetes.io~empty-dir", "data"),
+			},
+		},
+		Annotations: map[string]string{
+			containerAnnoContainerName:      testContainerName,
+			containerAnnoSandboxName:        testPodName,
+			containerAnnoSandboxNamespace:   testPodNamespace,
+			"io.kubernetes.cri.sandbox-id":  fixtureSandboxID,
+			"io.kubernetes.cri.sandbox-uid": testPodUID,
+		},
+		Linux: &ociruntime.Linux{
+			CgroupsPath: filepath.Join("/kubepods/besteffort/pod"+testPodUID, fixtureContainerID),
+			Namespaces: []ociruntime.LinuxNamespace{
+				{Type: ociruntime.PIDNamespace},
+				{Type: ociruntime.NetworkNamespace, Path: fmt.Sprintf("/proc/%d/ns/net", fixturePid)},
+			},
+		},
+	}
+}
+
+// buildFixtureArchive 生成指定格式版本的检查点归档，mutateInfo 不为 nil 时用于修改检查点信息
+func buildFixtureArchive(t *testing.T, version int, mutateInfo func(info *CheckpointInfo)) []byte {
+	ctx := context.Background()
+
+	// 容器检查点镜像
+	b := fake.NewBackend()
+	b.AddContainer(fixtureContainerID, fixtureContainerSpec(), []byte("heap: counter=42"))
+	img, err := b.Checkpoint(ctx, fixtureContainerID, "checkpoint-fixture:default_web-0_app")
+	if err != nil {
+		t.Fatalf("checkpoint fixture container error: %v", err)
+	}
+	containerTar := &bytes.Buffer{}
+	if err := b.Export(ctx, containerTar, img.Name); err != nil {
+		t.Fatalf("export fixture checkpoint image error: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	writeFile := func(name string, mode int64, data []byte) {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     mode,
+			Size:     int64(len(data)),
+			ModTime:  fixtureModTime,
+		}); err != nil {
+			t.Fatalf("write tar header %q error: %v", name, err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatalf("write tar file %q error: %v", name, err)
+		}
+	}
+	writeDir := func(name string) {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     name + "/",
+			Mode:     0o755,
+			ModTime:  fixtureModTime,
+		}); err != nil {
+			t.Fatalf("write tar header %q error: %v", name, err)
+		}
+	}
+	writeJSON := func(name string, v interface{}) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("marshal %q error: %v", name, err)
+		}
+		writeFile(name, 0o644, data)
+	}
+
+	writeJSON(sandboxInfoJSONName, fixtureSandboxInfo())
+	if version >= archiveFormatVersionV1 {
+		info := &CheckpointInfo{
+			FormatVersion: version,
+			ID:            "fixture",
+			KubeletPodDir: fixtureKubeletPodDir(),
+			Volumes: []VolumeInfo{{
+				Name:   "data",
+				Plugin: emptyDirVolumePlugin,
+				Policy: common.VolumePolicyCopy,
+				Path:   filepath.Join(kubeletPodVolumesDirName, "kubernetes.io~empty-dir", "data"),
+			}},
+			Containers: []ContainerInfo{{
+				Name:   testContainerName,
+				ID:     fixtureContainerID,
+				Image:  "docker.io/library/busybox:1.36",
+				Action: ContainerActionCheckpoint,
+			}},
+		}
+		if mutateInfo != nil {
+			mutateInfo(info)
+		}
+		writeJSON(checkpointInfoJSONName, info)
+	}
+	writeFile(containerCheckpointTarNamePrefix+testContainerName+".tar", 0o644, containerTar.Bytes())
+	podDir := kubeletPodDirTarNamePrefix + fixtureKubeletPodDir()
+	writeDir(podDir)
+	writeFile(podDir+"/"+kubeletPodHostsFileName, 0o644, []byte("10.244.1.5\t"+testPodName+"\n"))
+	writeDir(podDir + "/" + kubeletPodVolumesDirName)
+	writeDir(podDir + "/" + kubeletPodVolumesDirName + "/kubernetes.io~empty-dir")
+	writeDir(podDir + "/" + kubeletPodVolumesDirName + "/kubernetes.io~empty-dir/data")
+	writeFile(podDir+"/"+kubeletPodVolumesDirName+"/kubernetes.io~empty-dir/data/state", 0o600, []byte("counter=42\n"))
+
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar writer error: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("close gzip writer error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// fixtureRestoreResult 还原固定归档的结果
+type fixtureRestoreResult struct {
+	SandboxConfig *runtimev1.PodSandboxConfig `json:"sandboxConfig"`
+	Containers    []*ociruntime.Spec          `json:"containers"`
+	Files         []string                    `json:"files"`
+}
+
+// TestRestoreFixtureArchives 测试还原各格式版本的固定归档
+func TestRestoreFixtureArchives(t *testing.T) {
+	for _, version := range fixtureArchiveVersions {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			ctx := context.Background()
+			archivePath := filepath.Join("testdata", "archives", fmt.Sprintf("v%d.tar.gz", version))
+			if *updateArchives {
+				if err := os.WriteFile(archivePath, buildFixtureArchive(t, version, nil), 0o644); err != nil {
+					t.Fatalf("write fixture archive error: %v", err)
+				}
+			}
+			f, err := os.Open(archivePath)
+			if err != nil {
+				t.Fatalf("open fixture archive error: %v", err)
+			}
+			defer func() { _ = f.Close() }()
+			gr, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatalf("open gzip reader error: %v", err)
+			}
+
+			dst := newTestNode(t)
+			if err := dst.mgr.Restore(ctx, tar.NewReader(gr), common.RestoreOptions{
+				PodUID:        testRestoredUID,
+				PodName:       "web-1",
+				SkipPreflight: true,
+			}); err != nil {
+				t.Fatalf("restore error: %v", err)
+			}
+
+			// 收集还原结果
+			result := &fixtureRestoreResult{}
+			sandboxes, err := dst.cri.ListPodSandbox(ctx, nil)
+			if err != nil || len(sandboxes) != 1 {
+				t.Fatalf("expected 1 restored sandbox, got %d (%v)", len(sandboxes), err)
+			}
+			status, err := dst.cri.PodSandboxStatus(ctx, sandboxes[0].Id, true)
+			if err != nil {
+				t.Fatalf("get sandbox status error: %v", err)
+			}
+			sandboxInfo := &SandboxInfo{}
+			if err := json.Unmarshal([]byte(status.Info["info"]), sandboxInfo); err != nil {
+				t.Fatalf("unmarshal sandbox info error: %v", err)
+			}
+			result.SandboxConfig = sandboxInfo.Config
+			replacer := []string{sandboxes[0].Id, "<sandbox-id>"}
+			for _, c := range dst.backend.Containers() {
+				result.Containers = append(result.Containers, c.Spec)
+				replacer = append(replacer, c.ID, "<container-id>")
+			}
+			err = filepath.Walk(dst.kubeletRootDir, func(path string, info os.FileInfo, err error) error {
+				if err != nil || path == dst.kubeletRootDir {
+					return err
+				}
+				relPath, _ := filepath.Rel(dst.kubeletRootDir, path)
+				entry := fmt.Sprintf("%s %s", info.Mode(), filepath.ToSlash(relPath))
+				if info.Mode().IsRegular() {
+					data, err := os.ReadFile(path)
+					if err != nil {
+						return err
+					}
+					entry += fmt.Sprintf(" %q", data)
+				}
+				result.Files = append(result.Files, entry)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("walk restored kubelet root error: %v", err)
+			}
+			sort.Strings(result.Files)
+
+			raw, err := json.MarshalIndent(result, "", "  ")
+			if err != nil {
+				t.Fatalf("marshal result error: %v", err)
+			}
+			got := strings.NewReplacer(append(replacer, dst.kubeletRootDir, "<kubelet-root>")...).Replace(string(raw)) + "\n"
+
+			goldenPath := filepath.Join("testdata", "archives", fmt.Sprintf("v%d.golden.json", version))
+			if *update {
+				if err := os.WriteFile(goldenPath, []byte(got), 0o644); err != nil {
+					t.Fatalf("write golden file error: %v", err)
+				}
+			}
+			expected, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("read golden file error: %v", err)
+			}
+			if string(expected) != got {
+				t.Errorf("restore result mismatch golden file %s, run with -update and check the diff:\n%s", goldenPath, got)
+			}
+		})
+	}
+}
+
+// TestRestoreFixtureArchiveUnsupportedVersion 测试拒绝更新格式版本的归档
+func TestRestoreFixtureArchiveUnsupportedVersion(t *testing.T) {
+	ctx := context.Background()
+	gr, err := gzip.NewReader(bytes.NewReader(buildFixtureArchive(t, currentArchiveFormatVersion+1, nil)))
+	if err != nil {
+		t.Fatalf("open gzip reader error: %v", err)
+	}
+	dst := newTestNode(t)
+	err = dst.mgr.Restore(ctx, tar.NewReader(gr), common.RestoreOptions{SkipPreflight: true})
+	if err == nil || !strings.Contains(err.Error(), "unsupported checkpoint format version") {
+		t.Errorf("expected unsupported format version error, got %v", err)
+	}
+	if imgs := dst.backend.Images(); len(imgs) != 0 {
+		t.Errorf("expected no image imported, got %d", len(imgs))
+	}
+}
+
+// TestRestorePreflightBeforeImport 测试兼容性检查失败时不导入镜像、不写入文件
+func TestRestorePreflightBeforeImport(t *testing.T) {
+	ctx := context.Background()
+	archive := buildFixtureArchive(t, archiveFormatVersionV1, func(info *CheckpointInfo) {
+		info.BaseImages = []string{"docker.io/library/not-exists:latest"}
+	})
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("open gzip reader error: %v", err)
+	}
+	dst := newTestNode(t)
+	err = dst.mgr.Restore(ctx, tar.NewReader(gr), common.RestoreOptions{PodUID: testRestoredUID})
+	if err == nil || !strings.Contains(err.Error(), "preflight error") {
+		t.Fatalf("expected preflight error, got %v", err)
+	}
+	if imgs := dst.backend.Images(); len(imgs) != 0 {
+		t.Errorf("expected no image imported before preflight, got %d", len(imgs))
+	}
+	if entries, err := os.ReadDir(dst.kubeletRootDir); err != nil || len(entries) != 0 {
+		t.Errorf("expected no kubelet file written before preflight, got %d (%v)", len(entries), err)
+	}
+	if len(dst.cri.Sandboxes) != 0 {
+		t.Errorf("expected no sandbox created, got %d", len(dst.cri.Sandboxes))
+	}
+}
+
+// TestRestoreRecreatedContainerImage 测试重新创建的容器的镜像不存在时拉取源容器的镜像名
+func TestRestoreRecreatedContainerImage(t *testing.T) {
+	const (
+		sidecarImage    = "docker.io/library/busybox:1.36"
+		sidecarImageRef = "sha256:3f57d9401f8d42f986df300f0c69192fc41da28ccc8d797829467780db3dd741"
+	)
+	withSidecar := func(info *CheckpointInfo) {
+		info.Containers = append(info.Containers, ContainerInfo{
+			Name:     "sidecar",
+			ID:       "sidecar-id",
+			Image:    sidecarImage,
+			ImageRef: sidecarImageRef,
+			Action:   ContainerActionRecreate,
+			Config: &runtimev1.ContainerConfig{
+				Metadata: &runtimev1.ContainerMetadata{Name: "sidecar"},
+				Image:    &runtimev1.ImageSpec{Image: sidecarImage},
+			},
+		})
+	}
+
+	cases := []struct {
+		name          string
+		existing      []string
+		expectedImage string
+		expectedPulls []string
+	}{
+		{
+			name:          "ImageRefExists",
+			existing:      []string{sidecarImageRef},
+			expectedImage: sidecarImageRef,
+		},
+		{
+			name:          "PullImageName",
+			expectedImage: sidecarImage, // FakeImageService 以镜像名作为拉取到的镜像 ID
+			expectedPulls: []string{sidecarImage},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			gr, err := gzip.NewReader(bytes.NewReader(buildFixtureArchive(t, archiveFormatVersionV1, withSidecar)))
+			if err != nil {
+				t.Fatalf("open gzip reader error: %v", err)
+			}
+			dst := newTestNode(t)
+			dst.images.SetFakeImages(c.existing)
+			if err := dst.mgr.Restore(ctx, tar.NewReader(gr), common.RestoreOptions{
+				PodUID:        testRestoredUID,
+				SkipPreflight: true,
+			}); err != nil {
+				t.Fatalf("restore error: %v", err)
+			}
+
+			for _, img := range c.expectedPulls {
+				dst.images.AssertImagePulledWithAuth(t, &runtimev1.ImageSpec{Image: img}, nil, "image not pulled")
+			}
+			if len(c.expectedPulls) == 0 && slices.Contains(dst.images.Called, "PullImage") {
+				t.Errorf("expected no image pulled, got calls %v", dst.images.Called)
+			}
+			found := false
+			for _, container := range dst.cri.Containers {
+				if container.GetMetadata().GetName() != "sidecar" {
+					continue
+				}
+				found = true
+				if got := container.GetImage().GetImage(); got != c.expectedImage {
+					t.Errorf("expected sidecar created from image %q, got %q", c.expectedImage, got)
+				}
+			}
+			if !found {
+				t.Errorf("sidecar container not recreated")
+			}
+		})
+	}
+}
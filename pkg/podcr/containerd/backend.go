@@ -0,0 +1,208 @@
+package containerd
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/cio"
+	"github.com/containerd/containerd/cmd/ctr/commands/tasks"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/images/archive"
+	"github.com/containerd/typeurl/v2"
+	ociimg "github.com/opencontainers/image-spec/specs-go/v1"
+	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/yhlooo/podmig/pkg/podcr/containerd/checkpointimage"
+)
+
+// ImageService 检查点镜像操作
+type ImageService interface {
+	// Get 获取镜像
+	Get(ctx context.Context, name string) (images.Image, error)
+	// Create 创建镜像
+	Create(ctx context.Context, image images.Image) (images.Image, error)
+	// Delete 删除镜像
+	Delete(ctx context.Context, name string) error
+	// Import 从 r 导入镜像
+	Import(ctx context.Context, r io.Reader) ([]images.Image, error)
+	// Export 将镜像导出到 w
+	Export(ctx context.Context, w io.Writer, name string) error
+}
+
+// ContentStore 检查点镜像内容存储
+type ContentStore interface {
+	content.Provider
+	content.Ingester
+}
+
+// ContainerService 容器和 task 操作
+type ContainerService interface {
+	// Spec 获取容器配置
+	Spec(ctx context.Context, id string) (*ociruntime.Spec, error)
+	// TaskStatus 获取容器 task 状态
+	TaskStatus(ctx context.Context, id string) (containerd.Status, error)
+	// PauseTask 暂停容器 task
+	PauseTask(ctx context.Context, id string) error
+	// ResumeTask 恢复容器 task
+	ResumeTask(ctx context.Context, id string) error
+	// Checkpoint 为容器建立名为 ref 的检查点镜像
+	Checkpoint(ctx context.Context, id, ref string, opts ...containerd.CheckpointOpts) (images.Image, error)
+	// Restore 从检查点镜像创建 ID 为 id 的容器，并还原、启动其 task
+	Restore(ctx context.Context, id string, checkpoint images.Image) error
+}
+
+var _ ImageService = &checkpointimage.MemoryStore{}
+var _ ContentStore = &checkpointimage.MemoryStore{}
+
+// containerdBackend 基于 containerd 客户端的 ImageService 、 ContentStore 和 ContainerService 实现
+type containerdBackend struct {
+	client *containerd.Client
+}
+
+var _ ImageService = &containerdBackend{}
+var _ ContentStore = &containerdBackend{}
+var _ ContainerService = &containerdBackend{}
+
+// newContainerdBackend 创建一个 *containerdBackend
+func newContainerdBackend(client *containerd.Client) *containerdBackend {
+	return &containerdBackend{client: client}
+}
+
+// Get 获取镜像
+func (b *containerdBackend) Get(ctx context.Context, name string) (images.Image, error) {
+	return b.client.ImageService().Get(ctx, name)
+}
+
+// Create 创建镜像
+func (b *containerdBackend) Create(ctx context.Context, image images.Image) (images.Image, error) {
+	return b.client.ImageService().Create(ctx, image)
+}
+
+// Delete 删除镜像
+func (b *containerdBackend) Delete(ctx context.Context, name string) error {
+	return b.client.ImageService().Delete(ctx, name)
+}
+
+// Import 从 r 导入镜像
+func (b *containerdBackend) Import(ctx context.Context, r io.Reader) ([]images.Image, error) {
+	return b.client.Import(ctx, r)
+}
+
+// Export 将镜像导出到 w
+func (b *containerdBackend) Export(ctx context.Context, w io.Writer, name string) error {
+	return b.client.Export(ctx, w, archive.WithImage(b.client.ImageService(), name))
+}
+
+// ReaderAt 获取内容读取器
+func (b *containerdBackend) ReaderAt(ctx context.Context, desc ociimg.Descriptor) (content.ReaderAt, error) {
+	return b.client.ContentStore().ReaderAt(ctx, desc)
+}
+
+// Writer 获取内容写入器
+func (b *containerdBackend) Writer(ctx context.Context, opts ...content.WriterOpt) (content.Writer, error) {
+	return b.client.ContentStore().Writer(ctx, opts...)
+}
+
+// Spec 获取容器配置
+func (b *containerdBackend) Spec(ctx context.Context, id string) (*ociruntime.Spec, error) {
+	container, err := b.client.ContainerService().Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	spec := &ociruntime.Spec{}
+	if err := typeurl.UnmarshalTo(container.Spec, spec); err != nil {
+		return nil, fmt.Errorf("unmarshal spec error: %w", err)
+	}
+	return spec, nil
+}
+
+// TaskStatus 获取容器 task 状态
+func (b *containerdBackend) TaskStatus(ctx context.Context, id string) (containerd.Status, error) {
+	task, err := b.loadTask(ctx, id)
+	if err != nil {
+		return containerd.Status{}, err
+	}
+	return task.Status(ctx)
+}
+
+// PauseTask 暂停容器 task
+func (b *containerdBackend) PauseTask(ctx context.Context, id string) error {
+	task, err := b.loadTask(ctx, id)
+	if err != nil {
+		return err
+	}
+	return task.Pause(ctx)
+}
+
+// ResumeTask 恢复容器 task
+func (b *containerdBackend) ResumeTask(ctx context.Context, id string) error {
+	task, err := b.loadTask(ctx, id)
+	if err != nil {
+		return err
+	}
+	return task.Resume(ctx)
+}
+
+// Checkpoint 为容器建立名为 ref 的检查点镜像
+func (b *containerdBackend) Checkpoint(
+	ctx context.Context,
+	id, ref string,
+	opts ...containerd.CheckpointOpts,
+) (images.Image, error) {
+	container, err := b.client.LoadContainer(ctx, id)
+	if err != nil {
+		return images.Image{}, fmt.Errorf("load container %q error: %w", id, err)
+	}
+	img, err := container.Checkpoint(ctx, ref, opts...)
+	if err != nil {
+		return images.Image{}, err
+	}
+	return img.Metadata(), nil
+}
+
+// Restore 从检查点镜像创建 ID 为 id 的容器，并还原、启动其 task
+func (b *containerdBackend) Restore(ctx context.Context, id string, checkpoint images.Image) error {
+	checkpointImage := containerd.NewImage(b.client, checkpoint)
+
+	// 还原容器
+	container, err := b.client.Restore(
+		ctx, id, checkpointImage,
+		containerd.WithRestoreImage,
+		containerd.WithRestoreSpec,
+		containerd.WithRestoreRuntime,
+		containerd.WithRestoreRW,
+	)
+	if err != nil {
+		return err
+	}
+
+	// 还原进程
+	task, err := tasks.NewTask(
+		ctx, b.client, container, "", nil, false, "",
+		[]cio.Opt{},
+		containerd.WithTaskCheckpoint(checkpointImage),
+	)
+	if err != nil {
+		return fmt.Errorf("restore task in container error: %w", err)
+	}
+	if err := task.Start(ctx); err != nil {
+		return fmt.Errorf("start task in container error: %w", err)
+	}
+	return nil
+}
+
+// loadTask 获取容器 task
+func (b *containerdBackend) loadTask(ctx context.Context, id string) (containerd.Task, error) {
+	container, err := b.client.LoadContainer(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("load container %q error: %w", id, err)
+	}
+	task, err := container.Task(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("get task for container %q error: %w", id, err)
+	}
+	return task, nil
+}
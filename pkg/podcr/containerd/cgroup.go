@@ -0,0 +1,133 @@
+package containerd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const (
+	// containerd CRI 插件在 systemd cgroup 驱动下使用的 scope 前缀
+	systemdCgroupScopePrefix = "cri-containerd"
+)
+
+// CgroupDriver cgroup 驱动
+type CgroupDriver string
+
+// CgroupDriver 的可选值
+const (
+	CgroupDriverSystemd  CgroupDriver = "systemd"
+	CgroupDriverCgroupfs CgroupDriver = "cgroupfs"
+)
+
+// CgroupTarget 还原容器的目标 cgroup 信息
+type CgroupTarget struct {
+	// Pod 级别 cgroup ，如 kubepods-burstable-pod<uid>.slice 或 /kubepods/burstable/pod<uid>
+	Parent string
+	// cgroup 驱动
+	Driver CgroupDriver
+	// 是否为 cgroup v2
+	V2 bool
+}
+
+// ContainerCgroupsPath 获取指定容器的 cgroups 路径
+func (t CgroupTarget) ContainerCgroupsPath(containerID string) string {
+	if t.Driver == CgroupDriverSystemd {
+		return t.Parent + ":" + systemdCgroupScopePrefix + ":" + containerID
+	}
+	return filepath.Join(t.Parent, containerID)
+}
+
+// getCgroupTarget 基于还原后的沙盒获取目标 cgroup 信息
+//
+// 优先从沙盒容器运行时配置的 cgroups 路径推断 Pod 级别 cgroup 和驱动，推断不出时使用沙盒配置中的 cgroup parent
+func getCgroupTarget(sandboxInfo *SandboxInfo, v2 bool) (CgroupTarget, error) {
+	target := CgroupTarget{
+		V2: v2,
+	}
+
+	sandboxCgroupsPath := ""
+	if sandboxInfo.RuntimeSpec != nil && sandboxInfo.RuntimeSpec.Linux != nil {
+		sandboxCgroupsPath = sandboxInfo.RuntimeSpec.Linux.CgroupsPath
+	}
+	switch {
+	case strings.Contains(sandboxCgroupsPath, ":"):
+		// systemd 驱动： <parent>:<prefix>:<id>
+		target.Driver = CgroupDriverSystemd
+		target.Parent = strings.SplitN(sandboxCgroupsPath, ":", 2)[0]
+	case sandboxCgroupsPath != "":
+		// cgroupfs 驱动： <parent>/<id>
+		target.Driver = CgroupDriverCgroupfs
+		target.Parent = filepath.Dir(sandboxCgroupsPath)
+	default:
+		target.Parent = sandboxInfo.Config.GetLinux().GetCgroupParent()
+		target.Driver = CgroupDriverCgroupfs
+		if strings.HasSuffix(target.Parent, ".slice") {
+			target.Driver = CgroupDriverSystemd
+		}
+	}
+
+	if target.Parent == "" {
+		return target, fmt.Errorf("can not determine cgroup parent of sandbox %q", sandboxInfo.ID)
+	}
+	return target, nil
+}
+
+// relocateCgroup 将容器配置中的 cgroup 重定位到目标 cgroup ，并移除目标 cgroup 版本不支持的资源限制
+func relocateCgroup(spec *ociruntime.Spec, target CgroupTarget, containerID string) []SpecRewriteRecord {
+	if spec.Linux == nil {
+		return nil
+	}
+
+	var records []SpecRewriteRecord
+	if spec.Linux.CgroupsPath != "" {
+		newPath := target.ContainerCgroupsPath(containerID)
+		if newPath != spec.Linux.CgroupsPath {
+			records = append(records, SpecRewriteRecord{
+				Field: "linux.cgroupsPath",
+				Rule:  "cgroup-" + string(target.Driver),
+				Old:   spec.Linux.CgroupsPath,
+				New:   newPath,
+			})
+			spec.Linux.CgroupsPath = newPath
+		}
+	}
+
+	res := spec.Linux.Resources
+	if res == nil {
+		return records
+	}
+	dropped := func(field, value string) {
+		records = append(records, SpecRewriteRecord{
+			Field: "linux.resources." + field,
+			Rule:  "cgroup-version",
+			Old:   value,
+			New:   "",
+		})
+	}
+	if target.V2 {
+		// cgroup v2 不支持内核内存限制和 swappiness
+		if res.Memory != nil {
+			if res.Memory.Kernel != nil {
+				dropped("memory.kernel", fmt.Sprint(*res.Memory.Kernel))
+				res.Memory.Kernel = nil
+			}
+			if res.Memory.KernelTCP != nil {
+				dropped("memory.kernelTCP", fmt.Sprint(*res.Memory.KernelTCP))
+				res.Memory.KernelTCP = nil
+			}
+			if res.Memory.Swappiness != nil {
+				dropped("memory.swappiness", fmt.Sprint(*res.Memory.Swappiness))
+				res.Memory.Swappiness = nil
+			}
+		}
+	} else if len(res.Unified) > 0 {
+		// cgroup v1 不支持 unified 资源限制
+		dropped("unified", fmt.Sprint(res.Unified))
+		res.Unified = nil
+	}
+
+	return records
+}
@@ -0,0 +1,8 @@
+package containerd
+
+import "github.com/containerd/cgroups/v3"
+
+// isCgroupV2 判断本节点是否使用 cgroup v2
+func isCgroupV2() bool {
+	return cgroups.Mode() == cgroups.Unified
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package containerd
+
+// isCgroupV2 判断本节点是否使用 cgroup v2
+//
+// 非 Linux 平台没有 cgroup ，总是返回 false
+func isCgroupV2() bool {
+	return false
+}
@@ -0,0 +1,210 @@
+package containerd
+
+import (
+	"reflect"
+	"testing"
+
+	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// TestGetCgroupTarget 测试从沙盒 cgroups 路径或沙盒配置的 cgroup parent 推断目标 cgroup
+func TestGetCgroupTarget(t *testing.T) {
+	cases := []struct {
+		name              string
+		cgroupsPath       string
+		cgroupParent      string
+		v2                bool
+		expected          CgroupTarget
+		expectedErr       bool
+		expectedContainer string
+	}{
+		{
+			name:              "SystemdV2",
+			cgroupsPath:       "kubepods-burstable-poduid.slice:cri-containerd:sandbox",
+			v2:                true,
+			expected:          CgroupTarget{Parent: "kubepods-burstable-poduid.slice", Driver: CgroupDriverSystemd, V2: true},
+			expectedContainer: "kubepods-burstable-poduid.slice:cri-containerd:app",
+		},
+		{
+			name:              "CgroupfsV1",
+			cgroupsPath:       "/kubepods/burstable/poduid/sandbox",
+			expected:          CgroupTarget{Parent: "/kubepods/burstable/poduid", Driver: CgroupDriverCgroupfs},
+			expectedContainer: "/kubepods/burstable/poduid/app",
+		},
+		{
+			name:              "PathOverridesParent",
+			cgroupsPath:       "/kubepods/poduid/sandbox",
+			cgroupParent:      "kubepods-poduid.slice",
+			v2:                true,
+			expected:          CgroupTarget{Parent: "/kubepods/poduid", Driver: CgroupDriverCgroupfs, V2: true},
+			expectedContainer: "/kubepods/poduid/app",
+		},
+		{
+			name:              "SystemdParent",
+			cgroupParent:      "kubepods-besteffort-poduid.slice",
+			v2:                true,
+			expected:          CgroupTarget{Parent: "kubepods-besteffort-poduid.slice", Driver: CgroupDriverSystemd, V2: true},
+			expectedContainer: "kubepods-besteffort-poduid.slice:cri-containerd:app",
+		},
+		{
+			name:              "CgroupfsParent",
+			cgroupParent:      "/kubepods/besteffort/poduid",
+			expected:          CgroupTarget{Parent: "/kubepods/besteffort/poduid", Driver: CgroupDriverCgroupfs},
+			expectedContainer: "/kubepods/besteffort/poduid/app",
+		},
+		{
+			name:        "Unknown",
+			v2:          true,
+			expectedErr: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sandboxInfo := &SandboxInfo{
+				ID: "sandbox",
+				Config: &runtimev1.PodSandboxConfig{
+					Linux: &runtimev1.LinuxPodSandboxConfig{CgroupParent: c.cgroupParent},
+				},
+			}
+			if c.cgroupsPath != "" {
+				sandboxInfo.RuntimeSpec = &ociruntime.Spec{Linux: &ociruntime.Linux{CgroupsPath: c.cgroupsPath}}
+			}
+
+			target, err := getCgroupTarget(sandboxInfo, c.v2)
+			if c.expectedErr {
+				if err == nil {
+					t.Errorf("expected error, got target %+v", target)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("get cgroup target error: %v", err)
+			}
+			if target != c.expected {
+				t.Errorf("expected target %+v, got %+v", c.expected, target)
+			}
+			if got := target.ContainerCgroupsPath("app"); got != c.expectedContainer {
+				t.Errorf("expected container cgroups path %q, got %q", c.expectedContainer, got)
+			}
+		})
+	}
+}
+
+// TestRelocateCgroup 测试重定位容器 cgroup 并移除目标 cgroup 版本不支持的资源限制
+func TestRelocateCgroup(t *testing.T) {
+	kernel := int64(1 << 20)
+	swappiness := uint64(60)
+	limit := int64(1 << 30)
+	newResources := func() *ociruntime.LinuxResources {
+		return &ociruntime.LinuxResources{
+			Memory: &ociruntime.LinuxMemory{
+				Limit:      &limit,
+				Kernel:     &kernel,
+				KernelTCP:  &kernel,
+				Swappiness: &swappiness,
+			},
+			Unified: map[string]string{"memory.high": "512M"},
+		}
+	}
+
+	cases := []struct {
+		name              string
+		cgroupsPath       string
+		target            CgroupTarget
+		expectedPath      string
+		expectedResources *ociruntime.LinuxResources
+		expectedRecords   []SpecRewriteRecord
+	}{
+		{
+			name:         "V1ToV2",
+			cgroupsPath:  "/kubepods/burstable/podold/old",
+			target:       CgroupTarget{Parent: "kubepods-burstable-podnew.slice", Driver: CgroupDriverSystemd, V2: true},
+			expectedPath: "kubepods-burstable-podnew.slice:cri-containerd:new",
+			expectedResources: &ociruntime.LinuxResources{
+				Memory:  &ociruntime.LinuxMemory{Limit: &limit},
+				Unified: map[string]string{"memory.high": "512M"},
+			},
+			expectedRecords: []SpecRewriteRecord{
+				{
+					Field: "linux.cgroupsPath",
+					Rule:  "cgroup-systemd",
+					Old:   "/kubepods/burstable/podold/old",
+					New:   "kubepods-burstable-podnew.slice:cri-containerd:new",
+				},
+				{Field: "linux.resources.memory.kernel", Rule: "cgroup-version", Old: "1048576"},
+				{Field: "linux.resources.memory.kernelTCP", Rule: "cgroup-version", Old: "1048576"},
+				{Field: "linux.resources.memory.swappiness", Rule: "cgroup-version", Old: "60"},
+			},
+		},
+		{
+			name:         "V2ToV1",
+			cgroupsPath:  "kubepods-burstable-podold.slice:cri-containerd:old",
+			target:       CgroupTarget{Parent: "/kubepods/burstable/podnew", Driver: CgroupDriverCgroupfs},
+			expectedPath: "/kubepods/burstable/podnew/new",
+			expectedResources: &ociruntime.LinuxResources{
+				Memory: &ociruntime.LinuxMemory{
+					Limit:      &limit,
+					Kernel:     &kernel,
+					KernelTCP:  &kernel,
+					Swappiness: &swappiness,
+				},
+			},
+			expectedRecords: []SpecRewriteRecord{
+				{
+					Field: "linux.cgroupsPath",
+					Rule:  "cgroup-cgroupfs",
+					Old:   "kubepods-burstable-podold.slice:cri-containerd:old",
+					New:   "/kubepods/burstable/podnew/new",
+				},
+				{Field: "linux.resources.unified", Rule: "cgroup-version", Old: "map[memory.high:512M]"},
+			},
+		},
+		{
+			name:         "SamePath",
+			cgroupsPath:  "kubepods-burstable-podnew.slice:cri-containerd:new",
+			target:       CgroupTarget{Parent: "kubepods-burstable-podnew.slice", Driver: CgroupDriverSystemd, V2: true},
+			expectedPath: "kubepods-burstable-podnew.slice:cri-containerd:new",
+			expectedResources: &ociruntime.LinuxResources{
+				Memory:  &ociruntime.LinuxMemory{Limit: &limit},
+				Unified: map[string]string{"memory.high": "512M"},
+			},
+			expectedRecords: []SpecRewriteRecord{
+				{Field: "linux.resources.memory.kernel", Rule: "cgroup-version", Old: "1048576"},
+				{Field: "linux.resources.memory.kernelTCP", Rule: "cgroup-version", Old: "1048576"},
+				{Field: "linux.resources.memory.swappiness", Rule: "cgroup-version", Old: "60"},
+			},
+		},
+		{
+			name:              "NoCgroupsPath",
+			target:            CgroupTarget{Parent: "/kubepods/burstable/podnew", Driver: CgroupDriverCgroupfs},
+			expectedResources: &ociruntime.LinuxResources{Memory: newResources().Memory},
+			expectedRecords: []SpecRewriteRecord{
+				{Field: "linux.resources.unified", Rule: "cgroup-version", Old: "map[memory.high:512M]"},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			spec := &ociruntime.Spec{Linux: &ociruntime.Linux{
+				CgroupsPath: c.cgroupsPath,
+				Resources:   newResources(),
+			}}
+			records := relocateCgroup(spec, c.target, "new")
+			if spec.Linux.CgroupsPath != c.expectedPath {
+				t.Errorf("expected cgroups path %q, got %q", c.expectedPath, spec.Linux.CgroupsPath)
+			}
+			if !reflect.DeepEqual(spec.Linux.Resources, c.expectedResources) {
+				t.Errorf("expected resources %+v, got %+v", c.expectedResources, spec.Linux.Resources)
+			}
+			if !reflect.DeepEqual(records, c.expectedRecords) {
+				t.Errorf("expected records %+v, got %+v", c.expectedRecords, records)
+			}
+		})
+	}
+
+	// 没有 Linux 配置时不改写
+	if records := relocateCgroup(&ociruntime.Spec{}, CgroupTarget{V2: true}, "new"); records != nil {
+		t.Errorf("expected no records, got %+v", records)
+	}
+}
@@ -8,21 +8,32 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"time"
 
 	"github.com/containerd/containerd"
-	"github.com/containerd/containerd/images/archive"
-	"github.com/containerd/typeurl/v2"
+	"github.com/containerd/containerd/images"
 	"github.com/go-logr/logr"
-	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	criapis "k8s.io/cri-api/pkg/apis"
 	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
 
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+	"github.com/yhlooo/podmig/pkg/podcr/events"
+	"github.com/yhlooo/podmig/pkg/podcr/metrics"
+	"github.com/yhlooo/podmig/pkg/podcr/tracing"
 	"github.com/yhlooo/podmig/pkg/utils/tarutil"
 )
 
 // Checkpoint 建立 Pod 检查点，并导出到 tw
-func (h *Manager) Checkpoint(ctx context.Context, checkpointID, namespace, name string, tw *tar.Writer) error {
+func (h *Manager) Checkpoint(
+	ctx context.Context,
+	checkpointID, namespace, name string,
+	tw *tar.Writer,
+	opts common.CheckpointOptions,
+) error {
 	tmpdir, err := os.MkdirTemp(h.tmpdir, "pod-checkpoint-")
 	if err != nil {
 		return fmt.Errorf("make temp dir error: %w", err)
@@ -32,10 +43,14 @@ func (h *Manager) Checkpoint(ctx context.Context, checkpointID, namespace, name
 	}()
 
 	return (&Checkpoint{
+		opts:                   opts,
 		tmpdir:                 tmpdir,
 		criClient:              h.criClient,
-		containerdClient:       h.containerdClient,
+		imageService:           h.imageService,
+		containerService:       h.containerService,
 		retainCheckpointImages: h.retainCheckpointImages,
+		kubeletPodsDir:         h.kubeletPodsDir(),
+		cgroupV2:               h.cgroupV2,
 		checkpointID:           checkpointID,
 		namespace:              namespace,
 		name:                   name,
@@ -45,33 +60,58 @@ func (h *Manager) Checkpoint(ctx context.Context, checkpointID, namespace, name
 
 // Checkpoint 建立 Pod 检查点
 type Checkpoint struct {
+	opts                   common.CheckpointOptions
 	tmpdir                 string
 	criClient              criapis.RuntimeService
-	containerdClient       *containerd.Client
+	imageService           ImageService
+	containerService       ContainerService
 	retainCheckpointImages bool
+	kubeletPodsDir         string
+	cgroupV2               bool
 	checkpointID           string
 	namespace              string
 	name                   string
 	tw                     *tar.Writer
 
-	sandboxInfo *SandboxInfo
-	containers  []*runtimev1.Container
+	sandboxInfo    *SandboxInfo
+	containers     []*runtimev1.Container
+	containersInfo []ContainerInfo
+	kubeletPodDir  string
+	mountPoints    mountPoints
+	volumes        []VolumeInfo
+	checkpointInfo *CheckpointInfo
+	// 暂存的内存介质卷，以卷目录为键，值为暂存的 tar 文件
+	stagedMemoryVolumes map[string]string
+	traceContext        map[string]string
+	// 建立检查点后保持暂停的容器
+	pausedContainers []string
 }
 
 // Do 执行建立 Pod 检查点操作
-func (c *Checkpoint) Do(ctx context.Context) error {
+func (c *Checkpoint) Do(ctx context.Context) (err error) {
+	start := time.Now()
+	defer func() { metrics.ObserveOperation(metrics.OperationCheckpoint, start, err) }()
+
 	podKey := c.namespace + "/" + c.name
 	logger := logr.FromContextOrDiscard(ctx).WithValues("pod", podKey)
 	ctx = logr.NewContext(ctx, logger)
 
+	ctx, span := tracing.Start(ctx, metrics.OperationCheckpoint, trace.WithAttributes(
+		attribute.String("pod.namespace", c.namespace),
+		attribute.String("pod.name", c.name),
+		attribute.String("checkpoint.id", c.checkpointID),
+	))
+	defer func() { tracing.End(span, err) }()
+	c.traceContext = tracing.Inject(ctx)
+
 	// 导出 Pod 沙盒
-	if err := c.exportPodSandbox(ctx); err != nil {
+	if err := runPhase(ctx, metrics.OperationCheckpoint, phaseExportSandbox, c.exportPodSandbox); err != nil {
 		return fmt.Errorf("export pod sandbox %q error: %w", podKey, err)
 	}
 	logger.Info(fmt.Sprintf("pod sandbox: %s", c.sandboxInfo.ID[:13]))
 
 	// 导出容器基础信息
-	if err := c.exportContainersInfo(ctx); err != nil {
+	if err := runPhase(ctx, metrics.OperationCheckpoint, phaseExportContainersInfo, c.exportContainersInfo); err != nil {
 		return fmt.Errorf("export containers info error: %w", err)
 	}
 	ids := make([]string, len(c.containers))
@@ -80,39 +120,186 @@ func (c *Checkpoint) Do(ctx context.Context) error {
 	}
 	logger.Info(fmt.Sprintf("containers: %v", ids))
 
-	// 按容器创建顺序反向创建检查点
+	// 确定 kubelet Pod 目录和卷的处理方式
+	if err := runPhase(ctx, metrics.OperationCheckpoint, phaseDecideVolumes, c.prepareVolumes); err != nil {
+		return fmt.Errorf("decide volumes error: %w", err)
+	}
+
+	// 暂停容器，建立容器检查点并暂存共享内存和内存介质卷的内容
+	pausedAt := time.Now()
+	checkpointImages, err := c.checkpointContainers(ctx)
+	if err != nil {
+		return err
+	}
+	if len(c.pausedContainers) > 0 {
+		logger.Info(fmt.Sprintf("leave %d containers paused", len(c.pausedContainers)))
+		defer func() {
+			// 导出失败时不再保持暂停
+			if err != nil {
+				c.resumeContainers(ctx, c.pausedContainers, pausedAt)
+			}
+		}()
+	}
+
+	// 导出检查点信息，此时各容器最终的还原方式已确定；
+	// 在容器检查点之前导出，使还原时可以在导入镜像、写入文件前检查兼容性
+	if err := runPhase(ctx, metrics.OperationCheckpoint, phaseExportCheckpointInfo, c.exportCheckpointInfo); err != nil {
+		return fmt.Errorf("export checkpoint info error: %w", err)
+	}
+
+	// 按容器创建顺序反向导出容器检查点
 	for i := len(c.containers) - 1; i >= 0; i-- {
 		cName := c.containers[i].Metadata.GetName()
-		// 创建容器检查点
-		logger.Info(fmt.Sprintf("checkpoint container %q", cName))
-		checkpointImage, err := c.checkpointContainer(ctx, c.containers[i])
-		if err != nil {
-			return fmt.Errorf("checkpoint container %q for pod %q error: %w", cName, podKey, err)
+		checkpoint, ok := checkpointImages[c.containers[i].Id]
+		if !ok {
+			continue
 		}
-		logger.Info(fmt.Sprintf("checkpoint: %s", checkpointImage.Name()))
-
-		// 将容器检查点镜像导出到文件
-		if err := c.exportContainerCheckpoint(ctx, cName, checkpointImage.Name()); err != nil {
+		start := time.Now()
+		cctx, end := startPhase(ctx, metrics.OperationCheckpoint, phaseExportContainer, cName)
+		size, err := c.exportContainerCheckpoint(cctx, cName, checkpoint.image.Name)
+		end(err)
+		if err != nil {
 			return fmt.Errorf("export container %q checkpoint for pod %q error: %w", cName, podKey, err)
 		}
+		events.Record(ctx, events.Event{
+			Type:       events.TypeContainerCheckpointed,
+			Container:  cName,
+			ID:         c.containers[i].Id,
+			DurationMS: (checkpoint.duration + time.Since(start)).Milliseconds(),
+			Bytes:      size,
+		})
+	}
+
+	// 导出沙盒共享内存
+	if err := runPhase(ctx, metrics.OperationCheckpoint, phaseExportSandboxShm, c.exportSandboxShm); err != nil {
+		return fmt.Errorf("export sandbox shm error: %w", err)
 	}
 
 	// 导出 kubelet Pod 目录
-	if err := c.exportKubeletPodDir(ctx); err != nil {
+	if err := runPhase(ctx, metrics.OperationCheckpoint, phaseExportKubeletPodDir, c.exportKubeletPodDir); err != nil {
 		return fmt.Errorf("export kubelet pod dir error: %w", err)
 	}
 
 	return nil
 }
 
+// resumeContainers 恢复暂停的容器
+//
+// ctx 已取消（如超时、中断）时也需要恢复，避免容器保持暂停
+func (c *Checkpoint) resumeContainers(ctx context.Context, ids []string, pausedAt time.Time) {
+	logger := logr.FromContextOrDiscard(ctx)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), resumeTimeout)
+	defer cancel()
+	for _, containerID := range ids {
+		if err := c.containerService.ResumeTask(ctx, containerID); err != nil {
+			logger.Error(err, fmt.Sprintf("resume task for container %q error", containerID))
+		}
+		metrics.ContainerFreezeDuration.Observe(time.Since(pausedAt).Seconds())
+	}
+}
+
+// resumeTimeout 建立检查点后恢复容器的超时时间
+const resumeTimeout = 10 * time.Second
+
+// containerCheckpoint 容器检查点镜像及建立检查点的耗时
+type containerCheckpoint struct {
+	image    images.Image
+	duration time.Duration
+}
+
+// checkpointContainers 暂停所有需要建立检查点的容器，按容器创建顺序反向建立检查点，
+// 并在容器暂停期间暂存沙盒共享内存和内存介质卷的内容，使其与容器检查点处于同一时刻
+//
+// 成功且要求保持暂停时，暂停的容器记录到 c.pausedContainers ，否则返回前恢复。
+// 返回以容器 ID 为键的检查点镜像
+func (c *Checkpoint) checkpointContainers(ctx context.Context) (_ map[string]containerCheckpoint, err error) {
+	logger := logr.FromContextOrDiscard(ctx)
+	podKey := c.namespace + "/" + c.name
+
+	// 暂停进程
+	var paused []string
+	pausedAt := time.Now()
+	defer func() {
+		if err == nil && c.opts.LeavePaused {
+			c.pausedContainers = paused
+			return
+		}
+		c.resumeContainers(ctx, paused, pausedAt)
+	}()
+	for i, container := range c.containers {
+		if c.containersInfo[i].Action != ContainerActionCheckpoint {
+			continue
+		}
+		if err := c.containerService.PauseTask(ctx, container.Id); err != nil {
+			return nil, fmt.Errorf("pause task for container %q error: %w", container.Id, err)
+		}
+		paused = append(paused, container.Id)
+	}
+
+	// 按容器创建顺序反向创建检查点
+	ret := make(map[string]containerCheckpoint, len(paused))
+	for i := len(c.containers) - 1; i >= 0; i-- {
+		cName := c.containers[i].Metadata.GetName()
+		info := &c.containersInfo[i]
+		if info.Action != ContainerActionCheckpoint {
+			if info.Action == ContainerActionExited {
+				logger.Info(fmt.Sprintf(
+					"skip checkpoint exited container %q (exit code %d, attempt %d)",
+					cName, info.Exited.GetExitCode(), info.Attempt,
+				))
+			} else {
+				logger.Info(fmt.Sprintf("skip checkpoint container %q (%s), it will be recreated on restore", cName, info.Reason))
+			}
+			events.Record(ctx, events.Event{
+				Type:      events.TypeContainerSkipped,
+				Container: cName,
+				ID:        info.ID,
+				Error:     info.Reason,
+			})
+			continue
+		}
+		start := time.Now()
+		cctx, end := startPhase(ctx, metrics.OperationCheckpoint, phaseCheckpointContainer, cName)
+		// 创建容器检查点
+		logger.Info(fmt.Sprintf("checkpoint container %q", cName))
+		checkpointImage, err := c.checkpointContainer(cctx, c.containers[i])
+		end(err)
+		if err != nil {
+			if !c.opts.RecreateOnCheckpointFailure {
+				return nil, fmt.Errorf("checkpoint container %q for pod %q error: %w", cName, podKey, err)
+			}
+			// 此时尚未写入 tar ，可以改为还原时重新创建
+			logger.Error(err, fmt.Sprintf("checkpoint container %q error, it will be recreated on restore", cName))
+			info.Action = ContainerActionRecreate
+			info.Reason = err.Error()
+			events.Record(ctx, events.Event{
+				Type:      events.TypeContainerSkipped,
+				Container: cName,
+				ID:        info.ID,
+				Error:     info.Reason,
+			})
+			continue
+		}
+		logger.Info(fmt.Sprintf("checkpoint: %s", checkpointImage.Name))
+		ret[c.containers[i].Id] = containerCheckpoint{image: checkpointImage, duration: time.Since(start)}
+	}
+
+	// 暂存沙盒共享内存和内存介质卷
+	if err := runPhase(ctx, metrics.OperationCheckpoint, phaseStageMemory, c.stageMemory); err != nil {
+		return nil, fmt.Errorf("stage sandbox shm and memory volumes error: %w", err)
+	}
+
+	return ret, nil
+}
+
 // exportPodSandbox 导出 Pod 沙盒
 func (c *Checkpoint) exportPodSandbox(ctx context.Context) error {
 	podKey := c.namespace + "/" + c.name
 
 	sandboxes, err := c.criClient.ListPodSandbox(ctx, &runtimev1.PodSandboxFilter{
 		LabelSelector: map[string]string{
-			"io.kubernetes.pod.name":      c.name,
-			"io.kubernetes.pod.namespace": c.namespace,
+			labelPodName:      c.name,
+			labelPodNamespace: c.namespace,
 		},
 	})
 	if err != nil {
@@ -142,6 +329,7 @@ func (c *Checkpoint) exportPodSandbox(ctx context.Context) error {
 
 	// 写 Pod 沙盒配置
 	c.sandboxInfo.ID = baseInfo.Id
+	c.sandboxInfo.IPs = getPodSandboxIPs(resp.Status)
 	if err := tarutil.WriteJSON(c.tw, sandboxInfoJSONName, 0644, c.sandboxInfo); err != nil {
 		return fmt.Errorf("write sandbox config to tar error: %w", err)
 	}
@@ -149,23 +337,85 @@ func (c *Checkpoint) exportPodSandbox(ctx context.Context) error {
 	return nil
 }
 
+// exportCheckpointInfo 导出检查点信息
+func (c *Checkpoint) exportCheckpointInfo(ctx context.Context) error {
+	c.checkpointInfo = &CheckpointInfo{
+		FormatVersion: currentArchiveFormatVersion,
+		ID:            c.checkpointID,
+		KubeletPodDir: c.kubeletPodDir,
+		Volumes:       c.volumes,
+		TraceContext:  c.traceContext,
+	}
+
+	// 节点指纹和基础镜像
+	var err error
+	c.checkpointInfo.Node, err = collectNodeFingerprint(ctx, c.criClient, c.cgroupV2)
+	if err != nil {
+		return fmt.Errorf("collect node fingerprint error: %w", err)
+	}
+	for _, container := range c.containersInfo {
+		if container.Action == ContainerActionExited || container.Ephemeral {
+			// 已退出的容器还原时不重新运行，临时容器仅在目标 Pod 声明时还原，不需要其镜像
+			continue
+		}
+		if img := container.Image; img != "" && !slices.Contains(c.checkpointInfo.BaseImages, img) {
+			c.checkpointInfo.BaseImages = append(c.checkpointInfo.BaseImages, img)
+		}
+	}
+
+	// 容器信息
+	c.checkpointInfo.Containers = c.containersInfo
+
+	// 网络信息
+	if c.opts.NetworkMode == common.NetworkModePreserveIP {
+		c.checkpointInfo.Network = &NetworkInfo{
+			Mode:           c.opts.NetworkMode,
+			IPs:            c.sandboxInfo.IPs,
+			TCPEstablished: true,
+		}
+	}
+
+	if err := tarutil.WriteJSON(c.tw, checkpointInfoJSONName, 0644, c.checkpointInfo); err != nil {
+		return fmt.Errorf("write checkpoint info to tar error: %w", err)
+	}
+	return nil
+}
+
 // exportKubeletPodDir 导出 kubelet Pod 目录
 func (c *Checkpoint) exportKubeletPodDir(ctx context.Context) error {
 	logger := logr.FromContextOrDiscard(ctx)
 
-	// 获取 kubelet Pod 导出目录
-	kubeletPodDir, err := c.getKubeletPodDir(ctx)
-	if err != nil {
-		return err
-	}
-	logger.Info(fmt.Sprintf("exporting kubelet pod directory: %s", kubeletPodDir))
+	logger.Info(fmt.Sprintf("exporting kubelet pod directory: %s", c.kubeletPodDir))
 
-	// 将 Pod 数据目录全部打包
-	return filepath.Walk(kubeletPodDir, func(path string, info os.FileInfo, err error) error {
+	// 将 Pod 数据目录打包，按卷数据处理策略跳过部分卷和挂载点
+	return filepath.Walk(c.kubeletPodDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
+		// 内存介质卷使用容器暂停期间暂存的内容
+		if stagedPath, ok := c.stagedMemoryVolumes[path]; ok && info.IsDir() {
+			logger.Info(fmt.Sprintf("export staged content of %q", path))
+			defer func() { _ = os.Remove(stagedPath) }()
+			if err := tarutil.CopyFileEntriesIn(c.tw, stagedPath); err != nil {
+				return fmt.Errorf("export staged memory volume %q error: %w", path, err)
+			}
+			return filepath.SkipDir
+		}
+
+		// 确定目录处理方式
+		action := kubeletPodDirWalkDescend
+		if info.IsDir() {
+			var reason string
+			action, reason, err = c.getKubeletPodDirWalkAction(path)
+			if err != nil {
+				return fmt.Errorf("check dir %q error: %w", path, err)
+			}
+			if action == kubeletPodDirWalkSkipContent {
+				logger.Info(fmt.Sprintf("skip content of %q: %s", path, reason))
+			}
+		}
+
 		// 获取软链目标
 		link := path
 		isSymlink := info.Mode()&os.ModeSymlink != 0
@@ -185,6 +435,9 @@ func (c *Checkpoint) exportKubeletPodDir(ctx context.Context) error {
 		if err := c.tw.WriteHeader(hdr); err != nil {
 			return fmt.Errorf("write tar header %q error: %w", path, err)
 		}
+		if action == kubeletPodDirWalkSkipContent {
+			return filepath.SkipDir
+		}
 		if info.IsDir() || isSymlink {
 			return nil
 		}
@@ -217,56 +470,59 @@ func (c *Checkpoint) exportContainersInfo(ctx context.Context) error {
 		return c.containers[i].CreatedAt < c.containers[j].CreatedAt
 	})
 
+	names := make([]string, len(c.containers))
+	for i, container := range c.containers {
+		names[i] = container.Metadata.GetName()
+	}
+	if err := c.opts.Containers.Validate(names); err != nil {
+		return err
+	}
+
+	// 容器配置和还原方式
+	c.containersInfo, err = c.getContainersInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("get containers info error: %w", err)
+	}
 	return nil
 }
 
-// checkpointContainer 建立容器检查点
+// checkpointContainer 为已暂停的容器建立检查点
 func (c *Checkpoint) checkpointContainer(
 	ctx context.Context,
 	containerInfo *runtimev1.Container,
-) (containerd.Image, error) {
+) (images.Image, error) {
 	containerID := containerInfo.Id
-	logger := logr.FromContextOrDiscard(ctx)
 
-	// 获取容器和 task 信息
-	container, err := c.containerdClient.LoadContainer(ctx, containerID)
-	if err != nil {
-		return nil, fmt.Errorf("load container %q error: %w", containerID, err)
-	}
-	task, err := container.Task(ctx, nil)
-	if err != nil {
-		return nil, fmt.Errorf("get task for container %q error: %w", containerID, err)
+	// 建立检查点
+	opts := []containerd.CheckpointOpts{
+		containerd.WithCheckpointRuntime,
+		containerd.WithCheckpointRW,
 	}
-
-	// 先暂停进程
-	if err := task.Pause(ctx); err != nil {
-		return nil, fmt.Errorf("pause task for container %q error: %w", containerID, err)
+	if c.opts.NetworkMode == common.NetworkModePreserveIP {
+		opts = append(opts, withCheckpointTCPEstablished)
 	}
-	defer func() {
-		// 还原进程
-		// TODO: 应该通过选项决定是否应该还原并保持运行
-		if err = task.Resume(ctx); err != nil {
-			logger.Error(err, fmt.Sprintf("resume task for container %q error", containerID))
-		}
-	}()
-
-	// 建立检查点
-	checkpoint, err := container.Checkpoint(
+	opts = append(opts, containerd.WithCheckpointTask) // 需要在修改 CRIU 选项后
+	start := time.Now()
+	checkpoint, err := c.containerService.Checkpoint(
 		ctx,
+		containerID,
 		c.getContainerCheckpointImageName(containerInfo.Metadata.GetName()),
-		containerd.WithCheckpointRuntime,
-		containerd.WithCheckpointRW,
-		containerd.WithCheckpointTask,
+		opts...,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("checkpoint container %q error: %w", containerID, err)
+		return images.Image{}, fmt.Errorf("checkpoint container %q error: %w", containerID, err)
 	}
+	metrics.ContainerCheckpointDuration.Observe(time.Since(start).Seconds())
 
 	return checkpoint, nil
 }
 
 // exportContainerCheckpoint 导出容器检查点镜像
-func (c *Checkpoint) exportContainerCheckpoint(ctx context.Context, containerName, checkpointImageName string) error {
+// 返回导出的检查点镜像大小
+func (c *Checkpoint) exportContainerCheckpoint(
+	ctx context.Context,
+	containerName, checkpointImageName string,
+) (int64, error) {
 	logger := logr.FromContextOrDiscard(ctx)
 
 	exportName := c.getContainerCheckpointImageTarName(containerName)
@@ -276,7 +532,7 @@ func (c *Checkpoint) exportContainerCheckpoint(ctx context.Context, containerNam
 	logger.Info(fmt.Sprintf("exporting checkpoint %q to tmp file %q", checkpointImageName, tmpfile))
 	w, err := os.Create(tmpfile)
 	if err != nil {
-		return fmt.Errorf("create export file %q error: %w", tmpfile, err)
+		return 0, fmt.Errorf("create export file %q error: %w", tmpfile, err)
 	}
 	defer func() {
 		if err := w.Close(); err != nil {
@@ -287,42 +543,51 @@ func (c *Checkpoint) exportContainerCheckpoint(ctx context.Context, containerNam
 	}()
 
 	// 导出镜像
-	imageService := c.containerdClient.ImageService()
-	if err := c.containerdClient.Export(ctx, w, archive.WithImage(imageService, checkpointImageName)); err != nil {
-		return fmt.Errorf("export checkpoint %q to file %q error: %w", checkpointImageName, tmpfile, err)
+	start := time.Now()
+	if err := c.imageService.Export(ctx, w, checkpointImageName); err != nil {
+		return 0, fmt.Errorf("export checkpoint %q to file %q error: %w", checkpointImageName, tmpfile, err)
 	}
+	info, err := w.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("stat export file %q error: %w", tmpfile, err)
+	}
+	metrics.ObserveImageTransfer(metrics.DirectionExport, start, info.Size())
 
 	// 将导出镜像文件写入到 tar
 	if err := tarutil.CopyIn(c.tw, exportName, 0644, tmpfile); err != nil {
-		return fmt.Errorf("copy checkpoint %q exported file %q to tar error: %w", checkpointImageName, tmpfile, err)
+		return 0, fmt.Errorf("copy checkpoint %q exported file %q to tar error: %w", checkpointImageName, tmpfile, err)
 	}
 
 	// 删除检查点镜像
 	if !c.retainCheckpointImages {
-		if err := c.containerdClient.ImageService().Delete(ctx, checkpointImageName); err != nil {
-			return fmt.Errorf("delete checkpoint image %q error: %w", checkpointImageName, err)
+		if err := c.imageService.Delete(ctx, checkpointImageName); err != nil {
+			return 0, fmt.Errorf("delete checkpoint image %q error: %w", checkpointImageName, err)
 		}
 	}
 
-	return nil
+	return info.Size(), nil
 }
 
 // getKubeletPodDir 获取 kubelet Pod 数据目录
 func (c *Checkpoint) getKubeletPodDir(ctx context.Context) (string, error) {
 	// 默认目录
-	defaultKubeletPodDir := filepath.Join(kubeletPodsDir, c.sandboxInfo.Config.Metadata.Uid)
-
-	if len(c.containers) == 0 {
+	defaultKubeletPodDir := filepath.Join(c.kubeletPodsDir, c.sandboxInfo.Config.Metadata.Uid)
+
+	// 已退出的容器可能已被清理，使用第一个未退出的容器
+	containerID := ""
+	for _, info := range c.containersInfo {
+		if info.Action != ContainerActionExited {
+			containerID = info.ID
+			break
+		}
+	}
+	if containerID == "" {
 		return defaultKubeletPodDir, nil
 	}
 
-	container, err := c.containerdClient.ContainerService().Get(ctx, c.containers[0].Id)
+	cSpec, err := c.containerService.Spec(ctx, containerID)
 	if err != nil {
-		return "", fmt.Errorf("get container %q info error: %w", c.containers[0].Id, err)
-	}
-	cSpec := &ociruntime.Spec{}
-	if err := typeurl.UnmarshalTo(container.Spec, cSpec); err != nil {
-		return "", fmt.Errorf("unmarshal container %q info error: %w", c.containers[0].Id, err)
+		return "", fmt.Errorf("get container %q spec error: %w", containerID, err)
 	}
 	for _, mount := range cSpec.Mounts {
 		if mount.Destination == "/etc/hosts" {
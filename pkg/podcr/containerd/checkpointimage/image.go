@@ -0,0 +1,148 @@
+package checkpointimage
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/protobuf"
+	"github.com/containerd/containerd/protobuf/proto"
+	"github.com/containerd/typeurl/v2"
+	"github.com/opencontainers/go-digest"
+	ociimg "github.com/opencontainers/image-spec/specs-go/v1"
+	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+const (
+	// MediaTypeContainerSpec containerd 检查点镜像中容器配置的类型
+	MediaTypeContainerSpec = "application/vnd.containerd.container.checkpoint.config.v1+proto"
+	// CRIU 转储的内存页镜像文件名
+	criuPagesImagePattern = "pages-*.img"
+)
+
+// ReadContainerSpec 从 application/vnd.containerd.container.checkpoint.config.v1+proto 类型的 content 中读取容器配置信息
+func ReadContainerSpec(ctx context.Context, provider content.Provider, desc ociimg.Descriptor) (*ociruntime.Spec, error) {
+	// 检查类型
+	if desc.MediaType != MediaTypeContainerSpec {
+		return nil, fmt.Errorf("unexpected media type %q, must be %q", desc.MediaType, MediaTypeContainerSpec)
+	}
+
+	// 读内容
+	raw, err := content.ReadBlob(ctx, provider, desc)
+	if err != nil {
+		return nil, err
+	}
+
+	// 反序列化
+	anyObj := &anypb.Any{}
+	if err := proto.Unmarshal(raw, anyObj); err != nil {
+		return nil, fmt.Errorf("unmarshal from proto error: %w", err)
+	}
+	var spec ociruntime.Spec
+	if err := typeurl.UnmarshalTo(anyObj, &spec); err != nil {
+		return nil, fmt.Errorf("unmarsal from any error: %w", err)
+	}
+
+	return &spec, nil
+}
+
+// WriteContainerSpec 将 application/vnd.containerd.container.checkpoint.config.v1+proto 类型的容器配置信息写入 content
+func WriteContainerSpec(ctx context.Context, ingester content.Ingester, spec *ociruntime.Spec) (ociimg.Descriptor, error) {
+	// 序列化
+	anyObj, err := protobuf.MarshalAnyToProto(spec)
+	if err != nil {
+		return ociimg.Descriptor{}, fmt.Errorf("marshal to any error: %w", err)
+	}
+	raw, err := proto.Marshal(anyObj)
+	if err != nil {
+		return ociimg.Descriptor{}, fmt.Errorf("marshal to proto error: %w", err)
+	}
+
+	// 写 content
+	dgst := digest.Digest(fmt.Sprintf("sha256:%x", sha256.Sum256(raw)))
+	desc := ociimg.Descriptor{
+		MediaType: MediaTypeContainerSpec,
+		Digest:    dgst,
+		Size:      int64(len(raw)),
+	}
+	return desc, content.WriteBlob(ctx, ingester, string(dgst), bytes.NewReader(raw), desc)
+}
+
+// ReadImageIndex 从 application/vnd.oci.image.index.v1+json 类型的 content 中读取镜像索引信息
+func ReadImageIndex(ctx context.Context, provider content.Provider, desc ociimg.Descriptor) (*ociimg.Index, error) {
+	// 检查类型
+	if desc.MediaType != ociimg.MediaTypeImageIndex {
+		return nil, fmt.Errorf("unexpected media type %q, must be %q", desc.MediaType, ociimg.MediaTypeImageIndex)
+	}
+
+	// 读内容
+	raw, err := content.ReadBlob(ctx, provider, desc)
+	if err != nil {
+		return nil, err
+	}
+
+	// 反序列化
+	var index ociimg.Index
+	return &index, json.Unmarshal(raw, &index)
+}
+
+// WriteImageIndex 将 application/vnd.oci.image.index.v1+json 类型的镜像索引信息写入 content
+func WriteImageIndex(ctx context.Context, ingester content.Ingester, index *ociimg.Index) (ociimg.Descriptor, error) {
+	// 序列化
+	raw, err := json.Marshal(index)
+	if err != nil {
+		return ociimg.Descriptor{}, fmt.Errorf("marshal to json error: %w", err)
+	}
+
+	// 确定标签
+	labels := map[string]string{}
+	for i, m := range index.Manifests {
+		// 垃圾回收相关的标签
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.%d", i)] = m.Digest.String()
+	}
+
+	// 写 content
+	dgst := digest.Digest(fmt.Sprintf("sha256:%x", sha256.Sum256(raw)))
+	desc := ociimg.Descriptor{
+		MediaType: ociimg.MediaTypeImageIndex,
+		Digest:    dgst,
+		Size:      int64(len(raw)),
+	}
+
+	return desc, content.WriteBlob(
+		ctx,
+		ingester,
+		string(dgst), // 这里的 ref 是用于唯一标识 content 写传输会话的，跟镜像的 ref 没有关系，所以用 digest
+		bytes.NewReader(raw),
+		desc,
+		content.WithLabels(labels),
+	)
+}
+
+// SumCRIUPagesSize 读取 CRIU 镜像目录的 tar ，计算内存页镜像 pages-*.img 的总大小
+func SumCRIUPagesSize(tr *tar.Reader) (int64, error) {
+	var size int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read criu image tar error: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if ok, _ := path.Match(criuPagesImagePattern, path.Base(hdr.Name)); ok {
+			size += hdr.Size
+		}
+	}
+	return size, nil
+}
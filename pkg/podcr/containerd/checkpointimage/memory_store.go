@@ -0,0 +1,438 @@
+package checkpointimage
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/opencontainers/go-digest"
+	ocispecs "github.com/opencontainers/image-spec/specs-go"
+	ociimg "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/yhlooo/podmig/pkg/utils/tarutil"
+)
+
+const (
+	ociLayoutFileName = "oci-layout"
+	ociIndexFileName  = "index.json"
+	ociBlobsDir       = "blobs"
+)
+
+// MemoryStore 内存中的镜像存储和内容存储，实现了 containerd.ImageService 和 containerd.ContentStore
+//
+// 导入、导出使用与 containerd 一致的 OCI 镜像布局 tar 格式，可以导入由 containerd 导出的检查点镜像
+type MemoryStore struct {
+	lock     sync.Mutex
+	contents map[digest.Digest][]byte
+	images   map[string]images.Image
+
+	// 是否仅保留元数据，为 true 时导入的层内容（ tar 或压缩数据）只校验摘要，不保存
+	metadataOnly bool
+	// 导入时被丢弃的层
+	discarded map[digest.Digest]discardedLayer
+}
+
+// discardedLayer 导入时被丢弃的层的摘要信息
+type discardedLayer struct {
+	// 层大小
+	Size int64
+	// 层为 tar 时，其中 CRIU 内存页镜像的总大小
+	CRIUPagesSize int64
+}
+
+// NewMemoryStore 创建一个 *MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		contents: make(map[digest.Digest][]byte),
+		images:   make(map[string]images.Image),
+	}
+}
+
+// NewMetadataOnlyStore 创建一个仅保留元数据的 *MemoryStore
+//
+// 用于读取检查点镜像中的清单和配置，导入时层内容以流式读取，不占用内存
+func NewMetadataOnlyStore() *MemoryStore {
+	s := NewMemoryStore()
+	s.metadataOnly = true
+	s.discarded = make(map[digest.Digest]discardedLayer)
+	return s
+}
+
+// Images 获取所有镜像，按名称排序
+func (s *MemoryStore) Images() []images.Image {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ret := make([]images.Image, 0, len(s.images))
+	for _, img := range s.images {
+		ret = append(ret, img)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+// Get 获取镜像
+func (s *MemoryStore) Get(_ context.Context, name string) (images.Image, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	img, ok := s.images[name]
+	if !ok {
+		return images.Image{}, fmt.Errorf("image %q: %w", name, errdefs.ErrNotFound)
+	}
+	return img, nil
+}
+
+// Create 创建镜像
+func (s *MemoryStore) Create(_ context.Context, image images.Image) (images.Image, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.images[image.Name]; ok {
+		return images.Image{}, fmt.Errorf("image %q: %w", image.Name, errdefs.ErrAlreadyExists)
+	}
+	now := time.Now()
+	image.CreatedAt, image.UpdatedAt = now, now
+	s.images[image.Name] = image
+	return image, nil
+}
+
+// Delete 删除镜像
+func (s *MemoryStore) Delete(_ context.Context, name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.images[name]; !ok {
+		return fmt.Errorf("image %q: %w", name, errdefs.ErrNotFound)
+	}
+	delete(s.images, name)
+	return nil
+}
+
+// Import 从 r 导入 OCI 镜像布局 tar 中的镜像
+func (s *MemoryStore) Import(ctx context.Context, r io.Reader) ([]images.Image, error) {
+	tr := tar.NewReader(r)
+	var index *ociimg.Index
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read image tar error: %w", err)
+		}
+
+		switch {
+		case hdr.Name == ociIndexFileName:
+			index = &ociimg.Index{}
+			if err := tarutil.ReadJSON(tr, index); err != nil {
+				return nil, fmt.Errorf("read image index from file %q error: %w", hdr.Name, err)
+			}
+		case strings.HasPrefix(hdr.Name, ociBlobsDir+"/") && hdr.Typeflag == tar.TypeReg:
+			if err := s.importBlob(tr, hdr.Name); err != nil {
+				return nil, fmt.Errorf("import blob %q error: %w", hdr.Name, err)
+			}
+		}
+	}
+	if index == nil {
+		return nil, fmt.Errorf("%q not found in image tar", ociIndexFileName)
+	}
+
+	imgs := make([]images.Image, 0, len(index.Manifests))
+	for _, desc := range index.Manifests {
+		name := desc.Annotations[images.AnnotationImageName]
+		if name == "" {
+			name = desc.Annotations[ociimg.AnnotationRefName]
+		}
+		if name == "" {
+			continue
+		}
+		desc.Annotations = nil
+		_ = s.Delete(ctx, name)
+		img, err := s.Create(ctx, images.Image{Name: name, Target: desc})
+		if err != nil {
+			return nil, err
+		}
+		imgs = append(imgs, img)
+	}
+	return imgs, nil
+}
+
+// importBlob 从 r 导入 OCI 镜像布局中名为 name 的 blob
+//
+// 仅保留元数据时，tar 或压缩数据被视为层，边读取边校验摘要，不保存内容
+func (s *MemoryStore) importBlob(r io.Reader, name string) error {
+	expected := digest.Digest(strings.Replace(strings.TrimPrefix(name, ociBlobsDir+"/"), "/", ":", 1))
+	if err := expected.Validate(); err != nil {
+		return fmt.Errorf("invalid blob name: %w", err)
+	}
+
+	br := bufio.NewReaderSize(r, tarBlockSize)
+	if s.metadataOnly {
+		head, _ := br.Peek(tarBlockSize)
+		if isLayerBlob(head) {
+			return s.discardLayer(br, expected, isTarBlob(head))
+		}
+	}
+
+	raw, err := io.ReadAll(br)
+	if err != nil {
+		return fmt.Errorf("read blob error: %w", err)
+	}
+	if dgst := expected.Algorithm().FromBytes(raw); dgst != expected {
+		return fmt.Errorf("blob digest mismatch, got %s", dgst)
+	}
+	s.lock.Lock()
+	s.contents[expected] = raw
+	s.lock.Unlock()
+	return nil
+}
+
+// discardLayer 读取并丢弃层内容，校验摘要并记录层的摘要信息
+func (s *MemoryStore) discardLayer(r io.Reader, expected digest.Digest, isTar bool) error {
+	digester := expected.Algorithm().Digester()
+	cr := &countingReader{r: io.TeeReader(r, digester.Hash())}
+	layer := discardedLayer{}
+	if isTar {
+		size, err := SumCRIUPagesSize(tar.NewReader(cr))
+		if err != nil {
+			return err
+		}
+		layer.CRIUPagesSize = size
+	}
+	// 读取 tar 结束标记后的填充内容
+	if _, err := io.Copy(io.Discard, cr); err != nil {
+		return fmt.Errorf("read blob error: %w", err)
+	}
+	if dgst := digester.Digest(); dgst != expected {
+		return fmt.Errorf("blob digest mismatch, got %s", dgst)
+	}
+	layer.Size = cr.n
+	s.lock.Lock()
+	s.discarded[expected] = layer
+	s.lock.Unlock()
+	return nil
+}
+
+// CRIUPagesSize 获取导入时被丢弃的层中 CRIU 内存页镜像的总大小
+func (s *MemoryStore) CRIUPagesSize(desc ociimg.Descriptor) (int64, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	layer, ok := s.discarded[desc.Digest]
+	return layer.CRIUPagesSize, ok
+}
+
+// tarBlockSize tar 块大小
+const tarBlockSize = 512
+
+// isLayerBlob 根据 blob 开头的内容判断是否为层（ tar 或压缩数据）
+func isLayerBlob(head []byte) bool {
+	return isTarBlob(head) ||
+		bytes.HasPrefix(head, []byte{0x1f, 0x8b}) || // gzip
+		bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}) // zstd
+}
+
+// isTarBlob 根据 blob 开头的内容判断是否为 tar
+func isTarBlob(head []byte) bool {
+	return len(head) >= 262 && string(head[257:262]) == "ustar"
+}
+
+// countingReader 记录已读取字节数的 io.Reader
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read 读取数据
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// Export 将镜像及其引用的 content 以 OCI 镜像布局 tar 格式导出到 w
+func (s *MemoryStore) Export(ctx context.Context, w io.Writer, name string) error {
+	s.lock.Lock()
+	img, ok := s.images[name]
+	s.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("image %q: %w", name, errdefs.ErrNotFound)
+	}
+
+	// 收集镜像引用的所有 content
+	var descs []ociimg.Descriptor
+	if err := images.Walk(ctx, images.HandlerFunc(
+		func(ctx context.Context, desc ociimg.Descriptor) ([]ociimg.Descriptor, error) {
+			descs = append(descs, desc)
+			return images.Children(ctx, s, desc)
+		},
+	), img.Target); err != nil {
+		return fmt.Errorf("walk image %q error: %w", name, err)
+	}
+
+	tw := tar.NewWriter(w)
+	if err := tarutil.WriteJSON(tw, ociLayoutFileName, 0644, ociimg.ImageLayout{
+		Version: ociimg.ImageLayoutVersion,
+	}); err != nil {
+		return err
+	}
+	target := img.Target
+	target.Annotations = map[string]string{images.AnnotationImageName: name}
+	if err := tarutil.WriteJSON(tw, ociIndexFileName, 0644, ociimg.Index{
+		Versioned: ocispecs.Versioned{SchemaVersion: 2},
+		MediaType: ociimg.MediaTypeImageIndex,
+		Manifests: []ociimg.Descriptor{target},
+	}); err != nil {
+		return err
+	}
+	written := make(map[digest.Digest]bool, len(descs))
+	for _, desc := range descs {
+		if written[desc.Digest] {
+			continue
+		}
+		written[desc.Digest] = true
+		s.lock.Lock()
+		raw, ok := s.contents[desc.Digest]
+		s.lock.Unlock()
+		if !ok {
+			return fmt.Errorf("content %s: %w", desc.Digest, errdefs.ErrNotFound)
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path.Join(ociBlobsDir, desc.Digest.Algorithm().String(), desc.Digest.Encoded()),
+			Mode:     0644,
+			Size:     int64(len(raw)),
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(raw); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// ReaderAt 获取内容读取器
+func (s *MemoryStore) ReaderAt(_ context.Context, desc ociimg.Descriptor) (content.ReaderAt, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	raw, ok := s.contents[desc.Digest]
+	if !ok {
+		return nil, fmt.Errorf("content %s: %w", desc.Digest, errdefs.ErrNotFound)
+	}
+	return memoryContentReaderAt{Reader: bytes.NewReader(raw)}, nil
+}
+
+// Writer 获取内容写入器
+func (s *MemoryStore) Writer(_ context.Context, opts ...content.WriterOpt) (content.Writer, error) {
+	var wOpts content.WriterOpts
+	for _, opt := range opts {
+		if err := opt(&wOpts); err != nil {
+			return nil, err
+		}
+	}
+	if wOpts.Desc.Digest != "" {
+		s.lock.Lock()
+		_, ok := s.contents[wOpts.Desc.Digest]
+		s.lock.Unlock()
+		if ok {
+			return nil, fmt.Errorf("content %s: %w", wOpts.Desc.Digest, errdefs.ErrAlreadyExists)
+		}
+	}
+	return &memoryContentWriter{
+		store:     s,
+		ref:       wOpts.Ref,
+		expected:  wOpts.Desc.Digest,
+		total:     wOpts.Desc.Size,
+		startedAt: time.Now(),
+	}, nil
+}
+
+// memoryContentReaderAt MemoryStore 的内容读取器
+type memoryContentReaderAt struct {
+	*bytes.Reader
+}
+
+// Close 关闭读取器
+func (memoryContentReaderAt) Close() error {
+	return nil
+}
+
+// memoryContentWriter MemoryStore 的内容写入器
+type memoryContentWriter struct {
+	store     *MemoryStore
+	ref       string
+	expected  digest.Digest
+	total     int64
+	buf       bytes.Buffer
+	startedAt time.Time
+	updatedAt time.Time
+}
+
+var _ content.Writer = &memoryContentWriter{}
+
+// Write 写入内容
+func (w *memoryContentWriter) Write(p []byte) (int, error) {
+	w.updatedAt = time.Now()
+	return w.buf.Write(p)
+}
+
+// Close 关闭写入器
+func (w *memoryContentWriter) Close() error {
+	return nil
+}
+
+// Digest 获取已写入内容的摘要
+func (w *memoryContentWriter) Digest() digest.Digest {
+	return digest.FromBytes(w.buf.Bytes())
+}
+
+// Commit 提交内容
+func (w *memoryContentWriter) Commit(_ context.Context, size int64, expected digest.Digest, _ ...content.Opt) error {
+	raw := w.buf.Bytes()
+	if size > 0 && int64(len(raw)) != size {
+		return fmt.Errorf("unexpected commit size %d, expected %d: %w", len(raw), size, errdefs.ErrFailedPrecondition)
+	}
+	dgst := digest.FromBytes(raw)
+	if expected != "" && dgst != expected {
+		return fmt.Errorf("unexpected commit digest %s, expected %s: %w", dgst, expected, errdefs.ErrFailedPrecondition)
+	}
+
+	w.store.lock.Lock()
+	defer w.store.lock.Unlock()
+	if _, ok := w.store.contents[dgst]; ok {
+		return fmt.Errorf("content %s: %w", dgst, errdefs.ErrAlreadyExists)
+	}
+	w.store.contents[dgst] = append([]byte(nil), raw...)
+	return nil
+}
+
+// Status 获取写入状态
+func (w *memoryContentWriter) Status() (content.Status, error) {
+	return content.Status{
+		Ref:       w.ref,
+		Offset:    int64(w.buf.Len()),
+		Total:     w.total,
+		Expected:  w.expected,
+		StartedAt: w.startedAt,
+		UpdatedAt: w.updatedAt,
+	}, nil
+}
+
+// Truncate 截断已写入的内容
+func (w *memoryContentWriter) Truncate(size int64) error {
+	if size > int64(w.buf.Len()) {
+		return fmt.Errorf("truncate size %d larger than written %d: %w", size, w.buf.Len(), errdefs.ErrInvalidArgument)
+	}
+	w.buf.Truncate(int(size))
+	return nil
+}
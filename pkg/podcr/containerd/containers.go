@@ -0,0 +1,382 @@
+package containerd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/containerd/containerd/images"
+	"github.com/go-logr/logr"
+	criapis "k8s.io/cri-api/pkg/apis"
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// ContainerAction 容器在目标节点的还原方式
+type ContainerAction string
+
+// ContainerAction 的可选值
+const (
+	// ContainerActionCheckpoint 转储内存，从检查点还原
+	ContainerActionCheckpoint ContainerAction = "checkpoint"
+	// ContainerActionRecreate 不转储内存，使用原始镜像重新创建
+	ContainerActionRecreate ContainerAction = "recreate"
+	// ContainerActionExited 已退出的容器（如已完成的 init 容器、处于重启退避中的容器），不转储也不重新运行
+	ContainerActionExited ContainerAction = "exited"
+)
+
+// ContainerInfo 检查点中的容器信息
+type ContainerInfo struct {
+	// 容器名
+	Name string `json:"name"`
+	// 源容器 ID
+	ID string `json:"id"`
+	// 容器镜像
+	Image string `json:"image,omitempty"`
+	// 容器镜像引用
+	ImageRef string `json:"imageRef,omitempty"`
+	// 还原方式
+	Action ContainerAction `json:"action"`
+	// 不从检查点还原的原因
+	Reason string `json:"reason,omitempty"`
+	// 是否为临时容器
+	Ephemeral bool `json:"ephemeral,omitempty"`
+	// 容器重启次数
+	Attempt uint32 `json:"attempt,omitempty"`
+	// 已退出容器的退出状态
+	Exited *ContainerExitedState `json:"exited,omitempty"`
+	// 创建容器时的 CRI 配置，用于重新创建容器
+	Config *runtimev1.ContainerConfig `json:"config,omitempty"`
+}
+
+// ContainerExitedState 已退出容器的退出状态
+type ContainerExitedState struct {
+	// 退出码
+	ExitCode int32 `json:"exitCode"`
+	// 退出原因
+	Reason string `json:"reason,omitempty"`
+	// 退出时间（纳秒时间戳）
+	FinishedAt int64 `json:"finishedAt,omitempty"`
+}
+
+// containerStatusInfo runtimev1.ContainerStatusResponse.Info["info"] 的部分结构
+type containerStatusInfo struct {
+	// 创建容器时的 CRI 配置
+	Config *runtimev1.ContainerConfig `json:"config,omitempty"`
+}
+
+// GetExitCode 获取退出码
+func (s *ContainerExitedState) GetExitCode() int32 {
+	if s == nil {
+		return 0
+	}
+	return s.ExitCode
+}
+
+// containerRestoreTarget 待还原的容器
+type containerRestoreTarget struct {
+	// 容器名
+	Name string
+	// 检查点镜像，为 nil 表示使用原始镜像重新创建
+	Checkpoint *images.Image
+	// 检查点中的容器信息，旧版本检查点中为 nil
+	Info *ContainerInfo
+}
+
+// getContainersInfo 获取 Pod 中所有容器的信息，按容器创建时间排序
+//
+// 仅运行中的容器可以转储，已退出的容器仅记录其退出状态，其它状态的容器还原时重新创建。
+// 临时容器默认不转储
+func (c *Checkpoint) getContainersInfo(ctx context.Context) ([]ContainerInfo, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+	ret := make([]ContainerInfo, 0, len(c.containers))
+	for _, container := range c.containers {
+		info := ContainerInfo{
+			Name:     container.Metadata.GetName(),
+			ID:       container.Id,
+			Image:    container.GetImage().GetImage(),
+			ImageRef: container.ImageRef,
+			Action:   ContainerActionCheckpoint,
+			Attempt:  container.Metadata.GetAttempt(),
+		}
+		status, config, err := getContainerStatus(ctx, c.criClient, container.Id)
+		if err != nil {
+			return nil, fmt.Errorf("get container %q status error: %w", info.Name, err)
+		}
+		info.Config = config
+		info.Ephemeral = isEphemeralContainer(config)
+		switch {
+		case status.State == runtimev1.ContainerState_CONTAINER_EXITED:
+			info.Action = ContainerActionExited
+			info.Reason = "exited"
+			info.Exited = &ContainerExitedState{
+				ExitCode:   status.ExitCode,
+				Reason:     status.Reason,
+				FinishedAt: status.FinishedAt,
+			}
+		case status.State != runtimev1.ContainerState_CONTAINER_RUNNING:
+			info.Action = ContainerActionRecreate
+			info.Reason = fmt.Sprintf("container state %s", status.State)
+		case !c.opts.Containers.Match(info.Name):
+			info.Action = ContainerActionRecreate
+			info.Reason = "excluded"
+		case info.Ephemeral && !c.opts.IncludeEphemeralContainers:
+			logger.Info(fmt.Sprintf(
+				"ephemeral container %q is excluded from checkpoint, "+
+					"it is only recreated on restore if declared by the target pod", info.Name,
+			))
+			info.Action = ContainerActionRecreate
+			info.Reason = "ephemeral"
+		}
+		ret = append(ret, info)
+	}
+	return ret, nil
+}
+
+// isEphemeralContainer 判断容器是否为临时容器
+//
+// kubelet 没有为临时容器设置专门的标签，以共享目标容器的 PID 命名空间（ kubectl debug --target ）判断，
+// 仅临时容器可以使用该模式。未指定 --target 的临时容器无法与普通容器区分，按普通容器处理
+func isEphemeralContainer(config *runtimev1.ContainerConfig) bool {
+	return config.GetLinux().GetSecurityContext().GetNamespaceOptions().GetPid() == runtimev1.NamespaceMode_TARGET
+}
+
+// getContainerStatus 获取容器状态和创建容器时的 CRI 配置
+func getContainerStatus(
+	ctx context.Context,
+	criClient criapis.RuntimeService,
+	containerID string,
+) (*runtimev1.ContainerStatus, *runtimev1.ContainerConfig, error) {
+	resp, err := criClient.ContainerStatus(ctx, containerID, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	info := &containerStatusInfo{}
+	if raw := resp.Info["info"]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), info); err != nil {
+			return nil, nil, fmt.Errorf("unmarshal container info from json error: %w", err)
+		}
+	}
+	if info.Config == nil {
+		return nil, nil, fmt.Errorf("container config not found in container status")
+	}
+	return resp.Status, info.Config, nil
+}
+
+// selectContainers 根据检查点中的容器信息和还原选项确定待还原的容器及其还原方式，按容器创建顺序排列
+func (r *Restore) selectContainers(ctx context.Context) error {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	// 检查点镜像对应的容器，检查点镜像按容器创建顺序的逆序导出
+	checkpoints := make(map[string]*images.Image, len(r.srcContainerCheckpointImages))
+	var checkpointNames []string
+	for i := len(r.srcContainerCheckpointImages) - 1; i >= 0; i-- {
+		img := &r.srcContainerCheckpointImages[i]
+		res, err := r.getCheckpointContainerResources(ctx, *img)
+		if err != nil {
+			return fmt.Errorf("get container name from checkpoint image %q error: %w", img.Name, err)
+		}
+		checkpoints[res.Name] = img
+		checkpointNames = append(checkpointNames, res.Name)
+	}
+
+	// 旧版本检查点中没有容器信息，只能还原有检查点镜像的容器
+	if r.srcCheckpointInfo == nil || len(r.srcCheckpointInfo.Containers) == 0 {
+		if err := r.opts.Containers.Validate(checkpointNames); err != nil {
+			return err
+		}
+		r.containerTargets = nil
+		for _, name := range checkpointNames {
+			if !r.opts.Containers.Match(name) {
+				logger.Info(fmt.Sprintf("skip container %q: no container config in checkpoint to recreate it", name))
+				continue
+			}
+			r.containerTargets = append(r.containerTargets, containerRestoreTarget{
+				Name:       name,
+				Checkpoint: checkpoints[name],
+			})
+		}
+		return nil
+	}
+
+	names := make([]string, len(r.srcCheckpointInfo.Containers))
+	for i, info := range r.srcCheckpointInfo.Containers {
+		names[i] = info.Name
+	}
+	if err := r.opts.Containers.Validate(names); err != nil {
+		return err
+	}
+	r.containerTargets = nil
+	for i := range r.srcCheckpointInfo.Containers {
+		info := &r.srcCheckpointInfo.Containers[i]
+		if info.Ephemeral && !slices.Contains(r.opts.EphemeralContainers, info.Name) {
+			logger.Info(fmt.Sprintf("skip ephemeral container %q: not declared by the target pod", info.Name))
+			continue
+		}
+		if info.Action == ContainerActionExited {
+			// 已退出的容器不重新创建，由 kubelet 按 Pod 定义处理：
+			// init 容器在任一普通容器运行后即被 kubelet 视为已完成，不会再次运行；
+			// 普通容器在运行时中没有状态，kubelet 按重启策略将其重新启动，与源节点上退出后的行为一致
+			// （重启次数从 0 开始，重启策略为 Never 时也会被运行一次）
+			logger.Info(fmt.Sprintf(
+				"skip exited container %q (exit code %d, attempt %d)",
+				info.Name, info.Exited.GetExitCode(), info.Attempt,
+			))
+			continue
+		}
+		target := containerRestoreTarget{Name: info.Name, Info: info}
+		if info.Action == ContainerActionCheckpoint && r.opts.Containers.Match(info.Name) {
+			target.Checkpoint = checkpoints[info.Name]
+			if target.Checkpoint == nil {
+				return fmt.Errorf("checkpoint image of container %q not found in checkpoint", info.Name)
+			}
+		}
+		if target.Checkpoint == nil && info.Config == nil {
+			return fmt.Errorf("no container config in checkpoint to recreate container %q", info.Name)
+		}
+		r.containerTargets = append(r.containerTargets, target)
+	}
+	return nil
+}
+
+// recreateContainer 使用原始镜像重新创建并启动容器
+func (r *Restore) recreateContainer(ctx context.Context, info *ContainerInfo) (string, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	config, records, err := r.convertContainerConfig(info)
+	if err != nil {
+		return "", err
+	}
+	for _, record := range records {
+		logger.V(1).Info(fmt.Sprintf("rewrote container config %s", record))
+	}
+	if err := r.ensureImage(ctx, info, config); err != nil {
+		return "", fmt.Errorf("ensure image of container error: %w", err)
+	}
+	logger.Info(fmt.Sprintf("recreating container %q from image: %s", info.Name, config.GetImage().GetImage()))
+	cID, err := r.criClient.CreateContainer(ctx, r.sandboxInfo.ID, config, r.srcSandboxInfo.Config)
+	if err != nil {
+		return "", fmt.Errorf("create container error: %w", err)
+	}
+	if err := r.criClient.StartContainer(ctx, cID); err != nil {
+		return cID, fmt.Errorf("start container %q error: %w", cID, err)
+	}
+	return cID, nil
+}
+
+// ensureImage 确保重新创建的容器使用的镜像存在于本节点
+//
+// config 中的镜像为源容器实际运行的镜像 ID （ sha256:... ），本节点不存在时无法按 ID 拉取，
+// 此时通过 CRI 拉取源容器的镜像名，并以拉取到的镜像替换 config 中的镜像。
+// 拉取不携带镜像仓库凭据，私有镜像需要预先拉取到本节点
+func (r *Restore) ensureImage(ctx context.Context, info *ContainerInfo, config *runtimev1.ContainerConfig) error {
+	if r.criImageClient == nil {
+		return nil
+	}
+	logger := logr.FromContextOrDiscard(ctx)
+
+	image := config.GetImage().GetImage()
+	status, err := r.criImageClient.ImageStatus(ctx, &runtimev1.ImageSpec{Image: image}, false)
+	if err != nil {
+		return fmt.Errorf("get status of image %q error: %w", image, err)
+	}
+	if status.GetImage() != nil {
+		return nil
+	}
+	if info.Image == "" || info.Image == image {
+		return fmt.Errorf("image %q not found and can not be pulled", image)
+	}
+
+	logger.Info(fmt.Sprintf("image %q not found, pulling %q", image, info.Image))
+	imageRef, err := r.criImageClient.PullImage(ctx, &runtimev1.ImageSpec{
+		Image:       info.Image,
+		Annotations: config.GetImage().GetAnnotations(),
+	}, nil, r.srcSandboxInfo.Config)
+	if err != nil {
+		return fmt.Errorf("pull image %q error: %w", info.Image, err)
+	}
+	if info.ImageRef != "" && imageRef != info.ImageRef {
+		logger.Error(nil, fmt.Sprintf(
+			"pulled image %q is %s, differs from %s run by source container %q",
+			info.Image, imageRef, info.ImageRef, info.Name,
+		))
+	}
+	config.Image.Image = imageRef
+	return nil
+}
+
+// convertContainerConfig 基于还原的 Pod 转换用于重新创建容器的 CRI 配置，返回转换后的配置和所有改写记录
+//
+// 检查点中的配置不会被修改
+func (r *Restore) convertContainerConfig(info *ContainerInfo) (*runtimev1.ContainerConfig, []SpecRewriteRecord, error) {
+	config, err := cloneContainerConfig(info.Config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("clone container config error: %w", err)
+	}
+	records := NewSpecRewriter(r.specRewriteRules()...).RewriteContainerConfig(config)
+
+	// 使用源容器实际运行的镜像摘要，避免标签在迁移期间指向其它镜像
+	if info.ImageRef != "" && config.GetImage().GetImage() != info.ImageRef {
+		if config.Image == nil {
+			config.Image = &runtimev1.ImageSpec{}
+		}
+		records = append(records, SpecRewriteRecord{
+			Field: "image",
+			Rule:  "image-ref",
+			Old:   config.Image.Image,
+			New:   info.ImageRef,
+		})
+		config.Image.Image = info.ImageRef
+	}
+
+	if config.Labels == nil {
+		config.Labels = make(map[string]string)
+	}
+	config.Labels[labelPodUID] = r.opts.PodUID
+	config.Labels[labelPodName] = r.opts.PodName
+	config.Labels[labelPodNamespace] = r.opts.PodNamespace
+
+	// 资源限制覆盖
+	if res, ok := r.opts.Resources[config.GetMetadata().GetName()]; ok {
+		if config.Linux == nil {
+			config.Linux = &runtimev1.LinuxContainerConfig{}
+		}
+		if config.Linux.Resources == nil {
+			config.Linux.Resources = &runtimev1.LinuxContainerResources{}
+		}
+		if res.MilliCPU > 0 {
+			config.Linux.Resources.CpuPeriod = cpuQuotaPeriod
+			config.Linux.Resources.CpuQuota = milliCPUToQuota(res.MilliCPU)
+		}
+		if res.MemoryBytes > 0 {
+			config.Linux.Resources.MemoryLimitInBytes = res.MemoryBytes
+		}
+	}
+	return config, records, nil
+}
+
+// cloneContainerConfig 深拷贝 CRI 容器配置
+func cloneContainerConfig(config *runtimev1.ContainerConfig) (*runtimev1.ContainerConfig, error) {
+	raw, err := config.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	ret := &runtimev1.ContainerConfig{}
+	if err := ret.Unmarshal(raw); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// getContainerConfigResources 获取 CRI 容器配置中的资源信息
+func getContainerConfigResources(name string, config *runtimev1.ContainerConfig) checkpointContainerResources {
+	info := checkpointContainerResources{Name: name}
+	res := config.GetLinux().GetResources()
+	if res.GetCpuQuota() > 0 && res.GetCpuPeriod() > 0 {
+		info.MilliCPU = res.GetCpuQuota() * 1000 / res.GetCpuPeriod()
+	}
+	if res.GetMemoryLimitInBytes() > 0 {
+		info.MemoryBytes = res.GetMemoryLimitInBytes()
+	}
+	return info
+}
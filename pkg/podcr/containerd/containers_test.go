@@ -0,0 +1,39 @@
+package containerd
+
+import (
+	"testing"
+
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// TestIsEphemeralContainer 测试仅以共享目标容器 PID 命名空间判断临时容器
+func TestIsEphemeralContainer(t *testing.T) {
+	withPid := func(name string, mode runtimev1.NamespaceMode) *runtimev1.ContainerConfig {
+		return &runtimev1.ContainerConfig{
+			Metadata: &runtimev1.ContainerMetadata{Name: name},
+			Linux: &runtimev1.LinuxContainerConfig{
+				SecurityContext: &runtimev1.LinuxContainerSecurityContext{
+					NamespaceOptions: &runtimev1.NamespaceOption{Pid: mode},
+				},
+			},
+		}
+	}
+	cases := []struct {
+		name     string
+		config   *runtimev1.ContainerConfig
+		expected bool
+	}{
+		{name: "TargetPidNamespace", config: withPid("debugger-x7k2p", runtimev1.NamespaceMode_TARGET), expected: true},
+		{name: "TargetPidNamespaceCustomName", config: withPid("shell", runtimev1.NamespaceMode_TARGET), expected: true},
+		{name: "DebuggerNamePrefix", config: withPid("debugger-sidecar", runtimev1.NamespaceMode_CONTAINER)},
+		{name: "PodPidNamespace", config: withPid("app", runtimev1.NamespaceMode_POD)},
+		{name: "NoLinuxConfig", config: &runtimev1.ContainerConfig{Metadata: &runtimev1.ContainerMetadata{Name: "app"}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := isEphemeralContainer(c.config); got != c.expected {
+				t.Errorf("expected %t, got %t", c.expected, got)
+			}
+		})
+	}
+}
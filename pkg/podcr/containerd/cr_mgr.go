@@ -2,11 +2,17 @@ package containerd
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/containerd/containerd"
-	"go.opentelemetry.io/otel/trace/noop"
+	"github.com/containerd/containerd/pkg/dialer"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials/insecure"
 	criapis "k8s.io/cri-api/pkg/apis"
 	"k8s.io/kubernetes/pkg/kubelet/cri/remote"
 
@@ -16,12 +22,19 @@ import (
 const (
 	defaultCRIConnectionTimeout      = 2 * time.Second
 	defaultContainerdNamespace       = "k8s.io"
-	containerAnnoSandboxID           = "io.kubernetes.cri.sandbox-id"
-	containerAnnoSandboxUID          = "io.kubernetes.cri.sandbox-uid"
+	containerAnnoContainerName       = "io.kubernetes.cri.container-name"
+	containerAnnoSandboxName         = "io.kubernetes.cri.sandbox-name"
+	containerAnnoSandboxNamespace    = "io.kubernetes.cri.sandbox-namespace"
 	labelPodUID                      = "io.kubernetes.pod.uid"
-	kubeletPodsDir                   = "/var/lib/kubelet/pods"
+	labelPodName                     = "io.kubernetes.pod.name"
+	labelPodNamespace                = "io.kubernetes.pod.namespace"
+	envHostname                      = "HOSTNAME"
+	kubeletPodHostsFileName          = "etc-hosts"
+	defaultKubeletRootDir            = "/var/lib/kubelet"
+	kubeletPodsDirName               = "pods"
 	kubeletPodDirTarNamePrefix       = "kubelet_pod"
 	sandboxInfoJSONName              = "sandbox_info.json"
+	checkpointInfoJSONName           = "checkpoint_info.json"
 	containerCheckpointTarNamePrefix = "container_"
 )
 
@@ -29,41 +42,127 @@ const (
 type Manager struct {
 	tmpdir                 string
 	criClient              criapis.RuntimeService
-	containerdClient       *containerd.Client
+	criImageClient         criapis.ImageManagerService
+	imageService           ImageService
+	contentStore           ContentStore
+	containerService       ContainerService
 	retainCheckpointImages bool
+	kubeletRootDir         string
+	cgroupV2               bool
 }
 
 var _ common.PodCRManager = &Manager{}
 
+// ManagerOption Manager 的可选配置
+type ManagerOption func(m *Manager)
+
+// WithKubeletRootDir 指定 kubelet 根目录，默认为 /var/lib/kubelet
+//
+// 建立检查点时从该目录下的 pods 目录查找 Pod 数据目录，还原时将 Pod 数据目录写入该目录下的 pods 目录
+func WithKubeletRootDir(dir string) ManagerOption {
+	return func(m *Manager) {
+		m.kubeletRootDir = dir
+	}
+}
+
+// WithCRIImageService 指定 CRI 镜像服务客户端，还原时用于拉取重新创建的容器的镜像
+//
+// 未指定时不拉取镜像，重新创建的容器的镜像需要已存在于本节点
+func WithCRIImageService(client criapis.ImageManagerService) ManagerOption {
+	return func(m *Manager) {
+		m.criImageClient = client
+	}
+}
+
+// WithCgroupV2 指定本节点是否使用 cgroup v2 ，默认自动检测
+func WithCgroupV2(v2 bool) ManagerOption {
+	return func(m *Manager) {
+		m.cgroupV2 = v2
+	}
+}
+
 // New 创建一个 *Manager
-func New(endpoint, tmpdir string, retainCheckpointImages bool) (*Manager, error) {
+func New(endpoint, tmpdir string, retainCheckpointImages bool, opts ...ManagerOption) (*Manager, error) {
 	criClient, err := getCRIClient(endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("create cri client error: %w", err)
 	}
+	criImageClient, err := getCRIImageClient(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("create cri image client error: %w", err)
+	}
 	containerdClient, err := getContainerdClient(endpoint)
 	if err != nil {
 		return nil, fmt.Errorf("create containerd client error: %w", err)
 	}
 
-	return &Manager{
-		criClient:              criClient,
-		containerdClient:       containerdClient,
+	backend := newContainerdBackend(containerdClient)
+	opts = append([]ManagerOption{WithCRIImageService(criImageClient)}, opts...)
+	return NewWithClients(tmpdir, retainCheckpointImages, criClient, backend, backend, backend, opts...), nil
+}
+
+// NewWithClients 使用指定的 CRI 客户端和 containerd 操作接口创建一个 *Manager
+//
+// 可用于以 fake 包中的 RuntimeService 和 Backend 替代真实运行时
+func NewWithClients(
+	tmpdir string,
+	retainCheckpointImages bool,
+	criClient criapis.RuntimeService,
+	imageService ImageService,
+	contentStore ContentStore,
+	containerService ContainerService,
+	opts ...ManagerOption,
+) *Manager {
+	m := &Manager{
 		tmpdir:                 tmpdir,
+		criClient:              criClient,
+		imageService:           imageService,
+		contentStore:           contentStore,
+		containerService:       containerService,
 		retainCheckpointImages: retainCheckpointImages,
-	}, nil
+		kubeletRootDir:         defaultKubeletRootDir,
+		cgroupV2:               isCgroupV2(),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// kubeletPodsDir 获取 kubelet 存放 Pod 数据目录的目录
+func (h *Manager) kubeletPodsDir() string {
+	return filepath.Join(h.kubeletRootDir, kubeletPodsDirName)
 }
 
 // getCRIClient 获取 CRI 客户端
+//
+// 使用全局 TracerProvider ，调用时将 trace 上下文传播到容器运行时
 func getCRIClient(endpoint string) (criapis.RuntimeService, error) {
-	tp := noop.NewTracerProvider()
-	return remote.NewRemoteRuntimeService(endpoint, defaultCRIConnectionTimeout, tp)
+	return remote.NewRemoteRuntimeService(endpoint, defaultCRIConnectionTimeout, otel.GetTracerProvider())
+}
+
+// getCRIImageClient 获取 CRI 镜像服务客户端
+func getCRIImageClient(endpoint string) (criapis.ImageManagerService, error) {
+	return remote.NewRemoteImageService(endpoint, defaultCRIConnectionTimeout, otel.GetTracerProvider())
 }
 
 // getContainerdClient 获取 containerd 客户端
+//
+// 除 containerd 默认的连接选项外，通过 otelgrpc 将 trace 上下文传播到 containerd
 func getContainerdClient(endpoint string) (*containerd.Client, error) {
+	backoffConfig := backoff.DefaultConfig
+	backoffConfig.MaxDelay = 3 * time.Second
 	opts := []containerd.ClientOpt{
 		containerd.WithDefaultNamespace(defaultContainerdNamespace),
+		containerd.WithDialOpts([]grpc.DialOption{
+			grpc.WithBlock(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.FailOnNonTempDialError(true),
+			grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoffConfig}),
+			grpc.WithContextDialer(dialer.ContextDialer),
+			grpc.WithReturnConnectionError(),
+			grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		}),
 	}
 	endpoint = strings.TrimPrefix(endpoint, "unix://")
 	return containerd.New(endpoint, opts...)
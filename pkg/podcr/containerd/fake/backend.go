@@ -0,0 +1,350 @@
+package fake
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/opencontainers/go-digest"
+	ociimg "github.com/opencontainers/image-spec/specs-go/v1"
+	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/yhlooo/podmig/pkg/podcr/containerd/checkpointimage"
+)
+
+const (
+	criuInventoryImageName = "inventory.img"
+	criuPagesImageName     = "pages-1.img"
+)
+
+// Container Backend 中的容器
+type Container struct {
+	// 容器 ID
+	ID string
+	// 容器配置
+	Spec *ociruntime.Spec
+	// 容器 task 状态，为 Stopped 时 task 已被删除
+	Status containerd.ProcessStatus
+	// 作为 CRIU 转储内容写入检查点的数据
+	Memory []byte
+	// 容器还原自的检查点镜像，非还原的容器为空
+	RestoredFrom *images.Image
+}
+
+// Backend 用于测试的内存中的 containerd.ImageService 、 containerd.ContentStore 和 containerd.ContainerService 实现
+//
+// 建立检查点时以 Container.Memory 作为 CRIU 转储的内存页 pages-1.img ，与容器配置一起组成检查点镜像；
+// 还原时从检查点镜像中读取容器配置创建运行中的容器。
+// 镜像导入、导出使用与 containerd 一致的 OCI 镜像布局 tar 格式
+type Backend struct {
+	*checkpointimage.MemoryStore
+
+	lock           sync.Mutex
+	containers     map[string]*Container
+	checkpointHook func(ctx context.Context, id string) error
+}
+
+// NewBackend 创建一个 *Backend
+func NewBackend() *Backend {
+	return &Backend{
+		MemoryStore: checkpointimage.NewMemoryStore(),
+		containers:  make(map[string]*Container),
+	}
+}
+
+// AddContainer 添加运行中的容器
+func (b *Backend) AddContainer(id string, spec *ociruntime.Spec, memory []byte) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.containers[id] = &Container{
+		ID:     id,
+		Spec:   spec,
+		Status: containerd.Running,
+		Memory: memory,
+	}
+}
+
+// DeleteTask 删除容器 task ，模拟容器退出后 containerd CRI 插件删除其 task
+//
+// 之后获取、暂停、恢复该容器 task 或为其建立检查点时返回 errdefs.ErrNotFound
+func (b *Backend) DeleteTask(id string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	c, ok := b.containers[id]
+	if !ok {
+		return fmt.Errorf("container %q: %w", id, errdefs.ErrNotFound)
+	}
+	c.Status = containerd.Stopped
+	return nil
+}
+
+// SetCheckpointHook 设置建立检查点前调用的函数，返回错误时建立检查点失败并返回该错误
+//
+// 可用于模拟建立检查点期间被中断等情况
+func (b *Backend) SetCheckpointHook(hook func(ctx context.Context, id string) error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.checkpointHook = hook
+}
+
+// CancelCheckpoint 返回调用 cancel 并等待 ctx 取消的检查点钩子，模拟建立检查点期间收到 SIGINT 等中断
+func CancelCheckpoint(cancel context.CancelFunc) func(ctx context.Context, id string) error {
+	return func(ctx context.Context, _ string) error {
+		cancel()
+		<-ctx.Done()
+		return ctx.Err()
+	}
+}
+
+// Container 获取容器
+func (b *Backend) Container(id string) (*Container, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	c, ok := b.containers[id]
+	return c, ok
+}
+
+// Containers 获取所有容器，按 ID 排序
+func (b *Backend) Containers() []*Container {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	ret := make([]*Container, 0, len(b.containers))
+	for _, c := range b.containers {
+		ret = append(ret, c)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ID < ret[j].ID
+	})
+	return ret
+}
+
+// Spec 获取容器配置
+func (b *Backend) Spec(_ context.Context, id string) (*ociruntime.Spec, error) {
+	c, err := b.getContainer(id)
+	if err != nil {
+		return nil, err
+	}
+	return c.Spec, nil
+}
+
+// TaskStatus 获取容器 task 状态
+func (b *Backend) TaskStatus(_ context.Context, id string) (containerd.Status, error) {
+	c, err := b.getTask(id)
+	if err != nil {
+		return containerd.Status{}, err
+	}
+	return containerd.Status{Status: c.Status}, nil
+}
+
+// PauseTask 暂停容器 task
+//
+// 与 containerd 客户端一致， ctx 已取消时返回错误
+func (b *Backend) PauseTask(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.setContainerStatus(id, containerd.Running, containerd.Paused)
+}
+
+// ResumeTask 恢复容器 task
+//
+// 与 containerd 客户端一致， ctx 已取消时返回错误
+func (b *Backend) ResumeTask(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.setContainerStatus(id, containerd.Paused, containerd.Running)
+}
+
+// Checkpoint 为容器建立名为 ref 的检查点镜像
+//
+// opts 依赖 containerd 客户端，不会被应用
+func (b *Backend) Checkpoint(
+	ctx context.Context,
+	id, ref string,
+	_ ...containerd.CheckpointOpts,
+) (images.Image, error) {
+	b.lock.Lock()
+	hook := b.checkpointHook
+	b.lock.Unlock()
+	if hook != nil {
+		if err := hook(ctx, id); err != nil {
+			return images.Image{}, err
+		}
+	}
+
+	c, err := b.getTask(id)
+	if err != nil {
+		return images.Image{}, err
+	}
+	if c.Status != containerd.Running && c.Status != containerd.Paused {
+		return images.Image{}, fmt.Errorf("container %q is %s: %w", id, c.Status, errdefs.ErrFailedPrecondition)
+	}
+
+	// CRIU 转储内容
+	criuImage, err := NewCRIUImage(c.Memory)
+	if err != nil {
+		return images.Image{}, fmt.Errorf("create criu image error: %w", err)
+	}
+	criuDesc := ociimg.Descriptor{
+		MediaType: images.MediaTypeContainerd1Checkpoint,
+		Digest:    digest.FromBytes(criuImage),
+		Size:      int64(len(criuImage)),
+	}
+	if err := content.WriteBlob(ctx, b, criuDesc.Digest.String(), bytes.NewReader(criuImage), criuDesc); err != nil {
+		return images.Image{}, fmt.Errorf("write checkpoint content error: %w", err)
+	}
+	// 容器配置
+	specDesc, err := checkpointimage.WriteContainerSpec(ctx, b, c.Spec)
+	if err != nil {
+		return images.Image{}, fmt.Errorf("write container spec error: %w", err)
+	}
+	// 镜像索引
+	indexDesc, err := checkpointimage.WriteImageIndex(ctx, b, &ociimg.Index{
+		MediaType: ociimg.MediaTypeImageIndex,
+		Manifests: []ociimg.Descriptor{criuDesc, specDesc},
+	})
+	if err != nil {
+		return images.Image{}, fmt.Errorf("write image index error: %w", err)
+	}
+
+	return b.Create(ctx, images.Image{Name: ref, Target: indexDesc})
+}
+
+// Restore 从检查点镜像创建 ID 为 id 的运行中的容器
+func (b *Backend) Restore(ctx context.Context, id string, checkpoint images.Image) error {
+	index, err := checkpointimage.ReadImageIndex(ctx, b, checkpoint.Target)
+	if err != nil {
+		return fmt.Errorf("get image index error: %w", err)
+	}
+	c := &Container{
+		ID:           id,
+		Status:       containerd.Running,
+		RestoredFrom: &checkpoint,
+	}
+	for _, m := range index.Manifests {
+		switch m.MediaType {
+		case images.MediaTypeContainerd1Checkpoint:
+			criuImage, err := content.ReadBlob(ctx, b, m)
+			if err != nil {
+				return fmt.Errorf("read checkpoint content error: %w", err)
+			}
+			if c.Memory, err = readCRIUImage(criuImage); err != nil {
+				return fmt.Errorf("read criu image error: %w", err)
+			}
+		case checkpointimage.MediaTypeContainerSpec:
+			if c.Spec, err = checkpointimage.ReadContainerSpec(ctx, b, m); err != nil {
+				return fmt.Errorf("get container spec error: %w", err)
+			}
+		}
+	}
+	if c.Spec == nil {
+		return fmt.Errorf("container spec not found in checkpoint image %q", checkpoint.Name)
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if _, ok := b.containers[id]; ok {
+		return fmt.Errorf("container %q: %w", id, errdefs.ErrAlreadyExists)
+	}
+	b.containers[id] = c
+	return nil
+}
+
+// getContainer 获取容器
+func (b *Backend) getContainer(id string) (*Container, error) {
+	c, ok := b.Container(id)
+	if !ok {
+		return nil, fmt.Errorf("container %q: %w", id, errdefs.ErrNotFound)
+	}
+	return c, nil
+}
+
+// getTask 获取 task 未被删除的容器
+func (b *Backend) getTask(id string) (*Container, error) {
+	c, err := b.getContainer(id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status == containerd.Stopped {
+		return nil, errTaskNotFound(id)
+	}
+	return c, nil
+}
+
+// errTaskNotFound 返回与 containerd 客户端一致的容器 task 不存在的错误
+func errTaskNotFound(id string) error {
+	return fmt.Errorf("no running task found: task %s not found: %w", id, errdefs.ErrNotFound)
+}
+
+// setContainerStatus 将容器 task 状态从 from 改为 to
+func (b *Backend) setContainerStatus(id string, from, to containerd.ProcessStatus) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	c, ok := b.containers[id]
+	if !ok {
+		return fmt.Errorf("container %q: %w", id, errdefs.ErrNotFound)
+	}
+	if c.Status == containerd.Stopped {
+		return errTaskNotFound(id)
+	}
+	if c.Status != from {
+		return fmt.Errorf("container %q is %s, not %s: %w", id, c.Status, from, errdefs.ErrFailedPrecondition)
+	}
+	c.Status = to
+	return nil
+}
+
+// NewCRIUImage 创建与 CRIU 镜像目录 tar 格式一致的转储内容，以 memory 作为内存页
+func NewCRIUImage(memory []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{name: criuInventoryImageName},
+		{name: criuPagesImageName, data: memory},
+	} {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.name,
+			Mode:     0o600,
+			Size:     int64(len(f.data)),
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readCRIUImage 从 NewCRIUImage 创建的转储内容中读取内存页
+func readCRIUImage(data []byte) ([]byte, error) {
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%q not found", criuPagesImageName)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Name == criuPagesImageName {
+			return io.ReadAll(tr)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
+	criapis "k8s.io/cri-api/pkg/apis"
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+	critesting "k8s.io/cri-api/pkg/apis/testing"
+)
+
+// sandboxPidBase RuntimeService 分配的沙盒 Pid 起始值
+const sandboxPidBase = 10000
+
+// sandboxInfo containerd CRI 插件的沙盒详细状态中 info 信息的部分结构
+type sandboxInfo struct {
+	// 沙盒容器 1 号进程在宿主机上的 Pid
+	Pid int `json:"pid"`
+	// 沙盒配置
+	Config *runtimev1.PodSandboxConfig `json:"config,omitempty"`
+	// 沙盒运行时配置
+	RuntimeSpec *ociruntime.Spec `json:"runtimeSpec,omitempty"`
+}
+
+// containerStatusInfo containerd CRI 插件的容器详细状态中 info 信息的部分结构
+type containerStatusInfo struct {
+	// 创建容器时的 CRI 配置
+	Config *runtimev1.ContainerConfig `json:"config,omitempty"`
+}
+
+// RuntimeService 用于测试的 criapis.RuntimeService 实现
+//
+// 在 k8s.io/cri-api 提供的 FakeRuntimeService 基础上，为沙盒补充详细状态中的 info 信息（ Pid 、配置和运行时配置），
+// 为容器补充详细状态中的创建配置，使其可被 Checkpoint 和 Restore 使用。
+// 分配的 Pid 不对应真实进程，使用该实现的沙盒应使用宿主机 IPC 命名空间以跳过沙盒共享内存的导出
+type RuntimeService struct {
+	*critesting.FakeRuntimeService
+
+	lock       sync.Mutex
+	nextPid    int
+	sandboxes  map[string]*sandboxInfo
+	containers map[string]*runtimev1.ContainerConfig
+}
+
+var _ criapis.RuntimeService = &RuntimeService{}
+
+// NewRuntimeService 创建一个 *RuntimeService
+func NewRuntimeService() *RuntimeService {
+	return &RuntimeService{
+		FakeRuntimeService: critesting.NewFakeRuntimeService(),
+		nextPid:            sandboxPidBase,
+		sandboxes:          make(map[string]*sandboxInfo),
+		containers:         make(map[string]*runtimev1.ContainerConfig),
+	}
+}
+
+// RunPodSandbox 创建并启动沙盒
+func (r *RuntimeService) RunPodSandbox(
+	ctx context.Context,
+	config *runtimev1.PodSandboxConfig,
+	runtimeHandler string,
+) (string, error) {
+	id, err := r.FakeRuntimeService.RunPodSandbox(ctx, config, runtimeHandler)
+	if err != nil {
+		return "", err
+	}
+	r.SetSandboxInfo(id, config, nil)
+	return id, nil
+}
+
+// SetSandboxInfo 设置沙盒详细状态中的 info 信息
+//
+// spec 为 nil 时根据沙盒配置中的 cgroup parent 生成沙盒运行时配置
+func (r *RuntimeService) SetSandboxInfo(id string, config *runtimev1.PodSandboxConfig, spec *ociruntime.Spec) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if spec == nil {
+		spec = &ociruntime.Spec{
+			Hostname: config.GetHostname(),
+			Linux:    &ociruntime.Linux{},
+		}
+		if parent := config.GetLinux().GetCgroupParent(); parent != "" {
+			spec.Linux.CgroupsPath = filepath.Join(parent, id)
+		}
+	}
+	r.nextPid++
+	r.sandboxes[id] = &sandboxInfo{
+		Pid:         r.nextPid,
+		Config:      config,
+		RuntimeSpec: spec,
+	}
+}
+
+// PodSandboxStatus 获取沙盒状态
+func (r *RuntimeService) PodSandboxStatus(
+	ctx context.Context,
+	podSandboxID string,
+	verbose bool,
+) (*runtimev1.PodSandboxStatusResponse, error) {
+	resp, err := r.FakeRuntimeService.PodSandboxStatus(ctx, podSandboxID, verbose)
+	if err != nil || !verbose {
+		return resp, err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	info, ok := r.sandboxes[podSandboxID]
+	if !ok {
+		return resp, nil
+	}
+	raw, err := json.Marshal(info)
+	if err != nil {
+		return nil, fmt.Errorf("marshal sandbox info to json error: %w", err)
+	}
+	resp.Info = map[string]string{"info": string(raw)}
+	return resp, nil
+}
+
+// CreateContainer 创建容器
+func (r *RuntimeService) CreateContainer(
+	ctx context.Context,
+	podSandboxID string,
+	config *runtimev1.ContainerConfig,
+	sandboxConfig *runtimev1.PodSandboxConfig,
+) (string, error) {
+	id, err := r.FakeRuntimeService.CreateContainer(ctx, podSandboxID, config, sandboxConfig)
+	if err != nil {
+		return "", err
+	}
+	r.SetContainerConfig(id, config)
+	return id, nil
+}
+
+// SetContainerConfig 设置容器详细状态中的创建配置
+func (r *RuntimeService) SetContainerConfig(id string, config *runtimev1.ContainerConfig) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.containers[id] = config
+}
+
+// ContainerStatus 获取容器状态
+//
+// 未设置创建配置的容器，使用容器状态中的元信息、镜像、标签和注解作为创建配置
+func (r *RuntimeService) ContainerStatus(
+	ctx context.Context,
+	containerID string,
+	verbose bool,
+) (*runtimev1.ContainerStatusResponse, error) {
+	resp, err := r.FakeRuntimeService.ContainerStatus(ctx, containerID, verbose)
+	if err != nil || !verbose {
+		return resp, err
+	}
+
+	r.lock.Lock()
+	config, ok := r.containers[containerID]
+	r.lock.Unlock()
+	if !ok {
+		config = &runtimev1.ContainerConfig{
+			Metadata:    resp.Status.GetMetadata(),
+			Image:       resp.Status.GetImage(),
+			Labels:      resp.Status.GetLabels(),
+			Annotations: resp.Status.GetAnnotations(),
+		}
+	}
+	raw, err := json.Marshal(containerStatusInfo{Config: config})
+	if err != nil {
+		return nil, fmt.Errorf("marshal container info to json error: %w", err)
+	}
+	resp.Info = map[string]string{"info": string(raw)}
+	return resp, nil
+}
@@ -0,0 +1,101 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// Pod RunPod 运行的 Pod
+type Pod struct {
+	// Pod 命名空间
+	Namespace string
+	// Pod 名，同时作为主机名
+	Name string
+	// Pod UID
+	UID string
+	// Pod 标签，与 kubelet 一致设置为沙盒标签
+	Labels map[string]string
+	// 唯一容器的容器名
+	ContainerName string
+	// 容器挂载
+	Mounts []ociruntime.Mount
+	// 作为容器 CRIU 转储内容的数据
+	Memory []byte
+}
+
+// RunPod 在 cri 和 backend 中运行一个包含一个运行中容器的 Pod ，并创建其 kubelet Pod 目录，返回容器 ID
+//
+// Pod 使用宿主机 IPC 命名空间，因为 RuntimeService 的沙盒没有真实进程，需要跳过沙盒共享内存
+func RunPod(
+	ctx context.Context,
+	cri *RuntimeService,
+	backend *Backend,
+	kubeletRootDir string,
+	pod Pod,
+) (string, error) {
+	cgroupParent := "/kubepods/besteffort/pod" + pod.UID
+	sandboxLabels := map[string]string{
+		"io.kubernetes.pod.name":      pod.Name,
+		"io.kubernetes.pod.namespace": pod.Namespace,
+		"io.kubernetes.pod.uid":       pod.UID,
+	}
+	for k, v := range pod.Labels {
+		sandboxLabels[k] = v
+	}
+	sandboxConfig := &runtimev1.PodSandboxConfig{
+		Metadata: &runtimev1.PodSandboxMetadata{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+			Uid:       pod.UID,
+		},
+		Hostname: pod.Name,
+		Labels:   sandboxLabels,
+		Linux: &runtimev1.LinuxPodSandboxConfig{
+			CgroupParent: cgroupParent,
+			SecurityContext: &runtimev1.LinuxSandboxSecurityContext{
+				NamespaceOptions: &runtimev1.NamespaceOption{Ipc: runtimev1.NamespaceMode_NODE},
+			},
+		},
+	}
+	sandboxID, err := cri.RunPodSandbox(ctx, sandboxConfig, "")
+	if err != nil {
+		return "", fmt.Errorf("run pod sandbox error: %w", err)
+	}
+	podDir := filepath.Join(kubeletRootDir, "pods", pod.UID)
+	if err := os.MkdirAll(podDir, 0o755); err != nil {
+		return "", fmt.Errorf("make dir %q error: %w", podDir, err)
+	}
+
+	containerConfig := &runtimev1.ContainerConfig{
+		Metadata: &runtimev1.ContainerMetadata{Name: pod.ContainerName},
+		Image:    &runtimev1.ImageSpec{Image: "docker.io/library/busybox:1.36"},
+		Labels:   map[string]string{"io.kubernetes.container.name": pod.ContainerName},
+	}
+	containerID, err := cri.CreateContainer(ctx, sandboxID, containerConfig, sandboxConfig)
+	if err != nil {
+		return "", fmt.Errorf("create container error: %w", err)
+	}
+	if err := cri.StartContainer(ctx, containerID); err != nil {
+		return "", fmt.Errorf("start container error: %w", err)
+	}
+	backend.AddContainer(containerID, &ociruntime.Spec{
+		Hostname: pod.Name,
+		Process: &ociruntime.Process{
+			Args: []string{"sleep", "infinity"},
+			Env:  []string{"HOSTNAME=" + pod.Name},
+		},
+		Mounts: pod.Mounts,
+		Annotations: map[string]string{
+			"io.kubernetes.cri.container-name":    pod.ContainerName,
+			"io.kubernetes.cri.sandbox-name":      pod.Name,
+			"io.kubernetes.cri.sandbox-namespace": pod.Namespace,
+		},
+		Linux: &ociruntime.Linux{CgroupsPath: filepath.Join(cgroupParent, containerID)},
+	}, pod.Memory)
+	return containerID, nil
+}
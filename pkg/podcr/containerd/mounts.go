@@ -0,0 +1,77 @@
+package containerd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// mountPoints 挂载点集合
+type mountPoints map[string]struct{}
+
+// parseMountInfo 从 /proc/<pid>/mountinfo 格式的内容中解析挂载点
+//
+// 每行第 5 个字段为挂载点，其中空格等字符以 \ooo 八进制转义
+func parseMountInfo(r io.Reader) (mountPoints, error) {
+	ret := mountPoints{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		ret[unescapeMountInfoField(fields[4])] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read mountinfo error: %w", err)
+	}
+	return ret, nil
+}
+
+// unescapeMountInfoField 还原 mountinfo 字段中 \ooo 形式的八进制转义
+func unescapeMountInfoField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// contains 判断路径是否为挂载点
+//
+// 解析路径中的符号链接后比较，使同一文件系统内的绑定挂载也能被识别
+func (m mountPoints) contains(path string) (bool, error) {
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false, err
+	}
+	realPath, err = filepath.Abs(realPath)
+	if err != nil {
+		return false, err
+	}
+	_, ok := m[realPath]
+	return ok, nil
+}
+
+// isMountPoint 判断路径是否为挂载点
+func isMountPoint(path string) (bool, error) {
+	mounts, err := getMountPoints()
+	if err != nil {
+		return false, err
+	}
+	return mounts.contains(path)
+}
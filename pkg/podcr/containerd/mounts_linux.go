@@ -0,0 +1,18 @@
+package containerd
+
+import (
+	"fmt"
+	"os"
+)
+
+const selfMountInfoPath = "/proc/self/mountinfo"
+
+// getMountPoints 获取当前挂载命名空间中的所有挂载点
+func getMountPoints() (mountPoints, error) {
+	f, err := os.Open(selfMountInfoPath)
+	if err != nil {
+		return nil, fmt.Errorf("open %q error: %w", selfMountInfoPath, err)
+	}
+	defer func() { _ = f.Close() }()
+	return parseMountInfo(f)
+}
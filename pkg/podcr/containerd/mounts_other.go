@@ -0,0 +1,10 @@
+//go:build !linux
+
+package containerd
+
+// getMountPoints 获取当前挂载命名空间中的所有挂载点
+//
+// 非 Linux 平台不会为 Pod 挂载卷，总是返回空集合
+func getMountPoints() (mountPoints, error) {
+	return mountPoints{}, nil
+}
@@ -0,0 +1,71 @@
+package containerd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParseMountInfo 测试解析 mountinfo
+func TestParseMountInfo(t *testing.T) {
+	// 其中 58 为与 /var/lib/kubelet 在同一文件系统内的绑定挂载
+	const mountInfo = `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+26 22 0:23 / /run rw,nosuid,nodev,noexec,relatime shared:5 - tmpfs tmpfs rw,size=1631628k,mode=755
+57 22 0:50 / /var/lib/kubelet/pods/5f2b/volumes/kubernetes.io~projected/kube-api-access-7xk2p rw,relatime shared:30 - tmpfs tmpfs rw,size=7884416k
+58 22 8:1 /data/web /var/lib/kubelet/pods/5f2b/volumes/kubernetes.io~local-volume/pv-1 rw,relatime shared:1 - ext4 /dev/sda1 rw
+59 22 8:1 /data/a\040b /var/lib/kubelet/pods/5f2b/volumes/kubernetes.io~local-volume/pv\0402 rw,relatime shared:1 - ext4 /dev/sda1 rw
+`
+	mounts, err := parseMountInfo(strings.NewReader(mountInfo))
+	if err != nil {
+		t.Fatalf("parse mountinfo error: %v", err)
+	}
+	for _, path := range []string{
+		"/",
+		"/run",
+		"/var/lib/kubelet/pods/5f2b/volumes/kubernetes.io~projected/kube-api-access-7xk2p",
+		"/var/lib/kubelet/pods/5f2b/volumes/kubernetes.io~local-volume/pv-1",
+		"/var/lib/kubelet/pods/5f2b/volumes/kubernetes.io~local-volume/pv 2",
+	} {
+		if _, ok := mounts[path]; !ok {
+			t.Errorf("expected mount point %q not found", path)
+		}
+	}
+	if len(mounts) != 5 {
+		t.Errorf("expected 5 mount points, got %d: %v", len(mounts), mounts)
+	}
+}
+
+// TestMountPointsContains 测试通过符号链接判断挂载点
+func TestMountPointsContains(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("eval symlinks error: %v", err)
+	}
+	mountPath := filepath.Join(dir, "volume")
+	if err := os.Mkdir(mountPath, 0o755); err != nil {
+		t.Fatalf("mkdir error: %v", err)
+	}
+	linkPath := filepath.Join(dir, "link")
+	if err := os.Symlink(mountPath, linkPath); err != nil {
+		t.Fatalf("symlink error: %v", err)
+	}
+	mounts := mountPoints{mountPath: {}}
+
+	for path, expected := range map[string]bool{
+		mountPath: true,
+		linkPath:  true,
+		dir:       false,
+	} {
+		got, err := mounts.contains(path)
+		if err != nil {
+			t.Fatalf("check %q error: %v", path, err)
+		}
+		if got != expected {
+			t.Errorf("expected %q mount point: %t, got %t", path, expected, got)
+		}
+	}
+	if _, err := mounts.contains(filepath.Join(dir, "not-exist")); err == nil {
+		t.Errorf("expected error for not existing path, got nil")
+	}
+}
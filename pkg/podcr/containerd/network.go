@@ -0,0 +1,141 @@
+package containerd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/runtime/v2/runc/options"
+	"github.com/go-logr/logr"
+	ociimg "github.com/opencontainers/image-spec/specs-go/v1"
+	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+)
+
+const (
+	// runc 通过该注解指定 CRIU 配置文件
+	containerAnnoCRIUConfig = "org.criu.config"
+	criuConfigFileName      = "criu.conf"
+)
+
+var _ containerd.CheckpointOpts = withCheckpointTCPEstablished
+
+// withCheckpointTCPEstablished 转储已建立的 TCP 连接
+func withCheckpointTCPEstablished(
+	_ context.Context,
+	_ *containerd.Client,
+	_ *containers.Container,
+	_ *ociimg.Index,
+	copts *options.CheckpointOptions,
+) error {
+	copts.OpenTcp = true
+	return nil
+}
+
+// networkMode 获取还原使用的网络模式
+func (r *Restore) networkMode() common.NetworkMode {
+	if r.opts.NetworkMode != "" {
+		return r.opts.NetworkMode
+	}
+	if r.srcCheckpointInfo != nil && r.srcCheckpointInfo.Network != nil {
+		return r.srcCheckpointInfo.Network.Mode
+	}
+	return common.NetworkModeNew
+}
+
+// prepareNetwork 在还原沙盒前准备网络
+//
+// 复用源 Pod IP 时请求目标节点 CNI 分配源 Pod IP ；
+// 检查点中转储了已建立的 TCP 连接时，生成 CRIU 配置，复用 IP 时还原这些连接，否则关闭这些连接
+func (r *Restore) prepareNetwork(ctx context.Context) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	mode := r.networkMode()
+	logger.Info(fmt.Sprintf("network mode: %s", mode))
+	if err := r.validateNetworkMode(mode); err != nil {
+		return err
+	}
+
+	if mode == common.NetworkModePreserveIP {
+		logger.Info(fmt.Sprintf("requesting pod ips: %v", r.srcSandboxInfo.IPs))
+		if err := r.opts.IPRequester.RequestIPs(ctx, r.srcSandboxInfo.Config, r.srcSandboxInfo.IPs); err != nil {
+			return fmt.Errorf("request pod ips %v error: %w", r.srcSandboxInfo.IPs, err)
+		}
+	}
+
+	return r.prepareCRIUConfig()
+}
+
+// prepareCRIUConfig 检查点中转储了已建立的 TCP 连接时生成 CRIU 配置
+func (r *Restore) prepareCRIUConfig() error {
+	if !r.tcpEstablished() {
+		return nil
+	}
+	mode := r.networkMode()
+	criuConfig := "tcp-close\n"
+	if mode == common.NetworkModePreserveIP {
+		criuConfig = "tcp-established\n"
+	}
+	r.criuConfigPath = filepath.Join(r.tmpdir, criuConfigFileName)
+	if err := os.WriteFile(r.criuConfigPath, []byte(criuConfig), 0644); err != nil {
+		return fmt.Errorf("write criu config %q error: %w", r.criuConfigPath, err)
+	}
+	return nil
+}
+
+// validateNetworkMode 校验网络模式及其所需的选项和检查点信息
+func (r *Restore) validateNetworkMode(mode common.NetworkMode) error {
+	switch mode {
+	case common.NetworkModeNew:
+	case common.NetworkModePreserveIP:
+		if r.opts.IPRequester == nil {
+			return fmt.Errorf("no ip requester specified for network mode %q", mode)
+		}
+		if len(r.srcSandboxInfo.IPs) == 0 {
+			return fmt.Errorf("no source pod ip found in checkpoint")
+		}
+	default:
+		return fmt.Errorf("unsupported network mode: %q", mode)
+	}
+	return nil
+}
+
+// tcpEstablished 检查点中是否转储了已建立的 TCP 连接
+func (r *Restore) tcpEstablished() bool {
+	return r.srcCheckpointInfo != nil && r.srcCheckpointInfo.Network != nil &&
+		r.srcCheckpointInfo.Network.TCPEstablished
+}
+
+// checkNetwork 检查还原的沙盒网络是否满足网络模式的要求
+func (r *Restore) checkNetwork(_ context.Context) error {
+	if r.networkMode() != common.NetworkModePreserveIP {
+		return nil
+	}
+	for i, ip := range r.srcSandboxInfo.IPs {
+		if i >= len(r.sandboxInfo.IPs) || r.sandboxInfo.IPs[i] != ip {
+			return fmt.Errorf("pod ips %v not preserved, got %v", r.srcSandboxInfo.IPs, r.sandboxInfo.IPs)
+		}
+	}
+	return nil
+}
+
+// applyCRIUConfig 将 CRIU 配置应用到容器配置
+func (r *Restore) applyCRIUConfig(spec *ociruntime.Spec) []SpecRewriteRecord {
+	if r.criuConfigPath == "" {
+		return nil
+	}
+	if spec.Annotations == nil {
+		spec.Annotations = make(map[string]string)
+	}
+	record := SpecRewriteRecord{
+		Field: "annotations[" + containerAnnoCRIUConfig + "]",
+		Rule:  "criu-config",
+		Old:   spec.Annotations[containerAnnoCRIUConfig],
+		New:   r.criuConfigPath,
+	}
+	spec.Annotations[containerAnnoCRIUConfig] = r.criuConfigPath
+	return []SpecRewriteRecord{record}
+}
@@ -0,0 +1,125 @@
+package containerd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+	"github.com/yhlooo/podmig/pkg/podcr/network"
+)
+
+// newNetworkTestRestore 创建用于测试网络准备和检查的 *Restore
+func newNetworkTestRestore(t *testing.T, ipRequester common.IPRequester, tcpEstablished bool) *Restore {
+	return &Restore{
+		opts: common.RestoreOptions{
+			NetworkMode: common.NetworkModePreserveIP,
+			IPRequester: ipRequester,
+		},
+		tmpdir: t.TempDir(),
+		srcSandboxInfo: &SandboxInfo{
+			ID:     "src",
+			IPs:    []string{"10.244.1.5", "fd00::5"},
+			Config: &runtimev1.PodSandboxConfig{Metadata: &runtimev1.PodSandboxMetadata{Name: "web-0"}},
+		},
+		srcCheckpointInfo: &CheckpointInfo{
+			Network: &NetworkInfo{
+				Mode:           common.NetworkModePreserveIP,
+				IPs:            []string{"10.244.1.5", "fd00::5"},
+				TCPEstablished: tcpEstablished,
+			},
+		},
+	}
+}
+
+// TestPrepareNetworkPreserveIP 测试复用 IP 模式下请求源 Pod IP 并还原已建立的 TCP 连接
+func TestPrepareNetworkPreserveIP(t *testing.T) {
+	ctx := context.Background()
+	ipRequester := network.NewFakeIPRequester()
+	r := newNetworkTestRestore(t, ipRequester, true)
+
+	if err := r.prepareNetwork(ctx); err != nil {
+		t.Fatalf("prepare network error: %v", err)
+	}
+	expected := [][]string{{"10.244.1.5", "fd00::5"}}
+	if got := ipRequester.Requests(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected ip requests %v, got %v", expected, got)
+	}
+	if r.criuConfigPath != filepath.Join(r.tmpdir, criuConfigFileName) {
+		t.Fatalf("unexpected criu config path %q", r.criuConfigPath)
+	}
+	criuConfig, err := os.ReadFile(r.criuConfigPath)
+	if err != nil {
+		t.Fatalf("read criu config error: %v", err)
+	}
+	if string(criuConfig) != "tcp-established\n" {
+		t.Errorf("expected criu config %q, got %q", "tcp-established\n", criuConfig)
+	}
+}
+
+// TestPrepareNetworkPreserveIPErrors 测试复用 IP 模式下的错误
+func TestPrepareNetworkPreserveIPErrors(t *testing.T) {
+	ctx := context.Background()
+
+	// 请求 IP 失败
+	ipRequester := network.NewFakeIPRequester()
+	ipRequester.Err = errors.New("ip 10.244.1.5 is in use")
+	r := newNetworkTestRestore(t, ipRequester, true)
+	if err := r.prepareNetwork(ctx); err == nil || !errors.Is(err, ipRequester.Err) {
+		t.Errorf("expected error wrapping %v, got %v", ipRequester.Err, err)
+	}
+	if r.criuConfigPath != "" {
+		t.Errorf("expected no criu config when requesting ips failed, got %q", r.criuConfigPath)
+	}
+
+	// 未指定 IP 请求方式
+	r = newNetworkTestRestore(t, nil, false)
+	if err := r.prepareNetwork(ctx); err == nil {
+		t.Errorf("expected error without ip requester, got nil")
+	}
+
+	// 检查点中没有源 Pod IP
+	ipRequester = network.NewFakeIPRequester()
+	r = newNetworkTestRestore(t, ipRequester, false)
+	r.srcSandboxInfo.IPs = nil
+	if err := r.prepareNetwork(ctx); err == nil {
+		t.Errorf("expected error without source pod ips, got nil")
+	}
+	if got := ipRequester.Requests(); len(got) != 0 {
+		t.Errorf("expected no ip requests, got %v", got)
+	}
+}
+
+// TestCheckNetworkPreserveIP 测试复用 IP 模式下检查还原的沙盒 IP
+func TestCheckNetworkPreserveIP(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		name    string
+		ips     []string
+		wantErr bool
+	}{
+		{name: "preserved", ips: []string{"10.244.1.5", "fd00::5"}},
+		{name: "changed", ips: []string{"10.244.2.7", "fd00::5"}, wantErr: true},
+		{name: "missing-secondary", ips: []string{"10.244.1.5"}, wantErr: true},
+		{name: "no-ip", wantErr: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ipRequester := network.NewFakeIPRequester()
+			r := newNetworkTestRestore(t, ipRequester, false)
+			if err := r.prepareNetwork(ctx); err != nil {
+				t.Fatalf("prepare network error: %v", err)
+			}
+			r.sandboxInfo = &SandboxInfo{ID: "dst", IPs: c.ips}
+			err := r.checkNetwork(ctx)
+			if (err != nil) != c.wantErr {
+				t.Errorf("expected error: %t, got %v", c.wantErr, err)
+			}
+		})
+	}
+}
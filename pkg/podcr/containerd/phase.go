@@ -0,0 +1,69 @@
+package containerd
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yhlooo/podmig/pkg/podcr/events"
+	"github.com/yhlooo/podmig/pkg/podcr/metrics"
+	"github.com/yhlooo/podmig/pkg/podcr/tracing"
+)
+
+// 进度事件和失败指标中的阶段名
+//
+// 容器相关阶段名后附加 /<容器名>
+const (
+	phaseExportSandbox        = "export-sandbox"
+	phaseExportContainersInfo = "export-containers-info"
+	phaseExportCheckpointInfo = "export-checkpoint-info"
+	phaseDecideVolumes        = "decide-volumes"
+	phaseCheckpointContainer  = "checkpoint-container"
+	phaseStageMemory          = "stage-memory"
+	phaseExportContainer      = "export-container-checkpoint"
+	phaseExportSandboxShm     = "export-sandbox-shm"
+	phaseExportKubeletPodDir  = "export-kubelet-pod-dir"
+
+	phaseImport            = "import"
+	phasePreflight         = "preflight"
+	phasePrepareResources  = "prepare-resources"
+	phasePrepareNetwork    = "prepare-network"
+	phaseRestoreSandbox    = "restore-sandbox"
+	phaseCheckNetwork      = "check-network"
+	phaseWaitVolumes       = "wait-volumes"
+	phaseRestoreSandboxShm = "restore-sandbox-shm"
+	phaseRestoreContainer  = "restore-container"
+)
+
+// startPhase 记录阶段开始，返回阶段的上下文和记录阶段结束的函数
+//
+// subject 非空时作为进度事件阶段名的后缀，阶段失败时计入 operation 的失败指标。
+// 仅在 ctx 中已有 span 时创建阶段 span
+func startPhase(ctx context.Context, operation, phase, subject string) (context.Context, func(err error)) {
+	name := phase
+	if subject != "" {
+		name += "/" + subject
+	}
+	var span trace.Span
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		ctx, span = tracing.Start(ctx, name)
+	}
+	end := events.StartPhase(ctx, name)
+	return ctx, func(err error) {
+		end(err)
+		if span != nil {
+			tracing.End(span, err)
+		}
+		if err != nil {
+			metrics.PhaseFailures.WithLabelValues(operation, phase).Inc()
+		}
+	}
+}
+
+// runPhase 执行 fn 并记录阶段开始和结束，返回 fn 的错误
+func runPhase(ctx context.Context, operation, phase string, fn func(ctx context.Context) error) error {
+	ctx, end := startPhase(ctx, operation, phase, "")
+	err := fn(ctx)
+	end(err)
+	return err
+}
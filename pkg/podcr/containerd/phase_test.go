@@ -0,0 +1,76 @@
+package containerd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+	"github.com/yhlooo/podmig/pkg/podcr/metrics"
+)
+
+// TestPhaseFailureMetrics 测试检查点和还原失败时只计入失败阶段的失败次数
+func TestPhaseFailureMetrics(t *testing.T) {
+	cases := []struct {
+		name      string
+		operation string
+		phase     string
+		// 失败阶段之前成功或未执行的阶段
+		unaffected string
+		run        func(t *testing.T, ctx context.Context) error
+	}{
+		{
+			name:       "ExportContainerFailed",
+			operation:  metrics.OperationCheckpoint,
+			phase:      phaseExportContainer,
+			unaffected: phaseCheckpointContainer,
+			run: func(t *testing.T, ctx context.Context) error {
+				src := newTestNode(t)
+				src.runTestPod(t, ctx, []byte("heap"))
+				tw := tar.NewWriter(failingWriter{match: []byte(containerCheckpointTarNamePrefix + testContainerName)})
+				return src.mgr.Checkpoint(ctx, "cp1", testPodNamespace, testPodName, tw, common.CheckpointOptions{})
+			},
+		},
+		{
+			name:       "PreflightFailed",
+			operation:  metrics.OperationRestore,
+			phase:      phasePreflight,
+			unaffected: phaseRestoreSandbox,
+			run: func(t *testing.T, ctx context.Context) error {
+				archive := buildFixtureArchive(t, archiveFormatVersionV1, func(info *CheckpointInfo) {
+					info.BaseImages = []string{"docker.io/library/not-exists:latest"}
+				})
+				gr, err := gzip.NewReader(bytes.NewReader(archive))
+				if err != nil {
+					t.Fatalf("open gzip reader error: %v", err)
+				}
+				dst := newTestNode(t)
+				return dst.mgr.Restore(ctx, tar.NewReader(gr), common.RestoreOptions{PodUID: testRestoredUID})
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// 其它测试也会计入失败次数，比较执行前后的差值
+			failures := func(phase string) float64 {
+				return testutil.ToFloat64(metrics.PhaseFailures.WithLabelValues(c.operation, phase))
+			}
+			before := failures(c.phase)
+			beforeUnaffected := failures(c.unaffected)
+
+			if err := c.run(t, context.Background()); err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+			if got := failures(c.phase) - before; got != 1 {
+				t.Errorf("expected 1 failure of phase %q, got %v", c.phase, got)
+			}
+			if got := failures(c.unaffected) - beforeUnaffected; got != 0 {
+				t.Errorf("expected no failure of phase %q, got %v", c.unaffected, got)
+			}
+		})
+	}
+}
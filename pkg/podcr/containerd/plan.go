@@ -0,0 +1,182 @@
+package containerd
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/go-logr/logr"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+	"github.com/yhlooo/podmig/pkg/podcr/containerd/checkpointimage"
+)
+
+// 还原计划中代替还原时才能确定的值的占位符
+const (
+	planSandboxID    = "<sandbox-id>"
+	planSandboxPid   = "<sandbox-pid>"
+	planContainerID  = "<container-id>"
+	planCgroupParent = "<cgroup-parent>"
+)
+
+// PlanRestore 从 tr 读取 Pod 检查点并计算还原计划，不创建沙盒、不导入镜像、不写入文件
+//
+// 检查点镜像的层内容以流式读取并丢弃，内存占用与检查点大小无关
+func (h *Manager) PlanRestore(
+	ctx context.Context,
+	tr *tar.Reader,
+	opts common.RestoreOptions,
+) (*common.RestorePlan, error) {
+	tmpdir, err := os.MkdirTemp(h.tmpdir, "pod-restore-plan-")
+	if err != nil {
+		return nil, fmt.Errorf("make temp dir error: %w", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpdir)
+	}()
+
+	// 检查点镜像仅将元数据导入到内存中，丢弃层内容
+	store := checkpointimage.NewMetadataOnlyStore()
+	r := &Restore{
+		opts:           opts,
+		tmpdir:         tmpdir,
+		criClient:      h.criClient,
+		imageService:   store,
+		contentStore:   store,
+		kubeletPodsDir: h.kubeletPodsDir(),
+		cgroupV2:       h.cgroupV2,
+		tr:             tr,
+		plan:           &common.RestorePlan{},
+	}
+	return r.plan, r.Plan(ctx)
+}
+
+// Plan 计算还原计划
+func (r *Restore) Plan(ctx context.Context) error {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	// 读取检查点 tar
+	logger.Info("reading checkpoint from tar")
+	if err := r.importTar(ctx); err != nil {
+		return fmt.Errorf("import checkpoint from tar error: %w", err)
+	}
+	r.reportVolumes(ctx)
+	if err := r.selectContainers(ctx); err != nil {
+		return fmt.Errorf("select containers error: %w", err)
+	}
+	for _, img := range r.srcContainerCheckpointImages {
+		r.plan.Images = append(r.plan.Images, img.Name)
+	}
+
+	// 校验并应用资源限制覆盖
+	if err := r.prepareResources(ctx); err != nil {
+		return fmt.Errorf("prepare resources error: %w", err)
+	}
+
+	// 校验网络模式，复用源 Pod IP 时仅在计划中记录将请求的 IP ，不调用 IPRequester
+	r.plan.NetworkMode = r.networkMode()
+	if err := r.validateNetworkMode(r.plan.NetworkMode); err != nil {
+		return fmt.Errorf("prepare network error: %w", err)
+	}
+	if r.plan.NetworkMode == common.NetworkModePreserveIP {
+		r.plan.RequestIPs = r.srcSandboxInfo.IPs
+	}
+	if err := r.prepareCRIUConfig(); err != nil {
+		return fmt.Errorf("prepare network error: %w", err)
+	}
+	r.plan.SandboxConfig = r.srcSandboxInfo.Config
+
+	// 以占位符代替还原的沙盒
+	r.sandboxInfo = &SandboxInfo{
+		ID:     planSandboxID,
+		Config: r.srcSandboxInfo.Config,
+	}
+	if r.plan.NetworkMode == common.NetworkModePreserveIP {
+		r.sandboxInfo.IPs = r.srcSandboxInfo.IPs
+	}
+	var err error
+	r.cgroupTarget, err = getCgroupTarget(r.sandboxInfo, r.cgroupV2)
+	if err != nil {
+		logger.Error(err, "determine cgroup parent error, use placeholder")
+		r.cgroupTarget.Parent = planCgroupParent
+	}
+
+	// 按容器创建顺序计算容器配置改写
+	for _, target := range r.containerTargets {
+		containerPlan := common.ContainerRestorePlan{Name: target.Name}
+		var records []SpecRewriteRecord
+		if target.Checkpoint == nil {
+			config, containerRecords, err := r.convertContainerConfig(target.Info)
+			if err != nil {
+				return fmt.Errorf("convert config of container %q error: %w", target.Name, err)
+			}
+			containerPlan.Image = config.GetImage().GetImage()
+			records = containerRecords
+		} else {
+			img := *target.Checkpoint
+			containerPlan.CheckpointImage = img.Name
+			imgIndex, err := r.getImageIndex(ctx, img.Target)
+			if err != nil {
+				return fmt.Errorf("get index from checkpoint image %q error: %w", img.Name, err)
+			}
+			for _, m := range imgIndex.Manifests {
+				if m.MediaType != checkpointimage.MediaTypeContainerSpec {
+					continue
+				}
+				spec, err := r.getContainerSpec(ctx, m)
+				if err != nil {
+					return fmt.Errorf("get container spec from checkpoint image %q error: %w", img.Name, err)
+				}
+				records = r.convertContainerSpec(ctx, spec, planContainerID)
+				break
+			}
+		}
+		for _, record := range records {
+			containerPlan.SpecChanges = append(containerPlan.SpecChanges, record.String())
+		}
+		r.plan.Containers = append(r.plan.Containers, containerPlan)
+	}
+
+	// 已退出的容器
+	if r.srcCheckpointInfo != nil {
+		for _, info := range r.srcCheckpointInfo.Containers {
+			if info.Action != ContainerActionExited {
+				continue
+			}
+			r.plan.Containers = append(r.plan.Containers, common.ContainerRestorePlan{
+				Name:     info.Name,
+				Exited:   true,
+				ExitCode: info.Exited.GetExitCode(),
+			})
+		}
+	}
+
+	return nil
+}
+
+// planFile 将 kubelet Pod 目录文件加入还原计划，并检查与已有文件的冲突
+func (r *Restore) planFile(path string, info os.FileInfo) {
+	filePlan := common.FileRestorePlan{
+		Path: path,
+		Mode: info.Mode(),
+	}
+	if info.Mode().IsRegular() {
+		filePlan.Size = info.Size()
+	}
+
+	existing, err := os.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		filePlan.Conflict = fmt.Sprintf("stat error: %s", err)
+	case existing.Mode().Type() != info.Mode().Type():
+		filePlan.Conflict = fmt.Sprintf("already exists as %s", existing.Mode().Type())
+	case existing.Mode().IsRegular():
+		filePlan.Conflict = "already exists, will be overwritten"
+	case existing.Mode()&os.ModeSymlink != 0:
+		filePlan.Conflict = "symlink already exists, can not be created"
+	}
+
+	r.plan.Files = append(r.plan.Files, filePlan)
+}
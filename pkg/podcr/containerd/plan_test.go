@@ -0,0 +1,150 @@
+package containerd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+	"github.com/yhlooo/podmig/pkg/podcr/containerd/checkpointimage"
+	"github.com/yhlooo/podmig/pkg/podcr/containerd/fake"
+	"github.com/yhlooo/podmig/pkg/podcr/network"
+)
+
+// openFixtureArchive 打开 testdata/archives 中的固定归档
+func openFixtureArchive(t *testing.T, name string) *tar.Reader {
+	raw, err := os.ReadFile(filepath.Join("testdata", "archives", name))
+	if err != nil {
+		t.Fatalf("read fixture archive error: %v", err)
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("open gzip reader error: %v", err)
+	}
+	return tar.NewReader(gr)
+}
+
+// TestPlanRestorePreserveIP 测试复用源 Pod IP 时计划中记录将请求的 IP ，但不调用 IPRequester
+func TestPlanRestorePreserveIP(t *testing.T) {
+	ctx := context.Background()
+	node := newTestNode(t)
+	ipRequester := network.NewFakeIPRequester()
+	plan, err := node.mgr.PlanRestore(ctx, openFixtureArchive(t, "v1.tar.gz"), common.RestoreOptions{
+		PodUID:      testRestoredUID,
+		NetworkMode: common.NetworkModePreserveIP,
+		IPRequester: ipRequester,
+	})
+	if err != nil {
+		t.Fatalf("plan restore error: %v", err)
+	}
+	if plan.NetworkMode != common.NetworkModePreserveIP {
+		t.Errorf("expected network mode %q, got %q", common.NetworkModePreserveIP, plan.NetworkMode)
+	}
+	if !reflect.DeepEqual(plan.RequestIPs, []string{"10.244.1.5"}) {
+		t.Errorf("expected pod ips [10.244.1.5] to request in plan, got %v", plan.RequestIPs)
+	}
+	if requests := ipRequester.Requests(); len(requests) != 0 {
+		t.Errorf("plan restore must not request pod ips, got %v", requests)
+	}
+	if len(node.cri.Sandboxes) != 0 || len(node.backend.Images()) != 0 {
+		t.Errorf("plan restore must not create sandboxes or import images")
+	}
+
+	// 未指定 IPRequester 时计划失败
+	_, err = node.mgr.PlanRestore(ctx, openFixtureArchive(t, "v1.tar.gz"), common.RestoreOptions{
+		NetworkMode: common.NetworkModePreserveIP,
+	})
+	if err == nil || !strings.Contains(err.Error(), "no ip requester specified") {
+		t.Errorf("expected no ip requester error, got %v", err)
+	}
+
+	// 新网络不请求 IP
+	plan, err = node.mgr.PlanRestore(ctx, openFixtureArchive(t, "v1.tar.gz"), common.RestoreOptions{
+		NetworkMode: common.NetworkModeNew,
+	})
+	if err != nil {
+		t.Fatalf("plan restore error: %v", err)
+	}
+	if len(plan.RequestIPs) != 0 {
+		t.Errorf("expected no pod ips to request, got %v", plan.RequestIPs)
+	}
+}
+
+// TestPlanRestoreResources 测试计划中根据被丢弃的检查点层校验资源限制
+func TestPlanRestoreResources(t *testing.T) {
+	ctx := context.Background()
+	node := newTestNode(t)
+	_, err := node.mgr.PlanRestore(ctx, openFixtureArchive(t, "v1.tar.gz"), common.RestoreOptions{
+		Resources: map[string]common.ContainerResources{testContainerName: {MemoryBytes: 1}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "less than checkpointed memory pages") {
+		t.Errorf("expected memory limit error, got %v", err)
+	}
+}
+
+// TestMetadataOnlyImageStore 测试仅保留元数据的镜像存储丢弃层内容
+func TestMetadataOnlyImageStore(t *testing.T) {
+	ctx := context.Background()
+	memory := []byte("heap: counter=42")
+	b := fake.NewBackend()
+	b.AddContainer(fixtureContainerID, fixtureContainerSpec(), memory)
+	img, err := b.Checkpoint(ctx, fixtureContainerID, "checkpoint-fixture:app")
+	if err != nil {
+		t.Fatalf("checkpoint error: %v", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := b.Export(ctx, buf, img.Name); err != nil {
+		t.Fatalf("export error: %v", err)
+	}
+
+	store := checkpointimage.NewMetadataOnlyStore()
+	imgs, err := store.Import(ctx, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("import error: %v", err)
+	}
+	if len(imgs) != 1 {
+		t.Fatalf("expected 1 image, got %d", len(imgs))
+	}
+	index, err := checkpointimage.ReadImageIndex(ctx, store, imgs[0].Target)
+	if err != nil {
+		t.Fatalf("read image index error: %v", err)
+	}
+	checked := 0
+	for _, m := range index.Manifests {
+		switch m.MediaType {
+		case checkpointimage.MediaTypeContainerSpec:
+			if _, err := store.ReaderAt(ctx, m); err != nil {
+				t.Errorf("expected container spec kept, got %v", err)
+			}
+			checked++
+		default:
+			if _, err := store.ReaderAt(ctx, m); err == nil {
+				t.Errorf("expected layer %s (%s) discarded", m.Digest, m.MediaType)
+			}
+			size, err := getCRIUPagesSize(ctx, store, m)
+			if err != nil {
+				t.Fatalf("get criu pages size error: %v", err)
+			}
+			if size != int64(len(memory)) {
+				t.Errorf("expected criu pages size %d, got %d", len(memory), size)
+			}
+			checked++
+		}
+	}
+	if checked != 2 {
+		t.Errorf("expected checkpoint and spec manifests, got %d", checked)
+	}
+
+	// 摘要不匹配的层被拒绝
+	corrupted := bytes.Replace(buf.Bytes(), memory, []byte("heap: counter=43"), 1)
+	if _, err := checkpointimage.NewMetadataOnlyStore().Import(ctx, bytes.NewReader(corrupted)); err == nil ||
+		!strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("expected digest mismatch error, got %v", err)
+	}
+}
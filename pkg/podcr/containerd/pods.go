@@ -0,0 +1,103 @@
+package containerd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/labels"
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+)
+
+// ListPods 列出本节点上命名空间 namespace （为空表示所有命名空间）中标签与 selector 匹配的运行中的 Pod
+//
+// kubelet 将 Pod 标签设置为沙盒标签，因此以沙盒标签匹配 selector
+func (h *Manager) ListPods(ctx context.Context, namespace string, selector labels.Selector) ([]common.PodKey, error) {
+	filter := &runtimev1.PodSandboxFilter{
+		State: &runtimev1.PodSandboxStateValue{State: runtimev1.PodSandboxState_SANDBOX_READY},
+	}
+	if namespace != "" {
+		filter.LabelSelector = map[string]string{labelPodNamespace: namespace}
+	}
+	sandboxes, err := h.criClient.ListPodSandbox(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("list pod sandboxes error: %w", err)
+	}
+
+	seen := make(map[common.PodKey]bool, len(sandboxes))
+	var ret []common.PodKey
+	for _, sandbox := range sandboxes {
+		if selector != nil && !selector.Matches(labels.Set(sandbox.Labels)) {
+			continue
+		}
+		key := common.PodKey{
+			Namespace: sandbox.GetMetadata().GetNamespace(),
+			Name:      sandbox.GetMetadata().GetName(),
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		ret = append(ret, key)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].String() < ret[j].String()
+	})
+	return ret, nil
+}
+
+// Resume 恢复 Pod 中暂停的容器，如以 CheckpointOptions.LeavePaused 建立检查点后保持暂停的容器
+//
+// 只处理就绪的沙盒中运行中（包括暂停）的容器。
+// containerd CRI 插件会删除已退出的容器的 task ，找不到 task 的容器视为已退出，无需恢复
+func (h *Manager) Resume(ctx context.Context, namespace, name string) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	podKey := namespace + "/" + name
+
+	sandboxes, err := h.criClient.ListPodSandbox(ctx, &runtimev1.PodSandboxFilter{
+		State: &runtimev1.PodSandboxStateValue{State: runtimev1.PodSandboxState_SANDBOX_READY},
+		LabelSelector: map[string]string{
+			labelPodName:      name,
+			labelPodNamespace: namespace,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("list pod sandboxes error: %w", err)
+	}
+	if len(sandboxes) == 0 {
+		return fmt.Errorf("ready pod sandbox %q not found", podKey)
+	}
+
+	for _, sandbox := range sandboxes {
+		containers, err := h.criClient.ListContainers(ctx, &runtimev1.ContainerFilter{
+			PodSandboxId: sandbox.Id,
+			State:        &runtimev1.ContainerStateValue{State: runtimev1.ContainerState_CONTAINER_RUNNING},
+		})
+		if err != nil {
+			return fmt.Errorf("list containers of sandbox %q error: %w", sandbox.Id, err)
+		}
+		for _, container := range containers {
+			status, err := h.containerService.TaskStatus(ctx, container.Id)
+			if errdefs.IsNotFound(err) {
+				logger.V(1).Info(fmt.Sprintf("task of container %q not found, skip", container.Metadata.GetName()))
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("get task status of container %q error: %w", container.Metadata.GetName(), err)
+			}
+			if status.Status != containerd.Paused {
+				continue
+			}
+			if err := h.containerService.ResumeTask(ctx, container.Id); err != nil {
+				return fmt.Errorf("resume task of container %q error: %w", container.Metadata.GetName(), err)
+			}
+			logger.Info(fmt.Sprintf("resumed container %q", container.Metadata.GetName()))
+		}
+	}
+	return nil
+}
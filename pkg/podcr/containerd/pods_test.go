@@ -0,0 +1,104 @@
+package containerd
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+	"github.com/yhlooo/podmig/pkg/podcr/containerd/fake"
+)
+
+// TestListPods 测试按命名空间和标签选择器列出本节点上运行中的 Pod
+func TestListPods(t *testing.T) {
+	ctx := context.Background()
+	n := newTestNode(t)
+	pods := []fake.Pod{
+		{Namespace: "default", Name: "web-1", UID: "uid-web-1", Labels: map[string]string{"app": "web"}},
+		{Namespace: "default", Name: "web-0", UID: "uid-web-0", Labels: map[string]string{"app": "web"}},
+		{Namespace: "default", Name: "db-0", UID: "uid-db-0", Labels: map[string]string{"app": "db"}},
+		{Namespace: "other", Name: "web-0", UID: "uid-other-web-0", Labels: map[string]string{"app": "web"}},
+		// 同名 Pod 的多个沙盒只列出一次
+		{Namespace: "default", Name: "web-0", UID: "uid-web-0-new", Labels: map[string]string{"app": "web"}},
+		// 已停止的沙盒不列出
+		{Namespace: "default", Name: "stopped-0", UID: "uid-stopped-0", Labels: map[string]string{"app": "web"}},
+	}
+	for _, pod := range pods {
+		pod.ContainerName = testContainerName
+		if _, err := fake.RunPod(ctx, n.cri, n.backend, n.kubeletRootDir, pod); err != nil {
+			t.Fatalf("run pod %s/%s error: %v", pod.Namespace, pod.Name, err)
+		}
+	}
+	stopped, err := n.cri.ListPodSandbox(ctx, &runtimev1.PodSandboxFilter{
+		LabelSelector: map[string]string{labelPodName: "stopped-0"},
+	})
+	if err != nil || len(stopped) != 1 {
+		t.Fatalf("expected 1 sandbox of stopped-0, got %d (%v)", len(stopped), err)
+	}
+	if err := n.cri.StopPodSandbox(ctx, stopped[0].Id); err != nil {
+		t.Fatalf("stop pod sandbox error: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		namespace string
+		selector  string
+		expected  []common.PodKey
+	}{
+		{
+			name:      "Namespace",
+			namespace: "default",
+			expected: []common.PodKey{
+				{Namespace: "default", Name: "db-0"},
+				{Namespace: "default", Name: "web-0"},
+				{Namespace: "default", Name: "web-1"},
+			},
+		},
+		{
+			name:      "NamespaceAndSelector",
+			namespace: "default",
+			selector:  "app=web",
+			expected: []common.PodKey{
+				{Namespace: "default", Name: "web-0"},
+				{Namespace: "default", Name: "web-1"},
+			},
+		},
+		{
+			name:     "AllNamespacesAndSelector",
+			selector: "app=web",
+			expected: []common.PodKey{
+				{Namespace: "default", Name: "web-0"},
+				{Namespace: "default", Name: "web-1"},
+				{Namespace: "other", Name: "web-0"},
+			},
+		},
+		{
+			name:     "SetSelector",
+			selector: "app in (db, cache)",
+			expected: []common.PodKey{{Namespace: "default", Name: "db-0"}},
+		},
+		{
+			name:      "NotMatched",
+			namespace: "other",
+			selector:  "app!=web",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			selector, err := labels.Parse(c.selector)
+			if err != nil {
+				t.Fatalf("parse selector error: %v", err)
+			}
+			got, err := n.mgr.ListPods(ctx, c.namespace, selector)
+			if err != nil {
+				t.Fatalf("list pods error: %v", err)
+			}
+			if !reflect.DeepEqual(got, c.expected) {
+				t.Errorf("expected pods %v, got %v", c.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package containerd
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/go-logr/logr"
+	criapis "k8s.io/cri-api/pkg/apis"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+	"github.com/yhlooo/podmig/pkg/utils/tarutil"
+)
+
+const (
+	criAPIVersion = "v1"
+	criuBinary    = "criu"
+	runcBinary    = "runc"
+)
+
+// versionRegexp 匹配命令输出中的版本号
+var versionRegexp = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// NodeFingerprint 节点指纹，记录影响检查点能否还原的节点信息
+type NodeFingerprint struct {
+	// CPU 架构
+	Arch string `json:"arch"`
+	// 内核版本
+	KernelVersion string `json:"kernelVersion,omitempty"`
+	// CPU 特性
+	CPUFlags []string `json:"cpuFlags,omitempty"`
+	// 是否为 cgroup v2
+	CgroupV2 bool `json:"cgroupV2"`
+	// CRIU 版本，为空表示未安装
+	CRIUVersion string `json:"criuVersion,omitempty"`
+	// runc 版本，为空表示未安装
+	RuncVersion string `json:"runcVersion,omitempty"`
+	// 容器运行时名
+	RuntimeName string `json:"runtimeName,omitempty"`
+	// 容器运行时版本
+	RuntimeVersion string `json:"runtimeVersion,omitempty"`
+}
+
+// Preflight 从 tr 读取 Pod 检查点，检查其与本节点的兼容性
+//
+// 旧版本检查点中没有检查点信息，跳过检查，报告中仅包含一条说明跳过的警告
+func (h *Manager) Preflight(ctx context.Context, tr *tar.Reader) (*common.PreflightReport, error) {
+	var checkpointInfo *CheckpointInfo
+	for checkpointInfo == nil {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read checkpoint tar file error: %w", err)
+		}
+		if hdr.Name != checkpointInfoJSONName {
+			continue
+		}
+		checkpointInfo = &CheckpointInfo{}
+		if err := tarutil.ReadJSON(tr, checkpointInfo); err != nil {
+			return nil, fmt.Errorf("read checkpoint info from file %q error: %w", hdr.Name, err)
+		}
+	}
+	if checkpointInfo == nil {
+		// 旧版本检查点中没有检查点信息，没有可比较的节点指纹和镜像
+		report := &common.PreflightReport{}
+		report.Add(common.PreflightSeverityWarning, "node", fmt.Sprintf(
+			"no node fingerprint in checkpoint (%q not found), preflight skipped", checkpointInfoJSONName,
+		))
+		return report, nil
+	}
+	return preflight(ctx, h.criClient, h.imageService, h.cgroupV2, checkpointInfo)
+}
+
+// preflight 检查检查点与本节点的兼容性
+func (r *Restore) preflight(ctx context.Context) error {
+	logger := logr.FromContextOrDiscard(ctx)
+	report, err := preflight(ctx, r.criClient, r.imageService, r.cgroupV2, r.srcCheckpointInfo)
+	if err != nil {
+		return err
+	}
+	for _, issue := range report.Issues {
+		logger.Info(fmt.Sprintf("preflight %s: %s", issue.Severity, issue))
+	}
+	if blocking := report.Blocking(); len(blocking) > 0 {
+		return fmt.Errorf("%d blocking incompatibilities found, first: %s", len(blocking), blocking[0])
+	}
+	return nil
+}
+
+// preflight 将检查点中记录的节点指纹、基础镜像与本节点比较
+func preflight(
+	ctx context.Context,
+	criClient criapis.RuntimeService,
+	imageService ImageService,
+	cgroupV2 bool,
+	checkpointInfo *CheckpointInfo,
+) (*common.PreflightReport, error) {
+	report := &common.PreflightReport{}
+	if checkpointInfo.Node == nil {
+		report.Add(common.PreflightSeverityWarning, "node", "no node fingerprint in checkpoint")
+	} else {
+		local, err := collectNodeFingerprint(ctx, criClient, cgroupV2)
+		if err != nil {
+			return nil, fmt.Errorf("collect local node fingerprint error: %w", err)
+		}
+		compareNodeFingerprint(report, checkpointInfo.Node, local)
+	}
+
+	// 基础镜像
+	for _, img := range checkpointInfo.BaseImages {
+		_, err := imageService.Get(ctx, img)
+		switch {
+		case errdefs.IsNotFound(err):
+			report.Add(common.PreflightSeverityBlocking, "image", fmt.Sprintf("base image %q not found", img))
+		case err != nil:
+			return nil, fmt.Errorf("get image %q error: %w", img, err)
+		}
+	}
+
+	// 重新创建的容器使用源容器实际运行的镜像
+	for _, container := range checkpointInfo.Containers {
+		if container.Action != ContainerActionRecreate || container.Ephemeral || container.ImageRef == "" {
+			continue
+		}
+		_, err := imageService.Get(ctx, container.ImageRef)
+		switch {
+		case errdefs.IsNotFound(err) && container.Image != "":
+			// 还原时拉取镜像名
+			report.Add(common.PreflightSeverityWarning, "image", fmt.Sprintf(
+				"image %q of container %q to be recreated not found, %q will be pulled",
+				container.ImageRef, container.Name, container.Image,
+			))
+		case errdefs.IsNotFound(err):
+			report.Add(common.PreflightSeverityBlocking, "image", fmt.Sprintf(
+				"image %q of container %q to be recreated not found", container.ImageRef, container.Name,
+			))
+		case err != nil:
+			return nil, fmt.Errorf("get image %q error: %w", container.ImageRef, err)
+		}
+	}
+
+	return report, nil
+}
+
+// compareNodeFingerprint 比较源节点与目标节点指纹
+func compareNodeFingerprint(report *common.PreflightReport, src, dst *NodeFingerprint) {
+	if src.Arch != dst.Arch {
+		report.Add(common.PreflightSeverityBlocking, "arch", fmt.Sprintf("%s -> %s", src.Arch, dst.Arch))
+	}
+
+	// CRIU 还原时要求目标 CPU 具有源 CPU 的所有特性
+	dstFlags := make(map[string]bool, len(dst.CPUFlags))
+	for _, flag := range dst.CPUFlags {
+		dstFlags[flag] = true
+	}
+	var missingFlags []string
+	for _, flag := range src.CPUFlags {
+		if !dstFlags[flag] {
+			missingFlags = append(missingFlags, flag)
+		}
+	}
+	if len(missingFlags) > 0 {
+		report.Add(common.PreflightSeverityBlocking, "cpu", fmt.Sprintf("missing cpu flags: %v", missingFlags))
+	}
+
+	switch {
+	case dst.CRIUVersion == "":
+		report.Add(common.PreflightSeverityBlocking, "criu", "criu not found")
+	case compareVersion(dst.CRIUVersion, src.CRIUVersion) < 0:
+		report.Add(common.PreflightSeverityWarning, "criu", fmt.Sprintf(
+			"older than checkpoint: %s -> %s", src.CRIUVersion, dst.CRIUVersion,
+		))
+	}
+	switch {
+	case dst.RuncVersion == "":
+		report.Add(common.PreflightSeverityWarning, "runc", "runc not found in PATH")
+	case compareVersion(dst.RuncVersion, src.RuncVersion) != 0:
+		report.Add(common.PreflightSeverityWarning, "runc", fmt.Sprintf("%s -> %s", src.RuncVersion, dst.RuncVersion))
+	}
+	if src.RuntimeName != dst.RuntimeName {
+		report.Add(common.PreflightSeverityBlocking, "runtime", fmt.Sprintf(
+			"%s -> %s", src.RuntimeName, dst.RuntimeName,
+		))
+	} else if src.RuntimeVersion != dst.RuntimeVersion {
+		report.Add(common.PreflightSeverityWarning, "runtime", fmt.Sprintf(
+			"%s %s -> %s", src.RuntimeName, src.RuntimeVersion, dst.RuntimeVersion,
+		))
+	}
+	switch compareVersion(dst.KernelVersion, src.KernelVersion) {
+	case -1:
+		report.Add(common.PreflightSeverityWarning, "kernel", fmt.Sprintf(
+			"older than checkpoint: %s -> %s", src.KernelVersion, dst.KernelVersion,
+		))
+	case 1:
+		report.Add(common.PreflightSeverityWarning, "kernel", fmt.Sprintf("%s -> %s", src.KernelVersion, dst.KernelVersion))
+	}
+	if src.CgroupV2 != dst.CgroupV2 {
+		// 还原时会重定位 cgroup 并移除目标 cgroup 版本不支持的资源限制
+		report.Add(common.PreflightSeverityWarning, "cgroup", fmt.Sprintf(
+			"cgroup v2: %t -> %t, unsupported resource limits will be dropped", src.CgroupV2, dst.CgroupV2,
+		))
+	}
+}
+
+// collectNodeFingerprint 收集本节点指纹
+func collectNodeFingerprint(
+	ctx context.Context,
+	criClient criapis.RuntimeService,
+	cgroupV2 bool,
+) (*NodeFingerprint, error) {
+	fp := &NodeFingerprint{
+		Arch:        runtime.GOARCH,
+		CgroupV2:    cgroupV2,
+		CRIUVersion: getBinaryVersion(ctx, criuBinary),
+		RuncVersion: getBinaryVersion(ctx, runcBinary),
+	}
+
+	var err error
+	fp.KernelVersion, err = getKernelVersion()
+	if err != nil {
+		return nil, fmt.Errorf("get kernel version error: %w", err)
+	}
+	fp.CPUFlags, err = getCPUFlags()
+	if err != nil {
+		return nil, fmt.Errorf("get cpu flags error: %w", err)
+	}
+	version, err := criClient.Version(ctx, criAPIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("get container runtime version error: %w", err)
+	}
+	fp.RuntimeName, fp.RuntimeVersion = version.GetRuntimeName(), version.GetRuntimeVersion()
+
+	return fp, nil
+}
+
+// getBinaryVersion 执行 `<name> --version` 获取版本，未安装或获取失败时返回空
+func getBinaryVersion(ctx context.Context, name string) string {
+	if _, err := exec.LookPath(name); err != nil {
+		return ""
+	}
+	out, err := exec.CommandContext(ctx, name, "--version").Output()
+	if err != nil {
+		return ""
+	}
+	return versionRegexp.FindString(string(out))
+}
+
+// compareVersion 比较点分版本号，返回 -1 、 0 或 1
+//
+// 忽略版本号中第一个非数字部分之后的内容，如 6.1.0-18-amd64 视为 6.1.0
+func compareVersion(a, b string) int {
+	as := strings.Split(versionRegexp.FindString(a), ".")
+	bs := strings.Split(versionRegexp.FindString(b), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
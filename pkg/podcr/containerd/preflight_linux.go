@@ -0,0 +1,59 @@
+package containerd
+
+import (
+	"bufio"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+const cpuInfoPath = "/proc/cpuinfo"
+
+// getKernelVersion 获取本节点内核版本
+func getKernelVersion() (string, error) {
+	var uname syscall.Utsname
+	if err := syscall.Uname(&uname); err != nil {
+		return "", err
+	}
+	return utsnameToString(uname.Release), nil
+}
+
+// utsnameToString 将 syscall.Utsname 中的字段转换为字符串
+func utsnameToString[T int8 | uint8](field [65]T) string {
+	var sb strings.Builder
+	for _, c := range field {
+		if c == 0 {
+			break
+		}
+		sb.WriteByte(byte(c))
+	}
+	return sb.String()
+}
+
+// getCPUFlags 从 /proc/cpuinfo 获取 CPU 特性，已排序
+func getCPUFlags() ([]string, error) {
+	f, err := os.Open(cpuInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		// x86 为 flags ， arm 为 Features
+		key = strings.TrimSpace(key)
+		if key != "flags" && key != "Features" {
+			continue
+		}
+		flags := strings.Fields(value)
+		sort.Strings(flags)
+		return flags, nil
+	}
+	return nil, scanner.Err()
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package containerd
+
+// getKernelVersion 获取本节点内核版本
+//
+// 非 Linux 平台没有 Linux 内核，返回空
+func getKernelVersion() (string, error) {
+	return "", nil
+}
+
+// getCPUFlags 获取 CPU 特性
+//
+// 非 Linux 平台不支持，返回空
+func getCPUFlags() ([]string, error) {
+	return nil, nil
+}
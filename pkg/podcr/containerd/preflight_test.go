@@ -0,0 +1,180 @@
+package containerd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+)
+
+// TestCompareVersion 测试比较内核、 CRIU 、 runc 等命令输出中的版本号
+func TestCompareVersion(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "3.17.1", b: "3.17.1", expected: 0},
+		{a: "3.17.1", b: "3.18", expected: -1},
+		{a: "3.19", b: "3.17.1", expected: 1},
+		{a: "3.17", b: "3.17.0", expected: 0},
+		{a: "Version: 3.17.1", b: "3.17.1", expected: 0},
+		{a: "runc version 1.1.12", b: "1.1.9", expected: 1},
+		// 忽略发行版的修订号和后缀
+		{a: "6.1.0-18-amd64", b: "6.1.0-21-amd64", expected: 0},
+		{a: "6.1.0-18-amd64", b: "5.15.0-91-generic", expected: 1},
+		{a: "5.15.0-91-generic", b: "6.1.0-18-amd64", expected: -1},
+		{a: "5.14.0-362.8.1.el9_3.x86_64", b: "5.14.0", expected: 0},
+		{a: "6.10.0", b: "6.9.12", expected: 1},
+		{a: "", b: "3.17.1", expected: -1},
+		{a: "", b: "", expected: 0},
+	}
+	for _, c := range cases {
+		if got := compareVersion(c.a, c.b); got != c.expected {
+			t.Errorf("expected compareVersion(%q, %q) = %d, got %d", c.a, c.b, c.expected, got)
+		}
+	}
+}
+
+// TestCompareNodeFingerprint 测试比较源节点与目标节点指纹产生的兼容性问题
+func TestCompareNodeFingerprint(t *testing.T) {
+	base := NodeFingerprint{
+		Arch:           "amd64",
+		KernelVersion:  "6.1.0-18-amd64",
+		CPUFlags:       []string{"sse4_2", "avx2"},
+		CgroupV2:       true,
+		CRIUVersion:    "3.17.1",
+		RuncVersion:    "1.1.12",
+		RuntimeName:    "containerd",
+		RuntimeVersion: "v1.7.16",
+	}
+
+	cases := []struct {
+		name     string
+		mutate   func(dst *NodeFingerprint)
+		expected []common.PreflightIssue
+	}{
+		{
+			name:   "Same",
+			mutate: func(*NodeFingerprint) {},
+		},
+		{
+			name:   "KernelRevision",
+			mutate: func(dst *NodeFingerprint) { dst.KernelVersion = "6.1.0-21-amd64" },
+		},
+		{
+			name: "MoreCPUFlags",
+			mutate: func(dst *NodeFingerprint) {
+				dst.CPUFlags = []string{"avx512f", "avx2", "sse4_2"}
+			},
+		},
+		{
+			name:   "Arch",
+			mutate: func(dst *NodeFingerprint) { dst.Arch = "arm64" },
+			expected: []common.PreflightIssue{
+				{Severity: common.PreflightSeverityBlocking, Item: "arch", Message: "amd64 -> arm64"},
+			},
+		},
+		{
+			name:   "MissingCPUFlags",
+			mutate: func(dst *NodeFingerprint) { dst.CPUFlags = []string{"sse4_2"} },
+			expected: []common.PreflightIssue{
+				{Severity: common.PreflightSeverityBlocking, Item: "cpu", Message: "missing cpu flags: [avx2]"},
+			},
+		},
+		{
+			name:   "CRIUNotFound",
+			mutate: func(dst *NodeFingerprint) { dst.CRIUVersion = "" },
+			expected: []common.PreflightIssue{
+				{Severity: common.PreflightSeverityBlocking, Item: "criu", Message: "criu not found"},
+			},
+		},
+		{
+			name:   "CRIUOlder",
+			mutate: func(dst *NodeFingerprint) { dst.CRIUVersion = "3.16" },
+			expected: []common.PreflightIssue{
+				{Severity: common.PreflightSeverityWarning, Item: "criu", Message: "older than checkpoint: 3.17.1 -> 3.16"},
+			},
+		},
+		{
+			name:   "CRIUNewer",
+			mutate: func(dst *NodeFingerprint) { dst.CRIUVersion = "3.19" },
+		},
+		{
+			name:   "RuncDifferent",
+			mutate: func(dst *NodeFingerprint) { dst.RuncVersion = "1.1.9" },
+			expected: []common.PreflightIssue{
+				{Severity: common.PreflightSeverityWarning, Item: "runc", Message: "1.1.12 -> 1.1.9"},
+			},
+		},
+		{
+			name:   "RuntimeDifferent",
+			mutate: func(dst *NodeFingerprint) { dst.RuntimeName, dst.RuntimeVersion = "cri-o", "1.30.0" },
+			expected: []common.PreflightIssue{
+				{Severity: common.PreflightSeverityBlocking, Item: "runtime", Message: "containerd -> cri-o"},
+			},
+		},
+		{
+			name:   "KernelOlder",
+			mutate: func(dst *NodeFingerprint) { dst.KernelVersion = "5.15.0-91-generic" },
+			expected: []common.PreflightIssue{{
+				Severity: common.PreflightSeverityWarning,
+				Item:     "kernel",
+				Message:  "older than checkpoint: 6.1.0-18-amd64 -> 5.15.0-91-generic",
+			}},
+		},
+		{
+			name:   "KernelNewer",
+			mutate: func(dst *NodeFingerprint) { dst.KernelVersion = "6.6.13-1-lts" },
+			expected: []common.PreflightIssue{
+				{Severity: common.PreflightSeverityWarning, Item: "kernel", Message: "6.1.0-18-amd64 -> 6.6.13-1-lts"},
+			},
+		},
+		{
+			name:   "CgroupV1",
+			mutate: func(dst *NodeFingerprint) { dst.CgroupV2 = false },
+			expected: []common.PreflightIssue{{
+				Severity: common.PreflightSeverityWarning,
+				Item:     "cgroup",
+				Message:  "cgroup v2: true -> false, unsupported resource limits will be dropped",
+			}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			src := base
+			dst := base
+			dst.CPUFlags = append([]string{}, base.CPUFlags...)
+			c.mutate(&dst)
+
+			report := &common.PreflightReport{}
+			compareNodeFingerprint(report, &src, &dst)
+			if !reflect.DeepEqual(report.Issues, c.expected) {
+				t.Errorf("expected issues %v, got %v", c.expected, report.Issues)
+			}
+		})
+	}
+}
+
+// TestPreflightLegacyArchive 测试旧版本检查点没有节点指纹时报告跳过检查而不是失败
+func TestPreflightLegacyArchive(t *testing.T) {
+	gr, err := gzip.NewReader(bytes.NewReader(buildFixtureArchive(t, archiveFormatVersionLegacy, nil)))
+	if err != nil {
+		t.Fatalf("open gzip reader error: %v", err)
+	}
+	report, err := newTestNode(t).mgr.Preflight(context.Background(), tar.NewReader(gr))
+	if err != nil {
+		t.Fatalf("preflight error: %v", err)
+	}
+	if len(report.Issues) != 1 {
+		t.Fatalf("expected 1 issue, got %v", report.Issues)
+	}
+	issue := report.Issues[0]
+	if issue.Severity != common.PreflightSeverityWarning || !strings.Contains(issue.Message, "preflight skipped") {
+		t.Errorf("expected warning of skipped preflight, got %s %s", issue.Severity, issue)
+	}
+}
@@ -0,0 +1,256 @@
+package containerd
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/go-logr/logr"
+	ociimg "github.com/opencontainers/image-spec/specs-go/v1"
+	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+	"github.com/yhlooo/podmig/pkg/podcr/containerd/checkpointimage"
+)
+
+const (
+	// 与 kubelet 一致的 CPU CFS 周期（微秒）
+	cpuQuotaPeriod = 100000
+	// 最小 CPU CFS 配额（微秒）
+	minCPUQuota = 1000
+)
+
+// checkpointContainerResources 检查点中容器的资源信息
+type checkpointContainerResources struct {
+	// 容器名
+	Name string
+	// 检查点中的 CPU 限制（ millicore ），为 0 表示不限制
+	MilliCPU int64
+	// 检查点中的内存限制（字节），为 0 表示不限制
+	MemoryBytes int64
+	// 检查点中转储的内存页大小（字节）
+	DumpedMemoryBytes int64
+}
+
+// prepareResources 在还原沙盒前校验资源限制覆盖选项，并据此调整沙盒资源配置
+func (r *Restore) prepareResources(ctx context.Context) error {
+	if len(r.opts.Resources) == 0 {
+		return nil
+	}
+	logger := logr.FromContextOrDiscard(ctx)
+
+	// 读取检查点中各容器的资源信息
+	containers := make(map[string]checkpointContainerResources, len(r.containerTargets))
+	for _, target := range r.containerTargets {
+		if target.Checkpoint == nil {
+			containers[target.Name] = getContainerConfigResources(target.Name, target.Info.Config)
+			continue
+		}
+		info, err := r.getCheckpointContainerResources(ctx, *target.Checkpoint)
+		if err != nil {
+			return fmt.Errorf("get container resources from checkpoint image %q error: %w", target.Checkpoint.Name, err)
+		}
+		containers[info.Name] = info
+	}
+
+	// 校验
+	names := make([]string, 0, len(r.opts.Resources))
+	for name := range r.opts.Resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		res := r.opts.Resources[name]
+		info, ok := containers[name]
+		if !ok {
+			return fmt.Errorf("container %q not found in checkpoint", name)
+		}
+		if res.MemoryBytes > 0 && res.MemoryBytes < info.DumpedMemoryBytes {
+			return fmt.Errorf(
+				"memory limit %d of container %q is less than checkpointed memory pages %d",
+				res.MemoryBytes, name, info.DumpedMemoryBytes,
+			)
+		}
+		logger.Info(fmt.Sprintf(
+			"container %q resources: cpu %dm -> %dm, memory %d -> %d (checkpointed memory pages: %d)",
+			name, info.MilliCPU, res.MilliCPU, info.MemoryBytes, res.MemoryBytes, info.DumpedMemoryBytes,
+		))
+	}
+
+	// 计算 Pod 级别资源限制，任意容器不限制则 Pod 不限制
+	var podMilliCPU, podMemoryBytes int64
+	cpuLimited, memoryLimited := true, true
+	for name, info := range containers {
+		milliCPU, memoryBytes := info.MilliCPU, info.MemoryBytes
+		if res, ok := r.opts.Resources[name]; ok {
+			if res.MilliCPU > 0 {
+				milliCPU = res.MilliCPU
+			}
+			if res.MemoryBytes > 0 {
+				memoryBytes = res.MemoryBytes
+			}
+		}
+		cpuLimited = cpuLimited && milliCPU > 0
+		memoryLimited = memoryLimited && memoryBytes > 0
+		podMilliCPU += milliCPU
+		podMemoryBytes += memoryBytes
+	}
+
+	// 调整沙盒资源配置
+	config := r.srcSandboxInfo.Config
+	if config.Linux == nil {
+		config.Linux = &runtimev1.LinuxPodSandboxConfig{}
+	}
+	if config.Linux.Resources == nil {
+		config.Linux.Resources = &runtimev1.LinuxContainerResources{}
+	}
+	if cpuLimited {
+		config.Linux.Resources.CpuPeriod = cpuQuotaPeriod
+		config.Linux.Resources.CpuQuota = milliCPUToQuota(podMilliCPU)
+	} else {
+		config.Linux.Resources.CpuPeriod = 0
+		config.Linux.Resources.CpuQuota = 0
+	}
+	if memoryLimited {
+		config.Linux.Resources.MemoryLimitInBytes = podMemoryBytes
+	} else {
+		config.Linux.Resources.MemoryLimitInBytes = 0
+	}
+
+	return nil
+}
+
+// getCheckpointContainerResources 从容器检查点镜像读取容器的资源信息
+func (r *Restore) getCheckpointContainerResources(
+	ctx context.Context,
+	img images.Image,
+) (checkpointContainerResources, error) {
+	imgIndex, err := r.getImageIndex(ctx, img.Target)
+	if err != nil {
+		return checkpointContainerResources{}, fmt.Errorf("get image index error: %w", err)
+	}
+
+	info := checkpointContainerResources{}
+	for _, m := range imgIndex.Manifests {
+		switch m.MediaType {
+		case images.MediaTypeContainerd1Checkpoint:
+			size, err := getCRIUPagesSize(ctx, r.contentStore, m)
+			if err != nil {
+				return info, fmt.Errorf("get dumped memory size error: %w", err)
+			}
+			info.DumpedMemoryBytes += size
+		case checkpointimage.MediaTypeContainerSpec:
+			spec, err := r.getContainerSpec(ctx, m)
+			if err != nil {
+				return info, fmt.Errorf("get container spec error: %w", err)
+			}
+			info.Name = spec.Annotations[containerAnnoContainerName]
+			if spec.Linux != nil && spec.Linux.Resources != nil {
+				res := spec.Linux.Resources
+				if res.CPU != nil && res.CPU.Quota != nil && *res.CPU.Quota > 0 &&
+					res.CPU.Period != nil && *res.CPU.Period > 0 {
+					info.MilliCPU = *res.CPU.Quota * 1000 / int64(*res.CPU.Period)
+				}
+				if res.Memory != nil && res.Memory.Limit != nil && *res.Memory.Limit > 0 {
+					info.MemoryBytes = *res.Memory.Limit
+				}
+			}
+		}
+	}
+	if info.Name == "" {
+		return info, fmt.Errorf("container name annotation %q not found", containerAnnoContainerName)
+	}
+
+	return info, nil
+}
+
+// criuPagesSizeGetter 可以直接获取层中 CRIU 内存页镜像总大小的 content.Provider ，如仅保留元数据的 checkpointimage.MemoryStore
+type criuPagesSizeGetter interface {
+	CRIUPagesSize(desc ociimg.Descriptor) (int64, bool)
+}
+
+// getCRIUPagesSize 获取 CRIU 转储内容中内存页镜像 pages-*.img 的总大小
+//
+// CRIU 转储内容是 CRIU 镜像目录的 tar ，只读取 tar 头，不读取文件内容
+func getCRIUPagesSize(ctx context.Context, provider content.Provider, desc ociimg.Descriptor) (int64, error) {
+	if getter, ok := provider.(criuPagesSizeGetter); ok {
+		if size, ok := getter.CRIUPagesSize(desc); ok {
+			return size, nil
+		}
+	}
+
+	ra, err := provider.ReaderAt(ctx, desc)
+	if err != nil {
+		return 0, fmt.Errorf("get reader for %q error: %w", desc.Digest, err)
+	}
+	defer func() { _ = ra.Close() }()
+	return checkpointimage.SumCRIUPagesSize(tar.NewReader(io.NewSectionReader(ra, 0, ra.Size())))
+}
+
+// applyContainerResources 将资源限制覆盖应用到容器配置
+func applyContainerResources(spec *ociruntime.Spec, res common.ContainerResources) []SpecRewriteRecord {
+	if res.MilliCPU <= 0 && res.MemoryBytes <= 0 {
+		return nil
+	}
+	if spec.Linux == nil {
+		spec.Linux = &ociruntime.Linux{}
+	}
+	if spec.Linux.Resources == nil {
+		spec.Linux.Resources = &ociruntime.LinuxResources{}
+	}
+	resources := spec.Linux.Resources
+
+	var records []SpecRewriteRecord
+	if res.MilliCPU > 0 {
+		if resources.CPU == nil {
+			resources.CPU = &ociruntime.LinuxCPU{}
+		}
+		oldQuota := ""
+		if resources.CPU.Quota != nil {
+			oldQuota = fmt.Sprint(*resources.CPU.Quota)
+		}
+		quota := milliCPUToQuota(res.MilliCPU)
+		period := uint64(cpuQuotaPeriod)
+		resources.CPU.Quota = &quota
+		resources.CPU.Period = &period
+		records = append(records, SpecRewriteRecord{
+			Field: "linux.resources.cpu.quota",
+			Rule:  "resources",
+			Old:   oldQuota,
+			New:   fmt.Sprint(quota),
+		})
+	}
+	if res.MemoryBytes > 0 {
+		if resources.Memory == nil {
+			resources.Memory = &ociruntime.LinuxMemory{}
+		}
+		oldLimit := ""
+		if resources.Memory.Limit != nil {
+			oldLimit = fmt.Sprint(*resources.Memory.Limit)
+		}
+		limit := res.MemoryBytes
+		resources.Memory.Limit = &limit
+		records = append(records, SpecRewriteRecord{
+			Field: "linux.resources.memory.limit",
+			Rule:  "resources",
+			Old:   oldLimit,
+			New:   fmt.Sprint(limit),
+		})
+	}
+
+	return records
+}
+
+// milliCPUToQuota 将 millicore 转换为 CFS 配额，与 kubelet 的计算方式一致
+func milliCPUToQuota(milliCPU int64) int64 {
+	quota := milliCPU * cpuQuotaPeriod / 1000
+	if quota < minCPUQuota {
+		quota = minCPUQuota
+	}
+	return quota
+}
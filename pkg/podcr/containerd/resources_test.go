@@ -0,0 +1,134 @@
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/opencontainers/go-digest"
+	ociimg "github.com/opencontainers/image-spec/specs-go/v1"
+	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+	"github.com/yhlooo/podmig/pkg/podcr/containerd/fake"
+)
+
+// TestGetCRIUPagesSize 测试仅以内存页镜像大小作为转储的内存大小
+func TestGetCRIUPagesSize(t *testing.T) {
+	ctx := context.Background()
+	b := fake.NewBackend()
+
+	memory := bytes.Repeat([]byte{0xaa}, 3*4096)
+	criuImage, err := fake.NewCRIUImage(memory)
+	if err != nil {
+		t.Fatalf("create criu image error: %v", err)
+	}
+	desc := ociimg.Descriptor{
+		MediaType: images.MediaTypeContainerd1Checkpoint,
+		Digest:    digest.FromBytes(criuImage),
+		Size:      int64(len(criuImage)),
+	}
+	if err := content.WriteBlob(ctx, b, desc.Digest.String(), bytes.NewReader(criuImage), desc); err != nil {
+		t.Fatalf("write blob error: %v", err)
+	}
+
+	size, err := getCRIUPagesSize(ctx, b, desc)
+	if err != nil {
+		t.Fatalf("get pages size error: %v", err)
+	}
+	if size != int64(len(memory)) {
+		t.Errorf("expected pages size %d, got %d (blob size %d)", len(memory), size, desc.Size)
+	}
+}
+
+// TestPrepareResourcesSandbox 测试根据各容器资源限制调整沙盒资源配置，任意容器不限制 CPU 时同时清除 CFS 配额和周期
+func TestPrepareResourcesSandbox(t *testing.T) {
+	cases := []struct {
+		name string
+		// 检查点中 sidecar 容器的 CPU 限制（ millicore ），为 0 表示不限制
+		sidecarMilliCPU int64
+		expected        *runtimev1.LinuxContainerResources
+	}{
+		{
+			name:            "Limited",
+			sidecarMilliCPU: 250,
+			expected: &runtimev1.LinuxContainerResources{
+				CpuPeriod:          cpuQuotaPeriod,
+				CpuQuota:           75000,
+				MemoryLimitInBytes: 3 << 20,
+			},
+		},
+		{
+			name: "RemoveCPULimit",
+			expected: &runtimev1.LinuxContainerResources{
+				MemoryLimitInBytes: 3 << 20,
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := context.Background()
+			b := fake.NewBackend()
+			r := &Restore{
+				opts: common.RestoreOptions{
+					Resources: map[string]common.ContainerResources{
+						testContainerName: {MilliCPU: 500, MemoryBytes: 2 << 20},
+					},
+				},
+				imageService: b,
+				contentStore: b,
+				srcSandboxInfo: &SandboxInfo{
+					Config: &runtimev1.PodSandboxConfig{
+						Linux: &runtimev1.LinuxPodSandboxConfig{
+							Resources: &runtimev1.LinuxContainerResources{
+								CpuPeriod:          cpuQuotaPeriod,
+								CpuQuota:           100000,
+								MemoryLimitInBytes: 2 << 20,
+							},
+						},
+					},
+				},
+			}
+			for i, container := range []struct {
+				name     string
+				milliCPU int64
+			}{
+				{name: testContainerName, milliCPU: 750},
+				{name: "sidecar", milliCPU: c.sidecarMilliCPU},
+			} {
+				spec := fixtureContainerSpec()
+				spec.Annotations[containerAnnoContainerName] = container.name
+				memory := int64(1 << 20)
+				spec.Linux.Resources = &ociruntime.LinuxResources{Memory: &ociruntime.LinuxMemory{Limit: &memory}}
+				if container.milliCPU > 0 {
+					quota := milliCPUToQuota(container.milliCPU)
+					period := uint64(cpuQuotaPeriod)
+					spec.Linux.Resources.CPU = &ociruntime.LinuxCPU{Quota: &quota, Period: &period}
+				}
+				id := fmt.Sprintf("container-%d", i)
+				b.AddContainer(id, spec, []byte("heap"))
+				img, err := b.Checkpoint(ctx, id, "checkpoint:"+container.name)
+				if err != nil {
+					t.Fatalf("checkpoint container %q error: %v", container.name, err)
+				}
+				r.containerTargets = append(r.containerTargets, containerRestoreTarget{
+					Name:       container.name,
+					Checkpoint: &img,
+				})
+			}
+
+			if err := r.prepareResources(ctx); err != nil {
+				t.Fatalf("prepare resources error: %v", err)
+			}
+			got := r.srcSandboxInfo.Config.Linux.Resources
+			if !reflect.DeepEqual(got, c.expected) {
+				t.Errorf("expected sandbox resources %+v, got %+v", c.expected, got)
+			}
+		})
+	}
+}
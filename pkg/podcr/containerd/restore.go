@@ -4,42 +4,52 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
-	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/containerd/containerd"
-	"github.com/containerd/containerd/cio"
-	"github.com/containerd/containerd/cmd/ctr/commands/tasks"
-	"github.com/containerd/containerd/content"
 	"github.com/containerd/containerd/images"
-	"github.com/containerd/containerd/protobuf"
-	"github.com/containerd/containerd/protobuf/proto"
 	_ "github.com/containerd/containerd/runtime"
-	"github.com/containerd/typeurl/v2"
 	"github.com/go-logr/logr"
-	"github.com/opencontainers/go-digest"
 	ociimg "github.com/opencontainers/image-spec/specs-go/v1"
 	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
-	"google.golang.org/protobuf/types/known/anypb"
+	"go.opentelemetry.io/otel/trace"
 	criapis "k8s.io/cri-api/pkg/apis"
 	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
 
 	"github.com/yhlooo/podmig/pkg/podcr/common"
+	"github.com/yhlooo/podmig/pkg/podcr/containerd/checkpointimage"
+	"github.com/yhlooo/podmig/pkg/podcr/events"
+	"github.com/yhlooo/podmig/pkg/podcr/metrics"
+	"github.com/yhlooo/podmig/pkg/podcr/tracing"
 	"github.com/yhlooo/podmig/pkg/utils/randutil"
 	"github.com/yhlooo/podmig/pkg/utils/tarutil"
 )
 
 // Restore 从 tr 读取 Pod 检查点并还原 Pod
 func (h *Manager) Restore(ctx context.Context, tr *tar.Reader, opts common.RestoreOptions) error {
+	tmpdir, err := os.MkdirTemp(h.tmpdir, "pod-restore-")
+	if err != nil {
+		return fmt.Errorf("make temp dir error: %w", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpdir)
+	}()
+
 	return (&Restore{
 		opts:             opts,
+		tmpdir:           tmpdir,
 		criClient:        h.criClient,
-		containerdClient: h.containerdClient,
+		criImageClient:   h.criImageClient,
+		imageService:     h.imageService,
+		contentStore:     h.contentStore,
+		containerService: h.containerService,
+		kubeletPodsDir:   h.kubeletPodsDir(),
+		cgroupV2:         h.cgroupV2,
 		tr:               tr,
 	}).Do(ctx)
 }
@@ -47,39 +57,133 @@ func (h *Manager) Restore(ctx context.Context, tr *tar.Reader, opts common.Resto
 // Restore 从 Pod 检查点还原
 type Restore struct {
 	opts             common.RestoreOptions
+	tmpdir           string
 	criClient        criapis.RuntimeService
-	containerdClient *containerd.Client
+	criImageClient   criapis.ImageManagerService
+	imageService     ImageService
+	contentStore     ContentStore
+	containerService ContainerService
+	kubeletPodsDir   string
+	cgroupV2         bool
 	tr               *tar.Reader
 
 	srcSandboxUID                string
+	srcSandboxName               string
+	srcSandboxNamespace          string
+	srcHostname                  string
+	srcLogDirectory              string
 	srcSandboxInfo               *SandboxInfo
+	srcCheckpointInfo            *CheckpointInfo
 	srcContainerCheckpointImages []images.Image
+	containerTargets             []containerRestoreTarget
+
+	sandboxInfo    *SandboxInfo
+	cgroupTarget   CgroupTarget
+	criuConfigPath string
+	// 还原时挂载了 tmpfs 的内存介质卷目录
+	mountedMemoryVolumes []string
 
-	sandboxInfo *SandboxInfo
+	// 不为 nil 时仅计算还原计划
+	plan *common.RestorePlan
 }
 
 // Do 执行从 Pod 检查点还原操作
-func (r *Restore) Do(ctx context.Context) error {
+func (r *Restore) Do(ctx context.Context) (err error) {
+	start := time.Now()
+	defer func() { metrics.ObserveOperation(metrics.OperationRestore, start, err) }()
+
 	logger := logr.FromContextOrDiscard(ctx)
+	defer func() {
+		if err != nil {
+			r.unmountMemoryVolumeDirs(ctx)
+		}
+	}()
+
+	// 调用方没有 trace 时，导入检查点后以检查点中的 trace 上下文作为父 span ，使检查点和还原属于同一个 trace
+	var span trace.Span
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		ctx, span = tracing.Start(ctx, metrics.OperationRestore)
+		defer func() { tracing.End(span, err) }()
+	}
 
 	// 导入检查点 tar
 	logger.Info("importing checkpoint from tar")
-	if err := r.importTar(ctx); err != nil {
-		return fmt.Errorf("import checkpoint from tar error: %w", err)
+	importErr := runPhase(ctx, metrics.OperationRestore, phaseImport, r.importTar)
+	if span == nil {
+		if r.srcCheckpointInfo != nil {
+			ctx = tracing.Extract(ctx, r.srcCheckpointInfo.TraceContext)
+		}
+		ctx, span = tracing.Start(ctx, metrics.OperationRestore, trace.WithTimestamp(start))
+		defer func() { tracing.End(span, err) }()
+		_, importSpan := tracing.Start(ctx, phaseImport, trace.WithTimestamp(start))
+		tracing.End(importSpan, importErr)
+	}
+	if importErr != nil {
+		return fmt.Errorf("import checkpoint from tar error: %w", importErr)
+	}
+	r.reportVolumes(ctx)
+	if err := r.selectContainers(ctx); err != nil {
+		return fmt.Errorf("select containers error: %w", err)
+	}
+
+	if r.plan == nil && !r.opts.SkipPreflight && r.srcCheckpointInfo == nil {
+		logger.Info(fmt.Sprintf(
+			"no node fingerprint in checkpoint (%q not found), preflight skipped", checkpointInfoJSONName,
+		))
+	}
+
+	// 校验并应用资源限制覆盖
+	if err := runPhase(ctx, metrics.OperationRestore, phasePrepareResources, r.prepareResources); err != nil {
+		return fmt.Errorf("prepare resources error: %w", err)
+	}
+
+	// 准备网络
+	if err := runPhase(ctx, metrics.OperationRestore, phasePrepareNetwork, r.prepareNetwork); err != nil {
+		return fmt.Errorf("prepare network error: %w", err)
 	}
 
 	// 还原 Pod 沙盒
-	if err := r.restorePodSandbox(ctx); err != nil {
+	if err := runPhase(ctx, metrics.OperationRestore, phaseRestoreSandbox, r.restorePodSandbox); err != nil {
 		return fmt.Errorf("restore pod sandbox error: %w", err)
 	}
+	events.Record(ctx, events.Event{Type: events.TypeSandboxRestored, ID: r.sandboxInfo.ID})
+	if err := runPhase(ctx, metrics.OperationRestore, phaseCheckNetwork, r.checkNetwork); err != nil {
+		return fmt.Errorf("check pod sandbox network error: %w", err)
+	}
+
+	// 等待 kubelet 重新投射卷内容
+	if err := runPhase(ctx, metrics.OperationRestore, phaseWaitVolumes, r.waitVolumes); err != nil {
+		return fmt.Errorf("wait for volumes error: %w", err)
+	}
+
+	// 还原沙盒共享内存
+	if err := runPhase(ctx, metrics.OperationRestore, phaseRestoreSandboxShm, r.restoreSandboxShm); err != nil {
+		return fmt.Errorf("restore sandbox shm error: %w", err)
+	}
 
-	// 按照创建检查点的逆序恢复容器
-	for i := len(r.srcContainerCheckpointImages) - 1; i >= 0; i-- {
-		cID, err := r.restoreContainer(ctx, r.srcContainerCheckpointImages[i])
+	// 按容器创建顺序还原或重新创建容器
+	for _, target := range r.containerTargets {
+		cName := target.Name
+		start := time.Now()
+		cctx, end := startPhase(ctx, metrics.OperationRestore, phaseRestoreContainer, cName)
+		var cID string
+		var err error
+		if target.Checkpoint != nil {
+			cID, err = r.restoreContainer(cctx, *target.Checkpoint)
+		} else {
+			cID, err = r.recreateContainer(cctx, target.Info)
+		}
+		end(err)
 		if err != nil {
-			return fmt.Errorf("restore container error: %w", err)
+			return fmt.Errorf("restore container %q error: %w", cName, err)
 		}
-		logger.Info(fmt.Sprintf("restored container: %s", cID))
+		logger.Info(fmt.Sprintf("restored container %q: %s", cName, cID))
+		events.Record(ctx, events.Event{
+			Type:       events.TypeContainerRestored,
+			Container:  cName,
+			ID:         cID,
+			DurationMS: time.Since(start).Milliseconds(),
+		})
 	}
 
 	return nil
@@ -101,24 +205,51 @@ func (r *Restore) importTar(ctx context.Context) error {
 		switch {
 		case strings.HasPrefix(hdr.Name, containerCheckpointTarNamePrefix):
 			logger.Info(fmt.Sprintf("importing checkpoint image from file %q ...", hdr.Name))
-			imgs, err := r.containerdClient.Import(ctx, r.tr)
+			start := time.Now()
+			imgs, err := r.imageService.Import(ctx, r.tr)
 			if err != nil {
 				return fmt.Errorf("import checkpoint image from file %q error: %w", hdr.Name, err)
 			}
+			if r.plan == nil {
+				metrics.ObserveImageTransfer(metrics.DirectionImport, start, hdr.Size)
+			}
 			for _, imgInfo := range imgs {
 				logger.Info(fmt.Sprintf("imported image: %s", imgInfo.Name))
 			}
 			r.srcContainerCheckpointImages = append(r.srcContainerCheckpointImages, imgs...)
+		case strings.HasPrefix(hdr.Name, sandboxShmTarNamePrefix):
+			if r.plan != nil {
+				continue
+			}
+			// 沙盒共享内存内容先暂存，待沙盒创建后写入
+			if err := tarutil.Extract(r.tr, hdr, filepath.Join(r.tmpdir, hdr.Name)); err != nil {
+				return fmt.Errorf("extract file %q from tar error: %w", hdr.Name, err)
+			}
+		case hdr.Name == checkpointInfoJSONName:
+			logger.Info(fmt.Sprintf("importing checkpoint info from file %q ...", hdr.Name))
+			r.srcCheckpointInfo = &CheckpointInfo{}
+			if err := tarutil.ReadJSON(r.tr, r.srcCheckpointInfo); err != nil {
+				return fmt.Errorf("read checkpoint info from file %q error: %w", hdr.Name, err)
+			}
+			if r.srcCheckpointInfo.FormatVersion > currentArchiveFormatVersion {
+				return fmt.Errorf(
+					"unsupported checkpoint format version %d, the latest supported version is %d",
+					r.srcCheckpointInfo.FormatVersion, currentArchiveFormatVersion,
+				)
+			}
+			// 检查点信息位于容器检查点和 kubelet Pod 目录之前，在导入镜像、写入文件前检查与本节点的兼容性
+			if r.plan == nil && !r.opts.SkipPreflight {
+				if err := runPhase(ctx, metrics.OperationRestore, phasePreflight, r.preflight); err != nil {
+					return fmt.Errorf("preflight error: %w", err)
+				}
+			}
 		case hdr.Name == sandboxInfoJSONName:
 			logger.Info(fmt.Sprintf("importing sandbox info from file %q ...", hdr.Name))
 			r.srcSandboxInfo = &SandboxInfo{}
 			if err := tarutil.ReadJSON(r.tr, r.srcSandboxInfo); err != nil {
 				return fmt.Errorf("read sandbox config from file %q error: %w", hdr.Name, err)
 			}
-			r.srcSandboxUID = r.srcSandboxInfo.Config.Metadata.Uid
-			if r.opts.PodUID == "" {
-				r.opts.PodUID = r.srcSandboxUID
-			}
+			r.completeRestoreOptions()  // 以检查点中的值补全还原选项
 			r.convertPodSandboxConfig() // 转换 Pod 沙盒配置
 		case strings.HasPrefix(hdr.Name, kubeletPodDirTarNamePrefix):
 			if r.srcSandboxUID == "" {
@@ -127,15 +258,32 @@ func (r *Restore) importTar(ctx context.Context) error {
 
 			// kubelet Pod 数据目录
 			path := strings.TrimPrefix(hdr.Name, kubeletPodDirTarNamePrefix)
-			path = strings.ReplaceAll(path, r.srcSandboxUID, r.opts.PodUID)
-			logger.Info(fmt.Sprintf("importing kubelet pod data file %q ...", path))
+			volume := r.findVolumeByPath(path)
+			isVolumeRoot := volume != nil &&
+				filepath.Join(r.srcCheckpointInfo.KubeletPodDir, volume.Path) == filepath.Clean(path)
+			if volume != nil && r.shouldRematerializeVolume(*volume) && !isVolumeRoot {
+				// 等待 kubelet 重新投射的卷仅还原卷目录本身
+				continue
+			}
+			path = r.targetKubeletPodPath(path)
 			info := hdr.FileInfo()
+			if r.plan != nil {
+				r.planFile(path, info)
+				continue
+			}
+			logger.Info(fmt.Sprintf("importing kubelet pod data file %q ...", path))
 
 			// 目录
 			if info.IsDir() {
 				if err := os.MkdirAll(path, info.Mode()); err != nil {
 					return fmt.Errorf("mkdir %q error: %w", path, err)
 				}
+				if isVolumeRoot && volume.Medium == volumeMediumMemory {
+					// 内存介质的卷需要先挂载 tmpfs 再写入内容
+					if err := r.prepareMemoryVolumeDir(path, volume.SizeBytes); err != nil {
+						return fmt.Errorf("prepare memory volume %q error: %w", volume.Name, err)
+					}
+				}
 				continue
 			}
 
@@ -148,11 +296,20 @@ func (r *Restore) importTar(ctx context.Context) error {
 			}
 
 			// 普通文件
+			var src io.Reader = r.tr
+			if filepath.Base(path) == kubeletPodHostsFileName && r.opts.Hostname != r.srcHostname {
+				// hosts 文件中包含主机名，需要替换
+				raw, err := io.ReadAll(r.tr)
+				if err != nil {
+					return fmt.Errorf("read file %q from tar error: %w", path, err)
+				}
+				src = bytes.NewReader(replaceHostsFileHostname(raw, r.srcHostname, r.opts.Hostname))
+			}
 			f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
 			if err != nil {
 				return fmt.Errorf("open file %q error: %w", path, err)
 			}
-			if _, err := io.Copy(f, r.tr); err != nil {
+			if _, err := io.Copy(f, src); err != nil {
 				_ = f.Close()
 				return fmt.Errorf("copy file %q from tar error: %w", path, err)
 			}
@@ -160,12 +317,23 @@ func (r *Restore) importTar(ctx context.Context) error {
 		}
 	}
 
+	if r.srcSandboxInfo == nil {
+		return fmt.Errorf("sandbox info %q not found in checkpoint", sandboxInfoJSONName)
+	}
+	formatVersion := archiveFormatVersionLegacy
+	if r.srcCheckpointInfo != nil {
+		formatVersion = r.srcCheckpointInfo.FormatVersion
+	}
+	logger.Info(fmt.Sprintf("checkpoint format version: %d", formatVersion))
+
 	return nil
 }
 
 // restorePodSandbox 还原 Pod 沙盒
 func (r *Restore) restorePodSandbox(ctx context.Context) error {
 	logger := logr.FromContextOrDiscard(ctx)
+	start := time.Now()
+	defer func() { metrics.SandboxRestoreDuration.Observe(time.Since(start).Seconds()) }()
 
 	sandboxID, err := r.criClient.RunPodSandbox(ctx, r.srcSandboxInfo.Config, "")
 	if err != nil {
@@ -202,6 +370,17 @@ func (r *Restore) restorePodSandbox(ctx context.Context) error {
 		return fmt.Errorf("unmarshal sandbox info from json error: %w", err)
 	}
 	r.sandboxInfo.ID = sandboxID
+	r.sandboxInfo.IPs = getPodSandboxIPs(resp.Status)
+
+	// 确定容器 cgroup 位置
+	r.cgroupTarget, err = getCgroupTarget(r.sandboxInfo, r.cgroupV2)
+	if err != nil {
+		return fmt.Errorf("get cgroup target error: %w", err)
+	}
+	logger.Info(fmt.Sprintf(
+		"cgroup parent: %s (driver: %s, v2: %t)",
+		r.cgroupTarget.Parent, r.cgroupTarget.Driver, r.cgroupTarget.V2,
+	))
 
 	return nil
 }
@@ -209,45 +388,52 @@ func (r *Restore) restorePodSandbox(ctx context.Context) error {
 // restoreContainer 还原容器
 func (r *Restore) restoreContainer(ctx context.Context, checkpoint images.Image) (string, error) {
 	logger := logr.FromContextOrDiscard(ctx)
-
-	// 基于 Pod 沙盒修改容器检查点镜像
-	restoreCheckpoint, err := r.convertContainerCheckpointImage(ctx, checkpoint)
-	if err != nil {
-		return "", fmt.Errorf("convert container checkpoint image %q error: %w", checkpoint.Name, err)
-	}
+	start := time.Now()
+	defer func() { metrics.ContainerRestoreDuration.Observe(time.Since(start).Seconds()) }()
 
 	// 生成还原容器 ID
 	// TODO: 暂不清楚 kubelet 如何生成容器 ID ，也不知道是否有其它逻辑依赖该 ID 的生成逻辑，先随机生成
 	cID := randutil.NewRand().HexN(64)
 
-	// 还原容器
-	restoreCheckpointImage := containerd.NewImage(r.containerdClient, restoreCheckpoint)
-	logger.Info(fmt.Sprintf("restoring container from checkpoint image: %s", restoreCheckpoint.Name))
-	container, err := r.containerdClient.Restore(
-		ctx, cID, restoreCheckpointImage,
-		containerd.WithRestoreImage,
-		containerd.WithRestoreSpec,
-		containerd.WithRestoreRuntime,
-		containerd.WithRestoreRW,
-	)
+	// 基于 Pod 沙盒修改容器检查点镜像
+	restoreCheckpoint, err := r.convertContainerCheckpointImage(ctx, checkpoint, cID)
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("convert container checkpoint image %q error: %w", checkpoint.Name, err)
 	}
 
-	// 还原进程
-	logger.Info(fmt.Sprintf("restoring task in container from checkpoint image: %s", restoreCheckpoint.Name))
-	task, err := tasks.NewTask(
-		ctx, r.containerdClient, container, "", nil, false, "",
-		[]cio.Opt{},
-		containerd.WithTaskCheckpoint(restoreCheckpointImage),
-	)
-	if err != nil {
-		return container.ID(), fmt.Errorf("restore task in container error: %w", err)
+	// 还原容器和进程
+	logger.Info(fmt.Sprintf("restoring container from checkpoint image: %s", restoreCheckpoint.Name))
+	if err := r.containerService.Restore(ctx, cID, restoreCheckpoint); err != nil {
+		return cID, err
 	}
-	if err := task.Start(ctx); err != nil {
-		return container.ID(), fmt.Errorf("start task in container error: %w", err)
+	return cID, nil
+}
+
+// completeRestoreOptions 记录检查点中 Pod 的原始标识，并以其补全还原选项中未指定的字段
+func (r *Restore) completeRestoreOptions() {
+	metadata := r.srcSandboxInfo.Config.GetMetadata()
+	r.srcSandboxUID = metadata.GetUid()
+	r.srcSandboxName = metadata.GetName()
+	r.srcSandboxNamespace = metadata.GetNamespace()
+	r.srcHostname = r.srcSandboxInfo.Config.GetHostname()
+	r.srcLogDirectory = r.srcSandboxInfo.Config.GetLogDirectory()
+
+	if r.opts.PodUID == "" {
+		r.opts.PodUID = r.srcSandboxUID
+	}
+	if r.opts.PodName == "" {
+		r.opts.PodName = r.srcSandboxName
+	}
+	if r.opts.PodNamespace == "" {
+		r.opts.PodNamespace = r.srcSandboxNamespace
+	}
+	if r.opts.Hostname == "" {
+		r.opts.Hostname = r.srcHostname
+		// 未显式指定 hostname 时 kubernetes 使用 Pod 名作为主机名，此时跟随新 Pod 名
+		if r.srcHostname == r.srcSandboxName {
+			r.opts.Hostname = r.opts.PodName
+		}
 	}
-	return container.ID(), nil
 }
 
 // convertPodSandboxConfig 转换 Pod 沙盒配置
@@ -256,14 +442,59 @@ func (r *Restore) convertPodSandboxConfig() {
 		return
 	}
 
-	// 替换 Pod UID
+	// 替换 Pod 标识
 	config := r.srcSandboxInfo.Config
+	if config.Metadata == nil {
+		config.Metadata = &runtimev1.PodSandboxMetadata{}
+	}
 	config.Metadata.Uid = r.opts.PodUID
-	config.LogDirectory = strings.ReplaceAll(config.LogDirectory, r.srcSandboxUID, r.opts.PodUID)
+	config.Metadata.Name = r.opts.PodName
+	config.Metadata.Namespace = r.opts.PodNamespace
+	config.Hostname = r.opts.Hostname
+	config.LogDirectory = r.convertPodLogDirectory(config.LogDirectory)
+	if config.Linux != nil && config.Linux.CgroupParent != "" {
+		// Pod 级别 cgroup 名中包含 Pod UID ， systemd 驱动下连字符被替换为下划线
+		config.Linux.CgroupParent = strings.ReplaceAll(
+			strings.ReplaceAll(config.Linux.CgroupParent, r.srcSandboxUID, r.opts.PodUID),
+			strings.ReplaceAll(r.srcSandboxUID, "-", "_"), strings.ReplaceAll(r.opts.PodUID, "-", "_"),
+		)
+	}
+
+	// 标签
 	if config.Labels == nil {
 		config.Labels = make(map[string]string)
 	}
+	for k, v := range r.opts.Labels {
+		config.Labels[k] = v
+	}
 	config.Labels[labelPodUID] = r.opts.PodUID
+	config.Labels[labelPodName] = r.opts.PodName
+	config.Labels[labelPodNamespace] = r.opts.PodNamespace
+
+	// 注解
+	if len(r.opts.Annotations) > 0 && config.Annotations == nil {
+		config.Annotations = make(map[string]string)
+	}
+	for k, v := range r.opts.Annotations {
+		config.Annotations[k] = v
+	}
+}
+
+// convertPodLogDirectory 转换 Pod 日志目录
+//
+// kubelet 使用的 Pod 日志目录形如 /var/log/pods/<namespace>_<name>_<uid>
+func (r *Restore) convertPodLogDirectory(logDir string) string {
+	if logDir == "" {
+		return ""
+	}
+	srcBase := fmt.Sprintf("%s_%s_%s", r.srcSandboxNamespace, r.srcSandboxName, r.srcSandboxUID)
+	if filepath.Base(logDir) == srcBase {
+		return filepath.Join(
+			filepath.Dir(logDir),
+			fmt.Sprintf("%s_%s_%s", r.opts.PodNamespace, r.opts.PodName, r.opts.PodUID),
+		)
+	}
+	return strings.ReplaceAll(logDir, r.srcSandboxUID, r.opts.PodUID)
 }
 
 // convertContainerCheckpointImage 转换容器检查点镜像
@@ -272,6 +503,7 @@ func (r *Restore) convertPodSandboxConfig() {
 func (r *Restore) convertContainerCheckpointImage(
 	ctx context.Context,
 	checkpointImage images.Image,
+	containerID string,
 ) (images.Image, error) {
 	logger := logr.FromContextOrDiscard(ctx)
 
@@ -287,7 +519,7 @@ func (r *Restore) convertContainerCheckpointImage(
 	var containerSpecI int
 	var containerSpec *ociruntime.Spec
 	for i, m := range imgIndex.Manifests {
-		if m.MediaType != "application/vnd.containerd.container.checkpoint.config.v1+proto" {
+		if m.MediaType != checkpointimage.MediaTypeContainerSpec {
 			continue
 		}
 		containerSpec, err = r.getContainerSpec(ctx, m)
@@ -303,7 +535,9 @@ func (r *Restore) convertContainerCheckpointImage(
 	}
 
 	// 转换容器配置
-	r.convertContainerSpec(ctx, containerSpec)
+	for _, record := range r.convertContainerSpec(ctx, containerSpec, containerID) {
+		logger.V(1).Info(fmt.Sprintf("rewrote container spec %s", record))
+	}
 
 	// 写入新容器配置
 	desc, err := r.writeContainerSpec(ctx, containerSpec)
@@ -324,143 +558,179 @@ func (r *Restore) convertContainerCheckpointImage(
 	// 创建转换后的镜像
 	newImage := "restore-" + imgName
 	logger.Info(fmt.Sprintf("creating converted checkpoint image: %s -> %s", desc.Digest, newImage))
-	_ = r.containerdClient.ImageService().Delete(ctx, newImage) // 先删除之前残留的
-	return r.containerdClient.ImageService().Create(ctx, images.Image{
+	_ = r.imageService.Delete(ctx, newImage) // 先删除之前残留的
+	return r.imageService.Create(ctx, images.Image{
 		Name:   newImage,
 		Target: desc,
 	})
 }
 
-// convertContainerSpec 转换容器配置
-func (r *Restore) convertContainerSpec(ctx context.Context, spec *ociruntime.Spec) {
-	// TODO: ...
+// convertContainerSpec 转换容器配置，返回所有改写记录
+func (r *Restore) convertContainerSpec(
+	_ context.Context,
+	spec *ociruntime.Spec,
+	containerID string,
+) []SpecRewriteRecord {
+	records := NewSpecRewriter(r.specRewriteRules()...).Rewrite(spec)
+	records = append(records, rewriteShmSize(spec, r.sandboxInfo.RuntimeSpec)...)
+	records = append(records, relocateCgroup(spec, r.cgroupTarget, containerID)...)
+	if res, ok := r.opts.Resources[spec.Annotations[containerAnnoContainerName]]; ok {
+		records = append(records, applyContainerResources(spec, res)...)
+	}
+	return append(records, r.applyCRIUConfig(spec)...)
+}
 
-	if spec.Annotations[containerAnnoSandboxID] == r.srcSandboxInfo.ID {
-		spec.Annotations[containerAnnoSandboxID] = r.sandboxInfo.ID
-	}
-	if spec.Annotations[containerAnnoSandboxUID] == r.srcSandboxUID {
-		spec.Annotations[containerAnnoSandboxUID] = r.opts.PodUID
-	}
-	for i, mount := range spec.Mounts {
-		switch mount.Destination {
-		case "/etc/hostname", "/etc/resolv.conf", "/dev/shm":
-			spec.Mounts[i].Source = strings.ReplaceAll(mount.Source, r.srcSandboxInfo.ID, r.sandboxInfo.ID)
-		case "/etc/hosts", "/dev/termination-log", "/var/run/secrets/kubernetes.io/serviceaccount":
-			spec.Mounts[i].Source = strings.ReplaceAll(mount.Source, r.srcSandboxUID, r.opts.PodUID)
-		}
-	}
-	if spec.Linux != nil {
-		// 替换 /proc/xxx 路径中的 sandbox pid
-		srcProcPath := fmt.Sprintf("/proc/%d", r.srcSandboxInfo.Pid)
-		dstProcPath := fmt.Sprintf("/proc/%d", r.sandboxInfo.Pid)
-		for i, ns := range spec.Linux.Namespaces {
-			if !strings.HasPrefix(ns.Path, srcProcPath) {
-				continue
-			}
-			spec.Linux.Namespaces[i].Path = strings.ReplaceAll(
-				ns.Path,
-				srcProcPath,
-				dstProcPath,
-			)
+// specRewriteRules 获取容器配置改写规则
+//
+// 规则按顺序应用，较长的、包含其它规则旧值的规则需要排在前面
+func (r *Restore) specRewriteRules() []SpecRewriteRule {
+	rules := []SpecRewriteRule{
+		{
+			Name: "sandbox-log-directory",
+			Old:  r.srcLogDirectory,
+			New:  r.srcSandboxInfo.Config.GetLogDirectory(),
+		},
+		{
+			Name: "sandbox-id",
+			Old:  r.srcSandboxInfo.ID,
+			New:  r.sandboxInfo.ID,
+		},
+		{
+			Name: "kubelet-pod-dir",
+			Old:  r.srcKubeletPodDir(),
+			New:  r.targetKubeletPodPath(r.srcKubeletPodDir()),
+		},
+		{
+			Name: "pod-uid",
+			Old:  r.srcSandboxUID,
+			New:  r.opts.PodUID,
+		},
+		{
+			// systemd cgroup 驱动下 slice 名中的 Pod UID 使用下划线代替连字符
+			Name: "pod-uid-systemd",
+			Old:  strings.ReplaceAll(r.srcSandboxUID, "-", "_"),
+			New:  strings.ReplaceAll(r.opts.PodUID, "-", "_"),
+		},
+		{
+			Name: "sandbox-pid",
+			Old:  fmt.Sprintf("/proc/%d/", r.srcSandboxInfo.Pid),
+			New:  r.sandboxProcDir(),
+		},
+		{
+			Name:   "pod-name",
+			Old:    r.srcSandboxName,
+			New:    r.opts.PodName,
+			Exact:  true,
+			Fields: []string{"annotations[" + containerAnnoSandboxName + "]", "process.env["},
+		},
+		{
+			Name:   "pod-namespace",
+			Old:    r.srcSandboxNamespace,
+			New:    r.opts.PodNamespace,
+			Exact:  true,
+			Fields: []string{"annotations[" + containerAnnoSandboxNamespace + "]"},
+		},
+		{
+			Name:   "hostname",
+			Old:    r.srcHostname,
+			New:    r.opts.Hostname,
+			Exact:  true,
+			Fields: []string{"hostname", "process.env[" + envHostname + "]"},
+		},
+	}
+
+	// Pod IP
+	for i, ip := range r.srcSandboxInfo.IPs {
+		if i >= len(r.sandboxInfo.IPs) {
+			break
 		}
+		rules = append(rules, SpecRewriteRule{
+			Name:       "pod-ip",
+			Old:        ip,
+			New:        r.sandboxInfo.IPs[i],
+			IPBoundary: true,
+			Fields:     []string{"process.env[", "process.args[", "annotations["},
+		})
 	}
+
+	return rules
 }
 
-// getContainerSpec 从 application/vnd.containerd.container.checkpoint.config.v1+proto 类型的 content 中读取容器配置信息
-func (r *Restore) getContainerSpec(ctx context.Context, desc ociimg.Descriptor) (*ociruntime.Spec, error) {
-	// 检查类型
-	if desc.MediaType != mediaTypeContainerSpec {
-		return nil, fmt.Errorf("unexpected media type %q, must be %q", desc.MediaType, mediaTypeContainerSpec)
+// srcKubeletPodDir 获取检查点中记录的源 kubelet Pod 目录
+//
+// 旧检查点中没有记录时使用 kubelet 默认根目录下的 Pod 目录
+func (r *Restore) srcKubeletPodDir() string {
+	if r.srcCheckpointInfo != nil && r.srcCheckpointInfo.KubeletPodDir != "" {
+		return r.srcCheckpointInfo.KubeletPodDir
 	}
-
-	// 读内容
-	raw, err := content.ReadBlob(ctx, r.containerdClient.ContentStore(), desc)
-	if err != nil {
-		return nil, err
+	if r.srcSandboxUID == "" {
+		return ""
 	}
+	return filepath.Join(defaultKubeletRootDir, kubeletPodsDirName, r.srcSandboxUID)
+}
 
-	// 反序列化
-	anyObj := &anypb.Any{}
-	if err := proto.Unmarshal(raw, anyObj); err != nil {
-		return nil, fmt.Errorf("unmarshal from proto error: %w", err)
+// targetKubeletPodPath 将源 kubelet Pod 目录中的路径转换为本节点 kubelet Pod 目录中的路径
+//
+// 源 kubelet Pod 目录之外的路径仅替换路径中的 Pod UID
+func (r *Restore) targetKubeletPodPath(path string) string {
+	if srcDir := r.srcKubeletPodDir(); srcDir != "" {
+		relPath, err := filepath.Rel(srcDir, path)
+		if err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return filepath.Join(r.kubeletPodsDir, r.opts.PodUID, relPath)
+		}
 	}
-	var spec ociruntime.Spec
-	if err := typeurl.UnmarshalTo(anyObj, &spec); err != nil {
-		return nil, fmt.Errorf("unmarsal from any error: %w", err)
+	return strings.ReplaceAll(path, r.srcSandboxUID, r.opts.PodUID)
+}
+
+// sandboxProcDir 获取还原的沙盒进程在宿主机 /proc 中的目录
+func (r *Restore) sandboxProcDir() string {
+	if r.plan != nil {
+		return "/proc/" + planSandboxPid + "/"
 	}
+	return fmt.Sprintf("/proc/%d/", r.sandboxInfo.Pid)
+}
 
-	return &spec, nil
+// getContainerSpec 从 application/vnd.containerd.container.checkpoint.config.v1+proto 类型的 content 中读取容器配置信息
+func (r *Restore) getContainerSpec(ctx context.Context, desc ociimg.Descriptor) (*ociruntime.Spec, error) {
+	return checkpointimage.ReadContainerSpec(ctx, r.contentStore, desc)
 }
 
 // writeContainerSpec 将 application/vnd.containerd.container.checkpoint.config.v1+proto 类型的容器配置信息写入 content
 func (r *Restore) writeContainerSpec(ctx context.Context, spec *ociruntime.Spec) (ociimg.Descriptor, error) {
-	// 序列化
-	anyObj, err := protobuf.MarshalAnyToProto(spec)
-	if err != nil {
-		return ociimg.Descriptor{}, fmt.Errorf("marshal to any error: %w", err)
-	}
-	raw, err := proto.Marshal(anyObj)
-	if err != nil {
-		return ociimg.Descriptor{}, fmt.Errorf("marshal to proto error: %w", err)
-	}
-
-	// 写 content
-	dgst := digest.Digest(fmt.Sprintf("sha256:%x", sha256.Sum256(raw)))
-	desc := ociimg.Descriptor{
-		MediaType: mediaTypeContainerSpec,
-		Digest:    dgst,
-		Size:      int64(len(raw)),
-	}
-	return desc, content.WriteBlob(ctx, r.containerdClient.ContentStore(), string(dgst), bytes.NewReader(raw), desc)
+	return checkpointimage.WriteContainerSpec(ctx, r.contentStore, spec)
 }
 
 // getImageIndex 从 application/vnd.oci.image.index.v1+json 类型的 content 中读取镜像索引信息
 func (r *Restore) getImageIndex(ctx context.Context, desc ociimg.Descriptor) (*ociimg.Index, error) {
-	// 检查类型
-	if desc.MediaType != ociimg.MediaTypeImageIndex {
-		return nil, fmt.Errorf("unexpected media type %q, must be %q", desc.MediaType, ociimg.MediaTypeImageIndex)
-	}
-
-	// 读内容
-	raw, err := content.ReadBlob(ctx, r.containerdClient.ContentStore(), desc)
-	if err != nil {
-		return nil, err
-	}
-
-	// 反序列化
-	var index ociimg.Index
-	return &index, json.Unmarshal(raw, &index)
+	return checkpointimage.ReadImageIndex(ctx, r.contentStore, desc)
 }
 
 // writeImageIndex 将 application/vnd.oci.image.index.v1+json 类型的镜像索引信息写入 content
 func (r *Restore) writeImageIndex(ctx context.Context, index *ociimg.Index) (ociimg.Descriptor, error) {
-	// 序列化
-	raw, err := json.Marshal(index)
-	if err != nil {
-		return ociimg.Descriptor{}, fmt.Errorf("marshal to json error: %w", err)
-	}
+	return checkpointimage.WriteImageIndex(ctx, r.contentStore, index)
+}
 
-	// 确定标签
-	labels := map[string]string{}
-	for i, m := range index.Manifests {
-		// 垃圾回收相关的标签
-		labels[fmt.Sprintf("containerd.io/gc.ref.content.%d", i)] = m.Digest.String()
+// replaceHostsFileHostname 替换 hosts 文件内容中的主机名
+func replaceHostsFileHostname(raw []byte, srcHostname, dstHostname string) []byte {
+	if srcHostname == "" || srcHostname == dstHostname {
+		return raw
 	}
-
-	// 写 content
-	dgst := digest.Digest(fmt.Sprintf("sha256:%x", sha256.Sum256(raw)))
-	desc := ociimg.Descriptor{
-		MediaType: ociimg.MediaTypeImageIndex,
-		Digest:    dgst,
-		Size:      int64(len(raw)),
+	lines := strings.Split(string(raw), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		changed := false
+		for j := 1; j < len(fields); j++ {
+			if fields[j] == srcHostname {
+				fields[j] = dstHostname
+				changed = true
+			}
+		}
+		if changed {
+			lines[i] = strings.Join(fields, "\t")
+		}
 	}
-
-	return desc, content.WriteBlob(
-		ctx,
-		r.containerdClient.ContentStore(),
-		string(dgst), // 这里的 ref 是用于唯一标识 content 写传输会话的，跟镜像的 ref 没有关系，所以用 digest
-		bytes.NewReader(raw),
-		desc,
-		content.WithLabels(labels),
-	)
+	return []byte(strings.Join(lines, "\n"))
 }
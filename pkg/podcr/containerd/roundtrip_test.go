@@ -0,0 +1,519 @@
+package containerd
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd"
+	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+	critesting "k8s.io/cri-api/pkg/apis/testing"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+	"github.com/yhlooo/podmig/pkg/podcr/containerd/fake"
+)
+
+const (
+	testPodUID        = "5f2b1c3e-8d4a-4e6f-9b7c-0a1d2e3f4a5b"
+	testRestoredUID   = "0c9d8e7f-6a5b-4c3d-2e1f-0a9b8c7d6e5f"
+	testPodName       = "web-0"
+	testPodNamespace  = "default"
+	testContainerName = "app"
+)
+
+var _ ImageService = &fake.Backend{}
+var _ ContentStore = &fake.Backend{}
+var _ ContainerService = &fake.Backend{}
+
+// testNode 测试用的节点，包括 CRI 、 containerd 和 kubelet 根目录
+type testNode struct {
+	cri            *fake.RuntimeService
+	backend        *fake.Backend
+	images         *critesting.FakeImageService
+	kubeletRootDir string
+	mgr            *Manager
+}
+
+// newTestNode 创建一个测试用的节点
+func newTestNode(t *testing.T) *testNode {
+	n := &testNode{
+		cri:            fake.NewRuntimeService(),
+		backend:        fake.NewBackend(),
+		images:         critesting.NewFakeImageService(),
+		kubeletRootDir: t.TempDir(),
+	}
+	n.mgr = NewWithClients(
+		t.TempDir(), false, n.cri, n.backend, n.backend, n.backend,
+		WithCRIImageService(n.images),
+		WithKubeletRootDir(n.kubeletRootDir),
+		WithCgroupV2(true),
+	)
+	return n
+}
+
+// kubeletPodDir 获取节点上 Pod 的 kubelet 数据目录
+func (n *testNode) kubeletPodDir(uid string) string {
+	return filepath.Join(n.kubeletRootDir, kubeletPodsDirName, uid)
+}
+
+// runTestPod 在节点上运行一个包含一个容器的测试 Pod ，返回容器 ID
+func (n *testNode) runTestPod(t *testing.T, ctx context.Context, memory []byte) string {
+	// kubelet Pod 目录
+	podDir := n.kubeletPodDir(testPodUID)
+	hostsPath := filepath.Join(podDir, kubeletPodHostsFileName)
+	dataPath := filepath.Join(podDir, kubeletPodVolumesDirName, "kubernetes.io~empty-dir", "data", "state")
+	if err := os.MkdirAll(filepath.Dir(dataPath), 0o755); err != nil {
+		t.Fatalf("mkdir error: %v", err)
+	}
+	if err := os.WriteFile(hostsPath, []byte("10.244.1.5\t"+testPodName+"\n"), 0o644); err != nil {
+		t.Fatalf("write hosts file error: %v", err)
+	}
+	if err := os.WriteFile(dataPath, []byte("counter=42\n"), 0o644); err != nil {
+		t.Fatalf("write volume data error: %v", err)
+	}
+
+	containerID, err := fake.RunPod(ctx, n.cri, n.backend, n.kubeletRootDir, fake.Pod{
+		Namespace:     testPodNamespace,
+		Name:          testPodName,
+		UID:           testPodUID,
+		ContainerName: testContainerName,
+		Mounts: []ociruntime.Mount{
+			{Destination: "/etc/hosts", Type: "bind", Source: hostsPath},
+			{Destination: "/data", Type: "bind", Source: filepath.Dir(dataPath)},
+		},
+		Memory: memory,
+	})
+	if err != nil {
+		t.Fatalf("run test pod error: %v", err)
+	}
+	return containerID
+}
+
+// TestCheckpointRestoreRoundTrip 测试建立检查点、导出到 tar 并在另一节点还原
+func TestCheckpointRestoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	memory := []byte("heap: counter=42")
+
+	// 在源节点建立检查点
+	src := newTestNode(t)
+	srcContainerID := src.runTestPod(t, ctx, memory)
+	archive := &bytes.Buffer{}
+	tw := tar.NewWriter(archive)
+	if err := src.mgr.Checkpoint(ctx, "cp1", testPodNamespace, testPodName, tw, common.CheckpointOptions{
+		NetworkMode: common.NetworkModeNew,
+	}); err != nil {
+		t.Fatalf("checkpoint error: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar writer error: %v", err)
+	}
+	if c, _ := src.backend.Container(srcContainerID); c.Status != containerd.Running {
+		t.Errorf("expected source container running after checkpoint, got %s", c.Status)
+	}
+	if imgs := src.backend.Images(); len(imgs) != 0 {
+		t.Errorf("expected checkpoint images deleted after export, got %d images", len(imgs))
+	}
+
+	// 在目标节点以新 UID 还原
+	dst := newTestNode(t)
+	if err := dst.mgr.Restore(ctx, tar.NewReader(bytes.NewReader(archive.Bytes())), common.RestoreOptions{
+		PodUID:        testRestoredUID,
+		SkipPreflight: true,
+	}); err != nil {
+		t.Fatalf("restore error: %v", err)
+	}
+
+	// 容器从检查点还原，内存内容一致
+	containers := dst.backend.Containers()
+	if len(containers) != 1 {
+		t.Fatalf("expected 1 restored container, got %d", len(containers))
+	}
+	restored := containers[0]
+	if restored.RestoredFrom == nil {
+		t.Errorf("expected container restored from checkpoint image")
+	}
+	if restored.Status != containerd.Running {
+		t.Errorf("expected restored container running, got %s", restored.Status)
+	}
+	if !bytes.Equal(restored.Memory, memory) {
+		t.Errorf("expected restored memory %q, got %q", memory, restored.Memory)
+	}
+
+	// kubelet Pod 目录还原到目标节点的 kubelet 根目录下新 UID 的目录中
+	dstPodDir := dst.kubeletPodDir(testRestoredUID)
+	data, err := os.ReadFile(filepath.Join(dstPodDir, kubeletPodVolumesDirName, "kubernetes.io~empty-dir", "data", "state"))
+	if err != nil {
+		t.Fatalf("read restored volume data error: %v", err)
+	}
+	if string(data) != "counter=42\n" {
+		t.Errorf("expected restored volume data %q, got %q", "counter=42\n", data)
+	}
+	if _, err := os.Stat(filepath.Join(dstPodDir, kubeletPodHostsFileName)); err != nil {
+		t.Errorf("expected restored hosts file: %v", err)
+	}
+
+	// 容器配置中的挂载路径指向目标节点的 kubelet Pod 目录
+	for _, mount := range restored.Spec.Mounts {
+		if !strings.HasPrefix(mount.Source, dstPodDir+string(filepath.Separator)) {
+			t.Errorf("expected mount %q source under %q, got %q", mount.Destination, dstPodDir, mount.Source)
+		}
+	}
+	if cgroupsPath := restored.Spec.Linux.CgroupsPath; !strings.Contains(cgroupsPath, "pod"+testRestoredUID) {
+		t.Errorf("expected cgroups path relocated to restored pod, got %q", cgroupsPath)
+	}
+}
+
+// TestCheckpointArchiveOrder 测试检查点 tar 中条目的顺序，检查点信息位于容器检查点和 kubelet Pod 目录之前
+func TestCheckpointArchiveOrder(t *testing.T) {
+	ctx := context.Background()
+	src := newTestNode(t)
+	src.runTestPod(t, ctx, []byte("heap"))
+	archive := &bytes.Buffer{}
+	tw := tar.NewWriter(archive)
+	if err := src.mgr.Checkpoint(ctx, "cp1", testPodNamespace, testPodName, tw, common.CheckpointOptions{}); err != nil {
+		t.Fatalf("checkpoint error: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar writer error: %v", err)
+	}
+
+	// 各类条目首次出现的顺序
+	var kinds []string
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read checkpoint tar error: %v", err)
+		}
+		kind := hdr.Name
+		switch {
+		case strings.HasPrefix(hdr.Name, containerCheckpointTarNamePrefix):
+			kind = containerCheckpointTarNamePrefix
+		case strings.HasPrefix(hdr.Name, kubeletPodDirTarNamePrefix):
+			kind = kubeletPodDirTarNamePrefix
+		}
+		if len(kinds) == 0 || kinds[len(kinds)-1] != kind {
+			kinds = append(kinds, kind)
+		}
+	}
+	expected := []string{
+		sandboxInfoJSONName,
+		checkpointInfoJSONName,
+		containerCheckpointTarNamePrefix,
+		kubeletPodDirTarNamePrefix,
+	}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("expected checkpoint tar entries in order %v, got %v", expected, kinds)
+	}
+}
+
+// TestCheckpointRestoreExitedContainer 测试已退出的容器只记录退出状态，还原时不重新创建，交由 kubelet 处理
+func TestCheckpointRestoreExitedContainer(t *testing.T) {
+	ctx := context.Background()
+	src := newTestNode(t)
+	src.runTestPod(t, ctx, []byte("heap"))
+
+	// 已完成的 init 容器
+	sandboxes, err := src.cri.ListPodSandbox(ctx, nil)
+	if err != nil || len(sandboxes) != 1 {
+		t.Fatalf("expected 1 sandbox, got %d (%v)", len(sandboxes), err)
+	}
+	initID, err := src.cri.CreateContainer(ctx, sandboxes[0].Id, &runtimev1.ContainerConfig{
+		Metadata: &runtimev1.ContainerMetadata{Name: "init"},
+		Image:    &runtimev1.ImageSpec{Image: "docker.io/library/busybox:1.36"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("create init container error: %v", err)
+	}
+	if err := src.cri.StartContainer(ctx, initID); err != nil {
+		t.Fatalf("start init container error: %v", err)
+	}
+	if err := src.cri.StopContainer(ctx, initID, 0); err != nil {
+		t.Fatalf("stop init container error: %v", err)
+	}
+
+	archive := &bytes.Buffer{}
+	tw := tar.NewWriter(archive)
+	if err := src.mgr.Checkpoint(ctx, "cp1", testPodNamespace, testPodName, tw, common.CheckpointOptions{}); err != nil {
+		t.Fatalf("checkpoint error: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar writer error: %v", err)
+	}
+
+	// 还原计划中记录退出状态
+	dst := newTestNode(t)
+	plan, err := dst.mgr.PlanRestore(ctx, tar.NewReader(bytes.NewReader(archive.Bytes())), common.RestoreOptions{
+		PodUID: testRestoredUID,
+	})
+	if err != nil {
+		t.Fatalf("plan restore error: %v", err)
+	}
+	var exited []string
+	for _, c := range plan.Containers {
+		if c.Exited {
+			exited = append(exited, c.Name)
+		}
+	}
+	if !reflect.DeepEqual(exited, []string{"init"}) {
+		t.Errorf("expected exited containers [init] in plan, got %v", exited)
+	}
+
+	// 还原时仅从检查点还原运行中的容器，不重新创建已退出的容器
+	if err := dst.mgr.Restore(ctx, tar.NewReader(bytes.NewReader(archive.Bytes())), common.RestoreOptions{
+		PodUID:        testRestoredUID,
+		SkipPreflight: true,
+	}); err != nil {
+		t.Fatalf("restore error: %v", err)
+	}
+	if n := len(dst.backend.Containers()); n != 1 {
+		t.Errorf("expected 1 container restored from checkpoint, got %d", n)
+	}
+	if n := len(dst.cri.Containers); n != 0 {
+		t.Errorf("expected no container recreated, got %d", n)
+	}
+}
+
+// TestCheckpointRestoreExcludedContainer 测试排除的容器不转储，还原时使用原始镜像重新创建
+func TestCheckpointRestoreExcludedContainer(t *testing.T) {
+	ctx := context.Background()
+	src := newTestNode(t)
+	appID := src.runTestPod(t, ctx, []byte("heap"))
+
+	// 运行中的 sidecar 容器
+	sandboxes, err := src.cri.ListPodSandbox(ctx, nil)
+	if err != nil || len(sandboxes) != 1 {
+		t.Fatalf("expected 1 sandbox, got %d (%v)", len(sandboxes), err)
+	}
+	sidecarID, err := src.cri.CreateContainer(ctx, sandboxes[0].Id, &runtimev1.ContainerConfig{
+		Metadata: &runtimev1.ContainerMetadata{Name: "sidecar"},
+		Image:    &runtimev1.ImageSpec{Image: "docker.io/library/nginx:1.25"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("create sidecar container error: %v", err)
+	}
+	if err := src.cri.StartContainer(ctx, sidecarID); err != nil {
+		t.Fatalf("start sidecar container error: %v", err)
+	}
+	src.backend.AddContainer(sidecarID, &ociruntime.Spec{
+		Process: &ociruntime.Process{Args: []string{"nginx"}},
+		Annotations: map[string]string{
+			containerAnnoContainerName:    "sidecar",
+			containerAnnoSandboxName:      testPodName,
+			containerAnnoSandboxNamespace: testPodNamespace,
+		},
+	}, []byte("sidecar heap"))
+
+	var checkpointed []string
+	src.backend.SetCheckpointHook(func(_ context.Context, id string) error {
+		checkpointed = append(checkpointed, id)
+		return nil
+	})
+	archive := &bytes.Buffer{}
+	tw := tar.NewWriter(archive)
+	if err := src.mgr.Checkpoint(ctx, "cp1", testPodNamespace, testPodName, tw, common.CheckpointOptions{
+		Containers: common.ContainerFilter{Exclude: []string{"sidecar"}},
+	}); err != nil {
+		t.Fatalf("checkpoint error: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar writer error: %v", err)
+	}
+	if !reflect.DeepEqual(checkpointed, []string{appID}) {
+		t.Errorf("expected only app container %q checkpointed, got %v", appID, checkpointed)
+	}
+	if c, _ := src.backend.Container(sidecarID); c.Status != containerd.Running {
+		t.Errorf("expected excluded container kept running, got %s", c.Status)
+	}
+
+	// 还原时从检查点还原 app 容器，使用原始镜像重新创建 sidecar 容器
+	dst := newTestNode(t)
+	dst.images.SetFakeImages([]string{"docker.io/library/nginx:1.25"})
+	if err := dst.mgr.Restore(ctx, tar.NewReader(bytes.NewReader(archive.Bytes())), common.RestoreOptions{
+		PodUID:        testRestoredUID,
+		SkipPreflight: true,
+	}); err != nil {
+		t.Fatalf("restore error: %v", err)
+	}
+	restored := dst.backend.Containers()
+	if len(restored) != 1 || restored[0].Spec.Annotations[containerAnnoContainerName] != testContainerName {
+		t.Fatalf("expected only container %q restored from checkpoint, got %d containers", testContainerName, len(restored))
+	}
+	var recreated []string
+	for _, c := range dst.cri.Containers {
+		recreated = append(recreated, c.Metadata.GetName())
+		if image := c.Image.GetImage(); image != "docker.io/library/nginx:1.25" {
+			t.Errorf("expected container %q recreated from original image, got %q", c.Metadata.GetName(), image)
+		}
+		if c.State != runtimev1.ContainerState_CONTAINER_RUNNING {
+			t.Errorf("expected recreated container %q running, got %s", c.Metadata.GetName(), c.State)
+		}
+	}
+	if !reflect.DeepEqual(recreated, []string{"sidecar"}) {
+		t.Errorf("expected containers [sidecar] recreated, got %v", recreated)
+	}
+}
+
+// TestCheckpointCanceledResumesContainers 测试建立检查点期间上下文被取消时仍恢复已暂停的容器
+func TestCheckpointCanceledResumesContainers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src := newTestNode(t)
+	containerID := src.runTestPod(t, ctx, []byte("heap"))
+	src.backend.SetCheckpointHook(fake.CancelCheckpoint(cancel))
+
+	tw := tar.NewWriter(io.Discard)
+	err := src.mgr.Checkpoint(ctx, "cp1", testPodNamespace, testPodName, tw, common.CheckpointOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled error, got %v", err)
+	}
+	if c, _ := src.backend.Container(containerID); c.Status != containerd.Running {
+		t.Errorf("expected container resumed after canceled checkpoint, got %s", c.Status)
+	}
+}
+
+// failingWriter 写入包含指定内容的数据时失败的 io.Writer
+type failingWriter struct {
+	match []byte
+}
+
+// Write 写入
+func (w failingWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, w.match) {
+		return 0, errors.New("write failed")
+	}
+	return len(p), nil
+}
+
+// TestCheckpointLeavePaused 测试建立检查点后保持容器暂停，并通过 Resume 恢复
+func TestCheckpointLeavePaused(t *testing.T) {
+	ctx := context.Background()
+	src := newTestNode(t)
+	containerID := src.runTestPod(t, ctx, []byte("heap"))
+
+	tw := tar.NewWriter(io.Discard)
+	if err := src.mgr.Checkpoint(ctx, "cp1", testPodNamespace, testPodName, tw, common.CheckpointOptions{
+		LeavePaused: true,
+	}); err != nil {
+		t.Fatalf("checkpoint error: %v", err)
+	}
+	if c, _ := src.backend.Container(containerID); c.Status != containerd.Paused {
+		t.Errorf("expected container left paused after checkpoint, got %s", c.Status)
+	}
+
+	if err := src.mgr.Resume(ctx, testPodNamespace, testPodName); err != nil {
+		t.Fatalf("resume error: %v", err)
+	}
+	if c, _ := src.backend.Container(containerID); c.Status != containerd.Running {
+		t.Errorf("expected container running after resume, got %s", c.Status)
+	}
+	// 没有暂停的容器时不做任何操作
+	if err := src.mgr.Resume(ctx, testPodNamespace, testPodName); err != nil {
+		t.Errorf("resume again error: %v", err)
+	}
+	if err := src.mgr.Resume(ctx, testPodNamespace, "not-exists"); err == nil {
+		t.Errorf("expected error resuming pod not found")
+	}
+}
+
+// TestCheckpointLeavePausedExportFailed 测试要求保持暂停但导出失败时恢复容器
+func TestCheckpointLeavePausedExportFailed(t *testing.T) {
+	ctx := context.Background()
+	src := newTestNode(t)
+	containerID := src.runTestPod(t, ctx, []byte("heap"))
+
+	tw := tar.NewWriter(failingWriter{match: []byte(containerCheckpointTarNamePrefix + testContainerName)})
+	if err := src.mgr.Checkpoint(ctx, "cp1", testPodNamespace, testPodName, tw, common.CheckpointOptions{
+		LeavePaused: true,
+	}); err == nil {
+		t.Fatalf("expected checkpoint error")
+	}
+	if c, _ := src.backend.Container(containerID); c.Status != containerd.Running {
+		t.Errorf("expected container resumed after failed export, got %s", c.Status)
+	}
+}
+
+// TestResumeSkipsExitedContainers 测试恢复时跳过已退出、 task 已被删除的容器和未就绪的旧沙盒
+func TestResumeSkipsExitedContainers(t *testing.T) {
+	ctx := context.Background()
+	src := newTestNode(t)
+	containerID := src.runTestPod(t, ctx, []byte("heap"))
+	sandboxes, err := src.cri.ListPodSandbox(ctx, nil)
+	if err != nil || len(sandboxes) != 1 {
+		t.Fatalf("expected 1 sandbox, got %d (%v)", len(sandboxes), err)
+	}
+
+	// addContainer 在沙盒中创建并启动一个容器， exited 为 true 时容器已退出
+	addContainer := func(sandboxID, name string, exited bool) string {
+		id, err := src.cri.CreateContainer(ctx, sandboxID, &runtimev1.ContainerConfig{
+			Metadata: &runtimev1.ContainerMetadata{Name: name},
+			Image:    &runtimev1.ImageSpec{Image: "docker.io/library/busybox:1.36"},
+		}, nil)
+		if err != nil {
+			t.Fatalf("create container %q error: %v", name, err)
+		}
+		if err := src.cri.StartContainer(ctx, id); err != nil {
+			t.Fatalf("start container %q error: %v", name, err)
+		}
+		if exited {
+			if err := src.cri.StopContainer(ctx, id, 0); err != nil {
+				t.Fatalf("stop container %q error: %v", name, err)
+			}
+		}
+		src.backend.AddContainer(id, &ociruntime.Spec{}, nil)
+		if err := src.backend.DeleteTask(id); err != nil {
+			t.Fatalf("delete task of container %q error: %v", name, err)
+		}
+		return id
+	}
+
+	// 已完成的 init 容器
+	addContainer(sandboxes[0].Id, "init", true)
+	tw := tar.NewWriter(io.Discard)
+	if err := src.mgr.Checkpoint(ctx, "cp1", testPodNamespace, testPodName, tw, common.CheckpointOptions{
+		LeavePaused: true,
+	}); err != nil {
+		t.Fatalf("checkpoint error: %v", err)
+	}
+	// 刚退出、 CRI 状态尚未更新的容器
+	addContainer(sandboxes[0].Id, "sidecar", false)
+	// 同一 Pod 的未就绪的旧沙盒
+	staleID, err := src.cri.RunPodSandbox(ctx, &runtimev1.PodSandboxConfig{
+		Metadata: &runtimev1.PodSandboxMetadata{
+			Name:      testPodName,
+			Namespace: testPodNamespace,
+			Uid:       testPodUID,
+			Attempt:   1,
+		},
+		Labels: map[string]string{
+			labelPodName:      testPodName,
+			labelPodNamespace: testPodNamespace,
+			labelPodUID:       testPodUID,
+		},
+	}, "")
+	if err != nil {
+		t.Fatalf("run stale sandbox error: %v", err)
+	}
+	addContainer(staleID, "app", true)
+	if err := src.cri.StopPodSandbox(ctx, staleID); err != nil {
+		t.Fatalf("stop stale sandbox error: %v", err)
+	}
+
+	if err := src.mgr.Resume(ctx, testPodNamespace, testPodName); err != nil {
+		t.Fatalf("resume error: %v", err)
+	}
+	if c, _ := src.backend.Container(containerID); c.Status != containerd.Running {
+		t.Errorf("expected container running after resume, got %s", c.Status)
+	}
+}
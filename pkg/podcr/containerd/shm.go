@@ -0,0 +1,168 @@
+package containerd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-logr/logr"
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/yhlooo/podmig/pkg/utils/tarutil"
+)
+
+const (
+	sandboxShmTarNamePrefix = "sandbox_shm"
+	// 内存介质的 emptyDir 卷
+	volumeMediumMemory = "Memory"
+)
+
+// stageMemory 在容器暂停期间将沙盒共享内存 /dev/shm 和内存介质卷的内容暂存到临时目录
+//
+// 这些内容都在 tmpfs 中，不在容器检查点内，需要与容器检查点在同一时刻导出，
+// 导出到检查点 tar 时使用暂存的内容
+func (c *Checkpoint) stageMemory(ctx context.Context) error {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	// 沙盒共享内存是 tmpfs ，其内容不在容器 rootfs 中，也不在 kubelet Pod 目录中
+	// 使用宿主机 IPC 命名空间时 /dev/shm 属于宿主机
+	if c.sandboxInfo.Config.GetLinux().GetSecurityContext().GetNamespaceOptions().GetIpc() ==
+		runtimev1.NamespaceMode_NODE {
+		logger.Info("skip staging sandbox shm: pod uses host ipc namespace")
+	} else {
+		shmDir := getSandboxShmDir(c.sandboxInfo.Pid)
+		logger.Info(fmt.Sprintf("staging sandbox shm: %s", shmDir))
+		if err := tarutil.CopyDirToFile(c.stagedSandboxShmPath(), sandboxShmTarNamePrefix, shmDir); err != nil {
+			return fmt.Errorf("stage sandbox shm %q error: %w", shmDir, err)
+		}
+	}
+
+	// 内存介质卷
+	c.stagedMemoryVolumes = make(map[string]string)
+	for i, volume := range c.volumes {
+		if volume.Medium != volumeMediumMemory || volume.DataExcluded() {
+			continue
+		}
+		path := filepath.Join(c.kubeletPodDir, volume.Path)
+		stagedPath := filepath.Join(c.tmpdir, fmt.Sprintf("memory_volume_%d.tar", i))
+		logger.Info(fmt.Sprintf("staging memory volume %q: %s", volume.Name, path))
+		if err := tarutil.CopyDirToFile(stagedPath, kubeletPodDirTarNamePrefix+path, path); err != nil {
+			return fmt.Errorf("stage memory volume %q error: %w", volume.Name, err)
+		}
+		c.stagedMemoryVolumes[path] = stagedPath
+	}
+	return nil
+}
+
+// exportSandboxShm 导出暂存的沙盒共享内存内容
+func (c *Checkpoint) exportSandboxShm(_ context.Context) error {
+	stagedPath := c.stagedSandboxShmPath()
+	if _, err := os.Stat(stagedPath); os.IsNotExist(err) {
+		return nil
+	}
+	defer func() { _ = os.Remove(stagedPath) }()
+	return tarutil.CopyFileEntriesIn(c.tw, stagedPath)
+}
+
+// stagedSandboxShmPath 获取暂存沙盒共享内存内容的 tar 文件路径
+func (c *Checkpoint) stagedSandboxShmPath() string {
+	return filepath.Join(c.tmpdir, sandboxShmTarNamePrefix+".tar")
+}
+
+// restoreSandboxShm 将检查点中的沙盒共享内存内容写入还原的沙盒挂载命名空间内的 /dev/shm
+func (r *Restore) restoreSandboxShm(ctx context.Context) error {
+	stagingDir := filepath.Join(r.tmpdir, sandboxShmTarNamePrefix)
+	if _, err := os.Stat(stagingDir); os.IsNotExist(err) {
+		return nil
+	}
+	logger := logr.FromContextOrDiscard(ctx)
+
+	shmDir := getSandboxShmDir(r.sandboxInfo.Pid)
+	logger.Info(fmt.Sprintf("restoring sandbox shm: %s", shmDir))
+	return copyDir(stagingDir, shmDir)
+}
+
+// prepareMemoryVolumeDir 在内存介质的卷目录上挂载大小为 sizeBytes 的 tmpfs
+//
+// sizeBytes 为 0 时使用 Pod 内存限制，与 kubelet 对未指定 sizeLimit 的内存介质 emptyDir 卷的处理一致。
+// 挂载的目录记录在 r.mountedMemoryVolumes 中，还原失败时卸载
+func (r *Restore) prepareMemoryVolumeDir(path string, sizeBytes int64) error {
+	mountPoint, err := isMountPoint(path)
+	if err != nil {
+		return err
+	}
+	if mountPoint {
+		return nil
+	}
+	if sizeBytes <= 0 {
+		sizeBytes = r.srcSandboxInfo.Config.GetLinux().GetResources().GetMemoryLimitInBytes()
+	}
+	options := ""
+	if sizeBytes > 0 {
+		options = fmt.Sprintf("size=%d", sizeBytes)
+	}
+	if err := mountTmpfs(path, options); err != nil {
+		return fmt.Errorf("mount tmpfs on %q error: %w", path, err)
+	}
+	r.mountedMemoryVolumes = append(r.mountedMemoryVolumes, path)
+	return nil
+}
+
+// unmountMemoryVolumeDirs 卸载还原时在内存介质的卷目录上挂载的 tmpfs
+func (r *Restore) unmountMemoryVolumeDirs(ctx context.Context) {
+	logger := logr.FromContextOrDiscard(ctx)
+	for i := len(r.mountedMemoryVolumes) - 1; i >= 0; i-- {
+		path := r.mountedMemoryVolumes[i]
+		if err := unmountTmpfs(path); err != nil {
+			logger.Error(err, fmt.Sprintf("unmount tmpfs on %q error", path))
+		}
+	}
+	r.mountedMemoryVolumes = nil
+}
+
+// getSandboxShmDir 获取从宿主机访问沙盒挂载命名空间内 /dev/shm 的路径
+func getSandboxShmDir(sandboxPid int) string {
+	return fmt.Sprintf("/proc/%d/root/dev/shm", sandboxPid)
+}
+
+// copyDir 将 src 目录中的内容拷贝到 dst 目录
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relPath)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case !info.Mode().IsRegular():
+			return nil
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = in.Close() }()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		defer func() { _ = out.Close() }()
+		_, err = io.Copy(out, in)
+		return err
+	})
+}
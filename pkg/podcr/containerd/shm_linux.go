@@ -0,0 +1,28 @@
+package containerd
+
+import "syscall"
+
+// tmpfs 文件系统类型，见 statfs(2)
+const tmpfsMagic = 0x01021994
+
+// mountTmpfs 在 path 上挂载 tmpfs
+func mountTmpfs(path, options string) error {
+	return syscall.Mount("tmpfs", path, "tmpfs", 0, options)
+}
+
+// unmountTmpfs 卸载 path 上的 tmpfs
+func unmountTmpfs(path string) error {
+	return syscall.Unmount(path, 0)
+}
+
+// getTmpfsInfo 判断路径是否位于 tmpfs 上，是则同时返回 tmpfs 大小（字节）
+func getTmpfsInfo(path string) (bool, int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return false, 0, err
+	}
+	if stat.Type != tmpfsMagic {
+		return false, 0, nil
+	}
+	return true, int64(stat.Blocks) * int64(stat.Bsize), nil
+}
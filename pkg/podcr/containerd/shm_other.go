@@ -0,0 +1,26 @@
+//go:build !linux
+
+package containerd
+
+import "fmt"
+
+// mountTmpfs 在 path 上挂载 tmpfs
+//
+// 非 Linux 平台不支持
+func mountTmpfs(_, _ string) error {
+	return fmt.Errorf("mount tmpfs is not supported on this platform")
+}
+
+// unmountTmpfs 卸载 path 上的 tmpfs
+//
+// 非 Linux 平台不支持
+func unmountTmpfs(_ string) error {
+	return fmt.Errorf("unmount tmpfs is not supported on this platform")
+}
+
+// getTmpfsInfo 判断路径是否位于 tmpfs 上，是则同时返回 tmpfs 大小（字节）
+//
+// 非 Linux 平台没有 tmpfs ，总是返回 false
+func getTmpfsInfo(_ string) (bool, int64, error) {
+	return false, 0, nil
+}
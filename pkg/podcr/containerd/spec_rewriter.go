@@ -0,0 +1,360 @@
+package containerd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+const (
+	shmMountDestination = "/dev/shm"
+	shmSizeOptionPrefix = "size="
+)
+
+// SpecRewriteRule 容器配置改写规则
+type SpecRewriteRule struct {
+	// 规则名
+	Name string
+	// 被替换的值
+	Old string
+	// 替换后的值
+	New string
+	// 为 true 时仅替换与 Old 完全相等的值，否则替换值中所有 Old 子串
+	Exact bool
+	// 为 true 时 Old 是 IP 地址，仅替换前后不与其它地址字符相连的子串
+	//
+	// 如 10.0.0.5 会替换 10.0.0.5:8080 和 http://10.0.0.5/ 中的子串，但不会替换 10.0.0.50 和 110.0.0.5 中的子串
+	IPBoundary bool
+	// 规则适用的字段前缀，为空表示适用于所有字段
+	Fields []string
+}
+
+// matchField 判断规则是否适用于指定字段
+func (rule SpecRewriteRule) matchField(field string) bool {
+	if len(rule.Fields) == 0 {
+		return true
+	}
+	for _, prefix := range rule.Fields {
+		if strings.HasPrefix(field, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply 对值应用规则，返回改写后的值以及是否发生了改写
+func (rule SpecRewriteRule) apply(value string) (string, bool) {
+	if rule.Old == "" || rule.Old == rule.New {
+		return value, false
+	}
+	if rule.Exact {
+		if value == rule.Old {
+			return rule.New, true
+		}
+		return value, false
+	}
+	if !strings.Contains(value, rule.Old) {
+		return value, false
+	}
+	if rule.IPBoundary {
+		return replaceIP(value, rule.Old, rule.New)
+	}
+	return strings.ReplaceAll(value, rule.Old, rule.New), true
+}
+
+// replaceIP 替换 value 中所有前后不与其它地址字符相连的 IP 地址 old
+func replaceIP(value, old, new string) (string, bool) {
+	isV6 := strings.Contains(old, ":")
+	var b strings.Builder
+	changed := false
+	i := 0
+	for {
+		j := strings.Index(value[i:], old)
+		if j < 0 {
+			break
+		}
+		start, end := i+j, i+j+len(old)
+		b.WriteString(value[i:start])
+		if isIPBoundary(value, start, end, isV6) {
+			b.WriteString(new)
+			changed = true
+		} else {
+			b.WriteString(old)
+		}
+		i = end
+	}
+	if !changed {
+		return value, false
+	}
+	b.WriteString(value[i:])
+	return b.String(), true
+}
+
+// isIPBoundary 判断 value[start:end] 处的 IP 地址前后是否没有与其它地址字符相连
+func isIPBoundary(value string, start, end int, isV6 bool) bool {
+	if isV6 {
+		// IPv6 地址中可能出现十六进制数字、冒号和点（内嵌 IPv4 ）
+		isAddrChar := func(c byte) bool {
+			return isHexDigit(c) || c == ':' || c == '.'
+		}
+		return (start == 0 || !isAddrChar(value[start-1])) && (end == len(value) || !isAddrChar(value[end]))
+	}
+	// IPv4 地址前后的点仅在与数字相连时才是地址的一部分，如句末的点
+	if start > 0 {
+		c := value[start-1]
+		if isDigit(c) || c == '.' && start > 1 && isDigit(value[start-2]) {
+			return false
+		}
+	}
+	if end < len(value) {
+		c := value[end]
+		if isDigit(c) || c == '.' && end+1 < len(value) && isDigit(value[end+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isDigit 判断是否十进制数字
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// isHexDigit 判断是否十六进制数字
+func isHexDigit(c byte) bool {
+	return isDigit(c) || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// SpecRewriteRecord 容器配置改写记录
+type SpecRewriteRecord struct {
+	// 被改写的字段，如 mounts[/etc/hosts].source
+	Field string `json:"field"`
+	// 生效的规则名
+	Rule string `json:"rule"`
+	// 改写前的值
+	Old string `json:"old"`
+	// 改写后的值
+	New string `json:"new"`
+}
+
+// String 返回记录的可读形式
+func (r SpecRewriteRecord) String() string {
+	return fmt.Sprintf("%s: %q -> %q (%s)", r.Field, r.Old, r.New, r.Rule)
+}
+
+// SpecRewriter 基于规则的容器配置改写器
+//
+// 遍历 OCI 容器配置中所有路径、环境变量、注解等字符串字段，按顺序应用所有规则
+type SpecRewriter struct {
+	rules   []SpecRewriteRule
+	records []SpecRewriteRecord
+}
+
+// NewSpecRewriter 创建一个 *SpecRewriter
+func NewSpecRewriter(rules ...SpecRewriteRule) *SpecRewriter {
+	return &SpecRewriter{rules: rules}
+}
+
+// Rewrite 改写容器配置，返回所有改写记录
+func (w *SpecRewriter) Rewrite(spec *ociruntime.Spec) []SpecRewriteRecord {
+	w.records = nil
+	if spec == nil {
+		return nil
+	}
+
+	w.rewriteString("hostname", &spec.Hostname)
+	w.rewriteString("domainname", &spec.Domainname)
+	if spec.Root != nil {
+		w.rewriteString("root.path", &spec.Root.Path)
+	}
+	if spec.Process != nil {
+		w.rewriteProcess(spec.Process)
+	}
+	for i := range spec.Mounts {
+		field := fmt.Sprintf("mounts[%s]", spec.Mounts[i].Destination)
+		w.rewriteString(field+".source", &spec.Mounts[i].Source)
+		for j := range spec.Mounts[i].Options {
+			w.rewriteString(fmt.Sprintf("%s.options[%d]", field, j), &spec.Mounts[i].Options[j])
+		}
+	}
+	w.rewriteStringMap("annotations", spec.Annotations)
+	if spec.Hooks != nil {
+		w.rewriteHooks("hooks.prestart", spec.Hooks.Prestart)
+		w.rewriteHooks("hooks.createRuntime", spec.Hooks.CreateRuntime)
+		w.rewriteHooks("hooks.createContainer", spec.Hooks.CreateContainer)
+		w.rewriteHooks("hooks.startContainer", spec.Hooks.StartContainer)
+		w.rewriteHooks("hooks.poststart", spec.Hooks.Poststart)
+		w.rewriteHooks("hooks.poststop", spec.Hooks.Poststop)
+	}
+	if spec.Linux != nil {
+		w.rewriteString("linux.cgroupsPath", &spec.Linux.CgroupsPath)
+		for i := range spec.Linux.Namespaces {
+			w.rewriteString(
+				fmt.Sprintf("linux.namespaces[%s].path", spec.Linux.Namespaces[i].Type),
+				&spec.Linux.Namespaces[i].Path,
+			)
+		}
+		w.rewriteStringMap("linux.sysctl", spec.Linux.Sysctl)
+		for i := range spec.Linux.MaskedPaths {
+			w.rewriteString(fmt.Sprintf("linux.maskedPaths[%d]", i), &spec.Linux.MaskedPaths[i])
+		}
+		for i := range spec.Linux.ReadonlyPaths {
+			w.rewriteString(fmt.Sprintf("linux.readonlyPaths[%d]", i), &spec.Linux.ReadonlyPaths[i])
+		}
+	}
+
+	return w.records
+}
+
+// RewriteContainerConfig 改写用于重新创建容器的 CRI 容器配置，返回所有改写记录
+//
+// 字段名使用与 OCI 容器配置对应的名称，使规则对两种配置一致生效
+func (w *SpecRewriter) RewriteContainerConfig(config *runtimev1.ContainerConfig) []SpecRewriteRecord {
+	w.records = nil
+	if config == nil {
+		return nil
+	}
+
+	w.rewriteString("process.cwd", &config.WorkingDir)
+	for i := range config.Command {
+		w.rewriteString(fmt.Sprintf("process.args[%d]", i), &config.Command[i])
+	}
+	for i := range config.Args {
+		w.rewriteString(fmt.Sprintf("process.args[%d]", len(config.Command)+i), &config.Args[i])
+	}
+	for _, env := range config.Envs {
+		w.rewriteString(fmt.Sprintf("process.env[%s]", env.Key), &env.Value)
+	}
+	for _, mount := range config.Mounts {
+		w.rewriteString(fmt.Sprintf("mounts[%s].source", mount.ContainerPath), &mount.HostPath)
+	}
+	w.rewriteStringMap("labels", config.Labels)
+	w.rewriteStringMap("annotations", config.Annotations)
+
+	return w.records
+}
+
+// rewriteProcess 改写进程配置
+func (w *SpecRewriter) rewriteProcess(process *ociruntime.Process) {
+	w.rewriteString("process.cwd", &process.Cwd)
+	for i := range process.Args {
+		w.rewriteString(fmt.Sprintf("process.args[%d]", i), &process.Args[i])
+	}
+	w.rewriteEnv("process.env", process.Env)
+}
+
+// rewriteHooks 改写钩子配置
+func (w *SpecRewriter) rewriteHooks(field string, hooks []ociruntime.Hook) {
+	for i := range hooks {
+		hookField := fmt.Sprintf("%s[%d]", field, i)
+		w.rewriteString(hookField+".path", &hooks[i].Path)
+		for j := range hooks[i].Args {
+			w.rewriteString(fmt.Sprintf("%s.args[%d]", hookField, j), &hooks[i].Args[j])
+		}
+		w.rewriteEnv(hookField+".env", hooks[i].Env)
+	}
+}
+
+// rewriteEnv 改写 KEY=VALUE 形式的环境变量值
+func (w *SpecRewriter) rewriteEnv(field string, env []string) {
+	for i, kv := range env {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		if w.rewriteString(fmt.Sprintf("%s[%s]", field, k), &v) {
+			env[i] = k + "=" + v
+		}
+	}
+}
+
+// rewriteStringMap 改写 map 中的值
+func (w *SpecRewriter) rewriteStringMap(field string, m map[string]string) {
+	// 排序以保证改写记录顺序稳定
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := m[k]
+		if w.rewriteString(fmt.Sprintf("%s[%s]", field, k), &v) {
+			m[k] = v
+		}
+	}
+}
+
+// rewriteString 对字段值依次应用所有规则，返回是否发生了改写
+func (w *SpecRewriter) rewriteString(field string, value *string) bool {
+	if *value == "" {
+		return false
+	}
+	changed := false
+	for _, rule := range w.rules {
+		if !rule.matchField(field) {
+			continue
+		}
+		newValue, ok := rule.apply(*value)
+		if !ok {
+			continue
+		}
+		w.records = append(w.records, SpecRewriteRecord{
+			Field: field,
+			Rule:  rule.Name,
+			Old:   *value,
+			New:   newValue,
+		})
+		*value = newValue
+		changed = true
+	}
+	return changed
+}
+
+// rewriteShmSize 将容器配置中 tmpfs 类型的 /dev/shm 挂载大小改写为与沙盒一致
+func rewriteShmSize(spec *ociruntime.Spec, sandboxSpec *ociruntime.Spec) []SpecRewriteRecord {
+	if spec == nil || sandboxSpec == nil {
+		return nil
+	}
+	sandboxShmSize := ""
+	for _, mount := range sandboxSpec.Mounts {
+		if mount.Destination == shmMountDestination {
+			sandboxShmSize = getMountOption(mount.Options, shmSizeOptionPrefix)
+		}
+	}
+	if sandboxShmSize == "" {
+		return nil
+	}
+
+	var records []SpecRewriteRecord
+	for i, mount := range spec.Mounts {
+		if mount.Destination != shmMountDestination || mount.Type != "tmpfs" {
+			continue
+		}
+		for j, opt := range mount.Options {
+			if !strings.HasPrefix(opt, shmSizeOptionPrefix) || opt == sandboxShmSize {
+				continue
+			}
+			records = append(records, SpecRewriteRecord{
+				Field: fmt.Sprintf("mounts[%s].options[%d]", shmMountDestination, j),
+				Rule:  "shm-size",
+				Old:   opt,
+				New:   sandboxShmSize,
+			})
+			spec.Mounts[i].Options[j] = sandboxShmSize
+		}
+	}
+	return records
+}
+
+// getMountOption 获取以 prefix 开头的挂载选项
+func getMountOption(options []string, prefix string) string {
+	for _, opt := range options {
+		if strings.HasPrefix(opt, prefix) {
+			return opt
+		}
+	}
+	return ""
+}
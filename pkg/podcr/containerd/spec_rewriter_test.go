@@ -0,0 +1,164 @@
+package containerd
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// TestSpecRewriter 测试以还原时生成的改写规则改写捕获的容器配置
+func TestSpecRewriter(t *testing.T) {
+	const (
+		srcUID       = "5f2b1c3e-8d4a-4e6f-9b7c-0a1d2e3f4a5b"
+		dstUID       = "0c9d8e7f-6a5b-4c3d-2e1f-0a9b8c7d6e5f"
+		srcSandboxID = "8a9b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b"
+		dstSandboxID = "1f2e3d4c5b6a79880a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f6071"
+		srcPodName   = "nginx-7c5ddbdf54-x8m2k"
+		dstPodName   = "nginx-7c5ddbdf54-p4q9z"
+	)
+	// newRestore 创建以 podName 和 ip 还原 nginx Pod 的 *Restore
+	newRestore := func(podName, ip string) *Restore {
+		return &Restore{
+			opts: common.RestoreOptions{
+				PodUID:       dstUID,
+				PodName:      podName,
+				PodNamespace: "default",
+				Hostname:     podName,
+			},
+			kubeletPodsDir: "/var/lib/kubelet/pods",
+			srcSandboxInfo: &SandboxInfo{
+				ID:  srcSandboxID,
+				Pid: 12345,
+				IPs: []string{"10.244.1.5"},
+				Config: &runtimev1.PodSandboxConfig{
+					LogDirectory: "/var/log/pods/default_" + podName + "_" + dstUID,
+				},
+			},
+			sandboxInfo: &SandboxInfo{
+				ID:  dstSandboxID,
+				Pid: 23456,
+				IPs: []string{ip},
+			},
+			srcSandboxUID:       srcUID,
+			srcSandboxName:      srcPodName,
+			srcSandboxNamespace: "default",
+			srcHostname:         srcPodName,
+			srcLogDirectory:     "/var/log/pods/default_" + srcPodName + "_" + srcUID,
+		}
+	}
+
+	cases := []struct {
+		name    string
+		spec    string
+		restore *Restore
+	}{
+		{
+			name:    "same-node",
+			spec:    "nginx.json",
+			restore: newRestore(srcPodName, "10.244.1.5"),
+		},
+		{
+			name:    "new-identity",
+			spec:    "nginx.json",
+			restore: newRestore(dstPodName, "10.244.2.7"),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			raw, err := os.ReadFile(filepath.Join("testdata", "specs", c.spec))
+			if err != nil {
+				t.Fatalf("read spec error: %v", err)
+			}
+			spec := &ociruntime.Spec{}
+			if err := json.Unmarshal(raw, spec); err != nil {
+				t.Fatalf("unmarshal spec error: %v", err)
+			}
+
+			records := NewSpecRewriter(c.restore.specRewriteRules()...).Rewrite(spec)
+			got, err := json.MarshalIndent(struct {
+				Records []SpecRewriteRecord `json:"records"`
+				Spec    *ociruntime.Spec    `json:"spec"`
+			}{Records: records, Spec: spec}, "", "  ")
+			if err != nil {
+				t.Fatalf("marshal result error: %v", err)
+			}
+
+			goldenPath := filepath.Join("testdata", "specs", c.name+".golden.json")
+			if *update {
+				if err := os.WriteFile(goldenPath, append(got, '\n'), 0o644); err != nil {
+					t.Fatalf("write golden file error: %v", err)
+				}
+			}
+			expected, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("read golden file error: %v", err)
+			}
+			if string(expected) != string(got)+"\n" {
+				t.Errorf("rewritten spec mismatch golden file %s, run with -update and check the diff:\n%s", goldenPath, got)
+			}
+		})
+	}
+}
+
+// TestSpecRewriteRuleIPBoundary 测试按 IP 地址边界替换子串
+func TestSpecRewriteRuleIPBoundary(t *testing.T) {
+	v4 := SpecRewriteRule{Name: "pod-ip", Old: "10.0.0.5", New: "10.0.1.7", IPBoundary: true}
+	v6 := SpecRewriteRule{Name: "pod-ip", Old: "fd00::5", New: "fd00::1:7", IPBoundary: true}
+	cases := []struct {
+		rule     SpecRewriteRule
+		value    string
+		expected string
+		changed  bool
+	}{
+		{rule: v4, value: "10.0.0.5", expected: "10.0.1.7", changed: true},
+		{rule: v4, value: "10.0.0.5:8080", expected: "10.0.1.7:8080", changed: true},
+		{rule: v4, value: "http://10.0.0.5/healthz", expected: "http://10.0.1.7/healthz", changed: true},
+		{rule: v4, value: "10.0.0.5,10.0.0.6", expected: "10.0.1.7,10.0.0.6", changed: true},
+		{rule: v4, value: "listen on 10.0.0.5.", expected: "listen on 10.0.1.7.", changed: true},
+		{rule: v4, value: "--bind=10.0.0.5 --peer=10.0.0.5", expected: "--bind=10.0.1.7 --peer=10.0.1.7", changed: true},
+		{rule: v4, value: "10.0.0.50", expected: "10.0.0.50"},
+		{rule: v4, value: "110.0.0.5", expected: "110.0.0.5"},
+		{rule: v4, value: "10.0.0.5.1", expected: "10.0.0.5.1"},
+		{rule: v4, value: "1.10.0.0.5", expected: "1.10.0.0.5"},
+		{rule: v4, value: "10.0.0.50,10.0.0.5", expected: "10.0.0.50,10.0.1.7", changed: true},
+		{rule: v6, value: "[fd00::5]:8080", expected: "[fd00::1:7]:8080", changed: true},
+		{rule: v6, value: "fd00::50", expected: "fd00::50"},
+		{rule: v6, value: "fd00::5:1", expected: "fd00::5:1"},
+		{rule: v6, value: "afd00::5", expected: "afd00::5"},
+	}
+	for _, c := range cases {
+		got, changed := c.rule.apply(c.value)
+		if got != c.expected || changed != c.changed {
+			t.Errorf(
+				"apply %q to %q: expected %q, %t, got %q, %t",
+				c.rule.Old, c.value, c.expected, c.changed, got, changed,
+			)
+		}
+	}
+}
+
+// TestSpecRewriteRuleExact 测试完全匹配规则
+func TestSpecRewriteRuleExact(t *testing.T) {
+	rule := SpecRewriteRule{Name: "pod-name", Old: "web-0", New: "web-1", Exact: true}
+	cases := map[string]string{
+		"web-0":   "web-1",
+		"web-0-a": "web-0-a",
+		"a-web-0": "a-web-0",
+	}
+	for value, expected := range cases {
+		if got, _ := rule.apply(value); !reflect.DeepEqual(got, expected) {
+			t.Errorf("apply to %q: expected %q, got %q", value, expected, got)
+		}
+	}
+}
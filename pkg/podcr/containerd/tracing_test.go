@@ -0,0 +1,101 @@
+package containerd
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+	"github.com/yhlooo/podmig/pkg/podcr/metrics"
+)
+
+// setupInMemoryTracing 设置将 span 同步导出到内存的全局 TracerProvider ，测试结束时恢复
+func setupInMemoryTracing(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		_ = tp.Shutdown(context.Background())
+		otel.SetTracerProvider(prev)
+	})
+	return exporter
+}
+
+// TestCheckpointRestoreTrace 测试检查点和还原的 span 树，还原 span 通过检查点中的 trace 上下文以检查点 span 为父 span
+func TestCheckpointRestoreTrace(t *testing.T) {
+	exporter := setupInMemoryTracing(t)
+	ctx := context.Background()
+
+	src := newTestNode(t)
+	src.runTestPod(t, ctx, []byte("heap"))
+	archive := &bytes.Buffer{}
+	tw := tar.NewWriter(archive)
+	if err := src.mgr.Checkpoint(ctx, "cp1", testPodNamespace, testPodName, tw, common.CheckpointOptions{}); err != nil {
+		t.Fatalf("checkpoint error: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar writer error: %v", err)
+	}
+	dst := newTestNode(t)
+	if err := dst.mgr.Restore(ctx, tar.NewReader(archive), common.RestoreOptions{
+		PodUID:        testRestoredUID,
+		SkipPreflight: true,
+	}); err != nil {
+		t.Fatalf("restore error: %v", err)
+	}
+
+	spans := exporter.GetSpans().Snapshots()
+	byName := make(map[string]sdktrace.ReadOnlySpan, len(spans))
+	for _, s := range spans {
+		byName[s.Name()] = s
+	}
+	checkpointSpan, ok := byName[metrics.OperationCheckpoint]
+	if !ok {
+		t.Fatalf("checkpoint span not found")
+	}
+	restoreSpan, ok := byName[metrics.OperationRestore]
+	if !ok {
+		t.Fatalf("restore span not found")
+	}
+
+	// 检查点 span 为根 span ，还原 span 的父 span 为检查点 span
+	if checkpointSpan.Parent().IsValid() {
+		t.Errorf("expected checkpoint span to be root, got parent %s", checkpointSpan.Parent().SpanID())
+	}
+	if restoreSpan.Parent().SpanID() != checkpointSpan.SpanContext().SpanID() {
+		t.Errorf("expected restore span parent %s, got %s",
+			checkpointSpan.SpanContext().SpanID(), restoreSpan.Parent().SpanID())
+	}
+
+	// 所有 span 属于同一个 trace ，各阶段 span 为所属操作 span 的子 span
+	expectedParents := map[string]sdktrace.ReadOnlySpan{
+		phaseExportSandbox: checkpointSpan,
+		phaseCheckpointContainer + "/" + testContainerName: checkpointSpan,
+		phaseExportContainer + "/" + testContainerName:     checkpointSpan,
+		phaseImport:         restoreSpan,
+		phaseRestoreSandbox: restoreSpan,
+		phaseRestoreContainer + "/" + testContainerName: restoreSpan,
+	}
+	for name, parent := range expectedParents {
+		s, ok := byName[name]
+		if !ok {
+			t.Errorf("span %q not found", name)
+			continue
+		}
+		if s.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("expected parent of span %q to be %q, got %s", name, parent.Name(), s.Parent().SpanID())
+		}
+	}
+	traceID := checkpointSpan.SpanContext().TraceID()
+	for _, s := range spans {
+		if s.SpanContext().TraceID() != traceID {
+			t.Errorf("span %q not in checkpoint trace %s", s.Name(), traceID)
+		}
+	}
+}
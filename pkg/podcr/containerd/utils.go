@@ -1,18 +1,31 @@
 package containerd
 
 import (
+	"encoding/json"
+
 	ociruntime "github.com/opencontainers/runtime-spec/specs-go"
 	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
 )
 
+// 检查点 tar 格式版本
+//
+// 版本 0 为未记录格式版本的检查点，可能没有 checkpoint_info.json ；
+// 版本 1 写入带格式版本的 checkpoint_info.json ，记录网络、卷等信息；
+// tar 中条目的顺序为 sandbox_info.json 、 checkpoint_info.json 、容器检查点、沙盒共享内存、 kubelet Pod 目录
 const (
-	mediaTypeContainerSpec = "application/vnd.containerd.container.checkpoint.config.v1+proto"
+	archiveFormatVersionLegacy  = 0
+	archiveFormatVersionV1      = 1
+	currentArchiveFormatVersion = archiveFormatVersionV1
 )
 
 // SandboxInfo 沙盒信息
 type SandboxInfo struct {
 	// 沙盒 ID
 	ID string `json:"id"`
+	// 沙盒 IP 地址，来自 runtimev1.PodSandboxStatus.Network ，第一个为主 IP
+	IPs []string `json:"ips,omitempty"`
 
 	// 以下字段是 runtimev1.PodSandboxStatusResponse.Info["info"] 的部分结构
 
@@ -22,4 +35,53 @@ type SandboxInfo struct {
 	Config *runtimev1.PodSandboxConfig `json:"config,omitempty"`
 	// 沙盒运行时配置
 	RuntimeSpec *ociruntime.Spec `json:"runtimeSpec,omitempty"`
+	// 沙盒网络命名空间的 CNI 配置结果
+	CNIResult json.RawMessage `json:"cniResult,omitempty"`
+}
+
+// CheckpointInfo 检查点信息
+type CheckpointInfo struct {
+	// 检查点 tar 格式版本
+	FormatVersion int `json:"formatVersion"`
+	// 检查点 ID
+	ID string `json:"id"`
+	// 网络信息
+	Network *NetworkInfo `json:"network,omitempty"`
+	// kubelet Pod 目录
+	KubeletPodDir string `json:"kubeletPodDir,omitempty"`
+	// kubelet Pod 目录中的卷
+	Volumes []VolumeInfo `json:"volumes,omitempty"`
+	// 源节点指纹
+	Node *NodeFingerprint `json:"node,omitempty"`
+	// 容器使用的基础镜像
+	BaseImages []string `json:"baseImages,omitempty"`
+	// 按创建时间排序的容器，记录各容器是转储内存还是重新创建
+	Containers []ContainerInfo `json:"containers,omitempty"`
+	// 建立检查点的 trace 上下文，还原时作为父 span 使检查点和还原属于同一个 trace
+	TraceContext map[string]string `json:"traceContext,omitempty"`
+}
+
+// NetworkInfo 检查点网络信息
+type NetworkInfo struct {
+	// 网络模式
+	Mode common.NetworkMode `json:"mode"`
+	// 源 Pod IP 地址，第一个为主 IP
+	IPs []string `json:"ips,omitempty"`
+	// 检查点中是否转储了已建立的 TCP 连接
+	TCPEstablished bool `json:"tcpEstablished,omitempty"`
+}
+
+// getPodSandboxIPs 获取沙盒状态中的 IP 地址列表，第一个为主 IP
+func getPodSandboxIPs(status *runtimev1.PodSandboxStatus) []string {
+	network := status.GetNetwork()
+	if network.GetIp() == "" {
+		return nil
+	}
+	ips := []string{network.GetIp()}
+	for _, ip := range network.GetAdditionalIps() {
+		if ip.GetIp() != "" {
+			ips = append(ips, ip.GetIp())
+		}
+	}
+	return ips
 }
@@ -0,0 +1,363 @@
+package containerd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+)
+
+const (
+	kubeletPodVolumesDirName        = "volumes"
+	kubeletPodVolumeSubpathsDirName = "volume-subpaths"
+	emptyDirVolumePlugin            = "kubernetes.io/empty-dir"
+)
+
+// defaultVolumePolicies 各卷插件默认的卷数据处理策略，未列出的卷插件（多为网络存储）默认不拷贝
+//
+// secret 和 projected 卷中包含绑定到源 Pod UID 和节点的 ServiceAccount token 等敏感数据，默认由 kubelet 重新投射
+var defaultVolumePolicies = map[string]common.VolumePolicy{
+	emptyDirVolumePlugin:         common.VolumePolicyCopy,
+	"kubernetes.io/configmap":    common.VolumePolicyCopy,
+	"kubernetes.io/secret":       common.VolumePolicyRematerialize,
+	"kubernetes.io/projected":    common.VolumePolicyRematerialize,
+	"kubernetes.io/downward-api": common.VolumePolicyCopy,
+	"kubernetes.io/git-repo":     common.VolumePolicyCopy,
+	"kubernetes.io/local-volume": common.VolumePolicySkip,
+}
+
+// projectedVolumePlugins kubelet 基于 API 对象投射内容的卷插件
+var projectedVolumePlugins = map[string]bool{
+	"kubernetes.io/configmap":    true,
+	"kubernetes.io/secret":       true,
+	"kubernetes.io/projected":    true,
+	"kubernetes.io/downward-api": true,
+}
+
+// VolumeInfo 检查点中卷的信息
+type VolumeInfo struct {
+	// 卷名
+	Name string `json:"name"`
+	// 卷插件名，如 kubernetes.io/empty-dir
+	Plugin string `json:"plugin"`
+	// 卷数据处理策略
+	Policy common.VolumePolicy `json:"policy"`
+	// 卷相对于 kubelet Pod 目录的路径
+	Path string `json:"path"`
+	// 建立检查点时卷是否为挂载点
+	MountPoint bool `json:"mountPoint,omitempty"`
+	// 卷存储介质，内存介质（ tmpfs ）的 emptyDir 卷为 Memory
+	Medium string `json:"medium,omitempty"`
+	// 内存介质卷的 tmpfs 大小（字节），为 0 表示未知
+	SizeBytes int64 `json:"sizeBytes,omitempty"`
+}
+
+// DataExcluded 返回检查点中是否不包含卷数据
+func (v VolumeInfo) DataExcluded() bool {
+	return v.Policy == common.VolumePolicySkip || v.Policy == common.VolumePolicyRematerialize
+}
+
+// getVolumePolicy 获取卷插件的卷数据处理策略
+func getVolumePolicy(plugin string, opts common.CheckpointOptions) common.VolumePolicy {
+	if policy, ok := opts.VolumePolicies[plugin]; ok {
+		return policy
+	}
+	policy, ok := defaultVolumePolicies[plugin]
+	if !ok {
+		return common.VolumePolicySkip
+	}
+	if policy == common.VolumePolicyRematerialize && opts.IncludeSecrets {
+		return common.VolumePolicyCopy
+	}
+	return policy
+}
+
+// decideVolumes 列出 kubelet Pod 目录中的卷，并确定各卷的数据处理策略
+func (c *Checkpoint) decideVolumes(ctx context.Context) ([]VolumeInfo, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	volumesDir := filepath.Join(c.kubeletPodDir, kubeletPodVolumesDirName)
+	pluginDirs, err := os.ReadDir(volumesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read dir %q error: %w", volumesDir, err)
+	}
+
+	var volumes []VolumeInfo
+	for _, pluginDir := range pluginDirs {
+		if !pluginDir.IsDir() {
+			continue
+		}
+		// kubelet 将插件名中的 / 转义为 ~
+		plugin := strings.ReplaceAll(pluginDir.Name(), "~", "/")
+		policy := getVolumePolicy(plugin, c.opts)
+		volumeDirs, err := os.ReadDir(filepath.Join(volumesDir, pluginDir.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read dir %q error: %w", filepath.Join(volumesDir, pluginDir.Name()), err)
+		}
+		for _, volumeDir := range volumeDirs {
+			relPath := filepath.Join(kubeletPodVolumesDirName, pluginDir.Name(), volumeDir.Name())
+			mountPoint, err := c.isMountPoint(filepath.Join(c.kubeletPodDir, relPath))
+			if err != nil {
+				return nil, err
+			}
+			volume := VolumeInfo{
+				Name:       volumeDir.Name(),
+				Plugin:     plugin,
+				Policy:     policy,
+				Path:       relPath,
+				MountPoint: mountPoint,
+			}
+			if plugin == emptyDirVolumePlugin && mountPoint {
+				tmpfs, size, err := getTmpfsInfo(filepath.Join(c.kubeletPodDir, relPath))
+				if err != nil {
+					return nil, err
+				}
+				if tmpfs {
+					volume.Medium = volumeMediumMemory
+					volume.SizeBytes = size
+				}
+			}
+			logger.Info(fmt.Sprintf("volume %q (%s): %s", volume.Name, volume.Plugin, volume.Policy))
+			volumes = append(volumes, volume)
+		}
+	}
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].Path < volumes[j].Path
+	})
+
+	return volumes, nil
+}
+
+// kubeletPodDirWalkAction 导出 kubelet Pod 目录时对目录的处理方式
+type kubeletPodDirWalkAction int
+
+const (
+	// 进入目录
+	kubeletPodDirWalkDescend kubeletPodDirWalkAction = iota
+	// 仅导出目录本身，不导出目录内容
+	kubeletPodDirWalkSkipContent
+)
+
+// getKubeletPodDirWalkAction 确定导出 kubelet Pod 目录时对目录的处理方式
+func (c *Checkpoint) getKubeletPodDirWalkAction(path string) (kubeletPodDirWalkAction, string, error) {
+	relPath, err := filepath.Rel(c.kubeletPodDir, path)
+	if err != nil || relPath == "." {
+		return kubeletPodDirWalkDescend, "", err
+	}
+	parts := strings.Split(relPath, string(filepath.Separator))
+
+	// 找到所属的卷
+	var volume *VolumeInfo
+	isVolumeRoot := false
+	switch {
+	case parts[0] == kubeletPodVolumesDirName && len(parts) >= 3:
+		// volumes/<plugin>/<name>
+		volume = c.findVolume(strings.ReplaceAll(parts[1], "~", "/"), parts[2])
+		isVolumeRoot = len(parts) == 3
+	case parts[0] == kubeletPodVolumeSubpathsDirName && len(parts) >= 2:
+		// volume-subpaths/<name>/<container>/<index>
+		volume = c.findVolume("", parts[1])
+		isVolumeRoot = len(parts) <= 4
+	}
+	if volume != nil && volume.DataExcluded() {
+		return kubeletPodDirWalkSkipContent, fmt.Sprintf("volume %q policy is %s", volume.Name, volume.Policy), nil
+	}
+
+	// 挂载点
+	mountPoint, err := c.isMountPoint(path)
+	if err != nil || !mountPoint {
+		return kubeletPodDirWalkDescend, "", err
+	}
+	switch {
+	case c.opts.FollowMounts:
+	case volume != nil && volume.Policy == common.VolumePolicySnapshot:
+	case volume != nil && volume.Policy == common.VolumePolicyCopy && isVolumeRoot:
+	default:
+		return kubeletPodDirWalkSkipContent, "mount point", nil
+	}
+	return kubeletPodDirWalkDescend, "", nil
+}
+
+// prepareVolumes 确定 kubelet Pod 目录及其中各卷的处理方式
+func (c *Checkpoint) prepareVolumes(ctx context.Context) error {
+	var err error
+	c.kubeletPodDir, err = c.getKubeletPodDir(ctx)
+	if err != nil {
+		return fmt.Errorf("get kubelet pod dir error: %w", err)
+	}
+	c.volumes, err = c.decideVolumes(ctx)
+	return err
+}
+
+// isMountPoint 判断路径是否为挂载点，第一次调用时读取挂载点
+func (c *Checkpoint) isMountPoint(path string) (bool, error) {
+	if c.mountPoints == nil {
+		mounts, err := getMountPoints()
+		if err != nil {
+			return false, err
+		}
+		c.mountPoints = mounts
+	}
+	return c.mountPoints.contains(path)
+}
+
+// findVolume 根据插件名和卷名找到卷，插件名为空时仅匹配卷名
+func (c *Checkpoint) findVolume(plugin, name string) *VolumeInfo {
+	for i, volume := range c.volumes {
+		if volume.Name == name && (plugin == "" || volume.Plugin == plugin) {
+			return &c.volumes[i]
+		}
+	}
+	return nil
+}
+
+// reportVolumes 报告检查点中各卷的处理策略，并检查未拷贝的卷是否已在目标节点挂载
+func (r *Restore) reportVolumes(ctx context.Context) {
+	if r.srcCheckpointInfo == nil || len(r.srcCheckpointInfo.Volumes) == 0 {
+		return
+	}
+	logger := logr.FromContextOrDiscard(ctx)
+
+	kubeletPodDir := r.targetKubeletPodPath(r.srcCheckpointInfo.KubeletPodDir)
+	for _, volume := range r.srcCheckpointInfo.Volumes {
+		path := filepath.Join(kubeletPodDir, volume.Path)
+		switch volume.Policy {
+		case common.VolumePolicySkip:
+			mountPoint, err := isMountPoint(path)
+			if err == nil && !mountPoint {
+				err = fmt.Errorf("%q is not a mount point", path)
+			}
+			if err != nil {
+				logger.Error(err, fmt.Sprintf(
+					"volume %q (%s) is not included in checkpoint and not mounted, "+
+						"it should be attached before containers are restored",
+					volume.Name, volume.Plugin,
+				))
+				continue
+			}
+			logger.Info(fmt.Sprintf("volume %q (%s) is not included in checkpoint, mounted at %q",
+				volume.Name, volume.Plugin, path))
+		case common.VolumePolicyRematerialize:
+			logger.Info(fmt.Sprintf(
+				"volume %q (%s) is not included in checkpoint, waiting for kubelet to project it to %q",
+				volume.Name, volume.Plugin, path,
+			))
+		case common.VolumePolicySnapshot:
+			logger.Info(fmt.Sprintf(
+				"volume %q (%s) is restored from a point-in-time snapshot to %q",
+				volume.Name, volume.Plugin, path,
+			))
+		default:
+			if r.shouldRematerializeVolume(volume) {
+				logger.Info(fmt.Sprintf(
+					"volume %q (%s) is not restored from checkpoint, waiting for kubelet to project it to %q",
+					volume.Name, volume.Plugin, path,
+				))
+				continue
+			}
+			logger.Info(fmt.Sprintf("volume %q (%s) is restored to %q", volume.Name, volume.Plugin, path))
+		}
+	}
+}
+
+// shouldRematerializeVolume 判断还原时是否应等待 kubelet 重新投射卷内容
+func (r *Restore) shouldRematerializeVolume(volume VolumeInfo) bool {
+	if volume.Policy == common.VolumePolicyRematerialize {
+		return true
+	}
+	return r.opts.RematerializeVolumes && projectedVolumePlugins[volume.Plugin]
+}
+
+// findVolumeByPath 根据检查点中 kubelet Pod 目录下的文件路径找到所属的卷
+func (r *Restore) findVolumeByPath(path string) *VolumeInfo {
+	if r.srcCheckpointInfo == nil || r.srcCheckpointInfo.KubeletPodDir == "" {
+		return nil
+	}
+	relPath, err := filepath.Rel(r.srcCheckpointInfo.KubeletPodDir, path)
+	if err != nil {
+		return nil
+	}
+	for i, volume := range r.srcCheckpointInfo.Volumes {
+		if relPath == volume.Path || strings.HasPrefix(relPath, volume.Path+string(filepath.Separator)) {
+			return &r.srcCheckpointInfo.Volumes[i]
+		}
+	}
+	return nil
+}
+
+// waitVolumes 等待 kubelet 在目标节点重新投射卷内容
+//
+// 不会主动触发 kubelet 投射： kubelet 只为绑定到本节点的 Pod 挂载卷，
+// 因此调用方需要在等待超时前将 UID 为 RestoreOptions.PodUID 的 Pod 绑定到本节点。
+// 无法提前绑定时（如先还原再交接 Pod 对象的迁移），应在建立检查点时拷贝 secret 等卷的数据，
+// 并在还原时关闭重新投射，由 kubelet 在 Pod 绑定后原地更新卷内容
+func (r *Restore) waitVolumes(ctx context.Context) error {
+	if r.srcCheckpointInfo == nil {
+		return nil
+	}
+	logger := logr.FromContextOrDiscard(ctx)
+
+	var volumes []VolumeInfo
+	for _, volume := range r.srcCheckpointInfo.Volumes {
+		if r.shouldRematerializeVolume(volume) {
+			volumes = append(volumes, volume)
+		}
+	}
+	if len(volumes) == 0 {
+		return nil
+	}
+
+	timeout := r.opts.VolumeWaitTimeout
+	if timeout <= 0 {
+		timeout = common.DefaultVolumeWaitTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	kubeletPodDir := r.targetKubeletPodPath(r.srcCheckpointInfo.KubeletPodDir)
+	for {
+		var names []string
+		var pending []VolumeInfo
+		for _, volume := range volumes {
+			if !isVolumeProjected(filepath.Join(kubeletPodDir, volume.Path)) {
+				names = append(names, volume.Name)
+				pending = append(pending, volume)
+			}
+		}
+		volumes = pending
+		if len(volumes) == 0 {
+			break
+		}
+		logger.Info(fmt.Sprintf("wait for kubelet to project volumes: %v", names))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf(
+				"wait for volumes %v error: %w (kubelet only projects volumes of pods bound to this node, "+
+					"bind pod %q to this node, or checkpoint with --include-secrets to archive these volumes)",
+				names, ctx.Err(), r.opts.PodUID,
+			)
+		case <-time.After(time.Second):
+		}
+	}
+	logger.Info("all volumes are projected")
+
+	return nil
+}
+
+// isVolumeProjected 判断 kubelet 是否已投射卷内容（卷为挂载点或非空目录）
+func isVolumeProjected(path string) bool {
+	if mountPoint, err := isMountPoint(path); err == nil && mountPoint {
+		return true
+	}
+	entries, err := os.ReadDir(path)
+	return err == nil && len(entries) > 0
+}
@@ -0,0 +1,82 @@
+package containerd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+)
+
+// TestWaitVolumesTimeout 测试等待超时时错误中列出仍未投射的卷，并提示使用 --include-secrets 将其归档
+func TestWaitVolumesTimeout(t *testing.T) {
+	kubeletPodsDir := t.TempDir()
+	r := &Restore{
+		opts: common.RestoreOptions{
+			PodUID:            "uid-new",
+			VolumeWaitTimeout: 10 * time.Millisecond,
+		},
+		kubeletPodsDir: kubeletPodsDir,
+		srcCheckpointInfo: &CheckpointInfo{
+			KubeletPodDir: "/var/lib/kubelet/pods/uid-old",
+			Volumes: []VolumeInfo{
+				{
+					Name:   "token",
+					Plugin: "kubernetes.io/secret",
+					Policy: common.VolumePolicyRematerialize,
+					Path:   "volumes/kubernetes.io~secret/token",
+				},
+				{
+					Name:   "kube-api-access",
+					Plugin: "kubernetes.io/projected",
+					Policy: common.VolumePolicyRematerialize,
+					Path:   "volumes/kubernetes.io~projected/kube-api-access",
+				},
+				{
+					Name:   "projected",
+					Plugin: "kubernetes.io/projected",
+					Policy: common.VolumePolicyRematerialize,
+					Path:   "volumes/kubernetes.io~projected/projected",
+				},
+				{
+					Name:   "config",
+					Plugin: "kubernetes.io/configmap",
+					Policy: common.VolumePolicyCopy,
+					Path:   "volumes/kubernetes.io~configmap/config",
+				},
+			},
+		},
+	}
+
+	// 已投射的卷
+	projected := filepath.Join(kubeletPodsDir, "uid-new", "volumes/kubernetes.io~projected/projected")
+	if err := os.MkdirAll(projected, 0o755); err != nil {
+		t.Fatalf("make dir error: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(projected, "ca.crt"), []byte("ca"), 0o644); err != nil {
+		t.Fatalf("write file error: %v", err)
+	}
+
+	err := r.waitVolumes(context.Background())
+	if err == nil {
+		t.Fatalf("expected timeout error, got nil")
+	}
+	if !strings.Contains(err.Error(), "wait for volumes [token kube-api-access] error") {
+		t.Errorf("expected not projected volumes in error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "--include-secrets") {
+		t.Errorf("expected --include-secrets suggested in error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "--rematerialize-volumes") {
+		t.Errorf("expected no --rematerialize-volumes suggested in error, got %v", err)
+	}
+
+	// 卷都已投射
+	r.srcCheckpointInfo.Volumes = r.srcCheckpointInfo.Volumes[2:]
+	if err := r.waitVolumes(context.Background()); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
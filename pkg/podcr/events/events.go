@@ -0,0 +1,263 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+)
+
+// Type 事件类型
+type Type string
+
+// Type 的可选值
+const (
+	// TypePhaseStart 阶段开始
+	TypePhaseStart Type = "phase_start"
+	// TypePhaseEnd 阶段结束
+	TypePhaseEnd Type = "phase_end"
+	// TypeContainerCheckpointed 容器检查点已导出
+	TypeContainerCheckpointed Type = "container_checkpointed"
+	// TypeContainerSkipped 容器未转储，还原时将使用原始镜像重新创建
+	TypeContainerSkipped Type = "container_skipped"
+	// TypeSandboxRestored 沙盒已还原
+	TypeSandboxRestored Type = "sandbox_restored"
+	// TypeContainerRestored 容器已还原
+	TypeContainerRestored Type = "container_restored"
+	// TypeRestorePlan 还原计划，仅 restore --dry-run 输出
+	TypeRestorePlan Type = "restore_plan"
+	// TypeResult 最终结果
+	TypeResult Type = "result"
+	// TypeBatchResult 批量操作的最终结果
+	TypeBatchResult Type = "batch_result"
+)
+
+// Event 进度事件
+type Event struct {
+	// 事件时间
+	Time time.Time `json:"time"`
+	// 事件类型
+	Type Type `json:"type"`
+	// Pod 的 命名空间/名称 ，仅批量操作中的事件有
+	Pod string `json:"pod,omitempty"`
+	// 阶段名
+	Phase string `json:"phase,omitempty"`
+	// 容器名
+	Container string `json:"container,omitempty"`
+	// 容器或沙盒 ID
+	ID string `json:"id,omitempty"`
+	// 耗时（毫秒）
+	DurationMS int64 `json:"durationMs,omitempty"`
+	// 字节数
+	Bytes int64 `json:"bytes,omitempty"`
+	// 错误信息
+	Error string `json:"error,omitempty"`
+	// 还原计划，仅 TypeRestorePlan 事件有
+	RestorePlan *common.RestorePlan `json:"restorePlan,omitempty"`
+	// 最终结果，仅 TypeResult 事件有
+	Result *Result `json:"result,omitempty"`
+	// 批量操作的最终结果，仅 TypeBatchResult 事件有
+	BatchResult *BatchResult `json:"batchResult,omitempty"`
+}
+
+// Result checkpoint 或 restore 的最终结果
+type Result struct {
+	// 操作， checkpoint 或 restore
+	Operation string `json:"operation"`
+	// 是否成功
+	Success bool `json:"success"`
+	// 错误信息
+	Error string `json:"error,omitempty"`
+	// 检查点文件路径
+	ArchivePath string `json:"archivePath,omitempty"`
+	// 检查点 ID
+	CheckpointID string `json:"checkpointID,omitempty"`
+	// 还原的沙盒 ID
+	SandboxID string `json:"sandboxID,omitempty"`
+	// 以容器名为键的还原的容器 ID
+	ContainerIDs map[string]string `json:"containerIDs,omitempty"`
+	// 导出的字节数
+	BytesExported int64 `json:"bytesExported,omitempty"`
+	// 导入的字节数
+	BytesImported int64 `json:"bytesImported,omitempty"`
+	// 总耗时（毫秒）
+	DurationMS int64 `json:"durationMs"`
+}
+
+// BatchResult 批量操作的最终结果
+type BatchResult struct {
+	// 操作， checkpoint 或 restore
+	Operation string `json:"operation"`
+	// Pod 总数
+	Total int `json:"total"`
+	// 成功的 Pod 数
+	Succeeded int `json:"succeeded"`
+	// 失败的 Pod 数
+	Failed int `json:"failed"`
+	// 总耗时（毫秒）
+	DurationMS int64 `json:"durationMs"`
+}
+
+// Recorder 事件记录器
+type Recorder interface {
+	// Record 记录事件
+	Record(event Event)
+}
+
+type recorderKey struct{}
+
+// NewContext 将事件记录器注入上下文
+func NewContext(parent context.Context, recorder Recorder) context.Context {
+	return context.WithValue(parent, recorderKey{}, recorder)
+}
+
+// FromContextOrDiscard 从上下文获取事件记录器，上下文中没有时返回丢弃所有事件的记录器
+func FromContextOrDiscard(ctx context.Context) Recorder {
+	if recorder, ok := ctx.Value(recorderKey{}).(Recorder); ok {
+		return recorder
+	}
+	return discard{}
+}
+
+// Enabled 上下文中是否有事件记录器
+func Enabled(ctx context.Context) bool {
+	_, ok := ctx.Value(recorderKey{}).(Recorder)
+	return ok
+}
+
+// Record 记录事件，未设置事件时间时使用当前时间
+func Record(ctx context.Context, event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	FromContextOrDiscard(ctx).Record(event)
+}
+
+// StartPhase 记录阶段开始，返回记录阶段结束的函数
+func StartPhase(ctx context.Context, phase string) func(err error) {
+	start := time.Now()
+	Record(ctx, Event{Time: start, Type: TypePhaseStart, Phase: phase})
+	return func(err error) {
+		end := Event{
+			Type:       TypePhaseEnd,
+			Phase:      phase,
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			end.Error = err.Error()
+		}
+		Record(ctx, end)
+	}
+}
+
+// Phase 执行 fn 并记录阶段开始和结束，返回 fn 的错误
+func Phase(ctx context.Context, phase string, fn func(ctx context.Context) error) error {
+	end := StartPhase(ctx, phase)
+	err := fn(ctx)
+	end(err)
+	return err
+}
+
+// discard 丢弃所有事件的记录器
+type discard struct{}
+
+// Record 记录事件
+func (discard) Record(Event) {}
+
+// WithPod 返回为所有事件设置 Pod 字段后转发给 next 的记录器
+func WithPod(next Recorder, pod string) Recorder {
+	return podRecorder{next: next, pod: pod}
+}
+
+// podRecorder 为所有事件设置 Pod 字段的记录器
+type podRecorder struct {
+	next Recorder
+	pod  string
+}
+
+// Record 记录事件
+func (r podRecorder) Record(event Event) {
+	event.Pod = r.pod
+	r.next.Record(event)
+}
+
+// JSONRecorder 将事件以 NDJSON 格式写入 io.Writer 的记录器
+type JSONRecorder struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+}
+
+var _ Recorder = &JSONRecorder{}
+
+// NewJSONRecorder 创建一个 *JSONRecorder
+func NewJSONRecorder(w io.Writer) *JSONRecorder {
+	return &JSONRecorder{enc: json.NewEncoder(w)}
+}
+
+// Record 记录事件
+func (r *JSONRecorder) Record(event Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	_ = r.enc.Encode(event)
+}
+
+// Summarizer 汇总事件生成最终结果的记录器，同时将事件转发给下一个记录器
+type Summarizer struct {
+	lock   sync.Mutex
+	next   Recorder
+	start  time.Time
+	result Result
+}
+
+var _ Recorder = &Summarizer{}
+
+// NewSummarizer 创建一个 *Summarizer
+func NewSummarizer(operation string, next Recorder) *Summarizer {
+	if next == nil {
+		next = discard{}
+	}
+	return &Summarizer{
+		next:   next,
+		start:  time.Now(),
+		result: Result{Operation: operation},
+	}
+}
+
+// Record 记录事件
+func (s *Summarizer) Record(event Event) {
+	s.lock.Lock()
+	switch event.Type {
+	case TypeSandboxRestored:
+		s.result.SandboxID = event.ID
+	case TypeContainerRestored:
+		if s.result.ContainerIDs == nil {
+			s.result.ContainerIDs = make(map[string]string)
+		}
+		s.result.ContainerIDs[event.Container] = event.ID
+	}
+	s.lock.Unlock()
+	s.next.Record(event)
+}
+
+// Finish 记录最终结果事件，并返回最终结果
+//
+// update 用于补充只有调用方知道的结果字段，如检查点文件路径
+func (s *Summarizer) Finish(err error, update func(result *Result)) Result {
+	s.lock.Lock()
+	result := s.result
+	s.lock.Unlock()
+
+	result.Success = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.DurationMS = time.Since(s.start).Milliseconds()
+	if update != nil {
+		update(&result)
+	}
+	s.next.Record(Event{Time: time.Now(), Type: TypeResult, Result: &result})
+	return result
+}
@@ -0,0 +1,324 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+)
+
+const namespace = "podmig"
+
+// 操作名
+const (
+	OperationCheckpoint = "checkpoint"
+	OperationRestore    = "restore"
+)
+
+// 检查点镜像传输方向
+const (
+	DirectionExport = "export"
+	DirectionImport = "import"
+)
+
+// Registry podmig 指标注册到的注册表，不包括 Go 运行时和进程指标
+var Registry = prometheus.NewRegistry()
+
+// runtimeRegistry Go 运行时和进程指标注册到的注册表，仅通过 HTTP 暴露
+//
+// node-exporter 自身会导出同名的 go_* 和 process_* 指标，不能写入 textfile
+var runtimeRegistry = prometheus.NewRegistry()
+
+var (
+	// OperationDuration 检查点、还原操作耗时
+	OperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of pod checkpoint/restore operations.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"operation", "success"})
+	// PhaseFailures 各阶段失败次数
+	PhaseFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "phase_failures_total",
+		Help:      "Number of failed pod checkpoint/restore phases.",
+	}, []string{"operation", "phase"})
+	// ContainerFreezeDuration 容器进程被暂停的时长
+	ContainerFreezeDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "container_freeze_duration_seconds",
+		Help:      "Duration for which container processes are paused during checkpoint.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	})
+	// ContainerCheckpointDuration 容器建立检查点耗时
+	ContainerCheckpointDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "container_checkpoint_duration_seconds",
+		Help:      "Duration of checkpointing a single container.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	})
+	// ContainerRestoreDuration 容器还原耗时
+	ContainerRestoreDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "container_restore_duration_seconds",
+		Help:      "Duration of restoring a single container.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	})
+	// SandboxRestoreDuration 沙盒还原耗时
+	SandboxRestoreDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sandbox_restore_duration_seconds",
+		Help:      "Duration of restoring a pod sandbox until it is ready.",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 10),
+	})
+	// ImageTransferBytes 导出、导入的检查点镜像字节数
+	ImageTransferBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "checkpoint_image_transfer_bytes_total",
+		Help:      "Bytes of container checkpoint images exported or imported.",
+	}, []string{"direction"})
+	// ImageTransferDuration 导出、导入检查点镜像耗时
+	ImageTransferDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "checkpoint_image_transfer_duration_seconds",
+		Help:      "Duration of exporting or importing a container checkpoint image.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"direction"})
+	// ArchiveSize 检查点文件大小
+	ArchiveSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "archive_size_bytes",
+		Help:      "Size of pod checkpoint archives written or read.",
+		Buckets:   prometheus.ExponentialBuckets(1<<20, 4, 10),
+	}, []string{"operation"})
+)
+
+func init() {
+	runtimeRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	Registry.MustRegister(
+		OperationDuration,
+		PhaseFailures,
+		ContainerFreezeDuration,
+		ContainerCheckpointDuration,
+		ContainerRestoreDuration,
+		SandboxRestoreDuration,
+		ImageTransferBytes,
+		ImageTransferDuration,
+		ArchiveSize,
+	)
+}
+
+// ObserveOperation 记录从 start 开始的操作耗时
+func ObserveOperation(operation string, start time.Time, err error) {
+	OperationDuration.WithLabelValues(operation, strconv.FormatBool(err == nil)).Observe(time.Since(start).Seconds())
+}
+
+// ObserveImageTransfer 记录从 start 开始的检查点镜像导出或导入
+func ObserveImageTransfer(direction string, start time.Time, bytes int64) {
+	ImageTransferDuration.WithLabelValues(direction).Observe(time.Since(start).Seconds())
+	ImageTransferBytes.WithLabelValues(direction).Add(float64(bytes))
+}
+
+// Handler 返回暴露指标的 HTTP 处理器
+func Handler() http.Handler {
+	return promhttp.HandlerFor(prometheus.Gatherers{Registry, runtimeRegistry}, promhttp.HandlerOpts{})
+}
+
+// Serve 在 addr 上通过 HTTP 暴露指标，直到 ctx 结束
+func Serve(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	go func() {
+		_ = server.Serve(l)
+	}()
+	return nil
+}
+
+// WriteTextfile 将本次运行的 podmig 指标累加到 path 中已有的指标上，以文本格式写入 path ，
+// 可用于 node-exporter 的 textfile collector
+//
+// pcrctl 每次运行都是新的进程，计数器和直方图从零开始，与文件中已有的值累加后才能跨运行持续增长，
+// 因此每个进程只应写入一次。写入先写临时文件再重命名，不会被读到写入一半的内容，
+// 但多个进程同时写入时可能丢失其中一个进程的指标
+func WriteTextfile(path string) error {
+	return writeTextfile(path, Registry)
+}
+
+// writeTextfile 将 gatherer 收集的指标累加到 path 中已有的指标上，以文本格式写入 path
+func writeTextfile(path string, gatherer prometheus.Gatherer) error {
+	families, err := gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("gather metrics error: %w", err)
+	}
+	prev, err := readTextfile(path)
+	if err != nil {
+		return err
+	}
+	families = mergeMetricFamilies(prev, families)
+
+	buf := &bytes.Buffer{}
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(buf, mf); err != nil {
+			return fmt.Errorf("encode metric family %q error: %w", mf.GetName(), err)
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file error: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write temp file error: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp file error: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("chmod temp file error: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readTextfile 读取 path 中已有的 podmig 指标，文件不存在时返回空
+//
+// 其它指标（如旧版本写入的 go_* 和 process_* ）被丢弃
+func readTextfile(path string) (map[string]*dto.MetricFamily, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open metrics file %q error: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+	families, err := (&expfmt.TextParser{}).TextToMetricFamilies(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse metrics file %q error: %w", path, err)
+	}
+	for name := range families {
+		if !strings.HasPrefix(name, namespace+"_") {
+			delete(families, name)
+		}
+	}
+	return families, nil
+}
+
+// mergeMetricFamilies 将 cur 中的计数器和直方图累加到 prev 中同名、同标签的指标上，返回按名称排序的结果
+//
+// 类型不同的同名指标以 cur 为准；直方图的桶不同时以 cur 为准
+func mergeMetricFamilies(prev map[string]*dto.MetricFamily, cur []*dto.MetricFamily) []*dto.MetricFamily {
+	merged := make(map[string]*dto.MetricFamily, len(prev)+len(cur))
+	for name, mf := range prev {
+		merged[name] = mf
+	}
+	for _, mf := range cur {
+		old, ok := merged[mf.GetName()]
+		if !ok || old.GetType() != mf.GetType() {
+			merged[mf.GetName()] = mf
+			continue
+		}
+		metrics := make(map[string]*dto.Metric, len(old.Metric)+len(mf.Metric))
+		for _, m := range old.Metric {
+			metrics[labelsKey(m)] = m
+		}
+		for _, m := range mf.Metric {
+			key := labelsKey(m)
+			if o, ok := metrics[key]; ok {
+				addMetric(m, o)
+			}
+			metrics[key] = m
+		}
+		mf.Metric = make([]*dto.Metric, 0, len(metrics))
+		for _, m := range metrics {
+			mf.Metric = append(mf.Metric, m)
+		}
+		sort.Slice(mf.Metric, func(i, j int) bool {
+			return labelsKey(mf.Metric[i]) < labelsKey(mf.Metric[j])
+		})
+		merged[mf.GetName()] = mf
+	}
+
+	ret := make([]*dto.MetricFamily, 0, len(merged))
+	for _, mf := range merged {
+		ret = append(ret, mf)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].GetName() < ret[j].GetName()
+	})
+	return ret
+}
+
+// addMetric 将 prev 的计数器或直方图的值累加到 m 上
+func addMetric(m, prev *dto.Metric) {
+	switch {
+	case m.Counter != nil && prev.Counter != nil:
+		m.Counter.Value = proto.Float64(m.Counter.GetValue() + prev.Counter.GetValue())
+	case m.Histogram != nil && prev.Histogram != nil:
+		// 从文本解析的直方图包含 +Inf 桶，收集的直方图不包含
+		h, p := m.Histogram, prev.Histogram
+		buckets, prevBuckets := finiteBuckets(h.Bucket), finiteBuckets(p.Bucket)
+		if len(buckets) != len(prevBuckets) {
+			return
+		}
+		for i, b := range buckets {
+			if b.GetUpperBound() != prevBuckets[i].GetUpperBound() {
+				return
+			}
+		}
+		for i, b := range buckets {
+			b.CumulativeCount = proto.Uint64(b.GetCumulativeCount() + prevBuckets[i].GetCumulativeCount())
+		}
+		h.Bucket = buckets
+		h.SampleCount = proto.Uint64(h.GetSampleCount() + p.GetSampleCount())
+		h.SampleSum = proto.Float64(h.GetSampleSum() + p.GetSampleSum())
+	}
+}
+
+// finiteBuckets 返回上界不为 +Inf 的桶
+func finiteBuckets(buckets []*dto.Bucket) []*dto.Bucket {
+	ret := make([]*dto.Bucket, 0, len(buckets))
+	for _, b := range buckets {
+		if !math.IsInf(b.GetUpperBound(), 1) {
+			ret = append(ret, b)
+		}
+	}
+	return ret
+}
+
+// labelsKey 返回指标标签的唯一标识
+func labelsKey(m *dto.Metric) string {
+	pairs := make([]string, 0, len(m.Label))
+	for _, l := range m.Label {
+		pairs = append(pairs, l.GetName()+"="+strconv.Quote(l.GetValue()))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
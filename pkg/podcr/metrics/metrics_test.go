@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TestWriteTextfileOnlyPodmigMetrics 测试写入 textfile 的只有 podmig 指标，不包括与 node-exporter 同名的 Go 运行时和进程指标
+func TestWriteTextfileOnlyPodmigMetrics(t *testing.T) {
+	PhaseFailures.WithLabelValues(OperationCheckpoint, "export-sandbox").Inc()
+	path := filepath.Join(t.TempDir(), "podmig.prom")
+	if err := WriteTextfile(path); err != nil {
+		t.Fatalf("write textfile error: %v", err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read textfile error: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		name := strings.TrimPrefix(strings.TrimPrefix(line, "# HELP "), "# TYPE ")
+		if !strings.HasPrefix(name, namespace+"_") {
+			t.Errorf("unexpected non podmig metric line in textfile: %q", line)
+		}
+	}
+	expected := `podmig_phase_failures_total{operation="checkpoint",phase="export-sandbox"} 1`
+	if !strings.Contains(string(raw), expected) {
+		t.Errorf("expected %q in textfile, got:\n%s", expected, raw)
+	}
+}
+
+// TestWriteTextfileAccumulates 测试多次运行写入 textfile 时计数器和直方图与文件中已有的值累加
+func TestWriteTextfileAccumulates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "podmig.prom")
+	// 旧版本写入的 Go 运行时指标被丢弃
+	if err := os.WriteFile(path, []byte("# TYPE go_goroutines gauge\ngo_goroutines 8\n"), 0o644); err != nil {
+		t.Fatalf("write textfile error: %v", err)
+	}
+
+	// run 模拟一次 pcrctl 运行，从零开始记录指标并写入 textfile
+	run := func(failures map[string]float64, durations ...float64) {
+		registry := prometheus.NewRegistry()
+		counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "phase_failures_total",
+			Help:      "Number of failed pod checkpoint/restore phases.",
+		}, []string{"phase"})
+		histogram := prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of pod checkpoint/restore operations.",
+			Buckets:   []float64{1, 10},
+		})
+		registry.MustRegister(counter, histogram)
+		for phase, n := range failures {
+			counter.WithLabelValues(phase).Add(n)
+		}
+		for _, d := range durations {
+			histogram.Observe(d)
+		}
+		if err := writeTextfile(path, registry); err != nil {
+			t.Fatalf("write textfile error: %v", err)
+		}
+	}
+	run(map[string]float64{"import": 1, "preflight": 2}, 0.5, 5)
+	run(map[string]float64{"import": 3}, 20)
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read textfile error: %v", err)
+	}
+	got := string(raw)
+	for _, expected := range []string{
+		`podmig_phase_failures_total{phase="import"} 4`,
+		`podmig_phase_failures_total{phase="preflight"} 2`,
+		`podmig_operation_duration_seconds_bucket{le="1"} 1`,
+		`podmig_operation_duration_seconds_bucket{le="10"} 2`,
+		`podmig_operation_duration_seconds_bucket{le="+Inf"} 3`,
+		`podmig_operation_duration_seconds_sum 25.5`,
+		`podmig_operation_duration_seconds_count 3`,
+	} {
+		if !strings.Contains(got, expected+"\n") {
+			t.Errorf("expected %q in textfile, got:\n%s", expected, got)
+		}
+	}
+	if strings.Contains(got, "go_goroutines") {
+		t.Errorf("expected go_goroutines dropped from textfile, got:\n%s", got)
+	}
+}
@@ -0,0 +1,43 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+)
+
+// AnnotationIPRequester 通过沙盒注解请求 CNI 分配指定 IP 的 common.IPRequester 实现
+//
+// containerd 会将沙盒注解通过 io.kubernetes.cri.pod-annotations 能力传递给 CNI 插件，
+// 适用于支持从该能力中读取 IP 的 CNI 插件（如 calico 的 cni.projectcalico.org/ipAddrs ）
+type AnnotationIPRequester struct {
+	// 注解键，值为 IP 列表的 JSON 数组
+	Key string
+}
+
+var _ common.IPRequester = &AnnotationIPRequester{}
+
+// NewAnnotationIPRequester 创建一个 *AnnotationIPRequester
+func NewAnnotationIPRequester(key string) *AnnotationIPRequester {
+	return &AnnotationIPRequester{Key: key}
+}
+
+// RequestIPs 在创建沙盒前调用，通过修改沙盒配置请求 CNI 分配指定 IP
+func (r *AnnotationIPRequester) RequestIPs(_ context.Context, config *runtimev1.PodSandboxConfig, ips []string) error {
+	if r.Key == "" {
+		return fmt.Errorf("annotation key is empty")
+	}
+	raw, err := json.Marshal(ips)
+	if err != nil {
+		return fmt.Errorf("marshal ips to json error: %w", err)
+	}
+	if config.Annotations == nil {
+		config.Annotations = make(map[string]string)
+	}
+	config.Annotations[r.Key] = string(raw)
+	return nil
+}
@@ -0,0 +1,44 @@
+package network
+
+import (
+	"context"
+	"sync"
+
+	runtimev1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/yhlooo/podmig/pkg/podcr/common"
+)
+
+// FakeIPRequester 用于测试的 common.IPRequester 实现，记录所有请求
+type FakeIPRequester struct {
+	// RequestIPs 返回的错误
+	Err error
+
+	lock     sync.Mutex
+	requests [][]string
+}
+
+var _ common.IPRequester = &FakeIPRequester{}
+
+// NewFakeIPRequester 创建一个 *FakeIPRequester
+func NewFakeIPRequester() *FakeIPRequester {
+	return &FakeIPRequester{}
+}
+
+// RequestIPs 记录请求的 IP
+func (r *FakeIPRequester) RequestIPs(_ context.Context, _ *runtimev1.PodSandboxConfig, ips []string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.Err != nil {
+		return r.Err
+	}
+	r.requests = append(r.requests, append([]string(nil), ips...))
+	return nil
+}
+
+// Requests 返回所有请求过的 IP 列表
+func (r *FakeIPRequester) Requests() [][]string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([][]string(nil), r.requests...)
+}
@@ -0,0 +1,221 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	podcrcommon "github.com/yhlooo/podmig/pkg/podcr/common"
+)
+
+// maxManifestSize 镜像清单和索引的最大大小
+const maxManifestSize = 4 << 20
+
+// NewRemote 创建一个读取镜像 ref 中检查点的 *Remote ，检查点下载到 dir 中
+func NewRemote(ref string, resolver remotes.Resolver, dir string) *Remote {
+	return &Remote{
+		ref:      ref,
+		resolver: resolver,
+		cache:    New(dir),
+	}
+}
+
+// Remote 基于镜像仓库的只读检查点存储
+//
+// 镜像清单（或镜像索引中的各个清单）的每一层为一个检查点文件，
+// 层的 org.opencontainers.image.title 注解为检查点文件在目录存储中的相对路径，
+// 即 <namespace>/<name>/<建立时间>_<检查点 ID>.tar.gz ，
+// 如在目录存储根目录中执行 oras push REF <namespace>/<name>/*.tar.gz 推送的镜像。
+// 检查点在校验时才下载，下载后按目录存储的结构保存
+type Remote struct {
+	ref      string
+	resolver remotes.Resolver
+	cache    *Store
+
+	fetcher remotes.Fetcher
+	// 检查点下载路径到镜像层的映射，为 nil 时还未读取镜像清单
+	layers map[string]ocispec.Descriptor
+}
+
+// List 列出 Pod 的检查点，按建立时间从早到晚排序
+//
+// 返回的检查点路径为下载路径，校验前不存在
+func (r *Remote) List(ctx context.Context, pod podcrcommon.PodKey) ([]Entry, error) {
+	if err := r.load(ctx); err != nil {
+		return nil, err
+	}
+	podDir := r.cache.podDir(pod)
+	var entries []Entry
+	for path := range r.layers {
+		if filepath.Dir(path) != podDir {
+			continue
+		}
+		if entry, ok := parseEntry(pod, podDir, filepath.Base(path)); ok {
+			entries = append(entries, entry)
+		}
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// Verify 下载检查点并校验检查点文件完整
+//
+// 下载时校验镜像层的摘要，已下载的检查点不再下载
+func (r *Remote) Verify(ctx context.Context, entry *Entry) error {
+	if err := r.load(ctx); err != nil {
+		return err
+	}
+	desc, ok := r.layers[entry.Path]
+	if !ok {
+		return fmt.Errorf("%w: checkpoint %q not in image %q", ErrNotFound, entry.Path, r.ref)
+	}
+	if _, err := os.Stat(entry.Path); os.IsNotExist(err) {
+		if err := r.download(ctx, desc, entry); err != nil {
+			return err
+		}
+	}
+	return r.cache.Verify(entry)
+}
+
+// load 读取镜像清单，记录其中的检查点
+func (r *Remote) load(ctx context.Context) error {
+	if r.layers != nil {
+		return nil
+	}
+	name, desc, err := r.resolver.Resolve(ctx, r.ref)
+	if err != nil {
+		return fmt.Errorf("resolve image %q error: %w", r.ref, err)
+	}
+	r.fetcher, err = r.resolver.Fetcher(ctx, name)
+	if err != nil {
+		return fmt.Errorf("get fetcher for image %q error: %w", r.ref, err)
+	}
+	layers := map[string]ocispec.Descriptor{}
+	if err := r.walk(ctx, desc, layers); err != nil {
+		return err
+	}
+	r.layers = layers
+	return nil
+}
+
+// walk 遍历镜像清单或索引，将带标题的层按下载路径记录到 layers
+func (r *Remote) walk(ctx context.Context, desc ocispec.Descriptor, layers map[string]ocispec.Descriptor) error {
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageIndex, images.MediaTypeDockerSchema2ManifestList:
+		var index ocispec.Index
+		if err := r.fetchJSON(ctx, desc, &index); err != nil {
+			return err
+		}
+		for _, manifest := range index.Manifests {
+			if err := r.walk(ctx, manifest, layers); err != nil {
+				return err
+			}
+		}
+	case ocispec.MediaTypeImageManifest, images.MediaTypeDockerSchema2Manifest:
+		var manifest ocispec.Manifest
+		if err := r.fetchJSON(ctx, desc, &manifest); err != nil {
+			return err
+		}
+		for _, layer := range manifest.Layers {
+			path, ok := r.layerPath(layer)
+			if !ok {
+				continue
+			}
+			layers[path] = layer
+		}
+	default:
+		return fmt.Errorf("unsupported media type %q of %s in image %q", desc.MediaType, desc.Digest, r.ref)
+	}
+	return nil
+}
+
+// layerPath 返回镜像层对应检查点的下载路径，层的标题不是 <namespace>/<name>/<文件名> 时返回 false
+func (r *Remote) layerPath(layer ocispec.Descriptor) (string, bool) {
+	parts := strings.Split(layer.Annotations[ocispec.AnnotationTitle], "/")
+	if len(parts) != 3 {
+		return "", false
+	}
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			return "", false
+		}
+	}
+	pod := podcrcommon.PodKey{Namespace: parts[0], Name: parts[1]}
+	entry, ok := parseEntry(pod, r.cache.podDir(pod), parts[2])
+	return entry.Path, ok
+}
+
+// fetchJSON 下载镜像清单或索引并解析
+func (r *Remote) fetchJSON(ctx context.Context, desc ocispec.Descriptor, v interface{}) error {
+	if desc.Size > maxManifestSize {
+		return fmt.Errorf("size %d of %s in image %q exceeds %d", desc.Size, desc.Digest, r.ref, maxManifestSize)
+	}
+	rc, err := r.fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return fmt.Errorf("fetch %s of image %q error: %w", desc.Digest, r.ref, err)
+	}
+	defer func() { _ = rc.Close() }()
+	data, err := io.ReadAll(io.LimitReader(rc, desc.Size))
+	if err != nil {
+		return fmt.Errorf("read %s of image %q error: %w", desc.Digest, r.ref, err)
+	}
+	if int64(len(data)) != desc.Size || desc.Digest.Algorithm().FromBytes(data) != desc.Digest {
+		return fmt.Errorf("content of %s in image %q mismatch", desc.Digest, r.ref)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("unmarshal %s of image %q error: %w", desc.Digest, r.ref, err)
+	}
+	return nil
+}
+
+// download 下载镜像层到检查点路径
+//
+// 写入时使用 .partial 后缀，摘要一致时重命名
+func (r *Remote) download(ctx context.Context, desc ocispec.Descriptor, entry *Entry) error {
+	podDir := r.cache.podDir(entry.Pod)
+	if err := os.MkdirAll(podDir, 0755); err != nil {
+		return fmt.Errorf("make dir %q error: %w", podDir, err)
+	}
+	partial := entry.Path + partialSuffix
+	if err := r.fetchTo(ctx, desc, partial); err != nil {
+		_ = os.Remove(partial)
+		return err
+	}
+	if err := os.Rename(partial, entry.Path); err != nil {
+		_ = os.Remove(partial)
+		return fmt.Errorf("rename %q to %q error: %w", partial, entry.Path, err)
+	}
+	return nil
+}
+
+// fetchTo 下载镜像层到文件 path 并校验摘要
+func (r *Remote) fetchTo(ctx context.Context, desc ocispec.Descriptor, path string) error {
+	rc, err := r.fetcher.Fetch(ctx, desc)
+	if err != nil {
+		return fmt.Errorf("fetch %s of image %q error: %w", desc.Digest, r.ref, err)
+	}
+	defer func() { _ = rc.Close() }()
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create file %q error: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	verifier := desc.Digest.Verifier()
+	n, err := io.Copy(io.MultiWriter(f, verifier), io.LimitReader(rc, desc.Size))
+	if err != nil {
+		return fmt.Errorf("download %s of image %q to %q error: %w", desc.Digest, r.ref, path, err)
+	}
+	if n != desc.Size || !verifier.Verified() {
+		return fmt.Errorf("downloaded %s of image %q is truncated or corrupted", desc.Digest, r.ref)
+	}
+	return f.Close()
+}
@@ -0,0 +1,212 @@
+package store
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	podcrcommon "github.com/yhlooo/podmig/pkg/podcr/common"
+)
+
+const (
+	// archiveSuffix 检查点文件后缀
+	archiveSuffix = ".tar.gz"
+	// partialSuffix 写入中的检查点文件后缀
+	partialSuffix = ".partial"
+	// timeFormat 检查点文件名中的时间格式
+	timeFormat = "20060102T150405Z"
+)
+
+// ErrNotFound 存储中没有 Pod 的检查点
+var ErrNotFound = errors.New("checkpoint not found")
+
+// Entry 存储中的检查点
+type Entry struct {
+	// 所属 Pod
+	Pod podcrcommon.PodKey
+	// 检查点 ID
+	CheckpointID string
+	// 建立时间
+	CreatedAt time.Time
+	// 检查点文件路径
+	Path string
+}
+
+// New 创建一个以 dir 为根目录的 *Store
+func New(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Store 基于目录的检查点存储
+//
+// 检查点文件按 <dir>/<namespace>/<name>/<建立时间>_<检查点 ID>.tar.gz 保存，
+// 写入时使用 .partial 后缀，写入完成后重命名，未完成的检查点不会被列出
+type Store struct {
+	dir string
+}
+
+// Put 将 Pod 的检查点写入存储
+//
+// write 将检查点写入给定路径，失败时删除已写入的部分
+func (s *Store) Put(
+	pod podcrcommon.PodKey,
+	checkpointID string,
+	createdAt time.Time,
+	write func(path string) error,
+) (*Entry, error) {
+	podDir := s.podDir(pod)
+	if err := os.MkdirAll(podDir, 0755); err != nil {
+		return nil, fmt.Errorf("make dir %q error: %w", podDir, err)
+	}
+	entry := &Entry{
+		Pod:          pod,
+		CheckpointID: checkpointID,
+		CreatedAt:    createdAt.UTC().Truncate(time.Second),
+	}
+	entry.Path = filepath.Join(podDir, entry.CreatedAt.Format(timeFormat)+"_"+checkpointID+archiveSuffix)
+
+	partial := entry.Path + partialSuffix
+	if err := write(partial); err != nil {
+		_ = os.Remove(partial)
+		return nil, err
+	}
+	if err := os.Rename(partial, entry.Path); err != nil {
+		_ = os.Remove(partial)
+		return nil, fmt.Errorf("rename %q to %q error: %w", partial, entry.Path, err)
+	}
+	return entry, nil
+}
+
+// List 列出 Pod 的检查点，按建立时间从早到晚排序
+func (s *Store) List(pod podcrcommon.PodKey) ([]Entry, error) {
+	podDir := s.podDir(pod)
+	files, err := os.ReadDir(podDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read dir %q error: %w", podDir, err)
+	}
+	var entries []Entry
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if entry, ok := parseEntry(pod, podDir, f.Name()); ok {
+			entries = append(entries, entry)
+		}
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// Latest 获取 Pod 最新的检查点，没有时返回 ErrNotFound
+func (s *Store) Latest(pod podcrcommon.PodKey) (*Entry, error) {
+	entries, err := s.List(pod)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w for pod %q in store %q", ErrNotFound, pod, s.dir)
+	}
+	return &entries[len(entries)-1], nil
+}
+
+// Prune 只保留 Pod 最新的 keep 个检查点，返回删除的检查点
+func (s *Store) Prune(pod podcrcommon.PodKey, keep int) ([]Entry, error) {
+	entries, err := s.List(pod)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) <= keep {
+		return nil, nil
+	}
+	var removed []Entry
+	for _, entry := range entries[:len(entries)-keep] {
+		if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("remove checkpoint %q error: %w", entry.Path, err)
+		}
+		removed = append(removed, entry)
+	}
+	return removed, nil
+}
+
+// Verify 校验检查点文件完整，即可以作为 gzip 压缩的 tar 完整读取且不为空
+//
+// 可以发现写入中断、截断或损坏的检查点文件
+func (s *Store) Verify(entry *Entry) error {
+	f, err := os.Open(entry.Path)
+	if err != nil {
+		return fmt.Errorf("open checkpoint %q error: %w", entry.Path, err)
+	}
+	defer func() { _ = f.Close() }()
+	gzipR, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("open gzip reader for checkpoint %q error: %w", entry.Path, err)
+	}
+	defer func() { _ = gzipR.Close() }()
+
+	tr := tar.NewReader(gzipR)
+	files := 0
+	for {
+		_, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read checkpoint %q error: %w", entry.Path, err)
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("read checkpoint %q error: %w", entry.Path, err)
+		}
+		files++
+	}
+	// 读到 gzip 流末尾时才校验 CRC
+	if _, err := io.Copy(io.Discard, gzipR); err != nil {
+		return fmt.Errorf("read checkpoint %q error: %w", entry.Path, err)
+	}
+	if files == 0 {
+		return fmt.Errorf("checkpoint %q is empty", entry.Path)
+	}
+	return nil
+}
+
+// podDir 返回 Pod 的检查点目录
+func (s *Store) podDir(pod podcrcommon.PodKey) string {
+	return filepath.Join(s.dir, pod.Namespace, pod.Name)
+}
+
+// parseEntry 解析 Pod 检查点目录 podDir 中名为 name 的检查点文件，不是检查点文件时返回 false
+func parseEntry(pod podcrcommon.PodKey, podDir, name string) (Entry, bool) {
+	if !strings.HasSuffix(name, archiveSuffix) {
+		return Entry{}, false
+	}
+	timestamp, checkpointID, ok := strings.Cut(strings.TrimSuffix(name, archiveSuffix), "_")
+	if !ok {
+		return Entry{}, false
+	}
+	createdAt, err := time.Parse(timeFormat, timestamp)
+	if err != nil {
+		return Entry{}, false
+	}
+	return Entry{
+		Pod:          pod,
+		CheckpointID: checkpointID,
+		CreatedAt:    createdAt,
+		Path:         filepath.Join(podDir, name),
+	}, true
+}
+
+// sortEntries 将检查点按建立时间从早到晚排序
+func sortEntries(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+}
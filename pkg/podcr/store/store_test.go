@@ -0,0 +1,293 @@
+package store
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	podcrcommon "github.com/yhlooo/podmig/pkg/podcr/common"
+)
+
+var testPod = podcrcommon.PodKey{Namespace: "default", Name: "web-0"}
+
+// testTime 返回测试用的第 minute 分钟的时间
+func testTime(minute int) time.Time {
+	return time.Date(2024, 1, 1, 0, minute, 0, 0, time.UTC)
+}
+
+// testArchive 返回 gzip 压缩的包含 files 个文件的 tar
+func testArchive(t *testing.T, files int) []byte {
+	tarBuf := &bytes.Buffer{}
+	tw := tar.NewWriter(tarBuf)
+	for i := 0; i < files; i++ {
+		content := strings.Repeat("checkpoint", 100)
+		if err := tw.WriteHeader(&tar.Header{
+			Name: fmt.Sprintf("file-%d", i),
+			Mode: 0o644,
+			Size: int64(len(content)),
+		}); err != nil {
+			t.Fatalf("write tar header error: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("write tar error: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("close tar writer error: %v", err)
+	}
+	return gzipBytes(t, tarBuf.Bytes())
+}
+
+// gzipBytes 返回 gzip 压缩的 data
+func gzipBytes(t *testing.T, data []byte) []byte {
+	buf := &bytes.Buffer{}
+	gzipW := gzip.NewWriter(buf)
+	if _, err := gzipW.Write(data); err != nil {
+		t.Fatalf("write gzip error: %v", err)
+	}
+	if err := gzipW.Close(); err != nil {
+		t.Fatalf("close gzip writer error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// putTestCheckpoint 将内容为 data 的检查点写入存储
+func putTestCheckpoint(t *testing.T, s *Store, checkpointID string, createdAt time.Time, data []byte) *Entry {
+	entry, err := s.Put(testPod, checkpointID, createdAt, func(path string) error {
+		return os.WriteFile(path, data, 0o644)
+	})
+	if err != nil {
+		t.Fatalf("put checkpoint %q error: %v", checkpointID, err)
+	}
+	return entry
+}
+
+// entryIDs 返回检查点 ID 列表
+func entryIDs(entries []Entry) []string {
+	var ids []string
+	for _, entry := range entries {
+		ids = append(ids, entry.CheckpointID)
+	}
+	return ids
+}
+
+// TestPut 测试写入检查点时先写入 .partial 文件，完成后重命名，失败时删除已写入的部分
+func TestPut(t *testing.T) {
+	s := New(t.TempDir())
+	data := testArchive(t, 1)
+
+	var writtenPath string
+	entry, err := s.Put(testPod, "cp1", testTime(0), func(path string) error {
+		writtenPath = path
+		if !strings.HasSuffix(path, partialSuffix) {
+			t.Errorf("expected writing to %q suffixed file, got %q", partialSuffix, path)
+		}
+		// 写入中的检查点不会被列出
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return err
+		}
+		if entries, err := s.List(testPod); err != nil || len(entries) != 0 {
+			t.Errorf("expected no checkpoint listed while writing, got %v (error: %v)", entries, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("put checkpoint error: %v", err)
+	}
+	if writtenPath != entry.Path+partialSuffix {
+		t.Errorf("expected writing to %q, got %q", entry.Path+partialSuffix, writtenPath)
+	}
+	expectedPath := filepath.Join(s.dir, "default", "web-0", "20240101T000000Z_cp1.tar.gz")
+	if entry.Path != expectedPath {
+		t.Errorf("expected path %q, got %q", expectedPath, entry.Path)
+	}
+	if got, err := os.ReadFile(entry.Path); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("unexpected checkpoint content (error: %v)", err)
+	}
+	if _, err := os.Stat(writtenPath); !os.IsNotExist(err) {
+		t.Errorf("expected %q renamed, got stat error %v", writtenPath, err)
+	}
+
+	// 写入失败
+	writeErr := errors.New("write failed")
+	_, err = s.Put(testPod, "cp2", testTime(1), func(path string) error {
+		writtenPath = path
+		if err := os.WriteFile(path, data[:len(data)/2], 0o644); err != nil {
+			return err
+		}
+		return writeErr
+	})
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("expected error %v, got %v", writeErr, err)
+	}
+	if _, err := os.Stat(writtenPath); !os.IsNotExist(err) {
+		t.Errorf("expected partial checkpoint %q removed, got stat error %v", writtenPath, err)
+	}
+	entries, err := s.List(testPod)
+	if err != nil {
+		t.Fatalf("list checkpoints error: %v", err)
+	}
+	if ids := entryIDs(entries); len(ids) != 1 || ids[0] != "cp1" {
+		t.Errorf("expected checkpoints [cp1], got %v", ids)
+	}
+}
+
+// TestListAndLatest 测试按建立时间从早到晚列出检查点并忽略其它文件，以及获取最新的检查点
+func TestListAndLatest(t *testing.T) {
+	s := New(t.TempDir())
+
+	if _, err := s.Latest(testPod); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected %v from empty store, got %v", ErrNotFound, err)
+	}
+
+	data := testArchive(t, 1)
+	putTestCheckpoint(t, s, "cp2", testTime(5), data)
+	putTestCheckpoint(t, s, "cp3", testTime(10), data)
+	putTestCheckpoint(t, s, "cp1", testTime(0), data)
+	// 其它 Pod 的检查点
+	if _, err := s.Put(podcrcommon.PodKey{Namespace: "default", Name: "web-1"}, "other", testTime(20),
+		func(path string) error {
+			return os.WriteFile(path, data, 0o644)
+		},
+	); err != nil {
+		t.Fatalf("put checkpoint error: %v", err)
+	}
+	// 不是检查点的文件
+	podDir := s.podDir(testPod)
+	for _, name := range []string{
+		"20240101T003000Z_partial.tar.gz" + partialSuffix,
+		"notes.txt",
+		"invalid-time_cp.tar.gz",
+		"no-checkpoint-id.tar.gz",
+	} {
+		if err := os.WriteFile(filepath.Join(podDir, name), data, 0o644); err != nil {
+			t.Fatalf("write file error: %v", err)
+		}
+	}
+
+	entries, err := s.List(testPod)
+	if err != nil {
+		t.Fatalf("list checkpoints error: %v", err)
+	}
+	expected := []string{"cp1", "cp2", "cp3"}
+	if ids := entryIDs(entries); strings.Join(ids, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected checkpoints %v, got %v", expected, ids)
+	}
+	for i, entry := range entries {
+		if entry.Pod != testPod {
+			t.Errorf("expected pod %q of checkpoint %q, got %q", testPod, entry.CheckpointID, entry.Pod)
+		}
+		if i > 0 && !entries[i-1].CreatedAt.Before(entry.CreatedAt) {
+			t.Errorf("expected checkpoint %q created after %q", entry.CheckpointID, entries[i-1].CheckpointID)
+		}
+	}
+
+	latest, err := s.Latest(testPod)
+	if err != nil {
+		t.Fatalf("get latest checkpoint error: %v", err)
+	}
+	if latest.CheckpointID != "cp3" || !latest.CreatedAt.Equal(testTime(10)) {
+		t.Errorf("expected latest checkpoint cp3 created at %s, got %q created at %s",
+			testTime(10), latest.CheckpointID, latest.CreatedAt)
+	}
+}
+
+// TestPrune 测试只保留最新的 keep 个检查点
+func TestPrune(t *testing.T) {
+	cases := []struct {
+		name            string
+		keep            int
+		expectedRemoved []string
+		expectedKept    []string
+	}{
+		{name: "KeepSome", keep: 2, expectedRemoved: []string{"cp1", "cp2"}, expectedKept: []string{"cp3", "cp4"}},
+		{name: "KeepAll", keep: 4, expectedKept: []string{"cp1", "cp2", "cp3", "cp4"}},
+		{name: "KeepMore", keep: 10, expectedKept: []string{"cp1", "cp2", "cp3", "cp4"}},
+		{name: "KeepNone", keep: 0, expectedRemoved: []string{"cp1", "cp2", "cp3", "cp4"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := New(t.TempDir())
+			data := testArchive(t, 1)
+			for i, id := range []string{"cp1", "cp2", "cp3", "cp4"} {
+				putTestCheckpoint(t, s, id, testTime(i), data)
+			}
+
+			removed, err := s.Prune(testPod, c.keep)
+			if err != nil {
+				t.Fatalf("prune error: %v", err)
+			}
+			if ids := entryIDs(removed); strings.Join(ids, ",") != strings.Join(c.expectedRemoved, ",") {
+				t.Errorf("expected removed %v, got %v", c.expectedRemoved, ids)
+			}
+			for _, entry := range removed {
+				if _, err := os.Stat(entry.Path); !os.IsNotExist(err) {
+					t.Errorf("expected %q removed, got stat error %v", entry.Path, err)
+				}
+			}
+			entries, err := s.List(testPod)
+			if err != nil {
+				t.Fatalf("list checkpoints error: %v", err)
+			}
+			if ids := entryIDs(entries); strings.Join(ids, ",") != strings.Join(c.expectedKept, ",") {
+				t.Errorf("expected kept %v, got %v", c.expectedKept, ids)
+			}
+		})
+	}
+}
+
+// TestVerify 测试校验检查点时发现截断、损坏或为空的检查点文件
+func TestVerify(t *testing.T) {
+	valid := testArchive(t, 3)
+
+	// 解压后截断的 tar
+	tarBuf := &bytes.Buffer{}
+	gzipR, err := gzip.NewReader(bytes.NewReader(valid))
+	if err != nil {
+		t.Fatalf("open gzip reader error: %v", err)
+	}
+	if _, err := tarBuf.ReadFrom(gzipR); err != nil {
+		t.Fatalf("read gzip error: %v", err)
+	}
+	truncatedTar := gzipBytes(t, tarBuf.Bytes()[:tarBuf.Len()/2])
+
+	// 损坏 gzip 数据末尾的 CRC
+	corruptedCRC := bytes.Clone(valid)
+	corruptedCRC[len(corruptedCRC)-5] ^= 0xff
+
+	cases := []struct {
+		name        string
+		data        []byte
+		expectedErr string
+	}{
+		{name: "Valid", data: valid},
+		{name: "TruncatedGzip", data: valid[:len(valid)-10], expectedErr: "read checkpoint"},
+		{name: "TruncatedTar", data: truncatedTar, expectedErr: "read checkpoint"},
+		{name: "CorruptedCRC", data: corruptedCRC, expectedErr: "read checkpoint"},
+		{name: "NotGzip", data: []byte("not a checkpoint"), expectedErr: "open gzip reader"},
+		{name: "Empty", data: testArchive(t, 0), expectedErr: "is empty"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := New(t.TempDir())
+			entry := putTestCheckpoint(t, s, "cp1", testTime(0), c.data)
+			err := s.Verify(entry)
+			if c.expectedErr == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.expectedErr) {
+				t.Errorf("expected error containing %q, got %v", c.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName = "github.com/yhlooo/podmig/pkg/podcr"
+	// DefaultServiceName 默认服务名
+	DefaultServiceName = "podmig"
+)
+
+// propagator 用于在检查点中携带 trace 上下文的传播器
+//
+// 不使用全局传播器，保证未启用 tracing 时也能传递检查点中的 trace 上下文
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Options tracing 选项
+type Options struct {
+	// OTLP gRPC 接收端地址，为空时使用 OTEL_EXPORTER_OTLP_ENDPOINT 等环境变量
+	Endpoint string
+	// 是否不使用 TLS 连接接收端
+	Insecure bool
+	// 服务名
+	ServiceName string
+}
+
+// Setup 创建通过 OTLP 导出 span 的全局 TracerProvider ，返回用于导出剩余 span 并关闭的函数
+func Setup(ctx context.Context, opts Options) (func(ctx context.Context) error, error) {
+	var exporterOpts []otlptracegrpc.Option
+	if opts.Endpoint != "" {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithEndpoint(opts.Endpoint))
+	}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("create otlp trace exporter error: %w", err)
+	}
+	tp := newTracerProvider(opts.ServiceName, sdktrace.WithBatcher(exporter))
+	return tp.Shutdown, nil
+}
+
+// newTracerProvider 创建并设置全局 TracerProvider 和传播器
+func newTracerProvider(serviceName string, opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	opts = append(opts, sdktrace.WithResource(resource.NewSchemaless(
+		attribute.String("service.name", serviceName),
+	)))
+	tp := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagator)
+	return tp
+}
+
+// Start 使用全局 TracerProvider 创建 span
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// End 结束 span ， err 非空时将 span 标记为失败
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject 获取 ctx 中的 trace 上下文，用于写入检查点
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// Extract 将检查点中的 trace 上下文注入 ctx
+func Extract(ctx context.Context, traceContext map[string]string) context.Context {
+	if len(traceContext) == 0 {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier(traceContext))
+}
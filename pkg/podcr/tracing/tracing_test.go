@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// setupInMemory 创建将 span 同步导出到内存的全局 TracerProvider
+func setupInMemory(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := newTracerProvider("", sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	return exporter
+}
+
+// TestInjectExtract 测试通过检查点中的 trace 上下文在另一个进程中继续 trace
+func TestInjectExtract(t *testing.T) {
+	exporter := setupInMemory(t)
+
+	ctx, parent := Start(context.Background(), "checkpoint")
+	traceContext := Inject(ctx)
+	End(parent, nil)
+	if len(traceContext) == 0 {
+		t.Fatalf("expected trace context injected")
+	}
+
+	// 从空上下文还原 trace 上下文
+	ctx = Extract(context.Background(), traceContext)
+	_, child := Start(ctx, "restore")
+	End(child, errors.New("boom"))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	checkpointSpan, restoreSpan := spans[0], spans[1]
+	if restoreSpan.Parent.SpanID() != checkpointSpan.SpanContext.SpanID() {
+		t.Errorf("expected restore span parent %s, got %s",
+			checkpointSpan.SpanContext.SpanID(), restoreSpan.Parent.SpanID())
+	}
+	if restoreSpan.SpanContext.TraceID() != checkpointSpan.SpanContext.TraceID() {
+		t.Errorf("expected restore span in checkpoint trace")
+	}
+	if restoreSpan.Status.Code != codes.Error || restoreSpan.Status.Description != "boom" {
+		t.Errorf("expected restore span status error %q, got %+v", "boom", restoreSpan.Status)
+	}
+}
+
+// TestInjectWithoutSpan 测试没有 span 时不写入 trace 上下文，读取空 trace 上下文时不改变上下文
+func TestInjectWithoutSpan(t *testing.T) {
+	if traceContext := Inject(context.Background()); traceContext != nil {
+		t.Errorf("expected nil trace context, got %v", traceContext)
+	}
+	ctx := context.Background()
+	if got := Extract(ctx, nil); trace.SpanContextFromContext(got).IsValid() {
+		t.Errorf("expected no span context extracted")
+	}
+}
@@ -0,0 +1,136 @@
+package scheduling
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	corev1helpers "k8s.io/component-helpers/scheduling/corev1"
+)
+
+// filterFunc 判断节点能否运行 Pod ，不能时返回原因
+type filterFunc func(state *podState, node *nodeInfo) string
+
+// filters 依次执行的过滤
+var filters = []filterFunc{
+	filterSourceNode,
+	filterNodeReady,
+	filterNodeUnschedulable,
+	filterNodeAffinity,
+	filterTaintToleration,
+	filterResources,
+	filterPodAffinity,
+	filterTopologySpread,
+	filterFingerprint,
+}
+
+// runFilters 依次执行过滤，返回第一个不通过的原因
+func runFilters(state *podState, node *nodeInfo) string {
+	for _, filter := range filters {
+		if reason := filter(state, node); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+// filterSourceNode 排除 Pod 当前所在节点
+func filterSourceNode(state *podState, node *nodeInfo) string {
+	if node.node.Name == state.pod.Spec.NodeName {
+		return "source node"
+	}
+	return ""
+}
+
+// filterNodeReady 排除未就绪的节点
+func filterNodeReady(_ *podState, node *nodeInfo) string {
+	for _, cond := range node.node.Status.Conditions {
+		if cond.Type == corev1.NodeReady && cond.Status == corev1.ConditionTrue {
+			return ""
+		}
+	}
+	return "node(s) were not ready"
+}
+
+// filterNodeUnschedulable 排除不可调度的节点，容忍 node.kubernetes.io/unschedulable 污点的 Pod 除外
+func filterNodeUnschedulable(state *podState, node *nodeInfo) string {
+	if !node.node.Spec.Unschedulable {
+		return ""
+	}
+	if corev1helpers.TolerationsTolerateTaint(state.pod.Spec.Tolerations, &corev1.Taint{
+		Key:    corev1.TaintNodeUnschedulable,
+		Effect: corev1.TaintEffectNoSchedule,
+	}) {
+		return ""
+	}
+	return "node(s) were unschedulable"
+}
+
+// filterNodeAffinity 排除不满足 nodeSelector 和必须的节点亲和性的节点
+func filterNodeAffinity(state *podState, node *nodeInfo) string {
+	match, err := state.requiredAffinity.Match(node.node)
+	if err != nil {
+		return fmt.Sprintf("invalid node affinity: %v", err)
+	}
+	if !match {
+		return "node(s) didn't match Pod's node affinity/selector"
+	}
+	return ""
+}
+
+// filterTaintToleration 排除有 Pod 不容忍的 NoSchedule 、 NoExecute 污点的节点
+func filterTaintToleration(state *podState, node *nodeInfo) string {
+	taint, untolerated := corev1helpers.FindMatchingUntoleratedTaint(
+		node.node.Spec.Taints,
+		state.pod.Spec.Tolerations,
+		func(t *corev1.Taint) bool {
+			return t.Effect == corev1.TaintEffectNoSchedule || t.Effect == corev1.TaintEffectNoExecute
+		},
+	)
+	if untolerated {
+		return fmt.Sprintf("node(s) had untolerated taint {%s: %s}", taint.Key, taint.Value)
+	}
+	return ""
+}
+
+// filterResources 排除可分配资源不足的节点
+func filterResources(state *podState, node *nodeInfo) string {
+	if allowed := node.allocatable(corev1.ResourcePods); allowed > 0 && node.pods+1 > allowed {
+		return "Too many pods"
+	}
+	for name := range state.requests {
+		request := quantityValue(state.requests, name)
+		if request == 0 {
+			continue
+		}
+		if node.requestedOf(name)+request > node.allocatable(name) {
+			return fmt.Sprintf("Insufficient %s", name)
+		}
+	}
+	return ""
+}
+
+// filterPodAffinity 排除不满足必须的 Pod 间亲和性、反亲和性或违反已有 Pod 反亲和性的节点
+func filterPodAffinity(state *podState, node *nodeInfo) string {
+	switch {
+	case !state.podAffinity.satisfyExistingAntiAffinity(node.node):
+		return "node(s) didn't satisfy existing pods anti-affinity rules"
+	case !state.podAffinity.satisfyAntiAffinity(node.node):
+		return "node(s) didn't match pod anti-affinity rules"
+	case !state.podAffinity.satisfyAffinity(node.node):
+		return "node(s) didn't match pod affinity rules"
+	}
+	return ""
+}
+
+// filterTopologySpread 排除不满足 DoNotSchedule 的拓扑分布约束的节点
+func filterTopologySpread(state *podState, node *nodeInfo) string {
+	return state.topologySpread.satisfy(state.pod, node.node)
+}
+
+// filterFingerprint 排除检查点无法还原的节点
+func filterFingerprint(state *podState, node *nodeInfo) string {
+	if state.source == nil {
+		return ""
+	}
+	return node.fingerprint.Incompatible(state.source)
+}
@@ -0,0 +1,74 @@
+package scheduling
+
+import (
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// cpuFeatureLabelPrefix node-feature-discovery 标记 CPU 特性的节点标签前缀
+const cpuFeatureLabelPrefix = "feature.node.kubernetes.io/cpu-cpuid."
+
+// Fingerprint 从 Node 对象获取的节点指纹，是 pcrctl preflight 收集的节点指纹在集群视角下的子集
+type Fingerprint struct {
+	// 操作系统
+	OS string
+	// CPU 架构
+	Arch string
+	// 内核版本
+	KernelVersion string
+	// 容器运行时名
+	RuntimeName string
+	// 容器运行时版本
+	RuntimeVersion string
+	// CPU 特性，来自 node-feature-discovery 标签，已排序，未部署时为空
+	CPUFlags []string
+}
+
+// NodeFingerprint 获取节点指纹
+func NodeFingerprint(node *corev1.Node) *Fingerprint {
+	info := node.Status.NodeInfo
+	fp := &Fingerprint{
+		OS:            info.OperatingSystem,
+		Arch:          info.Architecture,
+		KernelVersion: info.KernelVersion,
+	}
+	// ContainerRuntimeVersion 格式为 <name>://<version>
+	fp.RuntimeName, fp.RuntimeVersion, _ = strings.Cut(info.ContainerRuntimeVersion, "://")
+	for key, value := range node.Labels {
+		if strings.HasPrefix(key, cpuFeatureLabelPrefix) && value == "true" {
+			fp.CPUFlags = append(fp.CPUFlags, strings.ToLower(strings.TrimPrefix(key, cpuFeatureLabelPrefix)))
+		}
+	}
+	sort.Strings(fp.CPUFlags)
+	return fp
+}
+
+// Incompatible 返回检查点从源节点 src 还原到本节点的阻断性不兼容原因，兼容时返回空
+//
+// 与 pcrctl preflight 的阻断项一致：架构、容器运行时不同或缺少 CPU 特性。
+// 源节点或本节点未部署 node-feature-discovery 时不检查 CPU 特性
+func (fp *Fingerprint) Incompatible(src *Fingerprint) string {
+	switch {
+	case src.OS != fp.OS:
+		return "node(s) had different operating system from source node"
+	case src.Arch != fp.Arch:
+		return "node(s) had different architecture from source node"
+	case src.RuntimeName != fp.RuntimeName:
+		return "node(s) had different container runtime from source node"
+	}
+	if len(src.CPUFlags) == 0 || len(fp.CPUFlags) == 0 {
+		return ""
+	}
+	flags := make(map[string]bool, len(fp.CPUFlags))
+	for _, flag := range fp.CPUFlags {
+		flags[flag] = true
+	}
+	for _, flag := range src.CPUFlags {
+		if !flags[flag] {
+			return "node(s) missing cpu features of source node"
+		}
+	}
+	return ""
+}
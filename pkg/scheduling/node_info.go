@@ -0,0 +1,156 @@
+package scheduling
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/component-helpers/scheduling/corev1/nodeaffinity"
+	resourcehelper "k8s.io/kubectl/pkg/util/resource"
+)
+
+// nodeInfo 节点及其上 Pod 已请求的资源
+type nodeInfo struct {
+	node *corev1.Node
+	// 节点上 Pod 请求的资源总和
+	requested corev1.ResourceList
+	// 节点上 Pod 数
+	pods int64
+	// 节点上的 Pod ，包含已选定该节点的 Pod
+	podList []*corev1.Pod
+	// 节点指纹
+	fingerprint *Fingerprint
+}
+
+// podState 待调度 Pod 的信息，在各节点间共用
+type podState struct {
+	pod *corev1.Pod
+	// Pod 请求的资源
+	requests corev1.ResourceList
+	// 必须满足的 nodeSelector 和节点亲和性
+	requiredAffinity nodeaffinity.RequiredNodeAffinity
+	// 偏好的节点亲和性
+	preferredAffinity *nodeaffinity.PreferredSchedulingTerms
+	// 源节点指纹，源节点不存在时为 nil
+	source *Fingerprint
+	// 必须满足的 Pod 间亲和性和反亲和性
+	podAffinity *podAffinityState
+	// 必须满足的拓扑分布约束
+	topologySpread *topologySpreadState
+}
+
+// buildNodeInfos 汇总各节点上 Pod 已请求的资源
+//
+// reserved 中的 Pod 计入其选定的节点，已出现在该节点上的除外； skip 指定的 Pod 不计入
+func buildNodeInfos(
+	nodes []corev1.Node,
+	pods []corev1.Pod,
+	reserved map[string]reservation,
+	skip string,
+) []*nodeInfo {
+	infos := make([]*nodeInfo, 0, len(nodes))
+	byName := make(map[string]*nodeInfo, len(nodes))
+	for i := range nodes {
+		info := &nodeInfo{
+			node:        &nodes[i],
+			requested:   corev1.ResourceList{},
+			fingerprint: NodeFingerprint(&nodes[i]),
+		}
+		infos = append(infos, info)
+		byName[nodes[i].Name] = info
+	}
+
+	add := func(node string, pod *corev1.Pod, requests corev1.ResourceList) {
+		info, ok := byName[node]
+		if !ok {
+			return
+		}
+		info.podList = append(info.podList, pod)
+		for name, q := range requests {
+			total := info.requested[name]
+			total.Add(q)
+			info.requested[name] = total
+		}
+		info.pods++
+	}
+	placed := make(map[string]string)
+	for i := range pods {
+		pod := &pods[i]
+		// 不依赖字段选择器，模拟客户端可能不支持
+		if pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		key := podKey(pod)
+		if key == skip {
+			continue
+		}
+		placed[key] = pod.Spec.NodeName
+		requests, _ := resourcehelper.PodRequestsAndLimits(pod)
+		add(pod.Spec.NodeName, pod, requests)
+	}
+	for key, r := range reserved {
+		if key == skip || placed[key] == r.node {
+			continue
+		}
+		add(r.node, r.pod, r.requests)
+	}
+	return infos
+}
+
+// newPodState 创建待调度 Pod 的信息， namespaces 为以命名空间名为键的命名空间标签
+func newPodState(pod *corev1.Pod, nodes []*nodeInfo, namespaces map[string]labels.Set) (*podState, error) {
+	state := &podState{
+		pod:              pod,
+		requiredAffinity: nodeaffinity.GetRequiredNodeAffinity(pod),
+	}
+	state.requests, _ = resourcehelper.PodRequestsAndLimits(pod)
+
+	if affinity := pod.Spec.Affinity; affinity != nil && affinity.NodeAffinity != nil {
+		terms := affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+		if len(terms) > 0 {
+			var err error
+			state.preferredAffinity, err = nodeaffinity.NewPreferredSchedulingTerms(terms)
+			if err != nil {
+				return nil, fmt.Errorf("parse preferred node affinity of pod %q error: %w", podKey(pod), err)
+			}
+		}
+	}
+
+	var err error
+	if state.podAffinity, err = newPodAffinityState(pod, nodes, namespaces); err != nil {
+		return nil, err
+	}
+	if state.topologySpread, err = newTopologySpreadState(pod, nodes); err != nil {
+		return nil, err
+	}
+
+	for _, node := range nodes {
+		if node.node.Name == pod.Spec.NodeName {
+			state.source = node.fingerprint
+			break
+		}
+	}
+	return state, nil
+}
+
+// allocatable 返回节点可分配的资源
+func (n *nodeInfo) allocatable(name corev1.ResourceName) int64 {
+	return quantityValue(n.node.Status.Allocatable, name)
+}
+
+// requestedOf 返回节点上 Pod 已请求的资源
+func (n *nodeInfo) requestedOf(name corev1.ResourceName) int64 {
+	return quantityValue(n.requested, name)
+}
+
+// quantityValue 返回资源数量， CPU 以毫核计
+func quantityValue(list corev1.ResourceList, name corev1.ResourceName) int64 {
+	q, ok := list[name]
+	if !ok {
+		return 0
+	}
+	if name == corev1.ResourceCPU {
+		return q.MilliValue()
+	}
+	return q.Value()
+}
@@ -0,0 +1,205 @@
+package scheduling
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// topologyPair 拓扑域，拓扑键和节点上该标签的值
+type topologyPair struct {
+	key   string
+	value string
+}
+
+// affinityTerm 解析后的 Pod 间亲和性条件
+type affinityTerm struct {
+	selector labels.Selector
+	// 显式指定的命名空间，与 namespaceSelector 匹配的命名空间取并集
+	namespaces        sets.Set[string]
+	namespaceSelector labels.Selector
+	topologyKey       string
+}
+
+// newAffinityTerms 解析 Pod pod 的 Pod 间亲和性条件
+//
+// 与 kube-scheduler 一致，未指定 namespaces 和 namespaceSelector 时仅匹配 pod 所在命名空间
+func newAffinityTerms(pod *corev1.Pod, terms []corev1.PodAffinityTerm) ([]affinityTerm, error) {
+	ret := make([]affinityTerm, 0, len(terms))
+	for i := range terms {
+		term := &terms[i]
+		selector, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("parse label selector of pod affinity term of pod %q error: %w", podKey(pod), err)
+		}
+		t := affinityTerm{
+			selector:    selector,
+			namespaces:  sets.New(term.Namespaces...),
+			topologyKey: term.TopologyKey,
+		}
+		if term.NamespaceSelector != nil {
+			t.namespaceSelector, err = metav1.LabelSelectorAsSelector(term.NamespaceSelector)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"parse namespace selector of pod affinity term of pod %q error: %w", podKey(pod), err,
+				)
+			}
+		} else if len(term.Namespaces) == 0 {
+			t.namespaces.Insert(pod.Namespace)
+		}
+		ret = append(ret, t)
+	}
+	return ret, nil
+}
+
+// matches 判断 Pod 是否与条件匹配， namespaces 为以命名空间名为键的命名空间标签
+func (t *affinityTerm) matches(pod *corev1.Pod, namespaces map[string]labels.Set) bool {
+	if !t.namespaces.Has(pod.Namespace) &&
+		(t.namespaceSelector == nil || !t.namespaceSelector.Matches(namespaces[pod.Namespace])) {
+		return false
+	}
+	return t.selector.Matches(labels.Set(pod.Labels))
+}
+
+// matchesAllAffinityTerms 判断 Pod 是否与所有条件匹配
+func matchesAllAffinityTerms(terms []affinityTerm, pod *corev1.Pod, namespaces map[string]labels.Set) bool {
+	if len(terms) == 0 {
+		return false
+	}
+	for i := range terms {
+		if !terms[i].matches(pod, namespaces) {
+			return false
+		}
+	}
+	return true
+}
+
+// podAffinityState 待调度 Pod 必须满足的 Pod 间亲和性和反亲和性，以及已有 Pod 的反亲和性
+type podAffinityState struct {
+	affinityTerms     []affinityTerm
+	antiAffinityTerms []affinityTerm
+	// 各拓扑域中与待调度 Pod 的所有亲和性条件匹配的 Pod 数
+	affinityCounts map[topologyPair]int64
+	// 各拓扑域中与待调度 Pod 的反亲和性条件匹配的 Pod 数
+	antiAffinityCounts map[topologyPair]int64
+	// 各拓扑域中反亲和性条件与待调度 Pod 匹配的已有 Pod 数
+	existingAntiAffinityCounts map[topologyPair]int64
+	// 待调度 Pod 与自身的所有亲和性条件匹配
+	selfAffinity bool
+}
+
+// newPodAffinityState 统计各节点上与 Pod 间亲和性、反亲和性条件相关的 Pod
+//
+// 只处理 requiredDuringSchedulingIgnoredDuringExecution ，统计方式与 kube-scheduler 的 InterPodAffinity 一致
+func newPodAffinityState(
+	pod *corev1.Pod,
+	nodes []*nodeInfo,
+	namespaces map[string]labels.Set,
+) (*podAffinityState, error) {
+	state := &podAffinityState{
+		affinityCounts:             make(map[topologyPair]int64),
+		antiAffinityCounts:         make(map[topologyPair]int64),
+		existingAntiAffinityCounts: make(map[topologyPair]int64),
+	}
+	if affinity := pod.Spec.Affinity; affinity != nil {
+		var err error
+		if affinity.PodAffinity != nil {
+			terms := affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+			if state.affinityTerms, err = newAffinityTerms(pod, terms); err != nil {
+				return nil, err
+			}
+		}
+		if affinity.PodAntiAffinity != nil {
+			terms := affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+			if state.antiAffinityTerms, err = newAffinityTerms(pod, terms); err != nil {
+				return nil, err
+			}
+		}
+	}
+	state.selfAffinity = matchesAllAffinityTerms(state.affinityTerms, pod, namespaces)
+
+	for _, node := range nodes {
+		nodeLabels := node.node.Labels
+		for _, existing := range node.podList {
+			// 已有 Pod 的反亲和性
+			if affinity := existing.Spec.Affinity; affinity != nil && affinity.PodAntiAffinity != nil {
+				terms, err := newAffinityTerms(
+					existing, affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+				)
+				if err != nil {
+					return nil, err
+				}
+				for i := range terms {
+					value, ok := nodeLabels[terms[i].topologyKey]
+					if ok && terms[i].matches(pod, namespaces) {
+						state.existingAntiAffinityCounts[topologyPair{key: terms[i].topologyKey, value: value}]++
+					}
+				}
+			}
+
+			// 待调度 Pod 的亲和性和反亲和性
+			if matchesAllAffinityTerms(state.affinityTerms, existing, namespaces) {
+				for i := range state.affinityTerms {
+					if value, ok := nodeLabels[state.affinityTerms[i].topologyKey]; ok {
+						state.affinityCounts[topologyPair{key: state.affinityTerms[i].topologyKey, value: value}]++
+					}
+				}
+			}
+			for i := range state.antiAffinityTerms {
+				value, ok := nodeLabels[state.antiAffinityTerms[i].topologyKey]
+				if ok && state.antiAffinityTerms[i].matches(existing, namespaces) {
+					state.antiAffinityCounts[topologyPair{key: state.antiAffinityTerms[i].topologyKey, value: value}]++
+				}
+			}
+		}
+	}
+	return state, nil
+}
+
+// satisfyExistingAntiAffinity 判断节点是否不违反已有 Pod 的反亲和性
+func (s *podAffinityState) satisfyExistingAntiAffinity(node *corev1.Node) bool {
+	if len(s.existingAntiAffinityCounts) == 0 {
+		return true
+	}
+	for key, value := range node.Labels {
+		if s.existingAntiAffinityCounts[topologyPair{key: key, value: value}] > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// satisfyAntiAffinity 判断节点是否满足待调度 Pod 的反亲和性
+func (s *podAffinityState) satisfyAntiAffinity(node *corev1.Node) bool {
+	for i := range s.antiAffinityTerms {
+		value, ok := node.Labels[s.antiAffinityTerms[i].topologyKey]
+		if ok && s.antiAffinityCounts[topologyPair{key: s.antiAffinityTerms[i].topologyKey, value: value}] > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// satisfyAffinity 判断节点是否满足待调度 Pod 的亲和性
+//
+// 与 kube-scheduler 一致，集群中没有任何 Pod 与亲和性条件匹配但待调度 Pod 与自身匹配时，
+// 认为其是一组互相亲和的 Pod 中的第一个，只要求节点有所有拓扑键
+func (s *podAffinityState) satisfyAffinity(node *corev1.Node) bool {
+	podsExist := true
+	for i := range s.affinityTerms {
+		value, ok := node.Labels[s.affinityTerms[i].topologyKey]
+		if !ok {
+			return false
+		}
+		if s.affinityCounts[topologyPair{key: s.affinityTerms[i].topologyKey, value: value}] <= 0 {
+			podsExist = false
+		}
+	}
+	if !podsExist {
+		return len(s.affinityCounts) == 0 && s.selfAffinity
+	}
+	return true
+}
@@ -0,0 +1,166 @@
+package scheduling
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	resourcehelper "k8s.io/kubectl/pkg/util/resource"
+)
+
+// activePodsFieldSelector 匹配占用节点资源的 Pod
+const activePodsFieldSelector = "status.phase!=" + string(corev1.PodSucceeded) + ",status.phase!=" + string(corev1.PodFailed)
+
+// NodeScore 节点得分
+type NodeScore struct {
+	// 节点名
+	Name string
+	// 总分
+	Score int64
+	// 各项得分
+	Scores map[string]int64
+}
+
+// Result 调度结果
+type Result struct {
+	// 选中的节点名
+	Node string
+	// 通过过滤的节点得分，按得分从高到低排序
+	Scores []NodeScore
+	// 未通过过滤的节点及原因
+	Filtered map[string]string
+}
+
+// FitError 没有节点通过过滤
+type FitError struct {
+	// 节点总数
+	NumAllNodes int
+	// 未通过过滤的节点及原因
+	Filtered map[string]string
+}
+
+// Error 返回错误描述
+func (e *FitError) Error() string {
+	// 按原因汇总，格式与 kube-scheduler 相近
+	counts := make(map[string]int)
+	for _, reason := range e.Filtered {
+		counts[reason]++
+	}
+	reasons := make([]string, 0, len(counts))
+	for reason, n := range counts {
+		reasons = append(reasons, fmt.Sprintf("%d %s", n, reason))
+	}
+	sort.Strings(reasons)
+	return fmt.Sprintf("0/%d nodes are available: %s", e.NumAllNodes, strings.Join(reasons, ", "))
+}
+
+// NewScheduler 创建一个 *Scheduler
+func NewScheduler(client kubernetes.Interface) *Scheduler {
+	return &Scheduler{
+		client:   client,
+		reserved: make(map[string]reservation),
+	}
+}
+
+// Scheduler 按 kube-scheduler 的视角为待迁移的 Pod 选择目标节点
+//
+// 依次按节点状态、 nodeSelector 和节点亲和性、污点与容忍、资源请求、必须满足的 Pod 间亲和性和反亲和性、
+// DoNotSchedule 的拓扑分布约束、检查点兼容性指纹过滤节点，
+// 再按资源余量、偏好的节点亲和性、 PreferNoSchedule 污点和指纹相似度打分，选择得分最高的节点。
+// 偏好的 Pod 间亲和性和 ScheduleAnyway 的拓扑分布约束不影响还原，不参与打分
+type Scheduler struct {
+	client kubernetes.Interface
+
+	lock sync.Mutex
+	// 已选定但尚未迁移完成的 Pod 占用的资源，以 Pod 的 namespace/name 为键
+	reserved map[string]reservation
+}
+
+// reservation 已选定目标节点的 Pod 占用的资源
+type reservation struct {
+	node     string
+	pod      *corev1.Pod
+	requests corev1.ResourceList
+}
+
+// Schedule 为 Pod 选择 Pod 当前所在节点以外的目标节点
+func (s *Scheduler) Schedule(ctx context.Context, pod *corev1.Pod) (*Result, error) {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	nodeList, err := s.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list nodes error: %w", err)
+	}
+	podList, err := s.client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: activePodsFieldSelector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list pods error: %w", err)
+	}
+
+	namespaceList, err := s.client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list namespaces error: %w", err)
+	}
+	namespaces := make(map[string]labels.Set, len(namespaceList.Items))
+	for _, ns := range namespaceList.Items {
+		namespaces[ns.Name] = ns.Labels
+	}
+
+	s.lock.Lock()
+	nodes := buildNodeInfos(nodeList.Items, podList.Items, s.reserved, podKey(pod))
+	s.lock.Unlock()
+
+	state, err := newPodState(pod, nodes, namespaces)
+	if err != nil {
+		return nil, err
+	}
+
+	// 过滤
+	result := &Result{Filtered: make(map[string]string)}
+	var feasible []*nodeInfo
+	for _, node := range nodes {
+		if reason := runFilters(state, node); reason != "" {
+			logger.V(1).Info(fmt.Sprintf("node %q filtered: %s", node.node.Name, reason))
+			result.Filtered[node.node.Name] = reason
+			continue
+		}
+		feasible = append(feasible, node)
+	}
+	if len(feasible) == 0 {
+		return result, &FitError{NumAllNodes: len(nodes), Filtered: result.Filtered}
+	}
+
+	// 打分
+	result.Scores = runScorers(state, feasible)
+	result.Node = result.Scores[0].Name
+	logger.V(1).Info(fmt.Sprintf("node scores: %v", result.Scores))
+	return result, nil
+}
+
+// Reserve 记录 Pod 将迁移到节点 node ，后续调度时计入该节点已请求的资源
+func (s *Scheduler) Reserve(pod *corev1.Pod, node string) {
+	requests, _ := resourcehelper.PodRequestsAndLimits(pod)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reserved[podKey(pod)] = reservation{node: node, pod: pod, requests: requests}
+}
+
+// Forget 移除 Reserve 的记录
+func (s *Scheduler) Forget(pod *corev1.Pod) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.reserved, podKey(pod))
+}
+
+// podKey 返回 Pod 的 namespace/name
+func podKey(pod *corev1.Pod) string {
+	return pod.Namespace + "/" + pod.Name
+}
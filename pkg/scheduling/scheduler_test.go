@@ -0,0 +1,531 @@
+package scheduling
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testHostnameKey = "kubernetes.io/hostname"
+	testZoneKey     = "topology.kubernetes.io/zone"
+)
+
+// newTestNode 创建就绪的测试用节点，可用 mutate 修改
+func newTestNode(name, zone string, mutate ...func(node *corev1.Node)) *corev1.Node {
+	node := &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{testHostnameKey: name, testZoneKey: zone},
+		},
+		Status: corev1.NodeStatus{
+			Allocatable: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("4"),
+				corev1.ResourceMemory: resource.MustParse("8Gi"),
+				corev1.ResourcePods:   resource.MustParse("110"),
+			},
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+			NodeInfo: corev1.NodeSystemInfo{
+				OperatingSystem:         "linux",
+				Architecture:            "amd64",
+				KernelVersion:           "6.1.0",
+				ContainerRuntimeVersion: "containerd://1.7.16",
+			},
+		},
+	}
+	for _, m := range mutate {
+		m(node)
+	}
+	return node
+}
+
+// newTestPod 创建运行在节点 node 上请求 cpu 、 memory 的测试用 Pod ，可用 mutate 修改
+func newTestPod(name, node, cpu, memory string, mutate ...func(pod *corev1.Pod)) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: corev1.PodSpec{
+			NodeName: node,
+			Containers: []corev1.Container{{
+				Name:  "app",
+				Image: "nginx",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse(cpu),
+						corev1.ResourceMemory: resource.MustParse(memory),
+					},
+				},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	for _, m := range mutate {
+		m(pod)
+	}
+	return pod
+}
+
+// withLabels 设置 Pod 标签
+func withLabels(kv ...string) func(pod *corev1.Pod) {
+	return func(pod *corev1.Pod) {
+		pod.Labels = map[string]string{}
+		for i := 0; i+1 < len(kv); i += 2 {
+			pod.Labels[kv[i]] = kv[i+1]
+		}
+	}
+}
+
+// withAntiAffinity 设置必须满足的 Pod 间反亲和性
+func withAntiAffinity(topologyKey string, term corev1.PodAffinityTerm) func(pod *corev1.Pod) {
+	return func(pod *corev1.Pod) {
+		term.TopologyKey = topologyKey
+		if pod.Spec.Affinity == nil {
+			pod.Spec.Affinity = &corev1.Affinity{}
+		}
+		pod.Spec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{term},
+		}
+	}
+}
+
+// withAffinity 设置必须满足的 Pod 间亲和性
+func withAffinity(topologyKey string, term corev1.PodAffinityTerm) func(pod *corev1.Pod) {
+	return func(pod *corev1.Pod) {
+		term.TopologyKey = topologyKey
+		if pod.Spec.Affinity == nil {
+			pod.Spec.Affinity = &corev1.Affinity{}
+		}
+		pod.Spec.Affinity.PodAffinity = &corev1.PodAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: []corev1.PodAffinityTerm{term},
+		}
+	}
+}
+
+// matchLabels 返回匹配标签的 PodAffinityTerm
+func matchLabels(key, value string) corev1.PodAffinityTerm {
+	return corev1.PodAffinityTerm{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{key: value}},
+	}
+}
+
+// TestScheduleFilters 测试各过滤项
+func TestScheduleFilters(t *testing.T) {
+	cases := []struct {
+		name     string
+		nodes    []*corev1.Node
+		pods     []*corev1.Pod
+		objs     []runtime.Object
+		pod      *corev1.Pod
+		expected string
+		filtered map[string]string
+	}{
+		{
+			name:     "SourceNode",
+			nodes:    []*corev1.Node{newTestNode("node-b", "zone-1")},
+			pod:      newTestPod("app", "node-a", "1", "1Gi"),
+			expected: "node-b",
+			filtered: map[string]string{"node-a": "source node"},
+		},
+		{
+			name: "NodeReady",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1", func(node *corev1.Node) {
+					node.Status.Conditions[0].Status = corev1.ConditionUnknown
+				}),
+				newTestNode("node-c", "zone-1"),
+			},
+			pod:      newTestPod("app", "node-a", "1", "1Gi"),
+			expected: "node-c",
+			filtered: map[string]string{"node-a": "source node", "node-b": "node(s) were not ready"},
+		},
+		{
+			name: "NodeUnschedulable",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1", func(node *corev1.Node) { node.Spec.Unschedulable = true }),
+				newTestNode("node-c", "zone-1"),
+			},
+			pod:      newTestPod("app", "node-a", "1", "1Gi"),
+			expected: "node-c",
+			filtered: map[string]string{"node-a": "source node", "node-b": "node(s) were unschedulable"},
+		},
+		{
+			name: "NodeUnschedulableTolerated",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1", func(node *corev1.Node) { node.Spec.Unschedulable = true }),
+			},
+			pod: newTestPod("app", "node-a", "1", "1Gi", func(pod *corev1.Pod) {
+				pod.Spec.Tolerations = []corev1.Toleration{{
+					Key:      corev1.TaintNodeUnschedulable,
+					Operator: corev1.TolerationOpExists,
+					Effect:   corev1.TaintEffectNoSchedule,
+				}}
+			}),
+			expected: "node-b",
+			filtered: map[string]string{"node-a": "source node"},
+		},
+		{
+			name: "NodeAffinity",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1"),
+				newTestNode("node-c", "zone-2"),
+			},
+			pod: newTestPod("app", "node-a", "1", "1Gi", func(pod *corev1.Pod) {
+				pod.Spec.NodeSelector = map[string]string{testZoneKey: "zone-2"}
+			}),
+			expected: "node-c",
+			filtered: map[string]string{
+				"node-a": "source node",
+				"node-b": "node(s) didn't match Pod's node affinity/selector",
+			},
+		},
+		{
+			name: "TaintToleration",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1", func(node *corev1.Node) {
+					node.Spec.Taints = []corev1.Taint{{Key: "gpu", Value: "true", Effect: corev1.TaintEffectNoSchedule}}
+				}),
+				newTestNode("node-c", "zone-1"),
+			},
+			pod:      newTestPod("app", "node-a", "1", "1Gi"),
+			expected: "node-c",
+			filtered: map[string]string{"node-a": "source node", "node-b": "node(s) had untolerated taint {gpu: true}"},
+		},
+		{
+			name: "Resources",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1"),
+				newTestNode("node-c", "zone-1", func(node *corev1.Node) {
+					node.Status.Allocatable[corev1.ResourcePods] = resource.MustParse("1")
+				}),
+				newTestNode("node-d", "zone-1"),
+			},
+			pods: []*corev1.Pod{
+				newTestPod("big", "node-b", "3500m", "1Gi"),
+				newTestPod("other", "node-c", "0", "0"),
+			},
+			pod:      newTestPod("app", "node-a", "1", "1Gi"),
+			expected: "node-d",
+			filtered: map[string]string{
+				"node-a": "source node",
+				"node-b": "Insufficient cpu",
+				"node-c": "Too many pods",
+			},
+		},
+		{
+			name: "PodAntiAffinity",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1"),
+				newTestNode("node-c", "zone-1"),
+			},
+			pods: []*corev1.Pod{newTestPod("web-2", "node-b", "0", "0", withLabels("app", "web"))},
+			pod: newTestPod("web-1", "node-a", "1", "1Gi",
+				withLabels("app", "web"), withAntiAffinity(testHostnameKey, matchLabels("app", "web")),
+			),
+			expected: "node-c",
+			filtered: map[string]string{"node-a": "source node", "node-b": "node(s) didn't match pod anti-affinity rules"},
+		},
+		{
+			name: "PodAntiAffinityNamespaceSelector",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1"),
+				newTestNode("node-c", "zone-2"),
+			},
+			pods: []*corev1.Pod{
+				newTestPod("noisy", "node-b", "0", "0", withLabels("noisy", "true"), func(pod *corev1.Pod) {
+					pod.Namespace = "batch"
+				}),
+			},
+			objs: []runtime.Object{&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "batch", Labels: map[string]string{"team": "batch"}},
+			}},
+			pod: newTestPod("app", "node-a", "1", "1Gi", withAntiAffinity(testZoneKey, corev1.PodAffinityTerm{
+				LabelSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"noisy": "true"}},
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "batch"}},
+			})),
+			expected: "node-c",
+			filtered: map[string]string{"node-a": "source node", "node-b": "node(s) didn't match pod anti-affinity rules"},
+		},
+		{
+			name: "ExistingPodAntiAffinity",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1"),
+				newTestNode("node-c", "zone-2"),
+			},
+			pods: []*corev1.Pod{
+				newTestPod("db", "node-b", "0", "0", withAntiAffinity(testZoneKey, matchLabels("app", "web"))),
+			},
+			pod:      newTestPod("web", "node-a", "1", "1Gi", withLabels("app", "web")),
+			expected: "node-c",
+			filtered: map[string]string{
+				"node-a": "source node",
+				"node-b": "node(s) didn't satisfy existing pods anti-affinity rules",
+			},
+		},
+		{
+			name: "PodAffinity",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1"),
+				newTestNode("node-c", "zone-2"),
+			},
+			pods: []*corev1.Pod{newTestPod("db", "node-c", "0", "0", withLabels("app", "db"))},
+			pod: newTestPod("web", "node-a", "1", "1Gi",
+				withAffinity(testZoneKey, matchLabels("app", "db")),
+			),
+			expected: "node-c",
+			filtered: map[string]string{"node-a": "source node", "node-b": "node(s) didn't match pod affinity rules"},
+		},
+		{
+			name: "PodAffinityToSelf",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1"),
+				newTestNode("node-c", "zone-2", func(node *corev1.Node) { delete(node.Labels, testZoneKey) }),
+			},
+			pod: newTestPod("web", "node-a", "1", "1Gi",
+				withLabels("app", "web"), withAffinity(testZoneKey, matchLabels("app", "web")),
+			),
+			expected: "node-b",
+			filtered: map[string]string{"node-a": "source node", "node-c": "node(s) didn't match pod affinity rules"},
+		},
+		{
+			name: "TopologySpread",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1"),
+				newTestNode("node-c", "zone-2"),
+				newTestNode("node-d", "", func(node *corev1.Node) { delete(node.Labels, testZoneKey) }),
+			},
+			pods: []*corev1.Pod{newTestPod("web-2", "node-b", "0", "0", withLabels("app", "web"))},
+			pod: newTestPod("web-1", "node-a", "1", "1Gi", withLabels("app", "web"), func(pod *corev1.Pod) {
+				pod.Spec.TopologySpreadConstraints = []corev1.TopologySpreadConstraint{{
+					MaxSkew:           1,
+					TopologyKey:       testZoneKey,
+					WhenUnsatisfiable: corev1.DoNotSchedule,
+					LabelSelector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+				}}
+			}),
+			expected: "node-c",
+			filtered: map[string]string{
+				"node-a": "source node",
+				"node-b": "node(s) didn't match pod topology spread constraints",
+				"node-d": "node(s) didn't match pod topology spread constraints (missing required label)",
+			},
+		},
+		{
+			name: "Fingerprint",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1", func(node *corev1.Node) { node.Status.NodeInfo.Architecture = "arm64" }),
+				newTestNode("node-c", "zone-1"),
+			},
+			pod:      newTestPod("app", "node-a", "1", "1Gi"),
+			expected: "node-c",
+			filtered: map[string]string{
+				"node-a": "source node",
+				"node-b": "node(s) had different architecture from source node",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			objs := append([]runtime.Object{
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+				newTestNode("node-a", "zone-1"),
+				c.pod,
+			}, c.objs...)
+			for _, node := range c.nodes {
+				objs = append(objs, node)
+			}
+			for _, pod := range c.pods {
+				objs = append(objs, pod)
+			}
+
+			result, err := NewScheduler(fake.NewSimpleClientset(objs...)).Schedule(context.Background(), c.pod)
+			if err != nil {
+				t.Fatalf("schedule error: %v", err)
+			}
+			if result.Node != c.expected {
+				t.Errorf("expected node %q, got %q", c.expected, result.Node)
+			}
+			if !reflect.DeepEqual(result.Filtered, c.filtered) {
+				t.Errorf("expected filtered %v, got %v", c.filtered, result.Filtered)
+			}
+		})
+	}
+}
+
+// TestScheduleNoFitNode 测试没有节点通过过滤时返回 *FitError
+func TestScheduleNoFitNode(t *testing.T) {
+	pod := newTestPod("app", "node-a", "1", "1Gi")
+	client := fake.NewSimpleClientset(
+		newTestNode("node-a", "zone-1"),
+		newTestNode("node-b", "zone-1", func(node *corev1.Node) { node.Spec.Unschedulable = true }),
+		pod,
+	)
+
+	_, err := NewScheduler(client).Schedule(context.Background(), pod)
+	fitErr := &FitError{}
+	if !errors.As(err, &fitErr) {
+		t.Fatalf("expected *FitError, got %v", err)
+	}
+	expected := "0/2 nodes are available: 1 node(s) were unschedulable, 1 source node"
+	if fitErr.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, fitErr.Error())
+	}
+}
+
+// TestScheduleScorers 测试各打分项
+func TestScheduleScorers(t *testing.T) {
+	cases := []struct {
+		name     string
+		scorer   string
+		nodes    []*corev1.Node
+		pods     []*corev1.Pod
+		pod      *corev1.Pod
+		expected string
+		scores   map[string]int64
+	}{
+		{
+			name:   "LeastAllocated",
+			scorer: "resources",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1"),
+				newTestNode("node-c", "zone-1"),
+			},
+			pods:     []*corev1.Pod{newTestPod("other", "node-b", "2", "4Gi")},
+			pod:      newTestPod("app", "node-a", "1", "2Gi"),
+			expected: "node-c",
+			// (4-2-1)/4 、 (8-4-2)/8 ； (4-1)/4 、 (8-2)/8
+			scores: map[string]int64{"node-b": 25, "node-c": 75},
+		},
+		{
+			name:   "NodeAffinity",
+			scorer: "node-affinity",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1"),
+				newTestNode("node-c", "zone-2"),
+			},
+			pod: newTestPod("app", "node-a", "1", "1Gi", func(pod *corev1.Pod) {
+				pod.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+					PreferredDuringSchedulingIgnoredDuringExecution: []corev1.PreferredSchedulingTerm{{
+						Weight: 10,
+						Preference: corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{{
+							Key:      testZoneKey,
+							Operator: corev1.NodeSelectorOpIn,
+							Values:   []string{"zone-2"},
+						}}},
+					}},
+				}}
+			}),
+			expected: "node-c",
+			scores:   map[string]int64{"node-b": 0, "node-c": 100},
+		},
+		{
+			name:   "TaintToleration",
+			scorer: "taint-toleration",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1", func(node *corev1.Node) {
+					node.Spec.Taints = []corev1.Taint{{Key: "spot", Effect: corev1.TaintEffectPreferNoSchedule}}
+				}),
+				newTestNode("node-c", "zone-1"),
+			},
+			pod:      newTestPod("app", "node-a", "1", "1Gi"),
+			expected: "node-c",
+			scores:   map[string]int64{"node-b": 0, "node-c": 100},
+		},
+		{
+			name:   "Fingerprint",
+			scorer: "fingerprint",
+			nodes: []*corev1.Node{
+				newTestNode("node-b", "zone-1", func(node *corev1.Node) {
+					node.Status.NodeInfo.KernelVersion = "5.15.0"
+					node.Status.NodeInfo.ContainerRuntimeVersion = "containerd://1.6.0"
+				}),
+				newTestNode("node-c", "zone-1", func(node *corev1.Node) {
+					node.Status.NodeInfo.KernelVersion = "5.15.0"
+				}),
+				newTestNode("node-d", "zone-1"),
+			},
+			pod:      newTestPod("app", "node-a", "1", "1Gi"),
+			expected: "node-d",
+			scores:   map[string]int64{"node-b": 0, "node-c": 50, "node-d": 100},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			objs := []runtime.Object{newTestNode("node-a", "zone-1"), c.pod}
+			for _, node := range c.nodes {
+				objs = append(objs, node)
+			}
+			for _, pod := range c.pods {
+				objs = append(objs, pod)
+			}
+
+			result, err := NewScheduler(fake.NewSimpleClientset(objs...)).Schedule(context.Background(), c.pod)
+			if err != nil {
+				t.Fatalf("schedule error: %v", err)
+			}
+			if result.Node != c.expected {
+				t.Errorf("expected node %q, got %q (scores: %v)", c.expected, result.Node, result.Scores)
+			}
+			scores := make(map[string]int64, len(result.Scores))
+			for _, s := range result.Scores {
+				scores[s.Name] = s.Scores[c.scorer]
+			}
+			if !reflect.DeepEqual(scores, c.scores) {
+				t.Errorf("expected %s scores %v, got %v", c.scorer, c.scores, scores)
+			}
+		})
+	}
+}
+
+// TestScheduleReserve 测试已选定节点但尚未迁移完成的 Pod 计入资源和 Pod 间反亲和性，Forget 后不再计入
+func TestScheduleReserve(t *testing.T) {
+	web1 := newTestPod("web-1", "node-a", "3", "1Gi",
+		withLabels("app", "web"), withAntiAffinity(testHostnameKey, matchLabels("app", "web")),
+	)
+	web2 := newTestPod("web-2", "node-a", "1", "1Gi",
+		withLabels("app", "web"), withAntiAffinity(testHostnameKey, matchLabels("app", "web")),
+	)
+	client := fake.NewSimpleClientset(
+		newTestNode("node-a", "zone-1"),
+		newTestNode("node-b", "zone-1"),
+		newTestNode("node-c", "zone-1"),
+		web1, web2,
+	)
+	s := NewScheduler(client)
+
+	result, err := s.Schedule(context.Background(), web1)
+	if err != nil {
+		t.Fatalf("schedule %q error: %v", web1.Name, err)
+	}
+	if result.Node != "node-b" {
+		t.Fatalf("expected %q scheduled to %q, got %q", web1.Name, "node-b", result.Node)
+	}
+	s.Reserve(web1, result.Node)
+
+	result, err = s.Schedule(context.Background(), web2)
+	if err != nil {
+		t.Fatalf("schedule %q error: %v", web2.Name, err)
+	}
+	expected := map[string]string{
+		"node-a": "source node",
+		"node-b": "node(s) didn't satisfy existing pods anti-affinity rules",
+	}
+	if result.Node != "node-c" || !reflect.DeepEqual(result.Filtered, expected) {
+		t.Errorf("expected %q scheduled to %q with filtered %v, got %q with %v",
+			web2.Name, "node-c", expected, result.Node, result.Filtered)
+	}
+
+	s.Forget(web1)
+	result, err = s.Schedule(context.Background(), web2)
+	if err != nil {
+		t.Fatalf("schedule %q error: %v", web2.Name, err)
+	}
+	if len(result.Filtered) != 1 {
+		t.Errorf("expected only source node filtered after forget, got %v", result.Filtered)
+	}
+}
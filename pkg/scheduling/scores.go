@@ -0,0 +1,150 @@
+package scheduling
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// maxNodeScore 单项最高得分
+const maxNodeScore = 100
+
+// scorer 节点打分项
+type scorer struct {
+	// 名称
+	name string
+	// 权重
+	weight int64
+	// 打分
+	score func(state *podState, node *nodeInfo) int64
+	// 归一化各节点得分到 [0, maxNodeScore] ，为 nil 时不归一化
+	normalize func(scores []int64)
+}
+
+// scorers 节点打分项
+var scorers = []scorer{
+	{name: "resources", weight: 1, score: scoreLeastAllocated},
+	{name: "node-affinity", weight: 2, score: scoreNodeAffinity, normalize: normalizeScores(false)},
+	{name: "taint-toleration", weight: 1, score: scoreTaintToleration, normalize: normalizeScores(true)},
+	{name: "fingerprint", weight: 1, score: scoreFingerprint},
+}
+
+// runScorers 为节点打分，返回按得分从高到低排序的结果，得分相同时按节点名排序
+func runScorers(state *podState, nodes []*nodeInfo) []NodeScore {
+	results := make([]NodeScore, len(nodes))
+	for i, node := range nodes {
+		results[i] = NodeScore{Name: node.node.Name, Scores: make(map[string]int64, len(scorers))}
+	}
+	for _, s := range scorers {
+		scores := make([]int64, len(nodes))
+		for i, node := range nodes {
+			scores[i] = s.score(state, node)
+		}
+		if s.normalize != nil {
+			s.normalize(scores)
+		}
+		for i := range results {
+			results[i].Scores[s.name] = scores[i]
+			results[i].Score += scores[i] * s.weight
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Name < results[j].Name
+	})
+	return results
+}
+
+// scoreLeastAllocated 按调度 Pod 后 CPU 和内存的剩余比例打分，剩余越多得分越高
+func scoreLeastAllocated(state *podState, node *nodeInfo) int64 {
+	var total, count int64
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		allocatable := node.allocatable(name)
+		if allocatable == 0 {
+			continue
+		}
+		free := allocatable - node.requestedOf(name) - quantityValue(state.requests, name)
+		if free < 0 {
+			free = 0
+		}
+		total += free * maxNodeScore / allocatable
+		count++
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / count
+}
+
+// scoreNodeAffinity 按满足的偏好节点亲和性权重打分
+func scoreNodeAffinity(state *podState, node *nodeInfo) int64 {
+	if state.preferredAffinity == nil {
+		return 0
+	}
+	return state.preferredAffinity.Score(node.node)
+}
+
+// scoreTaintToleration 按 Pod 不容忍的 PreferNoSchedule 污点数打分，归一化前污点越多得分越高
+func scoreTaintToleration(state *podState, node *nodeInfo) int64 {
+	var count int64
+	for i := range node.node.Spec.Taints {
+		taint := &node.node.Spec.Taints[i]
+		if taint.Effect != corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		tolerated := false
+		for _, toleration := range state.pod.Spec.Tolerations {
+			if toleration.ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			count++
+		}
+	}
+	return count
+}
+
+// scoreFingerprint 按与源节点指纹的相似度打分，内核和容器运行时版本与源节点相同时得分最高
+//
+// 版本不同不阻断还原，但 pcrctl preflight 会给出警告
+func scoreFingerprint(state *podState, node *nodeInfo) int64 {
+	if state.source == nil {
+		return maxNodeScore
+	}
+	score := int64(maxNodeScore)
+	if node.fingerprint.KernelVersion != state.source.KernelVersion {
+		score -= maxNodeScore / 2
+	}
+	if node.fingerprint.RuntimeVersion != state.source.RuntimeVersion {
+		score -= maxNodeScore / 2
+	}
+	return score
+}
+
+// normalizeScores 返回将得分按最大值归一化到 [0, maxNodeScore] 的函数， reverse 为 true 时原始得分越高归一化后越低
+func normalizeScores(reverse bool) func(scores []int64) {
+	return func(scores []int64) {
+		var highest int64
+		for _, score := range scores {
+			if score > highest {
+				highest = score
+			}
+		}
+		for i := range scores {
+			switch {
+			case highest == 0 && reverse:
+				scores[i] = maxNodeScore
+			case highest == 0:
+				scores[i] = 0
+			case reverse:
+				scores[i] = maxNodeScore - scores[i]*maxNodeScore/highest
+			default:
+				scores[i] = scores[i] * maxNodeScore / highest
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package scheduling
+
+import (
+	"fmt"
+	"math"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	corev1helpers "k8s.io/component-helpers/scheduling/corev1"
+	"k8s.io/component-helpers/scheduling/corev1/nodeaffinity"
+	"k8s.io/utils/ptr"
+)
+
+// spreadConstraint 解析后的拓扑分布约束
+type spreadConstraint struct {
+	maxSkew            int32
+	topologyKey        string
+	selector           labels.Selector
+	minDomains         int32
+	nodeAffinityPolicy corev1.NodeInclusionPolicy
+	nodeTaintsPolicy   corev1.NodeInclusionPolicy
+}
+
+// topologySpreadState 待调度 Pod 必须满足的拓扑分布约束及各拓扑域中匹配的 Pod 数
+type topologySpreadState struct {
+	constraints []spreadConstraint
+	// 各拓扑域中与约束匹配的 Pod 数，包含没有匹配 Pod 的拓扑域
+	counts map[topologyPair]int64
+	// 各拓扑键的拓扑域数
+	domains map[string]int32
+	// 各拓扑键的拓扑域中匹配的 Pod 数的最小值
+	minCounts map[string]int64
+}
+
+// newTopologySpreadState 统计各拓扑域中与 Pod 的拓扑分布约束匹配的 Pod 数
+//
+// 只处理 whenUnsatisfiable 为 DoNotSchedule 的约束，统计方式与 kube-scheduler 的 PodTopologySpread 一致。
+// 待迁移的 Pod 自身不计入，即按迁移完成后源 Pod 已删除的分布计算
+func newTopologySpreadState(pod *corev1.Pod, nodes []*nodeInfo) (*topologySpreadState, error) {
+	state := &topologySpreadState{
+		counts:    make(map[topologyPair]int64),
+		domains:   make(map[string]int32),
+		minCounts: make(map[string]int64),
+	}
+	for _, c := range pod.Spec.TopologySpreadConstraints {
+		if c.WhenUnsatisfiable != corev1.DoNotSchedule {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(c.LabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"parse label selector of topology spread constraint of pod %q error: %w", podKey(pod), err,
+			)
+		}
+		// matchLabelKeys 以 Pod 自身的标签值缩小选择范围
+		for _, key := range c.MatchLabelKeys {
+			value, ok := pod.Labels[key]
+			if !ok {
+				continue
+			}
+			req, err := labels.NewRequirement(key, selection.Equals, []string{value})
+			if err != nil {
+				return nil, fmt.Errorf("invalid match label key %q of pod %q: %w", key, podKey(pod), err)
+			}
+			selector = selector.Add(*req)
+		}
+		state.constraints = append(state.constraints, spreadConstraint{
+			maxSkew:            c.MaxSkew,
+			topologyKey:        c.TopologyKey,
+			selector:           selector,
+			minDomains:         ptr.Deref(c.MinDomains, 1),
+			nodeAffinityPolicy: ptr.Deref(c.NodeAffinityPolicy, corev1.NodeInclusionPolicyHonor),
+			nodeTaintsPolicy:   ptr.Deref(c.NodeTaintsPolicy, corev1.NodeInclusionPolicyIgnore),
+		})
+	}
+	if len(state.constraints) == 0 {
+		return state, nil
+	}
+
+	requiredAffinity := nodeaffinity.GetRequiredNodeAffinity(pod)
+	for _, node := range nodes {
+		// 节点需有所有约束的拓扑键
+		if !hasTopologyKeys(node.node, state.constraints) {
+			continue
+		}
+		for _, c := range state.constraints {
+			if c.nodeAffinityPolicy == corev1.NodeInclusionPolicyHonor {
+				if match, _ := requiredAffinity.Match(node.node); !match {
+					continue
+				}
+			}
+			if c.nodeTaintsPolicy == corev1.NodeInclusionPolicyHonor {
+				_, untolerated := corev1helpers.FindMatchingUntoleratedTaint(
+					node.node.Spec.Taints,
+					pod.Spec.Tolerations,
+					func(t *corev1.Taint) bool {
+						return t.Effect == corev1.TaintEffectNoSchedule || t.Effect == corev1.TaintEffectNoExecute
+					},
+				)
+				if untolerated {
+					continue
+				}
+			}
+			pair := topologyPair{key: c.topologyKey, value: node.node.Labels[c.topologyKey]}
+			state.counts[pair] += countMatchingPods(node.podList, c.selector, pod.Namespace)
+		}
+	}
+	for pair, count := range state.counts {
+		state.domains[pair.key]++
+		if minCount, ok := state.minCounts[pair.key]; !ok || count < minCount {
+			state.minCounts[pair.key] = count
+		}
+	}
+	return state, nil
+}
+
+// satisfy 判断节点是否满足拓扑分布约束，不满足时返回原因
+func (s *topologySpreadState) satisfy(pod *corev1.Pod, node *corev1.Node) string {
+	for _, c := range s.constraints {
+		value, ok := node.Labels[c.topologyKey]
+		if !ok {
+			return "node(s) didn't match pod topology spread constraints (missing required label)"
+		}
+		minCount, ok := s.minCounts[c.topologyKey]
+		if !ok {
+			// 没有可用的拓扑域
+			minCount = math.MaxInt32
+		}
+		if s.domains[c.topologyKey] < c.minDomains {
+			// 拓扑域数少于 minDomains 时全局最小值视为 0
+			minCount = 0
+		}
+		var self int64
+		if c.selector.Matches(labels.Set(pod.Labels)) {
+			self = 1
+		}
+		if s.counts[topologyPair{key: c.topologyKey, value: value}]+self-minCount > int64(c.maxSkew) {
+			return "node(s) didn't match pod topology spread constraints"
+		}
+	}
+	return ""
+}
+
+// hasTopologyKeys 判断节点是否有所有约束的拓扑键
+func hasTopologyKeys(node *corev1.Node, constraints []spreadConstraint) bool {
+	for _, c := range constraints {
+		if _, ok := node.Labels[c.topologyKey]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// countMatchingPods 统计命名空间 namespace 中与 selector 匹配的未在终止的 Pod 数
+func countMatchingPods(pods []*corev1.Pod, selector labels.Selector, namespace string) int64 {
+	if selector.Empty() {
+		return 0
+	}
+	var count int64
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Namespace != namespace {
+			continue
+		}
+		if selector.Matches(labels.Set(pod.Labels)) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,56 @@
+package ioutil
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// CountingWriter 统计写入字节数的 io.Writer
+type CountingWriter struct {
+	w     io.Writer
+	count atomic.Int64
+}
+
+var _ io.Writer = &CountingWriter{}
+
+// NewCountingWriter 创建一个 *CountingWriter
+func NewCountingWriter(w io.Writer) *CountingWriter {
+	return &CountingWriter{w: w}
+}
+
+// Write 写入数据
+func (w *CountingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.count.Add(int64(n))
+	return n, err
+}
+
+// Count 返回已写入的字节数
+func (w *CountingWriter) Count() int64 {
+	return w.count.Load()
+}
+
+// CountingReader 统计读取字节数的 io.Reader
+type CountingReader struct {
+	r     io.Reader
+	count atomic.Int64
+}
+
+var _ io.Reader = &CountingReader{}
+
+// NewCountingReader 创建一个 *CountingReader
+func NewCountingReader(r io.Reader) *CountingReader {
+	return &CountingReader{r: r}
+}
+
+// Read 读取数据
+func (r *CountingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.count.Add(int64(n))
+	return n, err
+}
+
+// Count 返回已读取的字节数
+func (r *CountingReader) Count() int64 {
+	return r.count.Load()
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 )
 
 // WriteJSON 将 JSON 写入 tar
@@ -67,3 +68,117 @@ func CopyIn(tw *tar.Writer, name string, mode int64, srcPath string) error {
 	_, err = io.Copy(tw, f)
 	return err
 }
+
+// CopyDirIn 将目录中所有内容拷贝到 tar ，tar 中的文件名以 name 为前缀
+func CopyDirIn(tw *tar.Writer, name string, srcDir string) error {
+	return filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+
+		// 获取软链目标
+		link := ""
+		isSymlink := info.Mode()&os.ModeSymlink != 0
+		if isSymlink {
+			link, err = os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("read link %q error: %w", path, err)
+			}
+		}
+
+		// 写头
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return fmt.Errorf("get tar header %q error: %w", path, err)
+		}
+		hdr.Name = filepath.Join(name, relPath)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("write tar header %q error: %w", path, err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		// 拷贝内容
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("open file %q error: %w", path, err)
+		}
+		defer func() { _ = f.Close() }()
+		if _, err := io.Copy(tw, f); err != nil {
+			return fmt.Errorf("copy file %q to tar error: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// CopyDirToFile 将目录中所有内容打包到 tar 文件 dstPath ，tar 中的文件名以 name 为前缀
+func CopyDirToFile(dstPath, name, srcDir string) (err error) {
+	f, err := os.Create(dstPath)
+	if err != nil {
+		return fmt.Errorf("create file %q error: %w", dstPath, err)
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("close file %q error: %w", dstPath, closeErr)
+		}
+	}()
+	tw := tar.NewWriter(f)
+	if err := CopyDirIn(tw, name, srcDir); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// CopyFileEntriesIn 将 tar 文件 srcPath 中的所有文件原样拷贝到 tw
+func CopyFileEntriesIn(tw *tar.Writer, srcPath string) error {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("open file %q error: %w", srcPath, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar file %q error: %w", srcPath, err)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("write tar header %q error: %w", hdr.Name, err)
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return fmt.Errorf("copy file %q to tar error: %w", hdr.Name, err)
+		}
+	}
+}
+
+// Extract 将 tar 中的当前文件释放到 path
+func Extract(tr *tar.Reader, hdr *tar.Header, path string) error {
+	info := hdr.FileInfo()
+	switch {
+	case info.IsDir():
+		return os.MkdirAll(path, info.Mode().Perm())
+	case info.Mode()&os.ModeSymlink != 0:
+		return os.Symlink(hdr.Linkname, path)
+	case info.Mode().IsRegular():
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		_, err = io.Copy(f, tr)
+		return err
+	}
+	return nil
+}